@@ -1,6 +1,6 @@
 // @title Todo API
 // @version 1.0
-// @description This is a Todo API with JWT authentication, owner-scoped Todos, and RFC7807 error responses.
+// @description This is a Todo API with JWT authentication, workspace-scoped Todos, and RFC7807 error responses.
 // @termsOfService http://swagger.io/terms/
 
 // @contact.name API Support
@@ -20,11 +20,15 @@ package main
 
 import (
 	"context"
+	"flag"
 	"fmt"
 	"log"
+	"math"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
+	"strings"
 	"syscall"
 	"time"
 
@@ -38,7 +42,9 @@ import (
 	"github.com/ahmadjafari86/go-todo-list/config"
 	_ "github.com/ahmadjafari86/go-todo-list/docs"
 	"github.com/ahmadjafari86/go-todo-list/internal/db"
+	"github.com/ahmadjafari86/go-todo-list/internal/encryption"
 	"github.com/ahmadjafari86/go-todo-list/internal/handlers"
+	"github.com/ahmadjafari86/go-todo-list/internal/mail"
 	"github.com/ahmadjafari86/go-todo-list/internal/middleware"
 	"github.com/ahmadjafari86/go-todo-list/internal/models"
 	"github.com/ahmadjafari86/go-todo-list/internal/repository"
@@ -53,33 +59,235 @@ func main() {
 
 	cfg := config.New()
 
+	migrateOnStart := flag.Bool("migrate", cfg.MigrateOnStart, "apply pending database migrations at startup")
+	flag.Parse()
+	if flag.Arg(0) == "migrate" {
+		os.Exit(runMigrate(cfg, flag.Args()[1:]))
+	}
+
 	// configure structured logger
 	logrus.SetFormatter(&logrus.JSONFormatter{})
 	logrus.SetOutput(os.Stdout)
 	logrus.SetLevel(logrus.PanicLevel)
 
-	if cfg.DatabaseURL == "" {
-		logrus.Fatal("DATABASE_URL is required")
+	// JWT signing keys: PEM key files take precedence over the shared secret
+	var keys *service.KeySet
+	var err error
+	if len(cfg.JWTSigningKeys) > 0 {
+		keys, err = service.LoadKeySet(cfg.JWTSigningKeys, cfg.JWTActiveKeyID)
+	} else {
+		keys, err = service.NewHMACKeySet(cfg.JWTSecret)
 	}
-
-	// init DB with pool settings and retry
-	dbConn, err := db.New(cfg.DatabaseURL, cfg.DBMaxOpenConns, cfg.DBMaxIdleConns, cfg.DBConnMaxLifetime)
 	if err != nil {
-		logrus.Fatalf("failed to connect to db: %v", err)
+		logrus.Fatalf("failed to load JWT signing keys: %v", err)
 	}
 
-	// Auto-migrate models (careful in prod)
-	dbConn.AutoMigrate(&models.Todo{}, &models.User{})
+	var repos *repository.Repositories
+	var replicas *db.ReplicaSet
+	var cacheBus repository.TodoCacheBus
+	if cfg.Storage == config.StorageMemory {
+		logrus.Warn("STORAGE=memory: data is kept in this process and lost on restart")
+		repos = repository.NewMemoryRepositories()
+	} else {
+		if cfg.DatabaseURL == "" {
+			logrus.Fatal("DATABASE_URL is required")
+		}
+
+		// init DB with pool settings and retry
+		dbConn, err := db.New(cfg.DatabaseURL, dbOptions(cfg))
+		if err != nil {
+			logrus.Fatalf("failed to connect to db: %v", err)
+		}
+		if err := dbConn.Use(db.QueryTimeout(time.Duration(cfg.DBQueryTimeout) * time.Second)); err != nil {
+			logrus.Fatalf("failed to configure query timeout: %v", err)
+		}
+
+		// versioned migrations replace AutoMigrate; see internal/db/migrations
+		if *migrateOnStart {
+			migrator, err := db.NewMigrator(dbConn)
+			if err != nil {
+				logrus.Fatalf("failed to load migrations: %v", err)
+			}
+			applied, err := migrator.Up(context.Background())
+			if err != nil {
+				logrus.Fatalf("failed to migrate database: %v", err)
+			}
+			logrus.Infof("applied %d migration(s)", applied)
+		}
+		repos = repository.NewGormRepositories(dbConn)
+		replicas = db.Replicas(dbConn)
+		if cfg.TodoCacheShared {
+			cacheBus = repository.NewGormTodoCacheBus(dbConn, time.Duration(cfg.TodoCacheSharedPollSeconds)*time.Second)
+		}
+	}
+
+	// todo titles are encrypted at rest once master keys are configured
+	var contentCipher *repository.ContentCipher
+	if len(cfg.TodoEncryptionKeys) > 0 {
+		masterKeys, err := encryption.ParseMasterKeys(cfg.TodoEncryptionKeys, cfg.TodoEncryptionActiveKey)
+		if err != nil {
+			logrus.Fatalf("failed to load todo encryption keys: %v", err)
+		}
+		contentCipher = repository.NewContentCipher(repos.DataKeys, masterKeys)
+		repository.EncryptContent(repos, contentCipher)
+	}
 
 	// Wire dependencies
-	userRepo := repository.NewGormUserRepository(dbConn)
-	todoRepo := repository.NewGormTodoRepository(dbConn)
+	userRepo := repos.Users
+	todoRepo := repos.Todos
+	revisionRepo := repos.Revisions
+	tokenRepo := repos.Tokens
+	recoveryRepo := repos.RecoveryCodes
+	identityRepo := repos.Identities
+	workspaceRepo := repos.Workspaces
+	listRepo := repos.Lists
+	invitationRepo := repos.Invitations
+	sessionRepo := repos.Sessions
+	magicLinkRepo := repos.MagicLinks
+	accountRepo := repos.Accounts
+	passwordResetRepo := repos.PasswordResets
+	oauthRepo := repos.OAuth
+	txManager := repos.Tx
+
+	// the cache only wraps the repository; handlers and services are unaware of it
+	var todoCache *repository.CachingTodoRepository
+	if cfg.TodoCache {
+		todoCache = repository.NewCachingTodoRepository(todoRepo, workspaceRepo, listRepo, repository.TodoCacheConfig{
+			MaxUsers: cfg.TodoCacheMaxUsers,
+			TTL:      time.Duration(cfg.TodoCacheTTLSeconds) * time.Second,
+			Bus:      cacheBus,
+		})
+		todoRepo = todoCache
+		workspaceRepo = todoCache.Workspaces(workspaceRepo)
+		listRepo = todoCache.Lists(listRepo)
+	}
+
+	// todos created before workspaces existed move into their owner's personal workspace
+	if err := workspaceRepo.BackfillPersonal(context.Background()); err != nil {
+		logrus.Fatalf("failed to backfill personal workspaces: %v", err)
+	}
+
+	attemptStore := repos.Attempts
+	if cfg.LoginAttemptStore == "memory" {
+		attemptStore = repository.NewMemoryAttemptStore()
+	}
+
+	var mailer mail.Mailer = mail.NewLogMailer()
+	if cfg.SMTPHost != "" {
+		mailer = mail.NewSMTPMailer(mail.SMTPConfig{
+			Host:     cfg.SMTPHost,
+			Port:     cfg.SMTPPort,
+			Username: cfg.SMTPUsername,
+			Password: cfg.SMTPPassword,
+			From:     cfg.MailFrom,
+		})
+	}
+
+	// checked before narrowing, as ARGON2_PARALLELISM=256 would become 0
+	if cfg.Argon2MemoryKiB < 0 || int64(cfg.Argon2MemoryKiB) > math.MaxUint32 || cfg.Argon2Iterations < 0 ||
+		int64(cfg.Argon2Iterations) > math.MaxUint32 || cfg.Argon2Parallelism < 0 || cfg.Argon2Parallelism > math.MaxUint8 {
+		logrus.Fatalf("invalid password hashing config: ARGON2_MEMORY_KIB, ARGON2_ITERATIONS or ARGON2_PARALLELISM out of range")
+	}
+	hasher, err := service.NewPasswordHasher(service.PasswordHashConfig{
+		Algorithm: cfg.PasswordHashAlgorithm,
+		Argon2: service.Argon2Params{
+			Memory:      uint32(cfg.Argon2MemoryKiB),
+			Iterations:  uint32(cfg.Argon2Iterations),
+			Parallelism: uint8(cfg.Argon2Parallelism),
+			SaltLength:  service.DefaultArgon2Params.SaltLength,
+			KeyLength:   service.DefaultArgon2Params.KeyLength,
+		},
+		BcryptCost: cfg.BcryptCost,
+	})
+	if err != nil {
+		logrus.Fatalf("invalid password hashing config: %v", err)
+	}
+
+	policyCfg := service.PasswordPolicyConfig{MinLength: cfg.PasswordMinLength, MinScore: cfg.PasswordMinScore}
+	if cfg.BreachedPasswordsDir != "" {
+		corpus, err := service.NewBreachCorpus(cfg.BreachedPasswordsDir)
+		if err != nil {
+			logrus.Fatalf("failed to open breached password corpus: %v", err)
+		}
+		policyCfg.Breached = corpus
+	}
+	policy := service.NewPasswordPolicy(policyCfg)
+
+	mfaSvc := service.NewMFAService(userRepo, recoveryRepo, cfg.TOTPIssuer)
+	jwtCfg := service.JWTConfig{
+		Keys:      keys,
+		Issuer:    cfg.JWTIssuer,
+		Audience:  cfg.JWTAudience,
+		AccessTTL: time.Duration(cfg.JWTExpMinutes) * time.Minute,
+	}
+	authSvc := service.NewAuthService(userRepo, sessionRepo, mfaSvc, hasher, policy, jwtCfg)
+	todoSvc := service.NewTodoService(todoRepo, workspaceRepo, listRepo, revisionRepo, txManager)
+	workspaceSvc := service.NewWorkspaceService(workspaceRepo, userRepo)
+	listSvc := service.NewListService(listRepo, workspaceRepo, userRepo)
+	invitationSvc := service.NewInvitationService(invitationRepo, workspaceRepo, listRepo, userRepo, authSvc, mailer, txManager, service.InvitationConfig{
+		JWT:       jwtCfg,
+		TTL:       time.Duration(cfg.InvitationTTLHours) * time.Hour,
+		AcceptURL: strings.TrimRight(cfg.PublicURL, "/") + "/invitations/accept",
+	})
+	tokenSvc := service.NewTokenService(tokenRepo, userRepo)
+	sessionSvc := service.NewSessionService(sessionRepo)
+	oauthSvc := service.NewOAuthService(oauthRepo, userRepo, service.OAuthConfig{
+		AccessTTL:  time.Duration(cfg.OAuthAccessTTLMinutes) * time.Minute,
+		RefreshTTL: time.Duration(cfg.OAuthRefreshTTLDays) * 24 * time.Hour,
+	})
+	accountSvc := service.NewAccountService(userRepo, accountRepo, attemptStore, hasher, txManager)
+	adminSvc := service.NewAdminService(userRepo)
+	if err := adminSvc.PromoteAdmins(context.Background(), cfg.AdminEmails); err != nil {
+		logrus.Fatalf("failed to promote admins: %v", err)
+	}
 
-	authSvc := service.NewAuthService(userRepo)
-	todoSvc := service.NewTodoService(todoRepo)
+	// config does not depend on service; its provider settings are mapped here
+	oidcProviders := make([]service.OIDCProvider, 0, len(cfg.OIDCProviders))
+	for _, p := range cfg.OIDCProviders {
+		oidcProviders = append(oidcProviders, service.OIDCProvider(p))
+	}
+	oidcSvc := service.NewOIDCService(oidcProviders, userRepo, identityRepo, authSvc)
 
-	authH := handlers.NewAuthHandler(authSvc)
+	magicLinkSvc := service.NewMagicLinkService(magicLinkRepo, userRepo, attemptStore, authSvc, mailer, service.MagicLinkConfig{
+		TTL:          time.Duration(cfg.MagicLinkTTLMinutes) * time.Minute,
+		MaxPerWindow: cfg.MagicLinkMaxPerWindow,
+		Window:       time.Duration(cfg.MagicLinkWindowMinutes) * time.Minute,
+		CallbackURL:  strings.TrimRight(cfg.PublicURL, "/") + "/auth/magic-link/callback",
+	})
+	passwordSvc := service.NewPasswordService(userRepo, passwordResetRepo, sessionRepo, attemptStore, hasher, policy, mailer, txManager, service.PasswordResetConfig{
+		TTL:          time.Duration(cfg.PasswordResetTTLMinutes) * time.Minute,
+		MaxPerWindow: cfg.PasswordResetMaxPerWindow,
+		Window:       time.Duration(cfg.PasswordResetWindowMinutes) * time.Minute,
+		ResetURL:     strings.TrimRight(cfg.PublicURL, "/") + "/reset-password",
+	})
+
+	limiter := service.NewLoginLimiter(attemptStore, service.LimiterConfig{
+		MaxAccountFailures: cfg.LoginMaxAccountFailures,
+		MaxIPFailures:      cfg.LoginMaxIPFailures,
+		BaseLockout:        time.Duration(cfg.LoginLockoutBaseSeconds) * time.Second,
+		MaxLockout:         time.Duration(cfg.LoginLockoutMaxSeconds) * time.Second,
+		ResetAfter:         time.Duration(cfg.LoginFailureWindowSeconds) * time.Second,
+	})
+
+	cookies, err := handlers.NewCookieScope(cfg.PublicURL)
+	if err != nil {
+		logrus.Fatalf("invalid PUBLIC_URL: %v", err)
+	}
+	authH := handlers.NewAuthHandler(authSvc, limiter)
 	todoH := handlers.NewTodoHandler(todoSvc)
+	tokenH := handlers.NewTokenHandler(tokenSvc)
+	mfaH := handlers.NewMFAHandler(mfaSvc)
+	jwksH := handlers.NewJWKSHandler(keys)
+	oidcH := handlers.NewOIDCHandler(oidcSvc, cookies)
+	adminH := handlers.NewAdminHandler(adminSvc, todoCache)
+	workspaceH := handlers.NewWorkspaceHandler(workspaceSvc)
+	listH := handlers.NewListHandler(listSvc)
+	invitationH := handlers.NewInvitationHandler(invitationSvc)
+	magicLinkH := handlers.NewMagicLinkHandler(magicLinkSvc, cookies, cfg.MagicLinkTTLMinutes*60)
+	sessionH := handlers.NewSessionHandler(sessionSvc)
+	accountH := handlers.NewAccountHandler(accountSvc)
+	passwordH := handlers.NewPasswordHandler(passwordSvc)
+	oauthH := handlers.NewOAuthHandler(oauthSvc)
 
 	// gin setup
 	gin.SetMode(gin.ReleaseMode)
@@ -92,28 +300,130 @@ func main() {
 		c.JSON(http.StatusOK, gin.H{"status": "ok"})
 	})
 
+	r.GET("/.well-known/jwks.json", jwksH.JWKS)
+
 	r.POST("/auth/register", authH.Register)
 	r.POST("/auth/login", authH.Login)
+	r.POST("/auth/login/mfa", authH.LoginMFA)
+	r.GET("/auth/oidc", oidcH.ListProviders)
+	r.GET("/auth/oidc/:provider/login", oidcH.Login)
+	r.GET("/auth/oidc/:provider/callback", oidcH.Callback)
+	r.POST("/auth/magic-link", magicLinkH.Request)
+	r.GET("/auth/magic-link/callback", magicLinkH.Callback)
+	r.POST("/auth/password/forgot", passwordH.Forgot)
+	r.POST("/auth/password/reset", passwordH.Reset)
+	r.POST("/oauth/token", oauthH.Token)
+	r.POST("/auth/invitations/accept", invitationH.AcceptAndRegister)
+	r.POST("/auth/invitations/decline", invitationH.Decline)
 
 	api := r.Group("/api")
-	api.Use(middleware.AuthMiddleware(authSvc))
+	api.Use(middleware.AuthMiddleware(authSvc, tokenSvc, oauthSvc))
 	{
-		api.GET("/todos", todoH.ListTodos)
-		api.GET("/todos/:id", todoH.GetTodo)
-		api.POST("/todos", todoH.CreateTodo)
-		api.PUT("/todos/:id", todoH.UpdateTodo)
-		api.PATCH("/todos/:id/complete", todoH.ToggleComplete)
-		api.DELETE("/todos/:id", todoH.DeleteTodo)
+		todosRead := api.Group("", middleware.RequireScope(models.ScopeTodosRead))
+		todosRead.GET("/todos", todoH.ListTodos)
+		todosRead.GET("/todos/:id", todoH.GetTodo)
+		todosRead.GET("/todos/:id/history", todoH.History)
+		todosRead.GET("/trash", todoH.ListTrash)
+		todosRead.GET("/workspaces", workspaceH.ListWorkspaces)
+		todosRead.GET("/workspaces/:id", workspaceH.GetWorkspace)
+		todosRead.GET("/workspaces/:id/members", workspaceH.ListMembers)
+		todosRead.GET("/lists", listH.ListLists)
+		todosRead.GET("/lists/shared", listH.SharedWithMe)
+		todosRead.GET("/lists/:id/shares", listH.ListShares)
+
+		todosWrite := api.Group("", middleware.RequireScope(models.ScopeTodosWrite))
+		todosWrite.POST("/todos", todoH.CreateTodo)
+		todosWrite.PUT("/todos/:id", todoH.UpdateTodo)
+		todosWrite.PATCH("/todos/:id/complete", todoH.ToggleComplete)
+		todosWrite.DELETE("/todos/:id", todoH.DeleteTodo)
+		todosWrite.POST("/todos/:id/revert/:rev", todoH.RevertTodo)
+		todosWrite.POST("/trash/:id/restore", todoH.RestoreTodo)
+		todosWrite.DELETE("/trash", todoH.EmptyTrash)
+		todosWrite.POST("/lists", listH.CreateList)
+		todosWrite.DELETE("/lists/:id", listH.DeleteList)
+
+		// token management is only available to interactive sessions
+		account := api.Group("", middleware.RequireScope(models.ScopeAccount))
+		account.GET("/tokens", tokenH.ListTokens)
+		account.POST("/tokens", tokenH.CreateToken)
+		account.DELETE("/tokens/:id", tokenH.RevokeToken)
+		account.POST("/me/mfa/totp", mfaH.BeginTOTP)
+		account.POST("/me/mfa/totp/confirm", mfaH.ConfirmTOTP)
+		account.POST("/me/mfa/totp/disable", mfaH.DisableTOTP)
+		account.POST("/me/mfa/recovery-codes", mfaH.RegenerateRecoveryCodes)
+		account.GET("/me/sessions", sessionH.ListSessions)
+		account.DELETE("/me/sessions/:id", sessionH.RevokeSession)
+		account.POST("/me/export", accountH.Export)
+		account.DELETE("/me", accountH.DeleteAccount)
+		account.POST("/me/password", passwordH.Change)
+		account.GET("/me/authorized-apps", oauthH.ListAuthorizedApps)
+		account.DELETE("/me/authorized-apps/:id", oauthH.RevokeAuthorizedApp)
+		account.POST("/oauth/clients", oauthH.RegisterClient)
+		account.GET("/oauth/clients", oauthH.ListClients)
+		account.DELETE("/oauth/clients/:id", oauthH.DeleteClient)
+		account.GET("/oauth/authorize", oauthH.AuthorizePrompt)
+		account.POST("/oauth/authorize", oauthH.Authorize)
+		account.POST("/workspaces", workspaceH.CreateWorkspace)
+		account.PATCH("/workspaces/:id", workspaceH.RenameWorkspace)
+		account.DELETE("/workspaces/:id", workspaceH.DeleteWorkspace)
+		account.POST("/workspaces/:id/members", workspaceH.AddMember)
+		account.PUT("/workspaces/:id/members/:user_id", workspaceH.UpdateMember)
+		account.DELETE("/workspaces/:id/members/:user_id", workspaceH.RemoveMember)
+		account.POST("/lists/:id/shares", listH.Grant)
+		account.PUT("/lists/:id/shares/:user_id", listH.ChangeShare)
+		account.DELETE("/lists/:id/shares/:user_id", listH.Revoke)
+		account.GET("/invitations", invitationH.ListInvitations)
+		account.POST("/invitations", invitationH.Invite)
+		account.DELETE("/invitations/:id", invitationH.RevokeInvitation)
+		account.POST("/invitations/accept", invitationH.Accept)
+	}
+
+	admin := r.Group("/admin")
+	admin.Use(middleware.AuthMiddleware(authSvc, tokenSvc, oauthSvc), middleware.RequireScope(models.ScopeAccount), middleware.RequireRole(models.RoleAdmin))
+	{
+		admin.GET("/users", adminH.ListUsers)
+		admin.GET("/users/:id", adminH.GetUser)
+		admin.POST("/users/:id/disable", adminH.DisableUser)
+		admin.POST("/users/:id/enable", adminH.EnableUser)
+		admin.PUT("/users/:id/role", adminH.SetRole)
+		admin.GET("/todo-cache", adminH.TodoCacheStats)
 	}
 
 	r.GET("/swagger/*any", ginSwagger.WrapHandler(swaggerFiles.Handler))
 
+	// every request context derives from baseCtx, so cancelling it aborts
+	// in-flight queries once the shutdown grace period is over
+	baseCtx, cancelRequests := context.WithCancel(context.Background())
+	defer cancelRequests()
 	srv := &http.Server{
 		Addr:         fmt.Sprintf(":%s", cfg.PortOrDefault()),
 		Handler:      r,
 		ReadTimeout:  time.Duration(cfg.ReadTimeout) * time.Second,
 		WriteTimeout: time.Duration(cfg.WriteTimeout) * time.Second,
 		IdleTimeout:  time.Duration(cfg.IdleTimeout) * time.Second,
+		BaseContext:  func(net.Listener) context.Context { return baseCtx },
+	}
+
+	if cfg.TrashRetentionDays > 0 {
+		purger := service.NewTrashPurger(todoRepo, service.TrashConfig{
+			Retention: time.Duration(cfg.TrashRetentionDays) * 24 * time.Hour,
+			Interval:  time.Duration(cfg.TrashPurgeIntervalMinutes) * time.Minute,
+		})
+		go purger.Run(baseCtx)
+	}
+	if replicas != nil {
+		logrus.Infof("reading from %d of %d replica(s)", replicas.Healthy(), len(cfg.DBReplicaURLs))
+		go replicas.Run(baseCtx)
+	}
+	if todoCache != nil {
+		go todoCache.Run(baseCtx)
+	}
+	if contentCipher != nil {
+		reencryptor := service.NewReencryptor(contentCipher, service.ReencryptConfig{
+			Interval:  time.Duration(cfg.TodoReencryptIntervalMinutes) * time.Minute,
+			BatchSize: cfg.TodoReencryptBatchSize,
+		})
+		go reencryptor.Run(baseCtx)
 	}
 
 	// start server
@@ -133,7 +443,36 @@ func main() {
 	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
 	defer cancel()
 	if err := srv.Shutdown(ctx); err != nil {
-		logrus.Fatalf("server forced to shutdown: %v", err)
+		// past the grace period: cancel the requests still running and give
+		// them a moment to roll back and answer before the process exits
+		logrus.Warnf("shutdown grace period over, cancelling in-flight requests: %v", err)
+		cancelRequests()
+		drain, cancelDrain := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancelDrain()
+		if err := srv.Shutdown(drain); err != nil {
+			logrus.Errorf("server forced to shutdown: %v", err)
+			srv.Close()
+		}
 	}
 	logrus.Info("server exiting")
 }
+
+// dbOptions are the pool settings of the primary database and its read replicas.
+func dbOptions(cfg *config.Config) db.Options {
+	return db.Options{
+		Pool: db.Pool{
+			MaxOpenConns:    cfg.DBMaxOpenConns,
+			MaxIdleConns:    cfg.DBMaxIdleConns,
+			ConnMaxLifetime: time.Duration(cfg.DBConnMaxLifetime) * time.Second,
+		},
+		ReplicaURLs: cfg.DBReplicaURLs,
+		ReplicaPool: db.Pool{
+			MaxOpenConns:    cfg.DBReplicaMaxOpenConns,
+			MaxIdleConns:    cfg.DBReplicaMaxIdleConns,
+			ConnMaxLifetime: time.Duration(cfg.DBReplicaConnMaxLifetime) * time.Second,
+		},
+		ReadYourWrites: time.Duration(cfg.DBReadYourWrites) * time.Second,
+		HealthInterval: time.Duration(cfg.DBReplicaHealthInterval) * time.Second,
+		MaxReplicaLag:  time.Duration(cfg.DBReplicaMaxLag) * time.Second,
+	}
+}
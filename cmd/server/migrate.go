@@ -0,0 +1,106 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"os"
+	"strconv"
+
+	"github.com/ahmadjafari86/go-todo-list/config"
+	"github.com/ahmadjafari86/go-todo-list/internal/db"
+)
+
+const migrateUsage = `usage: server migrate <command>
+
+commands:
+  up           apply all pending migrations
+  down [N|all] roll back the last N migrations (default 1)
+  status       list migrations and when they were applied
+  create NAME  write empty up/down pairs to ` + db.MigrationsDir + "/<database>"
+
+// runMigrate implements the `migrate` subcommand and returns the process exit code.
+func runMigrate(cfg *config.Config, args []string) int {
+	if len(args) == 0 {
+		fmt.Fprintln(os.Stderr, migrateUsage)
+		return 2
+	}
+
+	if args[0] == "create" {
+		if len(args) != 2 {
+			fmt.Fprintln(os.Stderr, migrateUsage)
+			return 2
+		}
+		paths, err := db.CreateMigration(db.MigrationsDir, args[1])
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "create migration: %v\n", err)
+			return 1
+		}
+		for _, p := range paths {
+			fmt.Println("created", p)
+		}
+		return 0
+	}
+
+	if cfg.DatabaseURL == "" {
+		fmt.Fprintln(os.Stderr, "DATABASE_URL is required")
+		return 1
+	}
+	conn, err := db.New(cfg.DatabaseURL, db.Options{Pool: dbOptions(cfg).Pool})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to connect to db: %v\n", err)
+		return 1
+	}
+	if sqlDB, err := conn.DB(); err == nil {
+		defer sqlDB.Close()
+	}
+	migrator, err := db.NewMigrator(conn)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "load migrations: %v\n", err)
+		return 1
+	}
+
+	ctx := context.Background()
+	switch args[0] {
+	case "up":
+		n, err := migrator.Up(ctx)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "migrate up: %v\n", err)
+			return 1
+		}
+		fmt.Printf("applied %d migration(s)\n", n)
+	case "down":
+		steps := 1
+		if len(args) > 1 {
+			if args[1] == "all" {
+				steps = math.MaxInt
+			} else if steps, err = strconv.Atoi(args[1]); err != nil || steps < 1 {
+				fmt.Fprintln(os.Stderr, migrateUsage)
+				return 2
+			}
+		}
+		n, err := migrator.Down(ctx, steps)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "migrate down: %v\n", err)
+			return 1
+		}
+		fmt.Printf("rolled back %d migration(s)\n", n)
+	case "status":
+		statuses, err := migrator.Status(ctx)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "migrate status: %v\n", err)
+			return 1
+		}
+		for _, s := range statuses {
+			applied := "pending"
+			if s.AppliedAt != nil {
+				applied = s.AppliedAt.Format("2006-01-02 15:04:05")
+			}
+			fmt.Printf("%04d  %-40s  %s\n", s.Version, s.Name, applied)
+		}
+	default:
+		fmt.Fprintln(os.Stderr, migrateUsage)
+		return 2
+	}
+	return 0
+}
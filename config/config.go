@@ -3,21 +3,149 @@ package config
 import (
 	"os"
 	"strconv"
+	"strings"
+)
+
+// OIDCProvider is an external OpenID Connect issuer. Providers are listed in
+// OIDC_PROVIDERS (comma separated) and configured with OIDC_<NAME>_ISSUER,
+// OIDC_<NAME>_CLIENT_ID, OIDC_<NAME>_CLIENT_SECRET, OIDC_<NAME>_REDIRECT_URL and
+// optionally OIDC_<NAME>_SCOPES.
+type OIDCProvider struct {
+	Name         string
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+	RedirectURL  string
+	Scopes       []string
+}
+
+// Storage backends selectable with STORAGE.
+const (
+	StorageDatabase = "database"
+	StorageMemory   = "memory"
 )
 
 type Config struct {
-	Port          string
-	DatabaseURL   string
+	Port        string
+	DatabaseURL string
+	// Storage is "database" (DATABASE_URL) or "memory", which keeps all data in
+	// the process and needs no database; it is lost on restart.
+	Storage       string
 	JWTSecret     string
 	JWTExpMinutes int
+	// JWTSigningKeys are PEM files with RS256 or EdDSA keys. When set they replace JWTSecret.
+	JWTSigningKeys []string
+	JWTActiveKeyID string
+	JWTIssuer      string
+	JWTAudience    string
+
+	OIDCProviders []OIDCProvider
+
+	// AdminEmails are promoted to the admin role at startup.
+	AdminEmails []string
+	TOTPIssuer  string
 
 	DBMaxOpenConns    int
 	DBMaxIdleConns    int
 	DBConnMaxLifetime int
+	// DBQueryTimeout bounds every database statement, in seconds, on top of
+	// the request's own context; 0 disables it.
+	DBQueryTimeout int
+	// MigrateOnStart applies pending schema migrations before serving. Turn it
+	// off when migrations run as a separate deploy step (`server migrate up`).
+	MigrateOnStart bool
+
+	// DBReplicaURLs are read replicas of DATABASE_URL with a pool of their own.
+	// Listing and lookup queries go to a healthy replica; writes and
+	// transactions use the primary.
+	DBReplicaURLs            []string
+	DBReplicaMaxOpenConns    int
+	DBReplicaMaxIdleConns    int
+	DBReplicaConnMaxLifetime int
+	// DBReadYourWrites keeps a user's reads on the primary for this many
+	// seconds after they write.
+	DBReadYourWrites        int
+	DBReplicaHealthInterval int
+	// DBReplicaMaxLag ejects Postgres replicas more than this many seconds
+	// behind; 0 disables the check.
+	DBReplicaMaxLag int
 
 	ReadTimeout  int
 	WriteTimeout int
 	IdleTimeout  int
+
+	// LoginAttemptStore is "postgres" (the database, shared across replicas,
+	// whichever driver DATABASE_URL selects) or "memory". STORAGE=memory always
+	// keeps attempts in memory.
+	LoginAttemptStore         string
+	LoginMaxAccountFailures   int
+	LoginMaxIPFailures        int
+	LoginLockoutBaseSeconds   int
+	LoginLockoutMaxSeconds    int
+	LoginFailureWindowSeconds int
+
+	// SMTPHost enables email delivery; without it emails are written to the log.
+	SMTPHost     string
+	SMTPPort     int
+	SMTPUsername string
+	SMTPPassword string
+	MailFrom     string
+
+	// PublicURL is where the web client is served; links in emails point there.
+	PublicURL          string
+	InvitationTTLHours int
+
+	MagicLinkTTLMinutes    int
+	MagicLinkMaxPerWindow  int
+	MagicLinkWindowMinutes int
+
+	// PasswordHashAlgorithm is "argon2id" or "bcrypt". Hashes made with another
+	// algorithm or weaker parameters are upgraded on the next successful login.
+	PasswordHashAlgorithm string
+	Argon2MemoryKiB       int
+	Argon2Iterations      int
+	Argon2Parallelism     int
+	BcryptCost            int
+
+	// PasswordMinScore is the minimum zxcvbn strength score, from 0 to 4.
+	PasswordMinLength int
+	PasswordMinScore  int
+	// BreachedPasswordsDir holds an offline breached-password corpus in the
+	// Have I Been Pwned range format; empty disables the check.
+	BreachedPasswordsDir string
+
+	PasswordResetTTLMinutes    int
+	PasswordResetMaxPerWindow  int
+	PasswordResetWindowMinutes int
+
+	// Lifetimes of tokens issued to third-party OAuth clients.
+	OAuthAccessTTLMinutes int
+	OAuthRefreshTTLDays   int
+
+	// TrashRetentionDays is how long deleted todos stay restorable before the
+	// purger removes them, checked every TrashPurgeIntervalMinutes; 0 keeps
+	// them until the trash is emptied.
+	TrashRetentionDays        int
+	TrashPurgeIntervalMinutes int
+
+	// TodoCache serves todo lists from an in-process cache of up to
+	// TodoCacheMaxUsers users for TodoCacheTTLSeconds. With TodoCacheShared
+	// the processes tell each other about changes through the database,
+	// which each polls every TodoCacheSharedPollSeconds.
+	TodoCache                  bool
+	TodoCacheMaxUsers          int
+	TodoCacheTTLSeconds        int
+	TodoCacheShared            bool
+	TodoCacheSharedPollSeconds int
+
+	// TodoEncryptionKeys are "version:base64" master keys. When set, todo
+	// titles are encrypted at rest and new data keys are wrapped with
+	// TodoEncryptionActiveKey, the highest version by default. The
+	// re-encryption job runs every TodoReencryptIntervalMinutes.
+	TodoEncryptionKeys           []string
+	TodoEncryptionActiveKey      int
+	TodoReencryptIntervalMinutes int
+	TodoReencryptBatchSize       int
 }
 
 func getenvInt(key string, fallback int) int {
@@ -29,18 +157,129 @@ func getenvInt(key string, fallback int) int {
 	return fallback
 }
 
+func getenvBool(key string, fallback bool) bool {
+	if v := os.Getenv(key); v != "" {
+		if b, err := strconv.ParseBool(v); err == nil {
+			return b
+		}
+	}
+	return fallback
+}
+
+func getenvList(key string) []string {
+	var out []string
+	for _, v := range strings.Split(os.Getenv(key), ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			out = append(out, v)
+		}
+	}
+	return out
+}
+
+func getenv(key, fallback string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return fallback
+}
+
+func loadOIDCProviders() []OIDCProvider {
+	var providers []OIDCProvider
+	for _, name := range getenvList("OIDC_PROVIDERS") {
+		prefix := "OIDC_" + strings.ToUpper(name) + "_"
+		providers = append(providers, OIDCProvider{
+			Name:         name,
+			Issuer:       os.Getenv(prefix + "ISSUER"),
+			ClientID:     os.Getenv(prefix + "CLIENT_ID"),
+			ClientSecret: os.Getenv(prefix + "CLIENT_SECRET"),
+			RedirectURL:  os.Getenv(prefix + "REDIRECT_URL"),
+			Scopes:       strings.Fields(os.Getenv(prefix + "SCOPES")),
+		})
+	}
+	return providers
+}
+
 func New() *Config {
 	return &Config{
 		Port:              os.Getenv("PORT"),
 		DatabaseURL:       os.Getenv("DATABASE_URL"),
+		Storage:           getenv("STORAGE", StorageDatabase),
 		JWTSecret:         os.Getenv("JWT_SECRET"),
 		JWTExpMinutes:     getenvInt("JWT_EXP_MINUTES", 60),
+		JWTSigningKeys:    getenvList("JWT_SIGNING_KEYS"),
+		JWTActiveKeyID:    os.Getenv("JWT_ACTIVE_KEY_ID"),
+		JWTIssuer:         getenv("JWT_ISSUER", "todo-api"),
+		JWTAudience:       getenv("JWT_AUDIENCE", "todo-api"),
+		OIDCProviders:     loadOIDCProviders(),
+		AdminEmails:       getenvList("ADMIN_EMAILS"),
+		TOTPIssuer:        getenv("TOTP_ISSUER", "Todo API"),
 		DBMaxOpenConns:    getenvInt("DB_MAX_OPEN_CONNS", 25),
 		DBMaxIdleConns:    getenvInt("DB_MAX_IDLE_CONNS", 25),
 		DBConnMaxLifetime: getenvInt("DB_CONN_MAX_LIFETIME", 300),
+		DBQueryTimeout:    getenvInt("DB_QUERY_TIMEOUT", 5),
+		MigrateOnStart:    getenvBool("MIGRATE_ON_START", true),
 		ReadTimeout:       getenvInt("READ_TIMEOUT", 5),
 		WriteTimeout:      getenvInt("WRITE_TIMEOUT", 10),
 		IdleTimeout:       getenvInt("IDLE_TIMEOUT", 120),
+
+		DBReplicaURLs:            getenvList("DATABASE_REPLICA_URLS"),
+		DBReplicaMaxOpenConns:    getenvInt("DB_REPLICA_MAX_OPEN_CONNS", 25),
+		DBReplicaMaxIdleConns:    getenvInt("DB_REPLICA_MAX_IDLE_CONNS", 25),
+		DBReplicaConnMaxLifetime: getenvInt("DB_REPLICA_CONN_MAX_LIFETIME", 300),
+		DBReadYourWrites:         getenvInt("DB_READ_YOUR_WRITES", 5),
+		DBReplicaHealthInterval:  getenvInt("DB_REPLICA_HEALTH_INTERVAL", 10),
+		DBReplicaMaxLag:          getenvInt("DB_REPLICA_MAX_LAG", 30),
+
+		LoginAttemptStore:         getenv("LOGIN_ATTEMPT_STORE", "postgres"),
+		LoginMaxAccountFailures:   getenvInt("LOGIN_MAX_ACCOUNT_FAILURES", 5),
+		LoginMaxIPFailures:        getenvInt("LOGIN_MAX_IP_FAILURES", 20),
+		LoginLockoutBaseSeconds:   getenvInt("LOGIN_LOCKOUT_BASE_SECONDS", 30),
+		LoginLockoutMaxSeconds:    getenvInt("LOGIN_LOCKOUT_MAX_SECONDS", 3600),
+		LoginFailureWindowSeconds: getenvInt("LOGIN_FAILURE_WINDOW_SECONDS", 3600),
+
+		SMTPHost:     os.Getenv("SMTP_HOST"),
+		SMTPPort:     getenvInt("SMTP_PORT", 587),
+		SMTPUsername: os.Getenv("SMTP_USERNAME"),
+		SMTPPassword: os.Getenv("SMTP_PASSWORD"),
+		MailFrom:     getenv("MAIL_FROM", "Todo API <no-reply@localhost>"),
+
+		PublicURL:          getenv("PUBLIC_URL", "http://localhost:8282"),
+		InvitationTTLHours: getenvInt("INVITATION_TTL_HOURS", 72),
+
+		MagicLinkTTLMinutes:    getenvInt("MAGIC_LINK_TTL_MINUTES", 15),
+		MagicLinkMaxPerWindow:  getenvInt("MAGIC_LINK_MAX_PER_WINDOW", 3),
+		MagicLinkWindowMinutes: getenvInt("MAGIC_LINK_WINDOW_MINUTES", 15),
+
+		PasswordHashAlgorithm: getenv("PASSWORD_HASH_ALGORITHM", "argon2id"),
+		Argon2MemoryKiB:       getenvInt("ARGON2_MEMORY_KIB", 64*1024),
+		Argon2Iterations:      getenvInt("ARGON2_ITERATIONS", 3),
+		Argon2Parallelism:     getenvInt("ARGON2_PARALLELISM", 2),
+		BcryptCost:            getenvInt("BCRYPT_COST", 10),
+
+		PasswordMinLength:    getenvInt("PASSWORD_MIN_LENGTH", 8),
+		PasswordMinScore:     getenvInt("PASSWORD_MIN_SCORE", 2),
+		BreachedPasswordsDir: os.Getenv("BREACHED_PASSWORDS_DIR"),
+
+		PasswordResetTTLMinutes:    getenvInt("PASSWORD_RESET_TTL_MINUTES", 30),
+		PasswordResetMaxPerWindow:  getenvInt("PASSWORD_RESET_MAX_PER_WINDOW", 3),
+		PasswordResetWindowMinutes: getenvInt("PASSWORD_RESET_WINDOW_MINUTES", 15),
+
+		OAuthAccessTTLMinutes: getenvInt("OAUTH_ACCESS_TTL_MINUTES", 60),
+		OAuthRefreshTTLDays:   getenvInt("OAUTH_REFRESH_TTL_DAYS", 30),
+
+		TrashRetentionDays:        getenvInt("TRASH_RETENTION_DAYS", 30),
+		TrashPurgeIntervalMinutes: getenvInt("TRASH_PURGE_INTERVAL_MINUTES", 60),
+
+		TodoCache:                  getenvBool("TODO_CACHE", false),
+		TodoCacheMaxUsers:          getenvInt("TODO_CACHE_MAX_USERS", 10000),
+		TodoCacheTTLSeconds:        getenvInt("TODO_CACHE_TTL_SECONDS", 30),
+		TodoCacheShared:            getenvBool("TODO_CACHE_SHARED", false),
+		TodoCacheSharedPollSeconds: getenvInt("TODO_CACHE_SHARED_POLL_SECONDS", 1),
+
+		TodoEncryptionKeys:           getenvList("TODO_ENCRYPTION_KEYS"),
+		TodoEncryptionActiveKey:      getenvInt("TODO_ENCRYPTION_ACTIVE_KEY", 0),
+		TodoReencryptIntervalMinutes: getenvInt("TODO_REENCRYPT_INTERVAL_MINUTES", 60),
+		TodoReencryptBatchSize:       getenvInt("TODO_REENCRYPT_BATCH_SIZE", 100),
 	}
 }
 
@@ -1,18 +1,118 @@
 package db
 
 import (
+	"fmt"
+	"strings"
 	"time"
 
 	"github.com/cenkalti/backoff/v4"
+	"github.com/glebarez/sqlite"
 	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
 )
 
-func New(dsn string, maxOpen, maxIdle, maxLifetimeSec int) (*gorm.DB, error) {
+// Dialect names as reported by gorm.Dialector.Name.
+const (
+	DialectPostgres = "postgres"
+	DialectSQLite   = "sqlite"
+)
+
+// sqlitePragmas are applied to every SQLite connection unless the URL sets its own.
+var sqlitePragmas = []string{"foreign_keys(1)", "busy_timeout(5000)", "journal_mode(WAL)"}
+
+// Dialector picks the driver from the DATABASE_URL scheme. sqlite://path.db
+// (or sqlite::memory:) selects SQLite; postgres:// URLs and key=value DSNs
+// select Postgres.
+func Dialector(databaseURL string) (gorm.Dialector, error) {
+	switch {
+	case strings.HasPrefix(databaseURL, "sqlite:"):
+		dsn, err := sqliteDSN(databaseURL)
+		if err != nil {
+			return nil, err
+		}
+		return sqlite.Open(dsn), nil
+	case strings.HasPrefix(databaseURL, "postgres://"), strings.HasPrefix(databaseURL, "postgresql://"), !strings.Contains(databaseURL, "://"):
+		return postgres.Open(databaseURL), nil
+	default:
+		scheme, _, _ := strings.Cut(databaseURL, "://")
+		return nil, fmt.Errorf("unsupported DATABASE_URL scheme %q; use postgres:// or sqlite://", scheme)
+	}
+}
+
+// sqliteDSN turns sqlite://path?query into the driver's file: URI.
+func sqliteDSN(databaseURL string) (string, error) {
+	rest := strings.TrimPrefix(strings.TrimPrefix(databaseURL, "sqlite:"), "//")
+	path, query, _ := strings.Cut(rest, "?")
+	if path == "" {
+		return "", fmt.Errorf("DATABASE_URL %q has no database file", databaseURL)
+	}
+	params := []string{}
+	if query != "" {
+		params = append(params, query)
+	}
+	if !strings.Contains(query, "_pragma=") {
+		for _, p := range sqlitePragmas {
+			// in-memory databases have no journal file
+			if p == "journal_mode(WAL)" && path == ":memory:" {
+				continue
+			}
+			params = append(params, "_pragma="+p)
+		}
+	}
+	// SQLite has no row locks. Taking the write lock when a transaction begins
+	// makes concurrent read-then-write transactions queue behind busy_timeout
+	// instead of failing with SQLITE_BUSY when they try to write.
+	if !strings.Contains(query, "_txlock=") {
+		params = append(params, "_txlock=immediate")
+	}
+	return "file:" + path + "?" + strings.Join(params, "&"), nil
+}
+
+func isSQLiteMemory(databaseURL string) bool {
+	path, _, _ := strings.Cut(strings.TrimPrefix(strings.TrimPrefix(databaseURL, "sqlite:"), "//"), "?")
+	return strings.HasPrefix(databaseURL, "sqlite:") && path == ":memory:"
+}
+
+// Pool sizes one connection pool. Zero values keep database/sql's defaults.
+type Pool struct {
+	MaxOpenConns    int
+	MaxIdleConns    int
+	ConnMaxLifetime time.Duration
+	// ConnMaxIdleTime defaults to DefaultConnMaxIdleTime.
+	ConnMaxIdleTime time.Duration
+}
+
+// DefaultConnMaxIdleTime closes pooled connections that sat unused this long.
+const DefaultConnMaxIdleTime = 30 * time.Second
+
+// Options configures New. With ReplicaURLs set, reads marked with
+// ReadFromReplica go to those replicas; everything else uses the primary.
+type Options struct {
+	Pool Pool
+
+	ReplicaURLs []string
+	ReplicaPool Pool
+	// ReadYourWrites keeps a user's reads on the primary for this long after
+	// they write, so they see their own changes despite replication lag.
+	ReadYourWrites time.Duration
+	// HealthInterval is how often replicas are checked; replicas that fail
+	// are ejected until they pass again.
+	HealthInterval time.Duration
+	// MaxReplicaLag ejects Postgres replicas that fall further behind; 0
+	// disables the lag check.
+	MaxReplicaLag time.Duration
+}
+
+func New(dsn string, opts Options) (*gorm.DB, error) {
+	dialector, err := Dialector(dsn)
+	if err != nil {
+		return nil, err
+	}
+
 	var db *gorm.DB
 	operation := func() error {
 		var err error
-		db, err = gorm.Open(postgres.Open(dsn), &gorm.Config{})
+		db, err = gorm.Open(dialector, &gorm.Config{})
 		return err
 	}
 
@@ -22,14 +122,44 @@ func New(dsn string, maxOpen, maxIdle, maxLifetimeSec int) (*gorm.DB, error) {
 		return nil, err
 	}
 
-	sqlDB, err := db.DB()
-	if err != nil {
+	if isSQLiteMemory(dsn) {
+		// an in-memory database lives as long as its connection; keep exactly one
+		sqlDB, err := db.DB()
+		if err != nil {
+			return nil, err
+		}
+		sqlDB.SetMaxOpenConns(1)
+		sqlDB.SetMaxIdleConns(1)
+		return db, nil
+	}
+	if err := configurePool(db, opts.Pool); err != nil {
 		return nil, err
 	}
-	sqlDB.SetMaxOpenConns(maxOpen)
-	sqlDB.SetMaxIdleConns(maxIdle)
-	sqlDB.SetConnMaxLifetime(time.Duration(maxLifetimeSec) * time.Second)
 
-	sqlDB.SetConnMaxIdleTime(30 * time.Second)
+	if len(opts.ReplicaURLs) > 0 {
+		replicas, err := openReplicas(dialector, opts)
+		if err != nil {
+			return nil, err
+		}
+		if err := db.Use(replicas); err != nil {
+			replicas.Close()
+			return nil, err
+		}
+	}
 	return db, nil
 }
+
+func configurePool(db *gorm.DB, pool Pool) error {
+	sqlDB, err := db.DB()
+	if err != nil {
+		return err
+	}
+	sqlDB.SetMaxOpenConns(pool.MaxOpenConns)
+	sqlDB.SetMaxIdleConns(pool.MaxIdleConns)
+	sqlDB.SetConnMaxLifetime(pool.ConnMaxLifetime)
+	if pool.ConnMaxIdleTime == 0 {
+		pool.ConnMaxIdleTime = DefaultConnMaxIdleTime
+	}
+	sqlDB.SetConnMaxIdleTime(pool.ConnMaxIdleTime)
+	return nil
+}
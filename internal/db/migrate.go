@@ -0,0 +1,385 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+//go:embed migrations/postgres/*.sql migrations/sqlite/*.sql
+var embedded embed.FS
+
+// MigrationsDir holds one directory of migrations per dialect; `migrate create`
+// writes new files there.
+const MigrationsDir = "internal/db/migrations"
+
+// Migrations returns the migrations compiled into the binary for a dialect.
+func Migrations(dialect string) (fs.FS, error) {
+	if _, ok := dialects[dialect]; !ok {
+		return nil, fmt.Errorf("no migrations for database %q", dialect)
+	}
+	return fs.Sub(embedded, "migrations/"+dialect)
+}
+
+// migrationLockID is the key of the advisory lock held while migrating, so
+// replicas starting at the same time apply each migration exactly once.
+const migrationLockID = 7_210_045_991
+
+// migrationDialect holds what differs between databases when migrating.
+type migrationDialect struct {
+	// lock serialises migrators across processes until release is called.
+	lock func(ctx context.Context, conn *sql.Conn) (release func(commit bool) error, err error)
+	// txPerMigration runs every migration in its own transaction. Otherwise
+	// lock has already opened the one transaction all of them run in.
+	txPerMigration bool
+	createTable    string
+	insert         string
+	delete         string
+}
+
+var dialects = map[string]migrationDialect{
+	DialectPostgres: {
+		lock: func(ctx context.Context, conn *sql.Conn) (func(bool) error, error) {
+			if _, err := conn.ExecContext(ctx, "SELECT pg_advisory_lock($1)", migrationLockID); err != nil {
+				return nil, err
+			}
+			return func(bool) error {
+				// unlock even if ctx was cancelled meanwhile; closing the connection would release it too
+				_, err := conn.ExecContext(context.Background(), "SELECT pg_advisory_unlock($1)", migrationLockID)
+				return err
+			}, nil
+		},
+		txPerMigration: true,
+		createTable: `CREATE TABLE IF NOT EXISTS schema_migrations (
+			version bigint PRIMARY KEY,
+			name text NOT NULL,
+			applied_at timestamptz NOT NULL
+		)`,
+		insert: "INSERT INTO schema_migrations (version, name, applied_at) VALUES ($1, $2, $3)",
+		delete: "DELETE FROM schema_migrations WHERE version = $1",
+	},
+	// SQLite has no advisory locks; BEGIN IMMEDIATE takes the database write
+	// lock, so pending migrations are applied together in that transaction.
+	DialectSQLite: {
+		lock: func(ctx context.Context, conn *sql.Conn) (func(bool) error, error) {
+			if _, err := conn.ExecContext(ctx, "BEGIN IMMEDIATE"); err != nil {
+				return nil, err
+			}
+			return func(commit bool) error {
+				stmt := "ROLLBACK"
+				if commit {
+					stmt = "COMMIT"
+				}
+				_, err := conn.ExecContext(context.Background(), stmt)
+				return err
+			}, nil
+		},
+		createTable: `CREATE TABLE IF NOT EXISTS schema_migrations (
+			version integer PRIMARY KEY,
+			name text NOT NULL,
+			applied_at datetime NOT NULL
+		)`,
+		insert: "INSERT INTO schema_migrations (version, name, applied_at) VALUES (?, ?, ?)",
+		delete: "DELETE FROM schema_migrations WHERE version = ?",
+	},
+}
+
+var migrationFile = regexp.MustCompile(`^(\d+)_([a-z0-9_]+)\.(up|down)\.sql$`)
+
+// ErrUnknownMigration is returned by Down when the database has migrations
+// applied that this build does not know how to roll back.
+var ErrUnknownMigration = errors.New("database has migrations applied that are not in this build")
+
+// Migration is one versioned schema change with its rollback.
+type Migration struct {
+	Version int64
+	Name    string
+	Up      string
+	Down    string
+}
+
+// MigrationStatus reports whether a migration has been applied.
+type MigrationStatus struct {
+	Version   int64
+	Name      string
+	AppliedAt *time.Time
+}
+
+// Migrator applies migrations and records them in schema_migrations.
+type Migrator struct {
+	db         *sql.DB
+	dialect    migrationDialect
+	migrations []Migration
+}
+
+// LoadMigrations reads NNNN_name.up.sql / NNNN_name.down.sql pairs from fsys.
+func LoadMigrations(fsys fs.FS) ([]Migration, error) {
+	entries, err := fs.ReadDir(fsys, ".")
+	if err != nil {
+		return nil, err
+	}
+	byVersion := map[int64]*Migration{}
+	for _, e := range entries {
+		m := migrationFile.FindStringSubmatch(e.Name())
+		if m == nil {
+			continue
+		}
+		version, _ := strconv.ParseInt(m[1], 10, 64)
+		body, err := fs.ReadFile(fsys, e.Name())
+		if err != nil {
+			return nil, err
+		}
+		mig, ok := byVersion[version]
+		if !ok {
+			mig = &Migration{Version: version, Name: m[2]}
+			byVersion[version] = mig
+		} else if mig.Name != m[2] {
+			return nil, fmt.Errorf("migration %d has two names: %s and %s", version, mig.Name, m[2])
+		}
+		if m[3] == "up" {
+			mig.Up = string(body)
+		} else {
+			mig.Down = string(body)
+		}
+	}
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if m.Up == "" || m.Down == "" {
+			return nil, fmt.Errorf("migration %d_%s needs both an up and a down file", m.Version, m.Name)
+		}
+		migrations = append(migrations, *m)
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+	return migrations, nil
+}
+
+// NewMigrator returns a migrator for the embedded migrations of gdb's dialect.
+func NewMigrator(gdb *gorm.DB) (*Migrator, error) {
+	name := gdb.Dialector.Name()
+	fsys, err := Migrations(name)
+	if err != nil {
+		return nil, err
+	}
+	migrations, err := LoadMigrations(fsys)
+	if err != nil {
+		return nil, err
+	}
+	sqlDB, err := gdb.DB()
+	if err != nil {
+		return nil, err
+	}
+	return &Migrator{db: sqlDB, dialect: dialects[name], migrations: migrations}, nil
+}
+
+// Up applies every pending migration in order and returns how many were applied.
+func (m *Migrator) Up(ctx context.Context) (int, error) {
+	applied := 0
+	err := m.locked(ctx, func(conn *sql.Conn) error {
+		done, err := m.applied(ctx, conn)
+		if err != nil {
+			return err
+		}
+		for _, mig := range m.migrations {
+			if _, ok := done[mig.Version]; ok {
+				continue
+			}
+			if err := m.run(ctx, conn, mig, true); err != nil {
+				return err
+			}
+			applied++
+		}
+		return nil
+	})
+	return applied, err
+}
+
+// Down rolls back the last steps applied migrations and returns how many were rolled back.
+func (m *Migrator) Down(ctx context.Context, steps int) (int, error) {
+	rolledBack := 0
+	err := m.locked(ctx, func(conn *sql.Conn) error {
+		done, err := m.applied(ctx, conn)
+		if err != nil {
+			return err
+		}
+		known := map[int64]bool{}
+		for _, mig := range m.migrations {
+			known[mig.Version] = true
+		}
+		for version := range done {
+			if !known[version] {
+				return fmt.Errorf("%w: version %d", ErrUnknownMigration, version)
+			}
+		}
+		for i := len(m.migrations) - 1; i >= 0 && rolledBack < steps; i-- {
+			mig := m.migrations[i]
+			if _, ok := done[mig.Version]; !ok {
+				continue
+			}
+			if err := m.run(ctx, conn, mig, false); err != nil {
+				return err
+			}
+			rolledBack++
+		}
+		return nil
+	})
+	return rolledBack, err
+}
+
+// Status lists every known migration, oldest first, followed by any applied
+// migrations this build does not know about.
+func (m *Migrator) Status(ctx context.Context) ([]MigrationStatus, error) {
+	var out []MigrationStatus
+	err := m.locked(ctx, func(conn *sql.Conn) error {
+		done, err := m.applied(ctx, conn)
+		if err != nil {
+			return err
+		}
+		for _, mig := range m.migrations {
+			s := MigrationStatus{Version: mig.Version, Name: mig.Name}
+			if at, ok := done[mig.Version]; ok {
+				at := at
+				s.AppliedAt = &at
+				delete(done, mig.Version)
+			}
+			out = append(out, s)
+		}
+		unknown := make([]MigrationStatus, 0, len(done))
+		for version, at := range done {
+			at := at
+			unknown = append(unknown, MigrationStatus{Version: version, Name: "(not in this build)", AppliedAt: &at})
+		}
+		sort.Slice(unknown, func(i, j int) bool { return unknown[i].Version < unknown[j].Version })
+		out = append(out, unknown...)
+		return nil
+	})
+	return out, err
+}
+
+// locked runs fn on a single connection holding the migration lock.
+func (m *Migrator) locked(ctx context.Context, fn func(conn *sql.Conn) error) (err error) {
+	conn, err := m.db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	release, err := m.dialect.lock(ctx, conn)
+	if err != nil {
+		return fmt.Errorf("acquire migration lock: %w", err)
+	}
+	defer func() {
+		if rerr := release(err == nil); err == nil {
+			err = rerr
+		}
+	}()
+
+	if _, err := conn.ExecContext(ctx, m.dialect.createTable); err != nil {
+		return err
+	}
+	return fn(conn)
+}
+
+func (m *Migrator) applied(ctx context.Context, conn *sql.Conn) (map[int64]time.Time, error) {
+	rows, err := conn.QueryContext(ctx, "SELECT version, applied_at FROM schema_migrations")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	done := map[int64]time.Time{}
+	for rows.Next() {
+		var version int64
+		var at time.Time
+		if err := rows.Scan(&version, &at); err != nil {
+			return nil, err
+		}
+		done[version] = at
+	}
+	return done, rows.Err()
+}
+
+// run executes one migration and its bookkeeping atomically.
+func (m *Migrator) run(ctx context.Context, conn *sql.Conn, mig Migration, up bool) error {
+	var exec interface {
+		ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+	} = conn
+	var tx *sql.Tx
+	if m.dialect.txPerMigration {
+		var err error
+		if tx, err = conn.BeginTx(ctx, nil); err != nil {
+			return err
+		}
+		defer tx.Rollback()
+		exec = tx
+	}
+
+	script, direction := mig.Up, "up"
+	if !up {
+		script, direction = mig.Down, "down"
+	}
+	if _, err := exec.ExecContext(ctx, script); err != nil {
+		return fmt.Errorf("migration %d_%s (%s): %w", mig.Version, mig.Name, direction, err)
+	}
+	var err error
+	if up {
+		_, err = exec.ExecContext(ctx, m.dialect.insert, mig.Version, mig.Name, time.Now().UTC())
+	} else {
+		_, err = exec.ExecContext(ctx, m.dialect.delete, mig.Version)
+	}
+	if err != nil || tx == nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// CreateMigration writes an empty up/down pair for every dialect under root,
+// numbered after the highest existing version, and returns the new paths.
+func CreateMigration(root, name string) ([]string, error) {
+	name = strings.ToLower(strings.Join(strings.FieldsFunc(name, func(r rune) bool {
+		return !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9')
+	}), "_"))
+	if name == "" {
+		return nil, errors.New("migration name is required")
+	}
+	names := make([]string, 0, len(dialects))
+	for dialect := range dialects {
+		names = append(names, dialect)
+	}
+	sort.Strings(names)
+
+	var next int64 = 1
+	for _, dialect := range names {
+		if err := os.MkdirAll(filepath.Join(root, dialect), 0o755); err != nil {
+			return nil, err
+		}
+		existing, err := LoadMigrations(os.DirFS(filepath.Join(root, dialect)))
+		if err != nil {
+			return nil, err
+		}
+		if len(existing) > 0 && existing[len(existing)-1].Version >= next {
+			next = existing[len(existing)-1].Version + 1
+		}
+	}
+	var paths []string
+	for _, dialect := range names {
+		for _, direction := range []string{"up", "down"} {
+			path := filepath.Join(root, dialect, fmt.Sprintf("%04d_%s.%s.sql", next, name, direction))
+			body := fmt.Sprintf("-- %04d_%s (%s, %s)\n", next, name, dialect, direction)
+			if err := os.WriteFile(path, []byte(body), 0o644); err != nil {
+				return paths, err
+			}
+			paths = append(paths, path)
+		}
+	}
+	return paths, nil
+}
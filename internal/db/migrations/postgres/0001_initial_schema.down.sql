@@ -0,0 +1,19 @@
+DROP TABLE IF EXISTS
+    oauth_tokens,
+    oauth_codes,
+    oauth_authorizations,
+    oauth_clients,
+    password_resets,
+    magic_links,
+    sessions,
+    invitations,
+    list_shares,
+    todo_lists,
+    memberships,
+    user_identities,
+    login_attempts,
+    recovery_codes,
+    personal_access_tokens,
+    todos,
+    workspaces,
+    users;
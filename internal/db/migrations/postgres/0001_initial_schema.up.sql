@@ -0,0 +1,229 @@
+-- Baseline schema. Every statement is IF NOT EXISTS so databases created by
+-- the old AutoMigrate startup step are adopted without changes.
+
+CREATE TABLE IF NOT EXISTS users (
+    id bigserial PRIMARY KEY,
+    email text NOT NULL CONSTRAINT uni_users_email UNIQUE,
+    password_hash text NOT NULL,
+    role text NOT NULL DEFAULT 'user',
+    disabled_at timestamptz,
+    totp_secret text,
+    totp_enabled boolean NOT NULL DEFAULT false,
+    totp_last_step bigint NOT NULL DEFAULT 0,
+    created_at timestamptz
+);
+
+CREATE TABLE IF NOT EXISTS workspaces (
+    id bigserial PRIMARY KEY,
+    name text NOT NULL,
+    personal boolean NOT NULL DEFAULT false,
+    owner_id bigint NOT NULL,
+    created_at timestamptz
+);
+CREATE INDEX IF NOT EXISTS idx_workspaces_owner_id ON workspaces (owner_id);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_personal_workspace ON workspaces (owner_id) WHERE personal = true;
+
+CREATE TABLE IF NOT EXISTS todos (
+    id bigserial PRIMARY KEY,
+    title text NOT NULL,
+    completed boolean NOT NULL,
+    owner_id bigint NOT NULL,
+    workspace_id bigint,
+    list_id bigint,
+    created_at timestamptz
+);
+CREATE INDEX IF NOT EXISTS idx_todos_owner_id ON todos (owner_id);
+CREATE INDEX IF NOT EXISTS idx_todos_workspace_id ON todos (workspace_id);
+CREATE INDEX IF NOT EXISTS idx_todos_list_id ON todos (list_id);
+
+-- Older databases can have todos whose owner was deleted. They are not dropped
+-- silently: the migration stops until an operator has reviewed and removed them.
+DO $$
+DECLARE
+    orphans bigint;
+BEGIN
+    IF NOT EXISTS (SELECT 1 FROM pg_constraint WHERE conname = 'fk_todos_owner') THEN
+        SELECT count(*) INTO orphans FROM todos WHERE owner_id NOT IN (SELECT id FROM users);
+        IF orphans > 0 THEN
+            RAISE EXCEPTION '% todo(s) belong to users that no longer exist', orphans
+                USING HINT = 'Review them, remove them with DELETE FROM todos WHERE owner_id NOT IN (SELECT id FROM users), then migrate again.';
+        END IF;
+        ALTER TABLE todos ADD CONSTRAINT fk_todos_owner
+            FOREIGN KEY (owner_id) REFERENCES users (id) ON DELETE CASCADE;
+    END IF;
+END
+$$;
+
+CREATE TABLE IF NOT EXISTS personal_access_tokens (
+    id bigserial PRIMARY KEY,
+    user_id bigint NOT NULL,
+    name text NOT NULL,
+    prefix text NOT NULL,
+    token_hash text NOT NULL,
+    scopes text NOT NULL,
+    expires_at timestamptz,
+    last_used_at timestamptz,
+    created_at timestamptz
+);
+CREATE INDEX IF NOT EXISTS idx_personal_access_tokens_user_id ON personal_access_tokens (user_id);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_personal_access_tokens_token_hash ON personal_access_tokens (token_hash);
+
+CREATE TABLE IF NOT EXISTS recovery_codes (
+    id bigserial PRIMARY KEY,
+    user_id bigint NOT NULL,
+    code_hash text NOT NULL,
+    used_at timestamptz,
+    created_at timestamptz
+);
+CREATE INDEX IF NOT EXISTS idx_recovery_codes_user_id ON recovery_codes (user_id);
+
+CREATE TABLE IF NOT EXISTS login_attempts (
+    key text PRIMARY KEY,
+    failures bigint NOT NULL DEFAULT 0,
+    locked_until timestamptz,
+    updated_at timestamptz
+);
+
+CREATE TABLE IF NOT EXISTS user_identities (
+    id bigserial PRIMARY KEY,
+    user_id bigint NOT NULL,
+    provider text NOT NULL,
+    subject text NOT NULL,
+    email text NOT NULL,
+    created_at timestamptz
+);
+CREATE INDEX IF NOT EXISTS idx_user_identities_user_id ON user_identities (user_id);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_identity_provider_subject ON user_identities (provider, subject);
+
+CREATE TABLE IF NOT EXISTS memberships (
+    workspace_id bigint,
+    user_id bigint,
+    role text NOT NULL,
+    created_at timestamptz,
+    PRIMARY KEY (workspace_id, user_id)
+);
+CREATE INDEX IF NOT EXISTS idx_memberships_user_id ON memberships (user_id);
+
+CREATE TABLE IF NOT EXISTS todo_lists (
+    id bigserial PRIMARY KEY,
+    workspace_id bigint NOT NULL,
+    owner_id bigint NOT NULL,
+    name text NOT NULL,
+    created_at timestamptz
+);
+CREATE INDEX IF NOT EXISTS idx_todo_lists_workspace_id ON todo_lists (workspace_id);
+
+CREATE TABLE IF NOT EXISTS list_shares (
+    list_id bigint,
+    user_id bigint,
+    permission text NOT NULL,
+    created_at timestamptz,
+    PRIMARY KEY (list_id, user_id)
+);
+CREATE INDEX IF NOT EXISTS idx_list_shares_user_id ON list_shares (user_id);
+
+CREATE TABLE IF NOT EXISTS invitations (
+    id bigserial PRIMARY KEY,
+    inviter_id bigint NOT NULL,
+    email text NOT NULL,
+    workspace_id bigint,
+    list_id bigint,
+    role text NOT NULL,
+    expires_at timestamptz NOT NULL,
+    accepted_at timestamptz,
+    declined_at timestamptz,
+    created_at timestamptz
+);
+CREATE INDEX IF NOT EXISTS idx_invitations_inviter_id ON invitations (inviter_id);
+
+CREATE TABLE IF NOT EXISTS sessions (
+    id bigserial PRIMARY KEY,
+    user_id bigint NOT NULL,
+    user_agent text,
+    ip text,
+    created_at timestamptz,
+    last_seen_at timestamptz,
+    expires_at timestamptz NOT NULL,
+    revoked_at timestamptz
+);
+CREATE INDEX IF NOT EXISTS idx_sessions_user_id ON sessions (user_id);
+
+CREATE TABLE IF NOT EXISTS magic_links (
+    id bigserial PRIMARY KEY,
+    user_id bigint NOT NULL,
+    token_hash text NOT NULL,
+    nonce_hash text NOT NULL,
+    expires_at timestamptz NOT NULL,
+    used_at timestamptz,
+    created_at timestamptz
+);
+CREATE INDEX IF NOT EXISTS idx_magic_links_user_id ON magic_links (user_id);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_magic_links_token_hash ON magic_links (token_hash);
+
+CREATE TABLE IF NOT EXISTS password_resets (
+    id bigserial PRIMARY KEY,
+    user_id bigint NOT NULL,
+    token_hash text NOT NULL,
+    expires_at timestamptz NOT NULL,
+    used_at timestamptz,
+    created_at timestamptz
+);
+CREATE INDEX IF NOT EXISTS idx_password_resets_user_id ON password_resets (user_id);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_password_resets_token_hash ON password_resets (token_hash);
+
+CREATE TABLE IF NOT EXISTS oauth_clients (
+    id bigserial PRIMARY KEY,
+    client_id text NOT NULL,
+    secret_hash text,
+    owner_id bigint NOT NULL,
+    name text NOT NULL,
+    redirect_uris text NOT NULL,
+    scopes text NOT NULL,
+    confidential boolean NOT NULL,
+    created_at timestamptz
+);
+CREATE INDEX IF NOT EXISTS idx_oauth_clients_owner_id ON oauth_clients (owner_id);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_oauth_clients_client_id ON oauth_clients (client_id);
+
+CREATE TABLE IF NOT EXISTS oauth_authorizations (
+    id bigserial PRIMARY KEY,
+    user_id bigint NOT NULL,
+    client_id bigint NOT NULL,
+    scopes text NOT NULL,
+    revoked_at timestamptz,
+    created_at timestamptz,
+    updated_at timestamptz
+);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_oauth_authorization ON oauth_authorizations (user_id, client_id);
+CREATE INDEX IF NOT EXISTS idx_oauth_authorizations_revoked_at ON oauth_authorizations (revoked_at);
+
+CREATE TABLE IF NOT EXISTS oauth_codes (
+    id bigserial PRIMARY KEY,
+    code_hash text NOT NULL,
+    authorization_id bigint NOT NULL,
+    redirect_uri text NOT NULL,
+    scopes text NOT NULL,
+    code_challenge text NOT NULL,
+    expires_at timestamptz NOT NULL,
+    used_at timestamptz,
+    created_at timestamptz
+);
+CREATE INDEX IF NOT EXISTS idx_oauth_codes_authorization_id ON oauth_codes (authorization_id);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_oauth_codes_code_hash ON oauth_codes (code_hash);
+
+CREATE TABLE IF NOT EXISTS oauth_tokens (
+    id bigserial PRIMARY KEY,
+    authorization_id bigint NOT NULL,
+    user_id bigint NOT NULL,
+    access_hash text NOT NULL,
+    refresh_hash text NOT NULL,
+    scopes text NOT NULL,
+    access_expires_at timestamptz NOT NULL,
+    refresh_expires_at timestamptz NOT NULL,
+    revoked_at timestamptz,
+    created_at timestamptz
+);
+CREATE INDEX IF NOT EXISTS idx_oauth_tokens_authorization_id ON oauth_tokens (authorization_id);
+CREATE INDEX IF NOT EXISTS idx_oauth_tokens_user_id ON oauth_tokens (user_id);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_oauth_tokens_access_hash ON oauth_tokens (access_hash);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_oauth_tokens_refresh_hash ON oauth_tokens (refresh_hash);
@@ -0,0 +1,5 @@
+-- 0002_soft_delete_todos (postgres, down)
+-- Trashed todos would reappear without the column, so they are dropped.
+DELETE FROM todos WHERE deleted_at IS NOT NULL;
+DROP INDEX idx_todos_deleted_at;
+ALTER TABLE todos DROP COLUMN deleted_at;
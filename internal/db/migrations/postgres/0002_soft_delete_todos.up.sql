@@ -0,0 +1,4 @@
+-- 0002_soft_delete_todos (postgres, up)
+-- Deleted todos stay in the trash until restored, emptied or purged.
+ALTER TABLE todos ADD COLUMN deleted_at timestamptz;
+CREATE INDEX idx_todos_deleted_at ON todos (deleted_at);
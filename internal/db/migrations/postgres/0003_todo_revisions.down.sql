@@ -0,0 +1,2 @@
+-- 0003_todo_revisions (postgres, down)
+DROP TABLE todo_revisions;
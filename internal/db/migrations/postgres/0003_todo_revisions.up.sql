@@ -0,0 +1,13 @@
+-- 0003_todo_revisions (postgres, up)
+-- Every change to a todo, with field-level before and after values.
+CREATE TABLE todo_revisions (
+    id bigserial PRIMARY KEY,
+    todo_id bigint NOT NULL CONSTRAINT fk_todo_revisions_todo REFERENCES todos (id) ON DELETE CASCADE,
+    rev bigint NOT NULL,
+    user_id bigint NOT NULL,
+    action text NOT NULL,
+    changes text NOT NULL,
+    created_at timestamptz
+);
+CREATE UNIQUE INDEX idx_todo_revisions_todo_rev ON todo_revisions (todo_id, rev);
+CREATE INDEX idx_todo_revisions_user_id ON todo_revisions (user_id);
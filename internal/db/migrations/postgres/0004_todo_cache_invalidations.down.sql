@@ -0,0 +1,2 @@
+-- 0004_todo_cache_invalidations (postgres, down)
+DROP TABLE todo_cache_invalidations;
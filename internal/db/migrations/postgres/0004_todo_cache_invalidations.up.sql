@@ -0,0 +1,8 @@
+-- 0004_todo_cache_invalidations (postgres, up)
+-- Lets the todo caches of several server processes invalidate each other.
+CREATE TABLE todo_cache_invalidations (
+    id bigserial PRIMARY KEY,
+    user_id bigint NOT NULL,
+    created_at timestamptz NOT NULL
+);
+CREATE INDEX idx_todo_cache_invalidations_created_at ON todo_cache_invalidations (created_at);
@@ -0,0 +1,2 @@
+-- 0005_data_keys (postgres, down)
+DROP TABLE data_keys;
@@ -0,0 +1,11 @@
+-- 0005_data_keys (postgres, up)
+-- Per-user keys for todo content, wrapped by a versioned master key.
+CREATE TABLE data_keys (
+    id bigserial PRIMARY KEY,
+    user_id bigint NOT NULL CONSTRAINT fk_data_keys_user REFERENCES users (id) ON DELETE CASCADE,
+    master_key_version bigint NOT NULL,
+    wrapped_key text NOT NULL,
+    created_at timestamptz NOT NULL
+);
+CREATE INDEX idx_data_keys_user_id ON data_keys (user_id);
+CREATE INDEX idx_data_keys_master_key_version ON data_keys (master_key_version);
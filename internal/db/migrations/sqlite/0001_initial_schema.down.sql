@@ -0,0 +1,18 @@
+DROP TABLE IF EXISTS oauth_tokens;
+DROP TABLE IF EXISTS oauth_codes;
+DROP TABLE IF EXISTS oauth_authorizations;
+DROP TABLE IF EXISTS oauth_clients;
+DROP TABLE IF EXISTS password_resets;
+DROP TABLE IF EXISTS magic_links;
+DROP TABLE IF EXISTS sessions;
+DROP TABLE IF EXISTS invitations;
+DROP TABLE IF EXISTS list_shares;
+DROP TABLE IF EXISTS todo_lists;
+DROP TABLE IF EXISTS memberships;
+DROP TABLE IF EXISTS user_identities;
+DROP TABLE IF EXISTS login_attempts;
+DROP TABLE IF EXISTS recovery_codes;
+DROP TABLE IF EXISTS personal_access_tokens;
+DROP TABLE IF EXISTS todos;
+DROP TABLE IF EXISTS workspaces;
+DROP TABLE IF EXISTS users;
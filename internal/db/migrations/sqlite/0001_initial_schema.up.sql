@@ -0,0 +1,208 @@
+CREATE TABLE users (
+    id integer PRIMARY KEY AUTOINCREMENT,
+    email text NOT NULL CONSTRAINT uni_users_email UNIQUE,
+    password_hash text NOT NULL,
+    role text NOT NULL DEFAULT 'user',
+    disabled_at datetime,
+    totp_secret text,
+    totp_enabled numeric NOT NULL DEFAULT false,
+    totp_last_step integer NOT NULL DEFAULT 0,
+    created_at datetime
+);
+
+CREATE TABLE workspaces (
+    id integer PRIMARY KEY AUTOINCREMENT,
+    name text NOT NULL,
+    personal numeric NOT NULL DEFAULT false,
+    owner_id integer NOT NULL,
+    created_at datetime
+);
+CREATE INDEX idx_workspaces_owner_id ON workspaces (owner_id);
+CREATE UNIQUE INDEX idx_personal_workspace ON workspaces (owner_id) WHERE personal = true;
+
+CREATE TABLE todos (
+    id integer PRIMARY KEY AUTOINCREMENT,
+    title text NOT NULL,
+    completed numeric NOT NULL,
+    owner_id integer NOT NULL CONSTRAINT fk_todos_owner REFERENCES users (id) ON DELETE CASCADE,
+    workspace_id integer,
+    list_id integer,
+    created_at datetime
+);
+CREATE INDEX idx_todos_owner_id ON todos (owner_id);
+CREATE INDEX idx_todos_workspace_id ON todos (workspace_id);
+CREATE INDEX idx_todos_list_id ON todos (list_id);
+
+CREATE TABLE personal_access_tokens (
+    id integer PRIMARY KEY AUTOINCREMENT,
+    user_id integer NOT NULL,
+    name text NOT NULL,
+    prefix text NOT NULL,
+    token_hash text NOT NULL,
+    scopes text NOT NULL,
+    expires_at datetime,
+    last_used_at datetime,
+    created_at datetime
+);
+CREATE INDEX idx_personal_access_tokens_user_id ON personal_access_tokens (user_id);
+CREATE UNIQUE INDEX idx_personal_access_tokens_token_hash ON personal_access_tokens (token_hash);
+
+CREATE TABLE recovery_codes (
+    id integer PRIMARY KEY AUTOINCREMENT,
+    user_id integer NOT NULL,
+    code_hash text NOT NULL,
+    used_at datetime,
+    created_at datetime
+);
+CREATE INDEX idx_recovery_codes_user_id ON recovery_codes (user_id);
+
+CREATE TABLE login_attempts (
+    key text PRIMARY KEY,
+    failures integer NOT NULL DEFAULT 0,
+    locked_until datetime,
+    updated_at datetime
+);
+
+CREATE TABLE user_identities (
+    id integer PRIMARY KEY AUTOINCREMENT,
+    user_id integer NOT NULL,
+    provider text NOT NULL,
+    subject text NOT NULL,
+    email text NOT NULL,
+    created_at datetime
+);
+CREATE INDEX idx_user_identities_user_id ON user_identities (user_id);
+CREATE UNIQUE INDEX idx_identity_provider_subject ON user_identities (provider, subject);
+
+CREATE TABLE memberships (
+    workspace_id integer,
+    user_id integer,
+    role text NOT NULL,
+    created_at datetime,
+    PRIMARY KEY (workspace_id, user_id)
+);
+CREATE INDEX idx_memberships_user_id ON memberships (user_id);
+
+CREATE TABLE todo_lists (
+    id integer PRIMARY KEY AUTOINCREMENT,
+    workspace_id integer NOT NULL,
+    owner_id integer NOT NULL,
+    name text NOT NULL,
+    created_at datetime
+);
+CREATE INDEX idx_todo_lists_workspace_id ON todo_lists (workspace_id);
+
+CREATE TABLE list_shares (
+    list_id integer,
+    user_id integer,
+    permission text NOT NULL,
+    created_at datetime,
+    PRIMARY KEY (list_id, user_id)
+);
+CREATE INDEX idx_list_shares_user_id ON list_shares (user_id);
+
+CREATE TABLE invitations (
+    id integer PRIMARY KEY AUTOINCREMENT,
+    inviter_id integer NOT NULL,
+    email text NOT NULL,
+    workspace_id integer,
+    list_id integer,
+    role text NOT NULL,
+    expires_at datetime NOT NULL,
+    accepted_at datetime,
+    declined_at datetime,
+    created_at datetime
+);
+CREATE INDEX idx_invitations_inviter_id ON invitations (inviter_id);
+
+CREATE TABLE sessions (
+    id integer PRIMARY KEY AUTOINCREMENT,
+    user_id integer NOT NULL,
+    user_agent text,
+    ip text,
+    created_at datetime,
+    last_seen_at datetime,
+    expires_at datetime NOT NULL,
+    revoked_at datetime
+);
+CREATE INDEX idx_sessions_user_id ON sessions (user_id);
+
+CREATE TABLE magic_links (
+    id integer PRIMARY KEY AUTOINCREMENT,
+    user_id integer NOT NULL,
+    token_hash text NOT NULL,
+    nonce_hash text NOT NULL,
+    expires_at datetime NOT NULL,
+    used_at datetime,
+    created_at datetime
+);
+CREATE INDEX idx_magic_links_user_id ON magic_links (user_id);
+CREATE UNIQUE INDEX idx_magic_links_token_hash ON magic_links (token_hash);
+
+CREATE TABLE password_resets (
+    id integer PRIMARY KEY AUTOINCREMENT,
+    user_id integer NOT NULL,
+    token_hash text NOT NULL,
+    expires_at datetime NOT NULL,
+    used_at datetime,
+    created_at datetime
+);
+CREATE INDEX idx_password_resets_user_id ON password_resets (user_id);
+CREATE UNIQUE INDEX idx_password_resets_token_hash ON password_resets (token_hash);
+
+CREATE TABLE oauth_clients (
+    id integer PRIMARY KEY AUTOINCREMENT,
+    client_id text NOT NULL,
+    secret_hash text,
+    owner_id integer NOT NULL,
+    name text NOT NULL,
+    redirect_uris text NOT NULL,
+    scopes text NOT NULL,
+    confidential numeric NOT NULL,
+    created_at datetime
+);
+CREATE INDEX idx_oauth_clients_owner_id ON oauth_clients (owner_id);
+CREATE UNIQUE INDEX idx_oauth_clients_client_id ON oauth_clients (client_id);
+
+CREATE TABLE oauth_authorizations (
+    id integer PRIMARY KEY AUTOINCREMENT,
+    user_id integer NOT NULL,
+    client_id integer NOT NULL,
+    scopes text NOT NULL,
+    revoked_at datetime,
+    created_at datetime,
+    updated_at datetime
+);
+CREATE UNIQUE INDEX idx_oauth_authorization ON oauth_authorizations (user_id, client_id);
+CREATE INDEX idx_oauth_authorizations_revoked_at ON oauth_authorizations (revoked_at);
+
+CREATE TABLE oauth_codes (
+    id integer PRIMARY KEY AUTOINCREMENT,
+    code_hash text NOT NULL,
+    authorization_id integer NOT NULL,
+    redirect_uri text NOT NULL,
+    scopes text NOT NULL,
+    code_challenge text NOT NULL,
+    expires_at datetime NOT NULL,
+    used_at datetime,
+    created_at datetime
+);
+CREATE INDEX idx_oauth_codes_authorization_id ON oauth_codes (authorization_id);
+CREATE UNIQUE INDEX idx_oauth_codes_code_hash ON oauth_codes (code_hash);
+
+CREATE TABLE oauth_tokens (
+    id integer PRIMARY KEY AUTOINCREMENT,
+    authorization_id integer NOT NULL,
+    user_id integer NOT NULL,
+    access_hash text NOT NULL,
+    refresh_hash text NOT NULL,
+    scopes text NOT NULL,
+    access_expires_at datetime NOT NULL,
+    refresh_expires_at datetime NOT NULL,
+    revoked_at datetime,
+    created_at datetime
+);
+CREATE INDEX idx_oauth_tokens_authorization_id ON oauth_tokens (authorization_id);
+CREATE INDEX idx_oauth_tokens_user_id ON oauth_tokens (user_id);
+CREATE UNIQUE INDEX idx_oauth_tokens_access_hash ON oauth_tokens (access_hash);
+CREATE UNIQUE INDEX idx_oauth_tokens_refresh_hash ON oauth_tokens (refresh_hash);
@@ -0,0 +1,13 @@
+-- 0003_todo_revisions (sqlite, up)
+-- Every change to a todo, with field-level before and after values.
+CREATE TABLE todo_revisions (
+    id integer PRIMARY KEY AUTOINCREMENT,
+    todo_id integer NOT NULL CONSTRAINT fk_todo_revisions_todo REFERENCES todos (id) ON DELETE CASCADE,
+    rev integer NOT NULL,
+    user_id integer NOT NULL,
+    action text NOT NULL,
+    changes text NOT NULL,
+    created_at datetime
+);
+CREATE UNIQUE INDEX idx_todo_revisions_todo_rev ON todo_revisions (todo_id, rev);
+CREATE INDEX idx_todo_revisions_user_id ON todo_revisions (user_id);
@@ -0,0 +1,2 @@
+-- 0004_todo_cache_invalidations (sqlite, down)
+DROP TABLE todo_cache_invalidations;
@@ -0,0 +1,8 @@
+-- 0004_todo_cache_invalidations (sqlite, up)
+-- Lets the todo caches of several server processes invalidate each other.
+CREATE TABLE todo_cache_invalidations (
+    id integer PRIMARY KEY AUTOINCREMENT,
+    user_id integer NOT NULL,
+    created_at datetime NOT NULL
+);
+CREATE INDEX idx_todo_cache_invalidations_created_at ON todo_cache_invalidations (created_at);
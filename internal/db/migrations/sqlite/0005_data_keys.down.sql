@@ -0,0 +1,2 @@
+-- 0005_data_keys (sqlite, down)
+DROP TABLE data_keys;
@@ -0,0 +1,303 @@
+package db
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	logrus "github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	replicasPluginName = "replicas"
+	replicaReadKey     = "db:replica_read"
+	replicaUsedKey     = "db:replica_used"
+
+	// DefaultReplicaHealthInterval is how often replicas are checked when
+	// Options.HealthInterval is unset.
+	DefaultReplicaHealthInterval = 10 * time.Second
+)
+
+// replicaLagSQL reports how far a Postgres standby is behind, in seconds. A
+// standby that has replayed everything it received is not lagging, however
+// old its last replayed transaction is.
+const replicaLagSQL = `SELECT CASE WHEN pg_last_wal_receive_lsn() = pg_last_wal_replay_lsn() THEN 0
+	ELSE COALESCE(EXTRACT(EPOCH FROM now() - pg_last_xact_replay_timestamp()), 0) END`
+
+// ReadFromReplica marks a query that tolerates replication lag, so it may run
+// on a read replica:
+//
+//	db.Clauses(ReadFromReplica).Find(&todos)
+//
+// Unmarked statements always run on the primary, and so do marked ones inside
+// a transaction, with a locking clause, or within the read-your-writes window
+// of the request's user.
+var ReadFromReplica = replicaRead{}
+
+type replicaRead struct{}
+
+func (replicaRead) Build(clause.Builder) {}
+
+func (replicaRead) ModifyStatement(stmt *gorm.Statement) {
+	stmt.Settings.Store(replicaReadKey, true)
+}
+
+type userKey struct{}
+
+// WithUser records the user a request acts for. After that user writes,
+// their reads stay on the primary for the read-your-writes window.
+func WithUser(ctx context.Context, userID uint) context.Context {
+	return context.WithValue(ctx, userKey{}, userID)
+}
+
+func userFrom(ctx context.Context) (uint, bool) {
+	if ctx == nil {
+		return 0, false
+	}
+	id, ok := ctx.Value(userKey{}).(uint)
+	return id, ok
+}
+
+// ReplicaSet is a GORM plugin that routes reads marked with ReadFromReplica to
+// healthy read replicas in turn. New installs it when replica URLs are given;
+// Run keeps their health up to date.
+type ReplicaSet struct {
+	replicas       []*replica
+	next           atomic.Uint64
+	readYourWrites time.Duration
+	healthInterval time.Duration
+	maxLag         time.Duration
+
+	mu     sync.Mutex
+	writes map[uint]time.Time // last write per user, within the window
+}
+
+type replica struct {
+	name    string
+	db      *gorm.DB
+	healthy atomic.Bool
+}
+
+// Replicas returns the replica set installed on db, or nil if it has none.
+func Replicas(db *gorm.DB) *ReplicaSet {
+	if p, ok := db.Config.Plugins[replicasPluginName]; ok {
+		return p.(*ReplicaSet)
+	}
+	return nil
+}
+
+// openReplicas connects to every replica and checks it once. A replica that
+// is down at startup is ejected rather than failing the primary's startup.
+func openReplicas(primary gorm.Dialector, opts Options) (*ReplicaSet, error) {
+	rs := &ReplicaSet{
+		readYourWrites: opts.ReadYourWrites,
+		healthInterval: opts.HealthInterval,
+		maxLag:         opts.MaxReplicaLag,
+		writes:         map[uint]time.Time{},
+	}
+	if rs.healthInterval <= 0 {
+		rs.healthInterval = DefaultReplicaHealthInterval
+	}
+	for i, url := range opts.ReplicaURLs {
+		dialector, err := Dialector(url)
+		if err != nil {
+			return nil, fmt.Errorf("replica %d: %w", i+1, err)
+		}
+		if dialector.Name() != primary.Name() {
+			return nil, fmt.Errorf("replica %d is %s but the primary is %s", i+1, dialector.Name(), primary.Name())
+		}
+		conn, err := gorm.Open(dialector, &gorm.Config{DisableAutomaticPing: true})
+		if err != nil {
+			return nil, fmt.Errorf("replica %d: %w", i+1, err)
+		}
+		if err := configurePool(conn, opts.ReplicaPool); err != nil {
+			return nil, err
+		}
+		rs.replicas = append(rs.replicas, &replica{name: fmt.Sprintf("replica %d", i+1), db: conn})
+	}
+	rs.Check(context.Background())
+	return rs, nil
+}
+
+func (*ReplicaSet) Name() string { return replicasPluginName }
+
+func (rs *ReplicaSet) Initialize(db *gorm.DB) error {
+	cb := db.Callback()
+	for _, err := range []error{
+		cb.Query().Before("gorm:query").Register("replicas:route", rs.route),
+		cb.Query().After("gorm:query").Register("replicas:eject", rs.ejectOnConnError),
+		cb.Row().Before("gorm:row").Register("replicas:route", rs.route),
+		cb.Row().After("gorm:row").Register("replicas:eject", rs.ejectOnConnError),
+		cb.Create().After("*").Register("replicas:wrote", rs.wrote),
+		cb.Update().After("*").Register("replicas:wrote", rs.wrote),
+		cb.Delete().After("*").Register("replicas:wrote", rs.wrote),
+		cb.Raw().After("*").Register("replicas:wrote", rs.wrote),
+	} {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Healthy reports how many replicas currently receive reads.
+func (rs *ReplicaSet) Healthy() int {
+	n := 0
+	for _, r := range rs.replicas {
+		if r.healthy.Load() {
+			n++
+		}
+	}
+	return n
+}
+
+// Check pings every replica, and on Postgres compares its replication lag
+// with the limit, ejecting the ones that fail and bringing back the ones that
+// pass again.
+func (rs *ReplicaSet) Check(ctx context.Context) {
+	for _, r := range rs.replicas {
+		err := rs.check(ctx, r)
+		if ctx.Err() != nil {
+			return
+		}
+		switch healthy := err == nil; {
+		case healthy && !r.healthy.Swap(true):
+			logrus.Infof("%s is healthy and receives reads", r.name)
+		case !healthy && r.healthy.Swap(false):
+			logrus.Warnf("%s ejected: %v", r.name, err)
+		}
+	}
+}
+
+func (rs *ReplicaSet) check(ctx context.Context, r *replica) error {
+	ctx, cancel := context.WithTimeout(ctx, rs.healthInterval)
+	defer cancel()
+	sqlDB, err := r.db.DB()
+	if err != nil {
+		return err
+	}
+	if err := sqlDB.PingContext(ctx); err != nil {
+		return err
+	}
+	if rs.maxLag <= 0 || r.db.Dialector.Name() != DialectPostgres {
+		return nil
+	}
+	var lag float64
+	if err := r.db.WithContext(ctx).Raw(replicaLagSQL).Scan(&lag).Error; err != nil {
+		return err
+	}
+	if lag > rs.maxLag.Seconds() {
+		return fmt.Errorf("replication lag %.1fs exceeds %s", lag, rs.maxLag)
+	}
+	return nil
+}
+
+// Run checks the replicas every health interval until ctx is done, and
+// forgets writes older than the read-your-writes window.
+func (rs *ReplicaSet) Run(ctx context.Context) {
+	ticker := time.NewTicker(rs.healthInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		rs.Check(ctx)
+		rs.mu.Lock()
+		for id, at := range rs.writes {
+			if time.Since(at) >= rs.readYourWrites {
+				delete(rs.writes, id)
+			}
+		}
+		rs.mu.Unlock()
+	}
+}
+
+// Close closes the replicas' connection pools.
+func (rs *ReplicaSet) Close() error {
+	var errs []error
+	for _, r := range rs.replicas {
+		if sqlDB, err := r.db.DB(); err == nil {
+			errs = append(errs, sqlDB.Close())
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (rs *ReplicaSet) route(db *gorm.DB) {
+	stmt := db.Statement
+	if _, ok := stmt.Settings.Load(replicaReadKey); !ok {
+		return
+	}
+	if _, inTx := stmt.ConnPool.(gorm.TxCommitter); inTx {
+		return
+	}
+	if _, locking := stmt.Clauses[clause.Locking{}.Name()]; locking {
+		return
+	}
+	if rs.wroteRecently(stmt.Context) {
+		return
+	}
+	if r := rs.pick(); r != nil {
+		stmt.ConnPool = r.db.ConnPool
+		stmt.Settings.Store(replicaUsedKey, r)
+	}
+}
+
+// pick returns the next healthy replica, or nil when all are ejected and
+// reads fall back to the primary.
+func (rs *ReplicaSet) pick() *replica {
+	n := len(rs.replicas)
+	start := int(rs.next.Add(1) % uint64(n))
+	for i := 0; i < n; i++ {
+		if r := rs.replicas[(start+i)%n]; r.healthy.Load() {
+			return r
+		}
+	}
+	return nil
+}
+
+// ejectOnConnError takes a replica out of rotation as soon as a read on it
+// fails to reach the server, instead of waiting for the next health check.
+func (rs *ReplicaSet) ejectOnConnError(db *gorm.DB) {
+	v, ok := db.Statement.Settings.Load(replicaUsedKey)
+	if !ok || db.Error == nil {
+		return
+	}
+	var netErr net.Error
+	if errors.Is(db.Error, driver.ErrBadConn) || errors.As(db.Error, &netErr) {
+		if r := v.(*replica); r.healthy.Swap(false) {
+			logrus.Warnf("%s ejected: %v", r.name, db.Error)
+		}
+	}
+}
+
+func (rs *ReplicaSet) wrote(db *gorm.DB) {
+	if rs.readYourWrites <= 0 || db.Error != nil {
+		return
+	}
+	if id, ok := userFrom(db.Statement.Context); ok {
+		rs.mu.Lock()
+		rs.writes[id] = time.Now()
+		rs.mu.Unlock()
+	}
+}
+
+func (rs *ReplicaSet) wroteRecently(ctx context.Context) bool {
+	id, ok := userFrom(ctx)
+	if !ok || rs.readYourWrites <= 0 {
+		return false
+	}
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+	at, ok := rs.writes[id]
+	return ok && time.Since(at) < rs.readYourWrites
+}
@@ -0,0 +1,61 @@
+package db
+
+import (
+	"context"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+const timeoutCancelKey = "db:query_timeout_cancel"
+
+// QueryTimeout is a GORM plugin that bounds every statement by a deadline on
+// top of the caller's context, so a slow query cannot hold a request (or a
+// pool connection) longer than the configured limit. Register it with
+// db.Use(QueryTimeout(d)); a zero or negative duration disables it.
+//
+// Row and Rows are left alone: their result set is read after the callback
+// chain returns, and cancelling the context then would abort the scan.
+type QueryTimeout time.Duration
+
+func (QueryTimeout) Name() string { return "query_timeout" }
+
+func (t QueryTimeout) Initialize(db *gorm.DB) error {
+	if t <= 0 {
+		return nil
+	}
+	cb := db.Callback()
+	for _, err := range []error{
+		cb.Create().Before("*").Register("query_timeout:begin", t.begin),
+		cb.Create().After("*").Register("query_timeout:end", t.end),
+		cb.Query().Before("*").Register("query_timeout:begin", t.begin),
+		cb.Query().After("*").Register("query_timeout:end", t.end),
+		cb.Update().Before("*").Register("query_timeout:begin", t.begin),
+		cb.Update().After("*").Register("query_timeout:end", t.end),
+		cb.Delete().Before("*").Register("query_timeout:begin", t.begin),
+		cb.Delete().After("*").Register("query_timeout:end", t.end),
+		cb.Raw().Before("*").Register("query_timeout:begin", t.begin),
+		cb.Raw().After("*").Register("query_timeout:end", t.end),
+	} {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (t QueryTimeout) begin(db *gorm.DB) {
+	ctx := db.Statement.Context
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	ctx, cancel := context.WithTimeout(ctx, time.Duration(t))
+	db.Statement.Context = ctx
+	db.Statement.Settings.Store(timeoutCancelKey, cancel)
+}
+
+func (QueryTimeout) end(db *gorm.DB) {
+	if v, ok := db.Statement.Settings.LoadAndDelete(timeoutCancelKey); ok {
+		v.(context.CancelFunc)()
+	}
+}
@@ -0,0 +1,193 @@
+// Package encryption implements the envelope encryption of todo content: each
+// user's content is sealed with AES-256-GCM under a data key of their own,
+// and data keys are stored wrapped by a versioned master key.
+package encryption
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// KeySize is the length of master and data keys, for AES-256.
+const KeySize = 32
+
+// SealedPrefix starts every sealed value: a format version, then the ID of
+// the data key, then the base64 nonce and ciphertext.
+const SealedPrefix = "enc:v1:"
+
+var (
+	ErrUnknownMasterKey = errors.New("unknown master key version")
+	ErrMalformed        = errors.New("malformed encrypted value")
+)
+
+// MasterKeys are the versions of the master key. New data keys are wrapped
+// with the active version; the others are kept to unwrap older data keys
+// until the re-encryption job has replaced them.
+type MasterKeys struct {
+	active int
+	keys   map[int][]byte
+}
+
+// ParseMasterKeys reads "version:base64key" entries of 32-byte keys. The
+// active version defaults to the highest one.
+func ParseMasterKeys(specs []string, active int) (*MasterKeys, error) {
+	if len(specs) == 0 {
+		return nil, errors.New("no master keys configured")
+	}
+	m := &MasterKeys{keys: make(map[int][]byte)}
+	for _, spec := range specs {
+		v, b64, ok := strings.Cut(spec, ":")
+		version, err := strconv.Atoi(v)
+		if !ok || err != nil || version <= 0 {
+			return nil, fmt.Errorf("master key %q: want a positive version, a colon and a base64 key", v)
+		}
+		key, err := base64.StdEncoding.DecodeString(b64)
+		if err != nil {
+			return nil, fmt.Errorf("master key %d: %w", version, err)
+		}
+		if len(key) != KeySize {
+			return nil, fmt.Errorf("master key %d is %d bytes, want %d", version, len(key), KeySize)
+		}
+		if _, dup := m.keys[version]; dup {
+			return nil, fmt.Errorf("duplicate master key version %d", version)
+		}
+		m.keys[version] = key
+	}
+	if active == 0 {
+		versions := make([]int, 0, len(m.keys))
+		for v := range m.keys {
+			versions = append(versions, v)
+		}
+		sort.Ints(versions)
+		active = versions[len(versions)-1]
+	}
+	if _, ok := m.keys[active]; !ok {
+		return nil, fmt.Errorf("active master key %d not found", active)
+	}
+	m.active = active
+	return m, nil
+}
+
+// Active is the version new data keys are wrapped with.
+func (m *MasterKeys) Active() int {
+	return m.active
+}
+
+// Wrap encrypts a data key of userID with the active master key. The user ID
+// is authenticated, so a wrapped key copied to another user does not unwrap.
+func (m *MasterKeys) Wrap(userID uint, dataKey []byte) (version int, wrapped string, err error) {
+	sealed, err := seal(m.keys[m.active], dataKey, wrapAAD(m.active, userID))
+	if err != nil {
+		return 0, "", err
+	}
+	return m.active, base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+func (m *MasterKeys) Unwrap(version int, userID uint, wrapped string) ([]byte, error) {
+	key, ok := m.keys[version]
+	if !ok {
+		return nil, fmt.Errorf("%w %d", ErrUnknownMasterKey, version)
+	}
+	sealed, err := base64.StdEncoding.DecodeString(wrapped)
+	if err != nil {
+		return nil, err
+	}
+	return open(key, sealed, wrapAAD(version, userID))
+}
+
+func wrapAAD(version int, userID uint) []byte {
+	return []byte(fmt.Sprintf("data-key:%d:%d", version, userID))
+}
+
+// NewDataKey returns a random data key.
+func NewDataKey() ([]byte, error) {
+	key := make([]byte, KeySize)
+	if _, err := rand.Read(key); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+// Seal encrypts plaintext with the data key keyID. The result names the key
+// and is safe to store in a text column.
+func Seal(key []byte, keyID uint, plaintext string) (string, error) {
+	header := SealedPrefix + strconv.FormatUint(uint64(keyID), 10) + ":"
+	sealed, err := seal(key, []byte(plaintext), []byte(header))
+	if err != nil {
+		return "", err
+	}
+	return header + base64.RawStdEncoding.EncodeToString(sealed), nil
+}
+
+// Open decrypts a value returned by Seal with the data key it names.
+func Open(key []byte, value string) (string, error) {
+	if _, ok := KeyID(value); !ok {
+		return "", ErrMalformed
+	}
+	i := strings.LastIndexByte(value, ':')
+	sealed, err := base64.RawStdEncoding.DecodeString(value[i+1:])
+	if err != nil {
+		return "", ErrMalformed
+	}
+	plaintext, err := open(key, sealed, []byte(value[:i+1]))
+	return string(plaintext), err
+}
+
+// IsSealed reports whether value was returned by Seal. Anything else is
+// plaintext stored before encryption was turned on.
+func IsSealed(value string) bool {
+	return strings.HasPrefix(value, SealedPrefix)
+}
+
+// KeyID returns the ID of the data key a sealed value was encrypted with.
+func KeyID(value string) (uint, bool) {
+	if !IsSealed(value) {
+		return 0, false
+	}
+	id, _, ok := strings.Cut(value[len(SealedPrefix):], ":")
+	if !ok {
+		return 0, false
+	}
+	n, err := strconv.ParseUint(id, 10, 0)
+	return uint(n), err == nil
+}
+
+// seal returns the random nonce followed by the AES-GCM ciphertext.
+func seal(key, plaintext, aad []byte) ([]byte, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return gcm.Seal(nonce, nonce, plaintext, aad), nil
+}
+
+func open(key, sealed, aad []byte) ([]byte, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(sealed) < gcm.NonceSize() {
+		return nil, ErrMalformed
+	}
+	nonce, ciphertext := sealed[:gcm.NonceSize()], sealed[gcm.NonceSize():]
+	return gcm.Open(nil, nonce, ciphertext, aad)
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
@@ -0,0 +1,80 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/ahmadjafari86/go-todo-list/internal/service"
+	"github.com/ahmadjafari86/go-todo-list/internal/validation"
+)
+
+type deleteAccountPayload struct {
+	Password string `json:"password" binding:"required"`
+}
+
+type AccountHandler struct {
+	svc service.AccountService
+}
+
+func NewAccountHandler(svc service.AccountService) *AccountHandler {
+	return &AccountHandler{svc: svc}
+}
+
+// Export godoc
+// @Summary Export my data
+// @Description Download a zip archive with one JSON file per kind of data stored about the authenticated user
+// @Tags account
+// @Produce application/zip
+// @Success 200 {file} file
+// @Failure 401 {object} validation.ProblemDetails
+// @Router /api/me/export [post]
+// @Security BearerAuth
+func (h *AccountHandler) Export(c *gin.Context) {
+	archive, err := h.svc.Export(c.Request.Context(), getUserIDFromContext(c))
+	if err != nil {
+		respondAccountError(c, err)
+		return
+	}
+	c.Header("Content-Disposition", `attachment; filename="todo-export.zip"`)
+	c.Data(http.StatusOK, "application/zip", archive)
+}
+
+// DeleteAccount godoc
+// @Summary Delete my account
+// @Description Permanently delete the authenticated user and everything they own. Requires the current password.
+// @Tags account
+// @Accept json
+// @Param body body models.DeleteAccountRequest true "Current password"
+// @Success 204
+// @Failure 400 {object} validation.ProblemDetails
+// @Failure 401 {object} validation.ProblemDetails
+// @Failure 403 {object} validation.ProblemDetails
+// @Router /api/me [delete]
+// @Security BearerAuth
+func (h *AccountHandler) DeleteAccount(c *gin.Context) {
+	var p deleteAccountPayload
+	if err := c.ShouldBindJSON(&p); err != nil {
+		validation.RespondProblem(c, http.StatusBadRequest, "Invalid Request", err.Error())
+		return
+	}
+	if err := h.svc.DeleteAccount(c.Request.Context(), getUserIDFromContext(c), p.Password); err != nil {
+		respondAccountError(c, err)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+func respondAccountError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, service.ErrInvalidCredentials):
+		validation.RespondProblem(c, http.StatusForbidden, "Forbidden", "password is incorrect")
+	case errors.Is(err, service.ErrPasswordNotSet):
+		validation.RespondProblem(c, http.StatusBadRequest, "Request Failed", err.Error())
+	case errors.Is(err, service.ErrUserNotFound):
+		validation.RespondProblem(c, http.StatusNotFound, "Not Found", err.Error())
+	default:
+		validation.RespondServerError(c, err)
+	}
+}
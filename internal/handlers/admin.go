@@ -0,0 +1,186 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/ahmadjafari86/go-todo-list/internal/repository"
+	"github.com/ahmadjafari86/go-todo-list/internal/service"
+	"github.com/ahmadjafari86/go-todo-list/internal/validation"
+)
+
+const (
+	defaultPageSize = 20
+	maxPageSize     = 100
+)
+
+type setRolePayload struct {
+	Role string `json:"role" binding:"required,oneof=user admin"`
+}
+
+type AdminHandler struct {
+	svc       service.AdminService
+	todoCache *repository.CachingTodoRepository
+}
+
+// NewAdminHandler takes the todo cache to report on, or nil when it is off.
+func NewAdminHandler(svc service.AdminService, todoCache *repository.CachingTodoRepository) *AdminHandler {
+	return &AdminHandler{svc: svc, todoCache: todoCache}
+}
+
+// ListUsers godoc
+// @Summary List users
+// @Description Page through users with their todo counts, optionally filtered by email
+// @Tags admin
+// @Produce json
+// @Param q query string false "Email contains"
+// @Param page query int false "Page (1-based)"
+// @Param page_size query int false "Page size (max 100)"
+// @Success 200 {object} models.AdminUserListResponse
+// @Failure 401 {object} validation.ProblemDetails
+// @Failure 403 {object} validation.ProblemDetails
+// @Router /admin/users [get]
+// @Security BearerAuth
+func (h *AdminHandler) ListUsers(c *gin.Context) {
+	page, size := pagination(c)
+	users, total, err := h.svc.ListUsers(c.Request.Context(), c.Query("q"), (page-1)*size, size)
+	if err != nil {
+		validation.RespondServerError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"users": users, "total": total, "page": page, "page_size": size})
+}
+
+// GetUser godoc
+// @Summary Get a user
+// @Tags admin
+// @Produce json
+// @Param id path int true "User ID"
+// @Success 200 {object} models.UserSummary
+// @Failure 401 {object} validation.ProblemDetails
+// @Failure 403 {object} validation.ProblemDetails
+// @Failure 404 {object} validation.ProblemDetails
+// @Router /admin/users/{id} [get]
+// @Security BearerAuth
+func (h *AdminHandler) GetUser(c *gin.Context) {
+	id, _ := strconv.Atoi(c.Param("id"))
+	u, err := h.svc.GetUser(c.Request.Context(), uint(id))
+	if err != nil {
+		respondAdminError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, u)
+}
+
+// DisableUser godoc
+// @Summary Disable a user
+// @Description Disabled users cannot log in and their existing tokens stop working
+// @Tags admin
+// @Param id path int true "User ID"
+// @Success 204
+// @Failure 400 {object} validation.ProblemDetails
+// @Failure 403 {object} validation.ProblemDetails
+// @Failure 404 {object} validation.ProblemDetails
+// @Router /admin/users/{id}/disable [post]
+// @Security BearerAuth
+func (h *AdminHandler) DisableUser(c *gin.Context) {
+	id, _ := strconv.Atoi(c.Param("id"))
+	if err := h.svc.DisableUser(c.Request.Context(), uint(id), getUserIDFromContext(c)); err != nil {
+		respondAdminError(c, err)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// EnableUser godoc
+// @Summary Enable a user
+// @Tags admin
+// @Param id path int true "User ID"
+// @Success 204
+// @Failure 403 {object} validation.ProblemDetails
+// @Failure 404 {object} validation.ProblemDetails
+// @Router /admin/users/{id}/enable [post]
+// @Security BearerAuth
+func (h *AdminHandler) EnableUser(c *gin.Context) {
+	id, _ := strconv.Atoi(c.Param("id"))
+	if err := h.svc.EnableUser(c.Request.Context(), uint(id)); err != nil {
+		respondAdminError(c, err)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// SetRole godoc
+// @Summary Change a user's role
+// @Tags admin
+// @Accept json
+// @Param id path int true "User ID"
+// @Param role body models.SetRoleRequest true "Role"
+// @Success 204
+// @Failure 400 {object} validation.ProblemDetails
+// @Failure 403 {object} validation.ProblemDetails
+// @Failure 404 {object} validation.ProblemDetails
+// @Router /admin/users/{id}/role [put]
+// @Security BearerAuth
+func (h *AdminHandler) SetRole(c *gin.Context) {
+	var p setRolePayload
+	if err := c.ShouldBindJSON(&p); err != nil {
+		validation.RespondProblem(c, http.StatusBadRequest, "Invalid Request", err.Error())
+		return
+	}
+	id, _ := strconv.Atoi(c.Param("id"))
+	if err := h.svc.SetRole(c.Request.Context(), uint(id), getUserIDFromContext(c), p.Role); err != nil {
+		respondAdminError(c, err)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// TodoCacheStats godoc
+// @Summary Todo cache statistics
+// @Description Hits, misses, invalidations and evictions of this process's todo cache since startup
+// @Tags admin
+// @Produce json
+// @Success 200 {object} repository.TodoCacheStats
+// @Failure 401 {object} validation.ProblemDetails
+// @Failure 403 {object} validation.ProblemDetails
+// @Failure 404 {object} validation.ProblemDetails
+// @Router /admin/todo-cache [get]
+// @Security BearerAuth
+func (h *AdminHandler) TodoCacheStats(c *gin.Context) {
+	if h.todoCache == nil {
+		validation.RespondProblem(c, http.StatusNotFound, "Not Found", "the todo cache is disabled")
+		return
+	}
+	c.JSON(http.StatusOK, h.todoCache.Stats())
+}
+
+func respondAdminError(c *gin.Context, err error) {
+	if validation.IsContextError(err) {
+		validation.RespondServerError(c, err)
+		return
+	}
+	if errors.Is(err, service.ErrUserNotFound) {
+		validation.RespondProblem(c, http.StatusNotFound, "Not Found", err.Error())
+		return
+	}
+	validation.RespondProblem(c, http.StatusBadRequest, "Request Failed", err.Error())
+}
+
+func pagination(c *gin.Context) (page, size int) {
+	page, _ = strconv.Atoi(c.Query("page"))
+	if page < 1 {
+		page = 1
+	}
+	size, _ = strconv.Atoi(c.Query("page_size"))
+	if size < 1 {
+		size = defaultPageSize
+	}
+	if size > maxPageSize {
+		size = maxPageSize
+	}
+	return page, size
+}
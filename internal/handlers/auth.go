@@ -1,7 +1,12 @@
 package handlers
 
 import (
+	"errors"
+	"fmt"
+	"math"
 	"net/http"
+	"strconv"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/go-playground/validator/v10"
@@ -11,8 +16,9 @@ import (
 )
 
 type registerPayload struct {
-	Email    string `json:"email" binding:"required,email"`
-	Password string `json:"password" binding:"required,min=8"`
+	Email string `json:"email" binding:"required,email"`
+	// Password strength is checked by the password policy.
+	Password string `json:"password" binding:"required"`
 }
 
 type loginPayload struct {
@@ -20,13 +26,19 @@ type loginPayload struct {
 	Password string `json:"password" binding:"required"`
 }
 
+type mfaLoginPayload struct {
+	MFAToken string `json:"mfa_token" binding:"required"`
+	Code     string `json:"code" binding:"required"`
+}
+
 type AuthHandler struct {
 	svc       service.AuthService
+	limiter   service.LoginLimiter
 	validator *validator.Validate
 }
 
-func NewAuthHandler(svc service.AuthService) *AuthHandler {
-	return &AuthHandler{svc: svc, validator: validator.New()}
+func NewAuthHandler(svc service.AuthService, limiter service.LoginLimiter) *AuthHandler {
+	return &AuthHandler{svc: svc, limiter: limiter, validator: validator.New()}
 }
 
 // Register godoc
@@ -42,16 +54,19 @@ func NewAuthHandler(svc service.AuthService) *AuthHandler {
 func (h *AuthHandler) Register(c *gin.Context) {
 	var p registerPayload
 	if err := c.ShouldBindJSON(&p); err != nil {
-		if errs, ok := err.(validator.ValidationErrors); ok {
-			validation.RespondProblem(c, http.StatusBadRequest, "Invalid Request", errs.Error())
-			return
-		}
-		validation.RespondProblem(c, http.StatusBadRequest, "Invalid Request", err.Error())
+		validation.RespondFieldProblem(c, http.StatusBadRequest, "Invalid Request", err.Error(), validation.FieldErrors(err))
 		return
 	}
 
-	u, err := h.svc.Register(p.Email, p.Password)
+	u, err := h.svc.Register(c.Request.Context(), p.Email, p.Password)
 	if err != nil {
+		if respondPasswordRejected(c, err, "password") {
+			return
+		}
+		if validation.IsContextError(err) {
+			validation.RespondServerError(c, err)
+			return
+		}
 		validation.RespondProblem(c, http.StatusBadRequest, "Registration Failed", err.Error())
 		return
 	}
@@ -60,13 +75,17 @@ func (h *AuthHandler) Register(c *gin.Context) {
 
 // Login godoc
 // @Summary Login user
-// @Description Authenticate user and return JWT
+// @Description Authenticate user and return JWT. Accounts with two-factor authentication
+// @Description get an mfa_token instead, to be exchanged at /auth/login/mfa.
 // @Tags auth
 // @Accept json
 // @Produce json
 // @Param credentials body models.LoginRequest true "User credentials"
 // @Success 200 {object} models.LoginResponse
 // @Failure 401 {object} validation.ProblemDetails
+// @Failure 403 {object} validation.ProblemDetails
+// @Failure 429 {object} validation.ProblemDetails
+// @Header 429 {integer} Retry-After "Seconds until the next attempt is allowed"
 // @Router /auth/login [post]
 func (h *AuthHandler) Login(c *gin.Context) {
 	var p loginPayload
@@ -78,10 +97,105 @@ func (h *AuthHandler) Login(c *gin.Context) {
 		validation.RespondProblem(c, http.StatusBadRequest, "Invalid Request", err.Error())
 		return
 	}
-	token, err := h.svc.Login(p.Email, p.Password)
+	ip := c.ClientIP()
+	if wait, err := h.limiter.Check(c.Request.Context(), p.Email, ip); err != nil {
+		validation.RespondServerError(c, err)
+		return
+	} else if wait > 0 {
+		respondLocked(c, wait)
+		return
+	}
+	res, err := h.svc.Login(c.Request.Context(), p.Email, p.Password, clientInfo(c))
 	if err != nil {
-		validation.RespondProblem(c, http.StatusUnauthorized, "Invalid Credentials", err.Error())
+		h.loginFailed(c, p.Email, ip, err)
+		return
+	}
+	if res.MFARequired {
+		// the account counter is only cleared once the second factor passes
+		c.JSON(http.StatusOK, gin.H{"mfa_required": true, "mfa_token": res.MFAToken})
+		return
+	}
+	if err := h.limiter.Succeed(c.Request.Context(), p.Email); err != nil {
+		validation.RespondServerError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"token": res.Token})
+}
+
+// LoginMFA godoc
+// @Summary Complete a two-factor login
+// @Description Exchange the mfa_token from /auth/login and a TOTP or recovery code for a JWT
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Param challenge body models.MFALoginRequest true "MFA challenge"
+// @Success 200 {object} models.LoginResponse
+// @Failure 400 {object} validation.ProblemDetails
+// @Failure 401 {object} validation.ProblemDetails
+// @Failure 429 {object} validation.ProblemDetails
+// @Header 429 {integer} Retry-After "Seconds until the next attempt is allowed"
+// @Router /auth/login/mfa [post]
+func (h *AuthHandler) LoginMFA(c *gin.Context) {
+	var p mfaLoginPayload
+	if err := c.ShouldBindJSON(&p); err != nil {
+		validation.RespondProblem(c, http.StatusBadRequest, "Invalid Request", err.Error())
+		return
+	}
+	ip := c.ClientIP()
+	// wrong codes count against the challenged account, not only the IP, so
+	// rotating addresses does not allow guessing codes
+	account, err := h.svc.ChallengedAccount(c.Request.Context(), p.MFAToken)
+	if err != nil {
+		h.loginFailed(c, "", ip, err)
+		return
+	}
+	if wait, err := h.limiter.Check(c.Request.Context(), account, ip); err != nil {
+		validation.RespondServerError(c, err)
+		return
+	} else if wait > 0 {
+		respondLocked(c, wait)
+		return
+	}
+	token, err := h.svc.CompleteMFALogin(c.Request.Context(), p.MFAToken, p.Code, clientInfo(c))
+	if err != nil {
+		h.loginFailed(c, account, ip, err)
+		return
+	}
+	if err := h.limiter.Succeed(c.Request.Context(), account); err != nil {
+		validation.RespondServerError(c, err)
 		return
 	}
 	c.JSON(http.StatusOK, gin.H{"token": token})
 }
+
+// loginFailed counts rejected credentials against the account and client IP.
+func (h *AuthHandler) loginFailed(c *gin.Context, account, ip string, err error) {
+	if errors.Is(err, service.ErrAccountDisabled) {
+		validation.RespondProblem(c, http.StatusForbidden, "Account Disabled", err.Error())
+		return
+	}
+	if errors.Is(err, service.ErrInvalidChallenge) {
+		validation.RespondProblem(c, http.StatusUnauthorized, "Invalid Credentials", err.Error())
+		return
+	}
+	if !errors.Is(err, service.ErrInvalidCredentials) {
+		validation.RespondServerError(c, err)
+		return
+	}
+	if _, ferr := h.limiter.Fail(c.Request.Context(), account, ip); ferr != nil {
+		validation.RespondServerError(c, ferr)
+		return
+	}
+	validation.RespondProblem(c, http.StatusUnauthorized, "Invalid Credentials", err.Error())
+}
+
+func clientInfo(c *gin.Context) service.ClientInfo {
+	return service.ClientInfo{UserAgent: c.Request.UserAgent(), IP: c.ClientIP()}
+}
+
+func respondLocked(c *gin.Context, wait time.Duration) {
+	secs := int(math.Ceil(wait.Seconds()))
+	c.Header("Retry-After", strconv.Itoa(secs))
+	validation.RespondProblem(c, http.StatusTooManyRequests, "Too Many Attempts",
+		fmt.Sprintf("too many failed login attempts, try again in %d seconds", secs))
+}
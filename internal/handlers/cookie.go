@@ -0,0 +1,43 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// CookieScope is where the login flow cookies live in the browser. It comes from
+// PUBLIC_URL rather than the request, which a proxy may have rewritten.
+type CookieScope struct {
+	Domain string
+	// Path prefixes the route's own path, e.g. /app when the API is served under it.
+	Path   string
+	Secure bool
+}
+
+// NewCookieScope derives the cookie domain, path prefix and Secure flag from the
+// public address of the service.
+func NewCookieScope(publicURL string) (CookieScope, error) {
+	u, err := url.Parse(publicURL)
+	if err != nil {
+		return CookieScope{}, err
+	}
+	if u.Hostname() == "" {
+		return CookieScope{}, fmt.Errorf("public URL %q has no host", publicURL)
+	}
+	return CookieScope{
+		Domain: u.Hostname(),
+		Path:   strings.TrimRight(u.Path, "/"),
+		Secure: u.Scheme == "https",
+	}, nil
+}
+
+// set writes an HTTP-only, SameSite=Lax cookie for the given route path. A
+// negative maxAge deletes it.
+func (s CookieScope) set(c *gin.Context, name, value string, maxAge int, path string) {
+	c.SetSameSite(http.SameSiteLaxMode)
+	c.SetCookie(name, value, maxAge, s.Path+path, s.Domain, s.Secure, true)
+}
@@ -0,0 +1,191 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/ahmadjafari86/go-todo-list/internal/service"
+	"github.com/ahmadjafari86/go-todo-list/internal/validation"
+)
+
+type invitePayload struct {
+	Email       string `json:"email" binding:"required,email"`
+	Role        string `json:"role" binding:"required"`
+	WorkspaceID uint   `json:"workspace_id"`
+	ListID      uint   `json:"list_id"`
+}
+
+type invitationTokenPayload struct {
+	Token string `json:"token" binding:"required"`
+}
+
+type invitationRegisterPayload struct {
+	Token    string `json:"token" binding:"required"`
+	Password string `json:"password" binding:"required"`
+}
+
+type InvitationHandler struct {
+	svc service.InvitationService
+}
+
+func NewInvitationHandler(svc service.InvitationService) *InvitationHandler {
+	return &InvitationHandler{svc: svc}
+}
+
+// Invite godoc
+// @Summary Invite someone by email
+// @Description Email a single-use, expiring invitation to a workspace (role admin, member or viewer) or a list (role view, edit or admin)
+// @Tags invitations
+// @Accept json
+// @Produce json
+// @Param invitation body models.InviteRequest true "Invitation"
+// @Success 201 {object} models.Invitation
+// @Failure 400 {object} validation.ProblemDetails
+// @Failure 403 {object} validation.ProblemDetails
+// @Failure 404 {object} validation.ProblemDetails
+// @Router /api/invitations [post]
+// @Security BearerAuth
+func (h *InvitationHandler) Invite(c *gin.Context) {
+	var p invitePayload
+	if err := c.ShouldBindJSON(&p); err != nil {
+		validation.RespondProblem(c, http.StatusBadRequest, "Invalid Request", err.Error())
+		return
+	}
+	inv, err := h.svc.Invite(c.Request.Context(), getUserIDFromContext(c), service.InviteRequest{
+		Email:       p.Email,
+		Role:        p.Role,
+		WorkspaceID: p.WorkspaceID,
+		ListID:      p.ListID,
+	})
+	if err != nil {
+		respondInvitationError(c, err)
+		return
+	}
+	c.JSON(http.StatusCreated, inv)
+}
+
+// ListInvitations godoc
+// @Summary List pending invitations
+// @Description List the pending invitations sent by the authenticated user
+// @Tags invitations
+// @Produce json
+// @Success 200 {array} models.Invitation
+// @Failure 401 {object} validation.ProblemDetails
+// @Router /api/invitations [get]
+// @Security BearerAuth
+func (h *InvitationHandler) ListInvitations(c *gin.Context) {
+	invs, err := h.svc.ListPending(c.Request.Context(), getUserIDFromContext(c))
+	if err != nil {
+		validation.RespondServerError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, invs)
+}
+
+// RevokeInvitation godoc
+// @Summary Revoke an invitation
+// @Tags invitations
+// @Param id path int true "Invitation ID"
+// @Success 204
+// @Failure 401 {object} validation.ProblemDetails
+// @Failure 404 {object} validation.ProblemDetails
+// @Router /api/invitations/{id} [delete]
+// @Security BearerAuth
+func (h *InvitationHandler) RevokeInvitation(c *gin.Context) {
+	id, _ := strconv.Atoi(c.Param("id"))
+	if err := h.svc.Revoke(c.Request.Context(), uint(id), getUserIDFromContext(c)); err != nil {
+		respondInvitationError(c, err)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// Accept godoc
+// @Summary Accept an invitation
+// @Description Accept an invitation with an existing account. The account's email must match the invited address.
+// @Tags invitations
+// @Accept json
+// @Produce json
+// @Param invitation body models.InvitationTokenRequest true "Invitation token"
+// @Success 200 {object} models.Invitation
+// @Failure 400 {object} validation.ProblemDetails
+// @Failure 403 {object} validation.ProblemDetails
+// @Router /api/invitations/accept [post]
+// @Security BearerAuth
+func (h *InvitationHandler) Accept(c *gin.Context) {
+	var p invitationTokenPayload
+	if err := c.ShouldBindJSON(&p); err != nil {
+		validation.RespondProblem(c, http.StatusBadRequest, "Invalid Request", err.Error())
+		return
+	}
+	inv, err := h.svc.Accept(c.Request.Context(), p.Token, getUserIDFromContext(c))
+	if err != nil {
+		respondInvitationError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, inv)
+}
+
+// AcceptAndRegister godoc
+// @Summary Accept an invitation with a new account
+// @Description Register an account for the invited email address and accept the invitation
+// @Tags invitations
+// @Accept json
+// @Produce json
+// @Param invitation body models.InvitationRegisterRequest true "Invitation token and password"
+// @Success 201 {object} models.UserResponse
+// @Failure 400 {object} validation.ProblemDetails
+// @Router /auth/invitations/accept [post]
+func (h *InvitationHandler) AcceptAndRegister(c *gin.Context) {
+	var p invitationRegisterPayload
+	if err := c.ShouldBindJSON(&p); err != nil {
+		validation.RespondProblem(c, http.StatusBadRequest, "Invalid Request", err.Error())
+		return
+	}
+	u, err := h.svc.AcceptAndRegister(c.Request.Context(), p.Token, p.Password)
+	if err != nil {
+		if respondPasswordRejected(c, err, "password") {
+			return
+		}
+		respondInvitationError(c, err)
+		return
+	}
+	c.JSON(http.StatusCreated, gin.H{"id": u.ID, "email": u.Email})
+}
+
+// Decline godoc
+// @Summary Decline an invitation
+// @Tags invitations
+// @Accept json
+// @Param invitation body models.InvitationTokenRequest true "Invitation token"
+// @Success 204
+// @Failure 400 {object} validation.ProblemDetails
+// @Router /auth/invitations/decline [post]
+func (h *InvitationHandler) Decline(c *gin.Context) {
+	var p invitationTokenPayload
+	if err := c.ShouldBindJSON(&p); err != nil {
+		validation.RespondProblem(c, http.StatusBadRequest, "Invalid Request", err.Error())
+		return
+	}
+	if err := h.svc.Decline(c.Request.Context(), p.Token); err != nil {
+		respondInvitationError(c, err)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+func respondInvitationError(c *gin.Context, err error) {
+	switch {
+	case validation.IsContextError(err):
+		validation.RespondServerError(c, err)
+	case errors.Is(err, service.ErrInvitationNotFound), errors.Is(err, service.ErrWorkspaceNotFound), errors.Is(err, service.ErrListNotFound):
+		validation.RespondProblem(c, http.StatusNotFound, "Not Found", err.Error())
+	case errors.Is(err, service.ErrForbidden), errors.Is(err, service.ErrInvitationMismatch):
+		validation.RespondProblem(c, http.StatusForbidden, "Forbidden", err.Error())
+	default:
+		validation.RespondProblem(c, http.StatusBadRequest, "Invitation Failed", err.Error())
+	}
+}
@@ -0,0 +1,29 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/ahmadjafari86/go-todo-list/internal/service"
+)
+
+type JWKSHandler struct {
+	keys *service.KeySet
+}
+
+func NewJWKSHandler(keys *service.KeySet) *JWKSHandler {
+	return &JWKSHandler{keys: keys}
+}
+
+// JWKS godoc
+// @Summary JSON Web Key Set
+// @Description Public keys for verifying access tokens, selected by the token's kid header
+// @Tags auth
+// @Produce json
+// @Success 200 {object} service.JWKS
+// @Router /.well-known/jwks.json [get]
+func (h *JWKSHandler) JWKS(c *gin.Context) {
+	c.Header("Cache-Control", "public, max-age=300")
+	c.JSON(http.StatusOK, h.keys.JWKS())
+}
@@ -0,0 +1,230 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/ahmadjafari86/go-todo-list/internal/service"
+	"github.com/ahmadjafari86/go-todo-list/internal/validation"
+)
+
+type listPayload struct {
+	Name        string `json:"name" binding:"required"`
+	WorkspaceID uint   `json:"workspace_id"`
+}
+
+type grantPayload struct {
+	UserID     uint   `json:"user_id" binding:"required"`
+	Permission string `json:"permission" binding:"required,oneof=view edit admin"`
+}
+
+type sharePermissionPayload struct {
+	Permission string `json:"permission" binding:"required,oneof=view edit admin"`
+}
+
+type ListHandler struct {
+	svc service.ListService
+}
+
+func NewListHandler(svc service.ListService) *ListHandler {
+	return &ListHandler{svc: svc}
+}
+
+// CreateList godoc
+// @Summary Create a list
+// @Description Create a todo list in the given workspace, or in the caller's personal workspace when none is given
+// @Tags lists
+// @Accept json
+// @Produce json
+// @Param list body models.CreateListRequest true "List"
+// @Success 201 {object} models.TodoList
+// @Failure 400 {object} validation.ProblemDetails
+// @Failure 403 {object} validation.ProblemDetails
+// @Failure 404 {object} validation.ProblemDetails
+// @Router /api/lists [post]
+// @Security BearerAuth
+func (h *ListHandler) CreateList(c *gin.Context) {
+	var p listPayload
+	if err := c.ShouldBindJSON(&p); err != nil {
+		validation.RespondProblem(c, http.StatusBadRequest, "Invalid Request", err.Error())
+		return
+	}
+	list, err := h.svc.CreateList(c.Request.Context(), p.Name, p.WorkspaceID, getUserIDFromContext(c))
+	if err != nil {
+		respondListError(c, err)
+		return
+	}
+	c.JSON(http.StatusCreated, list)
+}
+
+// ListLists godoc
+// @Summary List lists
+// @Description List the todo lists of every workspace the authenticated user belongs to
+// @Tags lists
+// @Produce json
+// @Success 200 {array} models.TodoList
+// @Failure 401 {object} validation.ProblemDetails
+// @Router /api/lists [get]
+// @Security BearerAuth
+func (h *ListHandler) ListLists(c *gin.Context) {
+	lists, err := h.svc.ListLists(c.Request.Context(), getUserIDFromContext(c))
+	if err != nil {
+		validation.RespondServerError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, lists)
+}
+
+// SharedWithMe godoc
+// @Summary Lists shared with me
+// @Description List the todo lists other users shared with the authenticated user, with the granted permission
+// @Tags lists
+// @Produce json
+// @Success 200 {array} models.SharedList
+// @Failure 401 {object} validation.ProblemDetails
+// @Router /api/lists/shared [get]
+// @Security BearerAuth
+func (h *ListHandler) SharedWithMe(c *gin.Context) {
+	lists, err := h.svc.SharedWithMe(c.Request.Context(), getUserIDFromContext(c))
+	if err != nil {
+		validation.RespondServerError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, lists)
+}
+
+// DeleteList godoc
+// @Summary Delete a list
+// @Description Deletes the list and its todos. Requires the workspace owner or admin role, or being the list's creator with write access.
+// @Tags lists
+// @Param id path int true "List ID"
+// @Success 204
+// @Failure 403 {object} validation.ProblemDetails
+// @Failure 404 {object} validation.ProblemDetails
+// @Router /api/lists/{id} [delete]
+// @Security BearerAuth
+func (h *ListHandler) DeleteList(c *gin.Context) {
+	id, _ := strconv.Atoi(c.Param("id"))
+	if err := h.svc.DeleteList(c.Request.Context(), uint(id), getUserIDFromContext(c)); err != nil {
+		respondListError(c, err)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// ListShares godoc
+// @Summary List a list's shares
+// @Description Users with view access only may not list the shares
+// @Tags lists
+// @Produce json
+// @Param id path int true "List ID"
+// @Success 200 {array} models.ListShare
+// @Failure 401 {object} validation.ProblemDetails
+// @Failure 403 {object} validation.ProblemDetails
+// @Failure 404 {object} validation.ProblemDetails
+// @Router /api/lists/{id}/shares [get]
+// @Security BearerAuth
+func (h *ListHandler) ListShares(c *gin.Context) {
+	id, _ := strconv.Atoi(c.Param("id"))
+	shares, err := h.svc.ListShares(c.Request.Context(), uint(id), getUserIDFromContext(c))
+	if err != nil {
+		respondListError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, shares)
+}
+
+// Grant godoc
+// @Summary Share a list
+// @Description Grant a user view, edit or admin permission on a list
+// @Tags lists
+// @Accept json
+// @Produce json
+// @Param id path int true "List ID"
+// @Param share body models.GrantShareRequest true "Share"
+// @Success 201 {object} models.ListShare
+// @Failure 400 {object} validation.ProblemDetails
+// @Failure 403 {object} validation.ProblemDetails
+// @Failure 404 {object} validation.ProblemDetails
+// @Router /api/lists/{id}/shares [post]
+// @Security BearerAuth
+func (h *ListHandler) Grant(c *gin.Context) {
+	var p grantPayload
+	if err := c.ShouldBindJSON(&p); err != nil {
+		validation.RespondProblem(c, http.StatusBadRequest, "Invalid Request", err.Error())
+		return
+	}
+	id, _ := strconv.Atoi(c.Param("id"))
+	share, err := h.svc.Grant(c.Request.Context(), uint(id), getUserIDFromContext(c), p.UserID, p.Permission)
+	if err != nil {
+		respondListError(c, err)
+		return
+	}
+	c.JSON(http.StatusCreated, share)
+}
+
+// ChangeShare godoc
+// @Summary Change a share's permission
+// @Tags lists
+// @Accept json
+// @Param id path int true "List ID"
+// @Param user_id path int true "User ID"
+// @Param share body models.SharePermissionRequest true "Permission"
+// @Success 204
+// @Failure 400 {object} validation.ProblemDetails
+// @Failure 403 {object} validation.ProblemDetails
+// @Failure 404 {object} validation.ProblemDetails
+// @Router /api/lists/{id}/shares/{user_id} [put]
+// @Security BearerAuth
+func (h *ListHandler) ChangeShare(c *gin.Context) {
+	var p sharePermissionPayload
+	if err := c.ShouldBindJSON(&p); err != nil {
+		validation.RespondProblem(c, http.StatusBadRequest, "Invalid Request", err.Error())
+		return
+	}
+	id, _ := strconv.Atoi(c.Param("id"))
+	userID, _ := strconv.Atoi(c.Param("user_id"))
+	if err := h.svc.ChangeShare(c.Request.Context(), uint(id), getUserIDFromContext(c), uint(userID), p.Permission); err != nil {
+		respondListError(c, err)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// Revoke godoc
+// @Summary Revoke a share
+// @Description Users with share rights can revoke anyone's share; any user can remove a list shared with them
+// @Tags lists
+// @Param id path int true "List ID"
+// @Param user_id path int true "User ID"
+// @Success 204
+// @Failure 403 {object} validation.ProblemDetails
+// @Failure 404 {object} validation.ProblemDetails
+// @Router /api/lists/{id}/shares/{user_id} [delete]
+// @Security BearerAuth
+func (h *ListHandler) Revoke(c *gin.Context) {
+	id, _ := strconv.Atoi(c.Param("id"))
+	userID, _ := strconv.Atoi(c.Param("user_id"))
+	if err := h.svc.Revoke(c.Request.Context(), uint(id), getUserIDFromContext(c), uint(userID)); err != nil {
+		respondListError(c, err)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+func respondListError(c *gin.Context, err error) {
+	switch {
+	case validation.IsContextError(err):
+		validation.RespondServerError(c, err)
+	case errors.Is(err, service.ErrListNotFound), errors.Is(err, service.ErrShareNotFound),
+		errors.Is(err, service.ErrWorkspaceNotFound), errors.Is(err, service.ErrUserNotFound):
+		validation.RespondProblem(c, http.StatusNotFound, "Not Found", err.Error())
+	case errors.Is(err, service.ErrForbidden):
+		validation.RespondProblem(c, http.StatusForbidden, "Forbidden", err.Error())
+	default:
+		validation.RespondProblem(c, http.StatusBadRequest, "Request Failed", err.Error())
+	}
+}
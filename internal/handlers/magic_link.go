@@ -0,0 +1,107 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/ahmadjafari86/go-todo-list/internal/service"
+	"github.com/ahmadjafari86/go-todo-list/internal/validation"
+)
+
+const (
+	magicLinkCookie     = "magic_link"
+	magicLinkCookiePath = "/auth/magic-link"
+)
+
+type magicLinkPayload struct {
+	Email string `json:"email" binding:"required,email"`
+}
+
+type MagicLinkHandler struct {
+	svc     service.MagicLinkService
+	cookies CookieScope
+	// cookieMaxAge matches the lifetime of the emailed link, in seconds.
+	cookieMaxAge int
+}
+
+func NewMagicLinkHandler(svc service.MagicLinkService, cookies CookieScope, cookieMaxAge int) *MagicLinkHandler {
+	return &MagicLinkHandler{svc: svc, cookies: cookies, cookieMaxAge: cookieMaxAge}
+}
+
+// Request godoc
+// @Summary Email a login link
+// @Description Sends a one-time login link to the address if it belongs to an account. The link only works
+// @Description in the browser that requested it, which receives a nonce cookie.
+// @Tags auth
+// @Accept json
+// @Param request body models.MagicLinkRequest true "Email"
+// @Success 202
+// @Failure 400 {object} validation.ProblemDetails
+// @Failure 429 {object} validation.ProblemDetails
+// @Header 429 {integer} Retry-After "Seconds until another link can be requested"
+// @Router /auth/magic-link [post]
+func (h *MagicLinkHandler) Request(c *gin.Context) {
+	var p magicLinkPayload
+	if err := c.ShouldBindJSON(&p); err != nil {
+		validation.RespondProblem(c, http.StatusBadRequest, "Invalid Request", err.Error())
+		return
+	}
+	req, err := h.svc.Request(c.Request.Context(), p.Email)
+	if err != nil {
+		validation.RespondServerError(c, err)
+		return
+	}
+	if req.RetryAfter > 0 {
+		secs := int(math.Ceil(req.RetryAfter.Seconds()))
+		c.Header("Retry-After", strconv.Itoa(secs))
+		validation.RespondProblem(c, http.StatusTooManyRequests, "Too Many Requests",
+			fmt.Sprintf("too many login links requested for this address, try again in %d seconds", secs))
+		return
+	}
+	h.cookies.set(c, magicLinkCookie, req.Nonce, h.cookieMaxAge, magicLinkCookiePath)
+	c.Status(http.StatusAccepted)
+}
+
+// Callback godoc
+// @Summary Log in with an emailed link
+// @Description Exchanges the emailed token, together with the browser's nonce cookie, for a JWT
+// @Tags auth
+// @Produce json
+// @Param token query string true "Token from the emailed link"
+// @Success 200 {object} models.LoginResponse
+// @Failure 400 {object} validation.ProblemDetails
+// @Failure 401 {object} validation.ProblemDetails
+// @Failure 403 {object} validation.ProblemDetails
+// @Router /auth/magic-link/callback [get]
+func (h *MagicLinkHandler) Callback(c *gin.Context) {
+	nonce, err := c.Cookie(magicLinkCookie)
+	if err != nil {
+		validation.RespondProblem(c, http.StatusBadRequest, "Invalid Request",
+			"open the link in the browser you requested it from")
+		return
+	}
+	res, err := h.svc.Complete(c.Request.Context(), c.Query("token"), nonce, clientInfo(c))
+	if errors.Is(err, service.ErrAccountDisabled) {
+		validation.RespondProblem(c, http.StatusForbidden, "Account Disabled", err.Error())
+		return
+	}
+	if validation.IsContextError(err) {
+		validation.RespondServerError(c, err)
+		return
+	}
+	if err != nil {
+		validation.RespondProblem(c, http.StatusUnauthorized, "Login Failed", err.Error())
+		return
+	}
+	h.cookies.set(c, magicLinkCookie, "", -1, magicLinkCookiePath)
+	if res.MFARequired {
+		c.JSON(http.StatusOK, gin.H{"mfa_required": true, "mfa_token": res.MFAToken})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"token": res.Token})
+}
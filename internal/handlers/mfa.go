@@ -0,0 +1,139 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/ahmadjafari86/go-todo-list/internal/service"
+	"github.com/ahmadjafari86/go-todo-list/internal/validation"
+)
+
+type mfaCodePayload struct {
+	Code string `json:"code" binding:"required"`
+}
+
+type MFAHandler struct {
+	svc service.MFAService
+}
+
+func NewMFAHandler(svc service.MFAService) *MFAHandler {
+	return &MFAHandler{svc: svc}
+}
+
+// BeginTOTP godoc
+// @Summary Start TOTP enrollment
+// @Description Generate a new TOTP secret. Two-factor authentication is not active until confirmed.
+// @Tags mfa
+// @Produce json
+// @Success 200 {object} models.TOTPEnrollmentResponse
+// @Failure 400 {object} validation.ProblemDetails
+// @Failure 401 {object} validation.ProblemDetails
+// @Router /api/me/mfa/totp [post]
+// @Security BearerAuth
+func (h *MFAHandler) BeginTOTP(c *gin.Context) {
+	userID := getUserIDFromContext(c)
+	if userID == 0 {
+		validation.RespondProblem(c, http.StatusUnauthorized, "Unauthorized", "missing user id")
+		return
+	}
+	secret, uri, err := h.svc.BeginTOTPEnrollment(c.Request.Context(), userID)
+	if err != nil {
+		validation.RespondProblem(c, http.StatusBadRequest, "Enrollment Failed", err.Error())
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"secret": secret, "otpauth_uri": uri})
+}
+
+// ConfirmTOTP godoc
+// @Summary Confirm TOTP enrollment
+// @Description Activate two-factor authentication with a code from the authenticator app. Returns one-time recovery codes.
+// @Tags mfa
+// @Accept json
+// @Produce json
+// @Param code body models.MFACodeRequest true "Verification code"
+// @Success 200 {object} models.RecoveryCodesResponse
+// @Failure 400 {object} validation.ProblemDetails
+// @Failure 401 {object} validation.ProblemDetails
+// @Router /api/me/mfa/totp/confirm [post]
+// @Security BearerAuth
+func (h *MFAHandler) ConfirmTOTP(c *gin.Context) {
+	var p mfaCodePayload
+	if err := c.ShouldBindJSON(&p); err != nil {
+		validation.RespondProblem(c, http.StatusBadRequest, "Invalid Request", err.Error())
+		return
+	}
+	userID := getUserIDFromContext(c)
+	codes, err := h.svc.ConfirmTOTPEnrollment(c.Request.Context(), userID, p.Code)
+	if err != nil {
+		respondMFAError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"recovery_codes": codes})
+}
+
+// DisableTOTP godoc
+// @Summary Disable two-factor authentication
+// @Description Requires a current TOTP code or an unused recovery code
+// @Tags mfa
+// @Accept json
+// @Produce json
+// @Param code body models.MFACodeRequest true "Verification code"
+// @Success 204
+// @Failure 400 {object} validation.ProblemDetails
+// @Failure 401 {object} validation.ProblemDetails
+// @Router /api/me/mfa/totp/disable [post]
+// @Security BearerAuth
+func (h *MFAHandler) DisableTOTP(c *gin.Context) {
+	var p mfaCodePayload
+	if err := c.ShouldBindJSON(&p); err != nil {
+		validation.RespondProblem(c, http.StatusBadRequest, "Invalid Request", err.Error())
+		return
+	}
+	userID := getUserIDFromContext(c)
+	if err := h.svc.DisableTOTP(c.Request.Context(), userID, p.Code); err != nil {
+		respondMFAError(c, err)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// RegenerateRecoveryCodes godoc
+// @Summary Regenerate recovery codes
+// @Description Replace all recovery codes. Requires a current TOTP code or an unused recovery code.
+// @Tags mfa
+// @Accept json
+// @Produce json
+// @Param code body models.MFACodeRequest true "Verification code"
+// @Success 200 {object} models.RecoveryCodesResponse
+// @Failure 400 {object} validation.ProblemDetails
+// @Failure 401 {object} validation.ProblemDetails
+// @Router /api/me/mfa/recovery-codes [post]
+// @Security BearerAuth
+func (h *MFAHandler) RegenerateRecoveryCodes(c *gin.Context) {
+	var p mfaCodePayload
+	if err := c.ShouldBindJSON(&p); err != nil {
+		validation.RespondProblem(c, http.StatusBadRequest, "Invalid Request", err.Error())
+		return
+	}
+	userID := getUserIDFromContext(c)
+	codes, err := h.svc.RegenerateRecoveryCodes(c.Request.Context(), userID, p.Code)
+	if err != nil {
+		respondMFAError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"recovery_codes": codes})
+}
+
+func respondMFAError(c *gin.Context, err error) {
+	if validation.IsContextError(err) {
+		validation.RespondServerError(c, err)
+		return
+	}
+	if errors.Is(err, service.ErrInvalidMFACode) {
+		validation.RespondProblem(c, http.StatusUnauthorized, "Invalid Code", err.Error())
+		return
+	}
+	validation.RespondProblem(c, http.StatusBadRequest, "Two-Factor Error", err.Error())
+}
@@ -0,0 +1,286 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/ahmadjafari86/go-todo-list/internal/service"
+	"github.com/ahmadjafari86/go-todo-list/internal/validation"
+)
+
+type registerClientPayload struct {
+	Name         string   `json:"name" binding:"required,max=100"`
+	RedirectURIs []string `json:"redirect_uris" binding:"required,min=1,dive,uri"`
+	Scopes       []string `json:"scopes" binding:"required,min=1,dive,oneof=todos:read todos:write"`
+	Confidential bool     `json:"confidential"`
+}
+
+type authorizePayload struct {
+	ResponseType        string `json:"response_type" form:"response_type" binding:"required"`
+	ClientID            string `json:"client_id" form:"client_id" binding:"required"`
+	RedirectURI         string `json:"redirect_uri" form:"redirect_uri" binding:"required"`
+	Scope               string `json:"scope" form:"scope"`
+	State               string `json:"state" form:"state"`
+	CodeChallenge       string `json:"code_challenge" form:"code_challenge"`
+	CodeChallengeMethod string `json:"code_challenge_method" form:"code_challenge_method"`
+	Approve             bool   `json:"approve" form:"-"`
+}
+
+func (p authorizePayload) request() service.AuthorizationRequest {
+	return service.AuthorizationRequest{
+		ResponseType:        p.ResponseType,
+		ClientID:            p.ClientID,
+		RedirectURI:         p.RedirectURI,
+		Scope:               p.Scope,
+		State:               p.State,
+		CodeChallenge:       p.CodeChallenge,
+		CodeChallengeMethod: p.CodeChallengeMethod,
+	}
+}
+
+type OAuthHandler struct {
+	svc service.OAuthService
+}
+
+func NewOAuthHandler(svc service.OAuthService) *OAuthHandler {
+	return &OAuthHandler{svc: svc}
+}
+
+// RegisterClient godoc
+// @Summary Register an OAuth client
+// @Description Register a third-party application. Confidential clients receive a client_secret, shown only once.
+// @Tags oauth
+// @Accept json
+// @Produce json
+// @Param client body models.RegisterClientRequest true "Client"
+// @Success 201 {object} models.RegisterClientResponse
+// @Failure 400 {object} validation.ProblemDetails
+// @Failure 401 {object} validation.ProblemDetails
+// @Router /api/oauth/clients [post]
+// @Security BearerAuth
+func (h *OAuthHandler) RegisterClient(c *gin.Context) {
+	var p registerClientPayload
+	if err := c.ShouldBindJSON(&p); err != nil {
+		validation.RespondFieldProblem(c, http.StatusBadRequest, "Invalid Request", err.Error(), validation.FieldErrors(err))
+		return
+	}
+	secret, client, err := h.svc.RegisterClient(c.Request.Context(), getUserIDFromContext(c), p.Name, p.RedirectURIs, p.Scopes, p.Confidential)
+	if validation.IsContextError(err) {
+		validation.RespondServerError(c, err)
+		return
+	}
+	if err != nil {
+		validation.RespondProblem(c, http.StatusBadRequest, "Registration Failed", err.Error())
+		return
+	}
+	body := gin.H{"client": client}
+	if secret != "" {
+		body["client_secret"] = secret
+	}
+	c.JSON(http.StatusCreated, body)
+}
+
+// ListClients godoc
+// @Summary List my OAuth clients
+// @Tags oauth
+// @Produce json
+// @Success 200 {array} models.OAuthClient
+// @Failure 401 {object} validation.ProblemDetails
+// @Router /api/oauth/clients [get]
+// @Security BearerAuth
+func (h *OAuthHandler) ListClients(c *gin.Context) {
+	clients, err := h.svc.ListClients(c.Request.Context(), getUserIDFromContext(c))
+	if err != nil {
+		validation.RespondServerError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, clients)
+}
+
+// DeleteClient godoc
+// @Summary Delete an OAuth client
+// @Description Delete one of my clients; every token issued to it stops working
+// @Tags oauth
+// @Param id path int true "Client ID"
+// @Success 204
+// @Failure 401 {object} validation.ProblemDetails
+// @Failure 404 {object} validation.ProblemDetails
+// @Router /api/oauth/clients/{id} [delete]
+// @Security BearerAuth
+func (h *OAuthHandler) DeleteClient(c *gin.Context) {
+	id, _ := strconv.Atoi(c.Param("id"))
+	if err := h.svc.DeleteClient(c.Request.Context(), uint(id), getUserIDFromContext(c)); err != nil {
+		respondOAuthError(c, err)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// AuthorizePrompt godoc
+// @Summary Describe an authorization request
+// @Description Validate the parameters of an authorization request and return what the consent screen should show.
+// @Description The web client calls this for the signed-in user before asking for consent.
+// @Tags oauth
+// @Produce json
+// @Param response_type query string true "Must be code"
+// @Param client_id query string true "Client ID"
+// @Param redirect_uri query string true "Registered redirect URI"
+// @Param scope query string false "Space separated scopes; defaults to the client's scopes"
+// @Param state query string false "Opaque value returned to the client"
+// @Param code_challenge query string true "PKCE challenge"
+// @Param code_challenge_method query string true "Must be S256"
+// @Success 200 {object} models.ConsentResponse
+// @Failure 400 {object} validation.ProblemDetails
+// @Failure 401 {object} validation.ProblemDetails
+// @Router /api/oauth/authorize [get]
+// @Security BearerAuth
+func (h *OAuthHandler) AuthorizePrompt(c *gin.Context) {
+	var p authorizePayload
+	if err := c.ShouldBindQuery(&p); err != nil {
+		validation.RespondFieldProblem(c, http.StatusBadRequest, "Invalid Request", err.Error(), validation.FieldErrors(err))
+		return
+	}
+	prompt, err := h.svc.PrepareAuthorization(c.Request.Context(), getUserIDFromContext(c), p.request())
+	if err != nil {
+		respondOAuthError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"client":     gin.H{"client_id": prompt.Client.ClientID, "name": prompt.Client.Name},
+		"scopes":     prompt.Scopes,
+		"authorized": prompt.Authorized,
+	})
+}
+
+// Authorize godoc
+// @Summary Approve or deny an authorization request
+// @Description Record the signed-in user's decision. The response names the URL to send the browser to,
+// @Description carrying an authorization code or an error for the client.
+// @Tags oauth
+// @Accept json
+// @Produce json
+// @Param decision body models.AuthorizeRequest true "Authorization request and decision"
+// @Success 200 {object} models.AuthorizeResponse
+// @Failure 400 {object} validation.ProblemDetails
+// @Failure 401 {object} validation.ProblemDetails
+// @Router /api/oauth/authorize [post]
+// @Security BearerAuth
+func (h *OAuthHandler) Authorize(c *gin.Context) {
+	var p authorizePayload
+	if err := c.ShouldBindJSON(&p); err != nil {
+		validation.RespondFieldProblem(c, http.StatusBadRequest, "Invalid Request", err.Error(), validation.FieldErrors(err))
+		return
+	}
+	redirect, err := h.svc.Authorize(c.Request.Context(), getUserIDFromContext(c), p.request(), p.Approve)
+	if err != nil {
+		respondOAuthError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"redirect_to": redirect})
+}
+
+// Token godoc
+// @Summary OAuth token endpoint
+// @Description Exchange an authorization code (with its PKCE verifier) or a refresh token for tokens.
+// @Description Confidential clients authenticate with HTTP Basic or client_secret. Errors follow RFC 6749.
+// @Tags oauth
+// @Accept x-www-form-urlencoded
+// @Produce json
+// @Param grant_type formData string true "authorization_code or refresh_token"
+// @Param code formData string false "Authorization code"
+// @Param redirect_uri formData string false "Redirect URI used for the code"
+// @Param code_verifier formData string false "PKCE verifier"
+// @Param refresh_token formData string false "Refresh token"
+// @Param client_id formData string false "Client ID, unless sent with HTTP Basic"
+// @Param client_secret formData string false "Client secret, unless sent with HTTP Basic"
+// @Success 200 {object} models.OAuthTokenResponse
+// @Failure 400 {object} models.OAuthErrorResponse
+// @Failure 401 {object} models.OAuthErrorResponse
+// @Router /oauth/token [post]
+func (h *OAuthHandler) Token(c *gin.Context) {
+	req := service.TokenRequest{
+		GrantType:    c.PostForm("grant_type"),
+		Code:         c.PostForm("code"),
+		RedirectURI:  c.PostForm("redirect_uri"),
+		CodeVerifier: c.PostForm("code_verifier"),
+		RefreshToken: c.PostForm("refresh_token"),
+		ClientID:     c.PostForm("client_id"),
+		ClientSecret: c.PostForm("client_secret"),
+	}
+	if id, secret, ok := c.Request.BasicAuth(); ok {
+		req.ClientID, req.ClientSecret = id, secret
+	}
+	c.Header("Cache-Control", "no-store")
+	res, err := h.svc.Token(c.Request.Context(), req)
+	var oerr *service.OAuthError
+	switch {
+	case err == nil:
+		c.JSON(http.StatusOK, res)
+	case errors.As(err, &oerr):
+		status := http.StatusBadRequest
+		if oerr.Code == "invalid_client" {
+			status = http.StatusUnauthorized
+			c.Header("WWW-Authenticate", `Basic realm="oauth"`)
+		}
+		c.JSON(status, gin.H{"error": oerr.Code, "error_description": oerr.Description})
+	case validation.IsContextError(err):
+		// RFC 6749 has no timeout code; temporarily_unavailable tells the client to retry
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "temporarily_unavailable", "error_description": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "server_error", "error_description": err.Error()})
+	}
+}
+
+// ListAuthorizedApps godoc
+// @Summary List authorized apps
+// @Description List the OAuth clients the authenticated user has granted access
+// @Tags oauth
+// @Produce json
+// @Success 200 {array} models.AuthorizedApp
+// @Failure 401 {object} validation.ProblemDetails
+// @Router /api/me/authorized-apps [get]
+// @Security BearerAuth
+func (h *OAuthHandler) ListAuthorizedApps(c *gin.Context) {
+	apps, err := h.svc.ListAuthorizedApps(c.Request.Context(), getUserIDFromContext(c))
+	if err != nil {
+		validation.RespondServerError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, apps)
+}
+
+// RevokeAuthorizedApp godoc
+// @Summary Revoke an authorized app
+// @Description Withdraw an app's access; its access and refresh tokens stop working immediately
+// @Tags oauth
+// @Param id path int true "Authorized app ID"
+// @Success 204
+// @Failure 401 {object} validation.ProblemDetails
+// @Failure 404 {object} validation.ProblemDetails
+// @Router /api/me/authorized-apps/{id} [delete]
+// @Security BearerAuth
+func (h *OAuthHandler) RevokeAuthorizedApp(c *gin.Context) {
+	id, _ := strconv.Atoi(c.Param("id"))
+	if err := h.svc.RevokeAuthorizedApp(c.Request.Context(), uint(id), getUserIDFromContext(c)); err != nil {
+		respondOAuthError(c, err)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+func respondOAuthError(c *gin.Context, err error) {
+	var oerr *service.OAuthError
+	switch {
+	case errors.As(err, &oerr):
+		validation.RespondProblem(c, http.StatusBadRequest, "Invalid Authorization Request", oerr.Error())
+	case errors.Is(err, service.ErrOAuthClientNotFound), errors.Is(err, service.ErrAuthorizedAppNotFound):
+		validation.RespondProblem(c, http.StatusNotFound, "Not Found", err.Error())
+	case errors.Is(err, service.ErrOAuthRedirectURI):
+		validation.RespondProblem(c, http.StatusBadRequest, "Invalid Authorization Request", err.Error())
+	default:
+		validation.RespondServerError(c, err)
+	}
+}
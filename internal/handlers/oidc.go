@@ -0,0 +1,125 @@
+package handlers
+
+import (
+	"crypto/subtle"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/ahmadjafari86/go-todo-list/internal/service"
+	"github.com/ahmadjafari86/go-todo-list/internal/validation"
+)
+
+const (
+	oidcCookie       = "oidc_flow"
+	oidcCookieMaxAge = 600
+)
+
+type OIDCHandler struct {
+	svc     service.OIDCService
+	cookies CookieScope
+}
+
+func NewOIDCHandler(svc service.OIDCService, cookies CookieScope) *OIDCHandler {
+	return &OIDCHandler{svc: svc, cookies: cookies}
+}
+
+// ListProviders godoc
+// @Summary List identity providers
+// @Description Names of the configured OpenID Connect providers
+// @Tags auth
+// @Produce json
+// @Success 200 {object} models.OIDCProvidersResponse
+// @Router /auth/oidc [get]
+func (h *OIDCHandler) ListProviders(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"providers": h.svc.Providers()})
+}
+
+// Login godoc
+// @Summary Start an OpenID Connect login
+// @Description Redirects to the provider's authorization endpoint (authorization code flow with PKCE)
+// @Tags auth
+// @Param provider path string true "Provider name"
+// @Success 302
+// @Failure 404 {object} validation.ProblemDetails
+// @Failure 502 {object} validation.ProblemDetails
+// @Router /auth/oidc/{provider}/login [get]
+func (h *OIDCHandler) Login(c *gin.Context) {
+	provider := c.Param("provider")
+	req, err := h.svc.Begin(c.Request.Context(), provider)
+	if errors.Is(err, service.ErrUnknownProvider) {
+		validation.RespondProblem(c, http.StatusNotFound, "Not Found", err.Error())
+		return
+	}
+	if validation.IsContextError(err) {
+		validation.RespondServerError(c, err)
+		return
+	}
+	if err != nil {
+		validation.RespondProblem(c, http.StatusBadGateway, "Provider Unavailable", err.Error())
+		return
+	}
+	h.cookies.set(c, oidcCookie, strings.Join([]string{req.State, req.Nonce, req.Verifier}, "."),
+		oidcCookieMaxAge, "/auth/oidc/"+provider)
+	c.Redirect(http.StatusFound, req.URL)
+}
+
+// Callback godoc
+// @Summary Finish an OpenID Connect login
+// @Description Redeems the authorization code and returns the API's own JWT. The provider account
+// @Description is linked to an existing user with the same verified email, or a new user is created.
+// @Tags auth
+// @Produce json
+// @Param provider path string true "Provider name"
+// @Param code query string true "Authorization code"
+// @Param state query string true "State"
+// @Success 200 {object} models.LoginResponse
+// @Failure 400 {object} validation.ProblemDetails
+// @Failure 401 {object} validation.ProblemDetails
+// @Failure 404 {object} validation.ProblemDetails
+// @Router /auth/oidc/{provider}/callback [get]
+func (h *OIDCHandler) Callback(c *gin.Context) {
+	provider := c.Param("provider")
+	if e := c.Query("error"); e != "" {
+		validation.RespondProblem(c, http.StatusUnauthorized, "Login Failed", e+": "+c.Query("error_description"))
+		return
+	}
+	raw, err := c.Cookie(oidcCookie)
+	parts := strings.Split(raw, ".")
+	if err != nil || len(parts) != 3 {
+		validation.RespondProblem(c, http.StatusBadRequest, "Invalid Request", "login session expired or missing")
+		return
+	}
+	// the flow cookie is single use
+	h.cookies.set(c, oidcCookie, "", -1, "/auth/oidc/"+provider)
+	if subtle.ConstantTimeCompare([]byte(parts[0]), []byte(c.Query("state"))) != 1 {
+		validation.RespondProblem(c, http.StatusBadRequest, "Invalid Request", "state mismatch")
+		return
+	}
+	code := c.Query("code")
+	if code == "" {
+		validation.RespondProblem(c, http.StatusBadRequest, "Invalid Request", "missing code")
+		return
+	}
+
+	res, err := h.svc.Complete(c.Request.Context(), provider, code, parts[2], parts[1], clientInfo(c))
+	if errors.Is(err, service.ErrUnknownProvider) {
+		validation.RespondProblem(c, http.StatusNotFound, "Not Found", err.Error())
+		return
+	}
+	if validation.IsContextError(err) {
+		validation.RespondServerError(c, err)
+		return
+	}
+	if err != nil {
+		validation.RespondProblem(c, http.StatusUnauthorized, "Login Failed", err.Error())
+		return
+	}
+	if res.MFARequired {
+		c.JSON(http.StatusOK, gin.H{"mfa_required": true, "mfa_token": res.MFAToken})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"token": res.Token})
+}
@@ -0,0 +1,142 @@
+package handlers
+
+import (
+	"errors"
+	"math"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/ahmadjafari86/go-todo-list/internal/service"
+	"github.com/ahmadjafari86/go-todo-list/internal/validation"
+)
+
+type forgotPasswordPayload struct {
+	Email string `json:"email" binding:"required,email"`
+}
+
+type resetPasswordPayload struct {
+	Token    string `json:"token" binding:"required"`
+	Password string `json:"password" binding:"required"`
+}
+
+type changePasswordPayload struct {
+	CurrentPassword string `json:"current_password" binding:"required"`
+	NewPassword     string `json:"new_password" binding:"required"`
+}
+
+type PasswordHandler struct {
+	svc service.PasswordService
+}
+
+func NewPasswordHandler(svc service.PasswordService) *PasswordHandler {
+	return &PasswordHandler{svc: svc}
+}
+
+// Forgot godoc
+// @Summary Email a password reset link
+// @Description Sends a one-time reset link to the address if it belongs to an account
+// @Tags auth
+// @Accept json
+// @Param request body models.ForgotPasswordRequest true "Email"
+// @Success 202
+// @Failure 400 {object} validation.ProblemDetails
+// @Failure 429 {object} validation.ProblemDetails
+// @Header 429 {integer} Retry-After "Seconds until another link can be requested"
+// @Router /auth/password/forgot [post]
+func (h *PasswordHandler) Forgot(c *gin.Context) {
+	var p forgotPasswordPayload
+	if err := c.ShouldBindJSON(&p); err != nil {
+		validation.RespondFieldProblem(c, http.StatusBadRequest, "Invalid Request", err.Error(), validation.FieldErrors(err))
+		return
+	}
+	wait, err := h.svc.RequestReset(c.Request.Context(), p.Email)
+	if err != nil {
+		validation.RespondServerError(c, err)
+		return
+	}
+	if wait > 0 {
+		c.Header("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+		validation.RespondProblem(c, http.StatusTooManyRequests, "Too Many Requests", "too many reset links requested for this address")
+		return
+	}
+	c.Status(http.StatusAccepted)
+}
+
+// Reset godoc
+// @Summary Reset a password
+// @Description Set a new password with the token from a reset email. All sessions are signed out.
+// @Tags auth
+// @Accept json
+// @Param request body models.ResetPasswordRequest true "Token and new password"
+// @Success 204
+// @Failure 400 {object} validation.ProblemDetails
+// @Router /auth/password/reset [post]
+func (h *PasswordHandler) Reset(c *gin.Context) {
+	var p resetPasswordPayload
+	if err := c.ShouldBindJSON(&p); err != nil {
+		validation.RespondFieldProblem(c, http.StatusBadRequest, "Invalid Request", err.Error(), validation.FieldErrors(err))
+		return
+	}
+	if err := h.svc.ResetPassword(c.Request.Context(), p.Token, p.Password); err != nil {
+		if respondPasswordRejected(c, err, "password") {
+			return
+		}
+		if errors.Is(err, service.ErrPasswordResetInvalid) {
+			validation.RespondFieldProblem(c, http.StatusBadRequest, "Reset Failed", err.Error(),
+				[]validation.FieldError{{Field: "token", Message: err.Error()}})
+			return
+		}
+		validation.RespondServerError(c, err)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// Change godoc
+// @Summary Change my password
+// @Description Set a new password after checking the current one. Every other session is signed out.
+// @Tags account
+// @Accept json
+// @Param request body models.ChangePasswordRequest true "Current and new password"
+// @Success 204
+// @Failure 400 {object} validation.ProblemDetails
+// @Failure 401 {object} validation.ProblemDetails
+// @Failure 403 {object} validation.ProblemDetails
+// @Router /api/me/password [post]
+// @Security BearerAuth
+func (h *PasswordHandler) Change(c *gin.Context) {
+	var p changePasswordPayload
+	if err := c.ShouldBindJSON(&p); err != nil {
+		validation.RespondFieldProblem(c, http.StatusBadRequest, "Invalid Request", err.Error(), validation.FieldErrors(err))
+		return
+	}
+	session, _ := strconv.Atoi(c.GetString("session_id"))
+	err := h.svc.ChangePassword(c.Request.Context(), getUserIDFromContext(c), uint(session), p.CurrentPassword, p.NewPassword)
+	switch {
+	case err == nil:
+		c.Status(http.StatusNoContent)
+	case respondPasswordRejected(c, err, "new_password"):
+	case errors.Is(err, service.ErrInvalidCredentials):
+		validation.RespondFieldProblem(c, http.StatusForbidden, "Forbidden", "password is incorrect",
+			[]validation.FieldError{{Field: "current_password", Message: "is incorrect"}})
+	default:
+		respondAccountError(c, err)
+	}
+}
+
+// respondPasswordRejected reports a password policy violation against field.
+// It returns false for other errors.
+func respondPasswordRejected(c *gin.Context, err error, field string) bool {
+	var policyErr *service.PasswordPolicyError
+	if !errors.As(err, &policyErr) {
+		return false
+	}
+	fields := make([]validation.FieldError, 0, len(policyErr.Violations))
+	for _, v := range policyErr.Violations {
+		fields = append(fields, validation.FieldError{Field: field, Message: v})
+	}
+	validation.RespondFieldProblem(c, http.StatusBadRequest, "Password Rejected", policyErr.Error(), fields)
+	return true
+}
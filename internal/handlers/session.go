@@ -0,0 +1,62 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/ahmadjafari86/go-todo-list/internal/service"
+	"github.com/ahmadjafari86/go-todo-list/internal/validation"
+)
+
+type SessionHandler struct {
+	svc service.SessionService
+}
+
+func NewSessionHandler(svc service.SessionService) *SessionHandler {
+	return &SessionHandler{svc: svc}
+}
+
+// ListSessions godoc
+// @Summary List active sessions
+// @Description List the devices the authenticated user is logged in on. The session of the calling token is marked current.
+// @Tags sessions
+// @Produce json
+// @Success 200 {array} models.Session
+// @Failure 401 {object} validation.ProblemDetails
+// @Router /api/me/sessions [get]
+// @Security BearerAuth
+func (h *SessionHandler) ListSessions(c *gin.Context) {
+	current, _ := strconv.Atoi(c.GetString("session_id"))
+	sessions, err := h.svc.ListSessions(c.Request.Context(), getUserIDFromContext(c), uint(current))
+	if err != nil {
+		validation.RespondServerError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, sessions)
+}
+
+// RevokeSession godoc
+// @Summary Sign out a session
+// @Description Revoke a session; tokens issued for it stop working immediately
+// @Tags sessions
+// @Param id path int true "Session ID"
+// @Success 204
+// @Failure 401 {object} validation.ProblemDetails
+// @Failure 404 {object} validation.ProblemDetails
+// @Router /api/me/sessions/{id} [delete]
+// @Security BearerAuth
+func (h *SessionHandler) RevokeSession(c *gin.Context) {
+	id, _ := strconv.Atoi(c.Param("id"))
+	if err := h.svc.RevokeSession(c.Request.Context(), uint(id), getUserIDFromContext(c)); err != nil {
+		if errors.Is(err, service.ErrSessionNotFound) {
+			validation.RespondProblem(c, http.StatusNotFound, "Not Found", err.Error())
+			return
+		}
+		validation.RespondServerError(c, err)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
@@ -1,15 +1,26 @@
 package handlers
 
 import (
+	"errors"
 	"net/http"
 	"strconv"
 
 	"github.com/ahmadjafari86/go-todo-list/internal/models"
+	"github.com/ahmadjafari86/go-todo-list/internal/repository"
 	"github.com/ahmadjafari86/go-todo-list/internal/service"
 	"github.com/ahmadjafari86/go-todo-list/internal/validation"
 	"github.com/gin-gonic/gin"
 )
 
+// createTodoPayload lists what a client may set on a new todo; the id, owner and
+// trash state are the server's.
+type createTodoPayload struct {
+	Title       string `json:"title" binding:"required"`
+	Completed   bool   `json:"completed"`
+	WorkspaceID uint   `json:"workspace_id"`
+	ListID      uint   `json:"list_id"`
+}
+
 type TodoHandler struct {
 	svc service.TodoService
 }
@@ -20,7 +31,7 @@ func NewTodoHandler(svc service.TodoService) *TodoHandler {
 
 // CreateTodo godoc
 // @Summary Create a todo
-// @Description Create a new todo for the authenticated user
+// @Description Create a new todo in the given list or workspace, or in the caller's personal workspace when neither is given
 // @Tags todos
 // @Accept json
 // @Produce json
@@ -28,10 +39,12 @@ func NewTodoHandler(svc service.TodoService) *TodoHandler {
 // @Success 201 {object} models.Todo
 // @Failure 400 {object} validation.ProblemDetails
 // @Failure 401 {object} validation.ProblemDetails
+// @Failure 403 {object} validation.ProblemDetails
+// @Failure 404 {object} validation.ProblemDetails
 // @Router /api/todos [post]
 // @Security BearerAuth
 func (h *TodoHandler) CreateTodo(c *gin.Context) {
-	var payload models.Todo
+	var payload createTodoPayload
 	if err := c.ShouldBindJSON(&payload); err != nil {
 		validation.RespondProblem(c, http.StatusBadRequest, "Invalid Request", err.Error())
 		return
@@ -41,18 +54,21 @@ func (h *TodoHandler) CreateTodo(c *gin.Context) {
 		validation.RespondProblem(c, http.StatusUnauthorized, "Unauthorized", "missing user id")
 		return
 	}
-	if err := h.svc.CreateTodo(&payload, ownerID); err != nil {
-		validation.RespondProblem(c, http.StatusBadRequest, "Create Failed", err.Error())
+	todo := models.Todo{Title: payload.Title, Completed: payload.Completed, WorkspaceID: payload.WorkspaceID, ListID: payload.ListID}
+	if err := h.svc.CreateTodo(c.Request.Context(), &todo, ownerID); err != nil {
+		respondTodoError(c, "Create Failed", err)
 		return
 	}
-	c.JSON(http.StatusCreated, payload)
+	c.JSON(http.StatusCreated, todo)
 }
 
 // ListTodos godoc
 // @Summary List todos
-// @Description Get all todos for the authenticated user
+// @Description Get the todos of every workspace the authenticated user belongs to and of every list shared with them
 // @Tags todos
 // @Produce json
+// @Param workspace_id query int false "Only todos of this workspace"
+// @Param list_id query int false "Only todos of this list"
 // @Success 200 {array} models.Todo
 // @Failure 401 {object} validation.ProblemDetails
 // @Router /api/todos [get]
@@ -63,9 +79,11 @@ func (h *TodoHandler) ListTodos(c *gin.Context) {
 		validation.RespondProblem(c, http.StatusUnauthorized, "Unauthorized", "missing user id")
 		return
 	}
-	todos, err := h.svc.ListTodos(ownerID)
+	wsID, _ := strconv.Atoi(c.Query("workspace_id"))
+	listID, _ := strconv.Atoi(c.Query("list_id"))
+	todos, err := h.svc.ListTodos(c.Request.Context(), ownerID, repository.TodoFilter{WorkspaceID: uint(wsID), ListID: uint(listID)})
 	if err != nil {
-		validation.RespondProblem(c, http.StatusInternalServerError, "Server Error", err.Error())
+		validation.RespondServerError(c, err)
 		return
 	}
 	c.JSON(http.StatusOK, todos)
@@ -73,7 +91,7 @@ func (h *TodoHandler) ListTodos(c *gin.Context) {
 
 // GetTodo godoc
 // @Summary Get a todo
-// @Description Get a todo by ID (must belong to the authenticated user)
+// @Description Get a todo by ID (must be in one of the authenticated user's workspaces or a list shared with them)
 // @Tags todos
 // @Produce json
 // @Param id path int true "Todo ID"
@@ -85,9 +103,9 @@ func (h *TodoHandler) ListTodos(c *gin.Context) {
 func (h *TodoHandler) GetTodo(c *gin.Context) {
 	id, _ := strconv.Atoi(c.Param("id"))
 	ownerID := getUserIDFromContext(c)
-	todo, err := h.svc.GetTodo(uint(id), ownerID)
-	if err != nil || todo == nil {
-		validation.RespondProblem(c, http.StatusNotFound, "Not Found", "todo not found")
+	todo, err := h.svc.GetTodo(c.Request.Context(), uint(id), ownerID)
+	if err != nil {
+		respondTodoError(c, "Request Failed", err)
 		return
 	}
 	c.JSON(http.StatusOK, todo)
@@ -95,7 +113,7 @@ func (h *TodoHandler) GetTodo(c *gin.Context) {
 
 // UpdateTodo godoc
 // @Summary Update a todo
-// @Description Update an existing todo (must belong to the authenticated user)
+// @Description Update an existing todo (requires a member, admin or owner role in its workspace, or edit permission on its shared list)
 // @Tags todos
 // @Accept json
 // @Produce json
@@ -104,6 +122,7 @@ func (h *TodoHandler) GetTodo(c *gin.Context) {
 // @Success 200 {object} models.Todo
 // @Failure 400 {object} validation.ProblemDetails
 // @Failure 401 {object} validation.ProblemDetails
+// @Failure 403 {object} validation.ProblemDetails
 // @Failure 404 {object} validation.ProblemDetails
 // @Router /api/todos/{id} [put]
 // @Security BearerAuth
@@ -116,8 +135,8 @@ func (h *TodoHandler) UpdateTodo(c *gin.Context) {
 	}
 	payload.ID = uint(id)
 	ownerID := getUserIDFromContext(c)
-	if err := h.svc.UpdateTodo(&payload, ownerID); err != nil {
-		validation.RespondProblem(c, http.StatusBadRequest, "Update Failed", err.Error())
+	if err := h.svc.UpdateTodo(c.Request.Context(), &payload, ownerID); err != nil {
+		respondTodoError(c, "Update Failed", err)
 		return
 	}
 	c.JSON(http.StatusOK, payload)
@@ -131,15 +150,16 @@ func (h *TodoHandler) UpdateTodo(c *gin.Context) {
 // @Param id path int true "Todo ID"
 // @Success 200 {object} models.Todo
 // @Failure 401 {object} validation.ProblemDetails
+// @Failure 403 {object} validation.ProblemDetails
 // @Failure 404 {object} validation.ProblemDetails
 // @Router /api/todos/{id}/complete [patch]
 // @Security BearerAuth
 func (h *TodoHandler) ToggleComplete(c *gin.Context) {
 	id, _ := strconv.Atoi(c.Param("id"))
 	ownerID := getUserIDFromContext(c)
-	todo, err := h.svc.ToggleComplete(uint(id), ownerID)
-	if err != nil || todo == nil {
-		validation.RespondProblem(c, http.StatusNotFound, "Not Found", "todo not found")
+	todo, err := h.svc.ToggleComplete(c.Request.Context(), uint(id), ownerID)
+	if err != nil {
+		respondTodoError(c, "Update Failed", err)
 		return
 	}
 	c.JSON(http.StatusOK, todo)
@@ -147,25 +167,146 @@ func (h *TodoHandler) ToggleComplete(c *gin.Context) {
 
 // DeleteTodo godoc
 // @Summary Delete a todo
-// @Description Delete a todo (must belong to the authenticated user)
+// @Description Move a todo to the trash (requires a member, admin or owner role in its workspace, or edit permission on its shared list).
+// @Description It can be restored until the trash is emptied or the retention period passes.
 // @Tags todos
 // @Produce json
 // @Param id path int true "Todo ID"
 // @Success 204
 // @Failure 401 {object} validation.ProblemDetails
+// @Failure 403 {object} validation.ProblemDetails
 // @Failure 404 {object} validation.ProblemDetails
 // @Router /api/todos/{id} [delete]
 // @Security BearerAuth
 func (h *TodoHandler) DeleteTodo(c *gin.Context) {
 	id, _ := strconv.Atoi(c.Param("id"))
 	ownerID := getUserIDFromContext(c)
-	if err := h.svc.DeleteTodo(uint(id), ownerID); err != nil {
-		validation.RespondProblem(c, http.StatusNotFound, "Not Found", "todo not found")
+	if err := h.svc.DeleteTodo(c.Request.Context(), uint(id), ownerID); err != nil {
+		respondTodoError(c, "Delete Failed", err)
 		return
 	}
 	c.Status(http.StatusNoContent)
 }
 
+// History godoc
+// @Summary Get the history of a todo
+// @Description List every change to a todo, oldest first: who made it, when, and the before and after value of each changed field
+// @Tags todos
+// @Produce json
+// @Param id path int true "Todo ID"
+// @Success 200 {array} models.TodoRevision
+// @Failure 401 {object} validation.ProblemDetails
+// @Failure 404 {object} validation.ProblemDetails
+// @Router /api/todos/{id}/history [get]
+// @Security BearerAuth
+func (h *TodoHandler) History(c *gin.Context) {
+	id, _ := strconv.Atoi(c.Param("id"))
+	revs, err := h.svc.History(c.Request.Context(), uint(id), getUserIDFromContext(c))
+	if err != nil {
+		respondTodoError(c, "History Failed", err)
+		return
+	}
+	c.JSON(http.StatusOK, revs)
+}
+
+// RevertTodo godoc
+// @Summary Revert a todo
+// @Description Set the title and completion of a todo back to their values right after the given revision (requires the same access as updating it).
+// @Description The revert is recorded as a new revision.
+// @Tags todos
+// @Produce json
+// @Param id path int true "Todo ID"
+// @Param rev path int true "Revision number"
+// @Success 200 {object} models.Todo
+// @Failure 401 {object} validation.ProblemDetails
+// @Failure 403 {object} validation.ProblemDetails
+// @Failure 404 {object} validation.ProblemDetails
+// @Router /api/todos/{id}/revert/{rev} [post]
+// @Security BearerAuth
+func (h *TodoHandler) RevertTodo(c *gin.Context) {
+	id, _ := strconv.Atoi(c.Param("id"))
+	rev, _ := strconv.Atoi(c.Param("rev"))
+	todo, err := h.svc.RevertTodo(c.Request.Context(), uint(id), uint(rev), getUserIDFromContext(c))
+	if err != nil {
+		respondTodoError(c, "Revert Failed", err)
+		return
+	}
+	c.JSON(http.StatusOK, todo)
+}
+
+// ListTrash godoc
+// @Summary List the trash
+// @Description List deleted todos the user can read, most recently deleted first
+// @Tags trash
+// @Produce json
+// @Success 200 {array} models.Todo
+// @Failure 401 {object} validation.ProblemDetails
+// @Router /api/trash [get]
+// @Security BearerAuth
+func (h *TodoHandler) ListTrash(c *gin.Context) {
+	todos, err := h.svc.ListTrash(c.Request.Context(), getUserIDFromContext(c))
+	if err != nil {
+		validation.RespondServerError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, todos)
+}
+
+// RestoreTodo godoc
+// @Summary Restore a deleted todo
+// @Description Move a todo out of the trash (requires the same access as deleting it)
+// @Tags trash
+// @Produce json
+// @Param id path int true "Todo ID"
+// @Success 200 {object} models.Todo
+// @Failure 401 {object} validation.ProblemDetails
+// @Failure 403 {object} validation.ProblemDetails
+// @Failure 404 {object} validation.ProblemDetails
+// @Router /api/trash/{id}/restore [post]
+// @Security BearerAuth
+func (h *TodoHandler) RestoreTodo(c *gin.Context) {
+	id, _ := strconv.Atoi(c.Param("id"))
+	todo, err := h.svc.RestoreTodo(c.Request.Context(), uint(id), getUserIDFromContext(c))
+	if err != nil {
+		respondTodoError(c, "Restore Failed", err)
+		return
+	}
+	c.JSON(http.StatusOK, todo)
+}
+
+// EmptyTrash godoc
+// @Summary Empty the trash
+// @Description Permanently delete the trashed todos the user may change
+// @Tags trash
+// @Produce json
+// @Success 200 {object} models.EmptyTrashResponse
+// @Failure 401 {object} validation.ProblemDetails
+// @Router /api/trash [delete]
+// @Security BearerAuth
+func (h *TodoHandler) EmptyTrash(c *gin.Context) {
+	n, err := h.svc.EmptyTrash(c.Request.Context(), getUserIDFromContext(c))
+	if err != nil {
+		validation.RespondServerError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"deleted": n})
+}
+
+// respondTodoError maps access errors to 404/403 and anything else to 400 with the given title.
+func respondTodoError(c *gin.Context, title string, err error) {
+	switch {
+	case validation.IsContextError(err):
+		validation.RespondServerError(c, err)
+	case errors.Is(err, service.ErrTodoNotFound), errors.Is(err, service.ErrWorkspaceNotFound), errors.Is(err, service.ErrListNotFound),
+		errors.Is(err, service.ErrRevisionNotFound):
+		validation.RespondProblem(c, http.StatusNotFound, "Not Found", err.Error())
+	case errors.Is(err, service.ErrForbidden):
+		validation.RespondProblem(c, http.StatusForbidden, "Forbidden", err.Error())
+	default:
+		validation.RespondProblem(c, http.StatusBadRequest, title, err.Error())
+	}
+}
+
 func getUserIDFromContext(c *gin.Context) uint {
 	if v, ok := c.Get("user_id"); ok {
 		if idStr, ok2 := v.(string); ok2 {
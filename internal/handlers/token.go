@@ -0,0 +1,121 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/ahmadjafari86/go-todo-list/internal/service"
+	"github.com/ahmadjafari86/go-todo-list/internal/validation"
+)
+
+const defaultTokenExpiryDays = 30
+
+type createTokenPayload struct {
+	Name          string   `json:"name" binding:"required,max=100"`
+	Scopes        []string `json:"scopes" binding:"required,min=1,dive,oneof=todos:read todos:write"`
+	ExpiresInDays int      `json:"expires_in_days" binding:"omitempty,min=1,max=365"`
+}
+
+type TokenHandler struct {
+	svc service.TokenService
+}
+
+func NewTokenHandler(svc service.TokenService) *TokenHandler {
+	return &TokenHandler{svc: svc}
+}
+
+// CreateToken godoc
+// @Summary Create a personal access token
+// @Description Create a scoped token for scripts and CI. The token value is only returned once.
+// @Tags tokens
+// @Accept json
+// @Produce json
+// @Param token body models.CreateTokenRequest true "Token"
+// @Success 201 {object} models.CreateTokenResponse
+// @Failure 400 {object} validation.ProblemDetails
+// @Failure 401 {object} validation.ProblemDetails
+// @Router /api/tokens [post]
+// @Security BearerAuth
+func (h *TokenHandler) CreateToken(c *gin.Context) {
+	var p createTokenPayload
+	if err := c.ShouldBindJSON(&p); err != nil {
+		validation.RespondProblem(c, http.StatusBadRequest, "Invalid Request", err.Error())
+		return
+	}
+	userID := getUserIDFromContext(c)
+	if userID == 0 {
+		validation.RespondProblem(c, http.StatusUnauthorized, "Unauthorized", "missing user id")
+		return
+	}
+	days := p.ExpiresInDays
+	if days == 0 {
+		days = defaultTokenExpiryDays
+	}
+	raw, t, err := h.svc.CreateToken(c.Request.Context(), userID, p.Name, p.Scopes, time.Duration(days)*24*time.Hour)
+	if validation.IsContextError(err) {
+		validation.RespondServerError(c, err)
+		return
+	}
+	if err != nil {
+		validation.RespondProblem(c, http.StatusBadRequest, "Create Failed", err.Error())
+		return
+	}
+	c.JSON(http.StatusCreated, gin.H{"token": raw, "info": t})
+}
+
+// ListTokens godoc
+// @Summary List personal access tokens
+// @Description List the authenticated user's tokens (values are never returned)
+// @Tags tokens
+// @Produce json
+// @Success 200 {array} models.PersonalAccessToken
+// @Failure 401 {object} validation.ProblemDetails
+// @Router /api/tokens [get]
+// @Security BearerAuth
+func (h *TokenHandler) ListTokens(c *gin.Context) {
+	userID := getUserIDFromContext(c)
+	if userID == 0 {
+		validation.RespondProblem(c, http.StatusUnauthorized, "Unauthorized", "missing user id")
+		return
+	}
+	tokens, err := h.svc.ListTokens(c.Request.Context(), userID)
+	if err != nil {
+		validation.RespondServerError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, tokens)
+}
+
+// RevokeToken godoc
+// @Summary Revoke a personal access token
+// @Tags tokens
+// @Produce json
+// @Param id path int true "Token ID"
+// @Success 204
+// @Failure 400 {object} validation.ProblemDetails
+// @Failure 401 {object} validation.ProblemDetails
+// @Failure 404 {object} validation.ProblemDetails
+// @Router /api/tokens/{id} [delete]
+// @Security BearerAuth
+func (h *TokenHandler) RevokeToken(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 0)
+	if err != nil {
+		validation.RespondProblem(c, http.StatusBadRequest, "Invalid Request", "id must be a positive number")
+		return
+	}
+	userID := getUserIDFromContext(c)
+	err = h.svc.RevokeToken(c.Request.Context(), uint(id), userID)
+	if errors.Is(err, service.ErrTokenNotFound) {
+		validation.RespondProblem(c, http.StatusNotFound, "Not Found", err.Error())
+		return
+	}
+	if err != nil {
+		validation.RespondServerError(c, err)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
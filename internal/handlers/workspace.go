@@ -0,0 +1,261 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/ahmadjafari86/go-todo-list/internal/service"
+	"github.com/ahmadjafari86/go-todo-list/internal/validation"
+)
+
+type workspacePayload struct {
+	Name string `json:"name" binding:"required"`
+}
+
+type addMemberPayload struct {
+	UserID uint   `json:"user_id" binding:"required"`
+	Role   string `json:"role" binding:"required,oneof=admin member viewer"`
+}
+
+type memberRolePayload struct {
+	Role string `json:"role" binding:"required,oneof=admin member viewer"`
+}
+
+type WorkspaceHandler struct {
+	svc service.WorkspaceService
+}
+
+func NewWorkspaceHandler(svc service.WorkspaceService) *WorkspaceHandler {
+	return &WorkspaceHandler{svc: svc}
+}
+
+// CreateWorkspace godoc
+// @Summary Create a workspace
+// @Description Create a shared workspace owned by the authenticated user
+// @Tags workspaces
+// @Accept json
+// @Produce json
+// @Param workspace body models.WorkspaceRequest true "Workspace"
+// @Success 201 {object} models.Workspace
+// @Failure 400 {object} validation.ProblemDetails
+// @Failure 401 {object} validation.ProblemDetails
+// @Router /api/workspaces [post]
+// @Security BearerAuth
+func (h *WorkspaceHandler) CreateWorkspace(c *gin.Context) {
+	var p workspacePayload
+	if err := c.ShouldBindJSON(&p); err != nil {
+		validation.RespondProblem(c, http.StatusBadRequest, "Invalid Request", err.Error())
+		return
+	}
+	ws, err := h.svc.CreateWorkspace(c.Request.Context(), p.Name, getUserIDFromContext(c))
+	if validation.IsContextError(err) {
+		validation.RespondServerError(c, err)
+		return
+	}
+	if err != nil {
+		validation.RespondProblem(c, http.StatusBadRequest, "Create Failed", err.Error())
+		return
+	}
+	c.JSON(http.StatusCreated, ws)
+}
+
+// ListWorkspaces godoc
+// @Summary List workspaces
+// @Description List the workspaces the authenticated user belongs to, with their role in each
+// @Tags workspaces
+// @Produce json
+// @Success 200 {array} models.WorkspaceWithRole
+// @Failure 401 {object} validation.ProblemDetails
+// @Router /api/workspaces [get]
+// @Security BearerAuth
+func (h *WorkspaceHandler) ListWorkspaces(c *gin.Context) {
+	list, err := h.svc.ListWorkspaces(c.Request.Context(), getUserIDFromContext(c))
+	if err != nil {
+		validation.RespondServerError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, list)
+}
+
+// GetWorkspace godoc
+// @Summary Get a workspace
+// @Tags workspaces
+// @Produce json
+// @Param id path int true "Workspace ID"
+// @Success 200 {object} models.WorkspaceWithRole
+// @Failure 401 {object} validation.ProblemDetails
+// @Failure 404 {object} validation.ProblemDetails
+// @Router /api/workspaces/{id} [get]
+// @Security BearerAuth
+func (h *WorkspaceHandler) GetWorkspace(c *gin.Context) {
+	id, _ := strconv.Atoi(c.Param("id"))
+	ws, err := h.svc.GetWorkspace(c.Request.Context(), uint(id), getUserIDFromContext(c))
+	if err != nil {
+		respondWorkspaceError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, ws)
+}
+
+// RenameWorkspace godoc
+// @Summary Rename a workspace
+// @Description Requires the owner or admin role
+// @Tags workspaces
+// @Accept json
+// @Param id path int true "Workspace ID"
+// @Param workspace body models.WorkspaceRequest true "Workspace"
+// @Success 204
+// @Failure 400 {object} validation.ProblemDetails
+// @Failure 403 {object} validation.ProblemDetails
+// @Failure 404 {object} validation.ProblemDetails
+// @Router /api/workspaces/{id} [patch]
+// @Security BearerAuth
+func (h *WorkspaceHandler) RenameWorkspace(c *gin.Context) {
+	var p workspacePayload
+	if err := c.ShouldBindJSON(&p); err != nil {
+		validation.RespondProblem(c, http.StatusBadRequest, "Invalid Request", err.Error())
+		return
+	}
+	id, _ := strconv.Atoi(c.Param("id"))
+	if err := h.svc.RenameWorkspace(c.Request.Context(), uint(id), getUserIDFromContext(c), p.Name); err != nil {
+		respondWorkspaceError(c, err)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// DeleteWorkspace godoc
+// @Summary Delete a workspace
+// @Description Deletes the workspace and all of its todos. Only the owner can delete it; personal workspaces cannot be deleted.
+// @Tags workspaces
+// @Param id path int true "Workspace ID"
+// @Success 204
+// @Failure 400 {object} validation.ProblemDetails
+// @Failure 403 {object} validation.ProblemDetails
+// @Failure 404 {object} validation.ProblemDetails
+// @Router /api/workspaces/{id} [delete]
+// @Security BearerAuth
+func (h *WorkspaceHandler) DeleteWorkspace(c *gin.Context) {
+	id, _ := strconv.Atoi(c.Param("id"))
+	if err := h.svc.DeleteWorkspace(c.Request.Context(), uint(id), getUserIDFromContext(c)); err != nil {
+		respondWorkspaceError(c, err)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// ListMembers godoc
+// @Summary List workspace members
+// @Tags workspaces
+// @Produce json
+// @Param id path int true "Workspace ID"
+// @Success 200 {array} models.Membership
+// @Failure 401 {object} validation.ProblemDetails
+// @Failure 404 {object} validation.ProblemDetails
+// @Router /api/workspaces/{id}/members [get]
+// @Security BearerAuth
+func (h *WorkspaceHandler) ListMembers(c *gin.Context) {
+	id, _ := strconv.Atoi(c.Param("id"))
+	members, err := h.svc.ListMembers(c.Request.Context(), uint(id), getUserIDFromContext(c))
+	if err != nil {
+		respondWorkspaceError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, members)
+}
+
+// AddMember godoc
+// @Summary Add a workspace member
+// @Description Requires the owner or admin role
+// @Tags workspaces
+// @Accept json
+// @Produce json
+// @Param id path int true "Workspace ID"
+// @Param member body models.AddMemberRequest true "Member"
+// @Success 201 {object} models.Membership
+// @Failure 400 {object} validation.ProblemDetails
+// @Failure 403 {object} validation.ProblemDetails
+// @Failure 404 {object} validation.ProblemDetails
+// @Router /api/workspaces/{id}/members [post]
+// @Security BearerAuth
+func (h *WorkspaceHandler) AddMember(c *gin.Context) {
+	var p addMemberPayload
+	if err := c.ShouldBindJSON(&p); err != nil {
+		validation.RespondProblem(c, http.StatusBadRequest, "Invalid Request", err.Error())
+		return
+	}
+	id, _ := strconv.Atoi(c.Param("id"))
+	m, err := h.svc.AddMember(c.Request.Context(), uint(id), getUserIDFromContext(c), p.UserID, p.Role)
+	if err != nil {
+		respondWorkspaceError(c, err)
+		return
+	}
+	c.JSON(http.StatusCreated, m)
+}
+
+// UpdateMember godoc
+// @Summary Change a member's role
+// @Description Requires the owner or admin role
+// @Tags workspaces
+// @Accept json
+// @Param id path int true "Workspace ID"
+// @Param user_id path int true "User ID"
+// @Param role body models.MemberRoleRequest true "Role"
+// @Success 204
+// @Failure 400 {object} validation.ProblemDetails
+// @Failure 403 {object} validation.ProblemDetails
+// @Failure 404 {object} validation.ProblemDetails
+// @Router /api/workspaces/{id}/members/{user_id} [put]
+// @Security BearerAuth
+func (h *WorkspaceHandler) UpdateMember(c *gin.Context) {
+	var p memberRolePayload
+	if err := c.ShouldBindJSON(&p); err != nil {
+		validation.RespondProblem(c, http.StatusBadRequest, "Invalid Request", err.Error())
+		return
+	}
+	id, _ := strconv.Atoi(c.Param("id"))
+	userID, _ := strconv.Atoi(c.Param("user_id"))
+	if err := h.svc.UpdateMemberRole(c.Request.Context(), uint(id), getUserIDFromContext(c), uint(userID), p.Role); err != nil {
+		respondWorkspaceError(c, err)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// RemoveMember godoc
+// @Summary Remove a workspace member
+// @Description Owners and admins can remove anyone but the owner; any member can remove themselves
+// @Tags workspaces
+// @Param id path int true "Workspace ID"
+// @Param user_id path int true "User ID"
+// @Success 204
+// @Failure 400 {object} validation.ProblemDetails
+// @Failure 403 {object} validation.ProblemDetails
+// @Failure 404 {object} validation.ProblemDetails
+// @Router /api/workspaces/{id}/members/{user_id} [delete]
+// @Security BearerAuth
+func (h *WorkspaceHandler) RemoveMember(c *gin.Context) {
+	id, _ := strconv.Atoi(c.Param("id"))
+	userID, _ := strconv.Atoi(c.Param("user_id"))
+	if err := h.svc.RemoveMember(c.Request.Context(), uint(id), getUserIDFromContext(c), uint(userID)); err != nil {
+		respondWorkspaceError(c, err)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+func respondWorkspaceError(c *gin.Context, err error) {
+	switch {
+	case validation.IsContextError(err):
+		validation.RespondServerError(c, err)
+	case errors.Is(err, service.ErrWorkspaceNotFound), errors.Is(err, service.ErrMemberNotFound), errors.Is(err, service.ErrUserNotFound):
+		validation.RespondProblem(c, http.StatusNotFound, "Not Found", err.Error())
+	case errors.Is(err, service.ErrForbidden):
+		validation.RespondProblem(c, http.StatusForbidden, "Forbidden", err.Error())
+	default:
+		validation.RespondProblem(c, http.StatusBadRequest, "Request Failed", err.Error())
+	}
+}
@@ -1,15 +1,24 @@
 package middleware
 
 import (
+	"fmt"
 	"net/http"
+	"strconv"
 	"strings"
 
+	"github.com/ahmadjafari86/go-todo-list/internal/db"
+	"github.com/ahmadjafari86/go-todo-list/internal/models"
 	"github.com/ahmadjafari86/go-todo-list/internal/service"
 	"github.com/ahmadjafari86/go-todo-list/internal/validation"
 	"github.com/gin-gonic/gin"
 )
 
-func AuthMiddleware(authSvc service.AuthService) gin.HandlerFunc {
+// AuthMiddleware accepts a JWT issued by /auth/login, a personal access token or an
+// access token issued to an OAuth client. Requests authenticated with a personal
+// access token or OAuth token carry its scopes in the context; JWT sessions are
+// unrestricted and carry their session ID. Tokens of revoked sessions are rejected
+// by ParseToken.
+func AuthMiddleware(authSvc service.AuthService, tokenSvc service.TokenService, oauthSvc service.OAuthService) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		auth := c.GetHeader("Authorization")
 		if auth == "" {
@@ -22,12 +31,80 @@ func AuthMiddleware(authSvc service.AuthService) gin.HandlerFunc {
 			return
 		}
 		token := parts[1]
-		claims, err := authSvc.ParseToken(token)
+		if strings.HasPrefix(token, service.PersonalTokenPrefix) {
+			pat, err := tokenSvc.Authenticate(c.Request.Context(), token)
+			if err != nil {
+				rejectToken(c, err)
+				return
+			}
+			setUser(c, pat.UserID)
+			c.Set("scopes", pat.Scopes)
+			c.Next()
+			return
+		}
+		if strings.HasPrefix(token, service.OAuthAccessTokenPrefix) {
+			tok, err := oauthSvc.Authenticate(c.Request.Context(), token)
+			if err != nil {
+				rejectToken(c, err)
+				return
+			}
+			setUser(c, tok.UserID)
+			c.Set("scopes", tok.Scopes)
+			c.Next()
+			return
+		}
+		claims, err := authSvc.ParseToken(c.Request.Context(), token)
 		if err != nil {
-			validation.RespondProblem(c, http.StatusUnauthorized, "Unauthorized", "invalid token")
+			rejectToken(c, err)
+			return
+		}
+		userID, _ := strconv.ParseUint(claims.Subject, 10, 0)
+		setUser(c, uint(userID))
+		c.Set("role", claims.Role)
+		c.Set("session_id", claims.SessionID)
+		c.Next()
+	}
+}
+
+// setUser stores the authenticated user for the handlers and in the request
+// context, where the database layer uses it to route the user's reads to the
+// primary right after they write.
+func setUser(c *gin.Context, userID uint) {
+	c.Set("user_id", fmt.Sprint(userID))
+	c.Request = c.Request.WithContext(db.WithUser(c.Request.Context(), userID))
+}
+
+// rejectToken answers 401 for a token that failed verification. A lookup cut
+// short by the request context is not the token's fault and gets the
+// timeout or cancellation response instead.
+func rejectToken(c *gin.Context, err error) {
+	if validation.IsContextError(err) {
+		validation.RespondServerError(c, err)
+		return
+	}
+	validation.RespondProblem(c, http.StatusUnauthorized, "Unauthorized", "invalid token")
+}
+
+// RequireRole only lets through JWT sessions whose user has the given role.
+func RequireRole(role string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.GetString("role") != role {
+			validation.RespondProblem(c, http.StatusForbidden, "Forbidden", fmt.Sprintf("requires %s role", role))
 			return
 		}
-		c.Set("user_id", claims.Subject)
+		c.Next()
+	}
+}
+
+// RequireScope rejects requests whose token is restricted to scopes that do not include scope.
+func RequireScope(scope string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if v, ok := c.Get("scopes"); ok {
+			if scopes, _ := v.(models.ScopeList); !scopes.Has(scope) {
+				validation.RespondProblem(c, http.StatusForbidden, "Forbidden", fmt.Sprintf("token lacks required scope %q", scope))
+				return
+			}
+		}
 		c.Next()
 	}
 }
@@ -0,0 +1,18 @@
+package models
+
+// AccountExport is everything stored about a user, as returned by the data export.
+// Secrets such as password and token hashes are never included.
+type AccountExport struct {
+	Profile     User                  `json:"profile"`
+	Todos       []Todo                `json:"todos"`
+	Workspaces  []WorkspaceWithRole   `json:"workspaces"`
+	Lists       []TodoList            `json:"lists"`
+	SharedLists []SharedList          `json:"shared_lists"`
+	Invitations []Invitation          `json:"invitations"`
+	Tokens      []PersonalAccessToken `json:"tokens"`
+	Sessions    []Session             `json:"sessions"`
+	Identities  []UserIdentity        `json:"identities"`
+	// OAuthClients are applications the user registered; AuthorizedApps those they granted access.
+	OAuthClients   []OAuthClient   `json:"oauth_clients"`
+	AuthorizedApps []AuthorizedApp `json:"authorized_apps"`
+}
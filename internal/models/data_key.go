@@ -0,0 +1,16 @@
+package models
+
+import "time"
+
+// DataKey encrypts one user's todo content. It is stored wrapped, that is
+// encrypted, by version MasterKeyVersion of the master key from the
+// configuration. When the master key rotates the user gets a new data key and
+// this one is deleted once nothing is encrypted with it anymore.
+type DataKey struct {
+	ID               uint      `gorm:"primaryKey"`
+	UserID           uint      `gorm:"not null;index"`
+	User             *User     `gorm:"foreignKey:UserID;constraint:OnDelete:CASCADE"`
+	MasterKeyVersion int       `gorm:"not null;index"`
+	WrappedKey       string    `gorm:"type:text;not null"`
+	CreatedAt        time.Time `gorm:"not null"`
+}
@@ -0,0 +1,13 @@
+package models
+
+import "time"
+
+// UserIdentity links a user to an account at an external OpenID Connect provider.
+type UserIdentity struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	UserID    uint      `gorm:"not null;index" json:"-"`
+	Provider  string    `gorm:"type:text;not null;uniqueIndex:idx_identity_provider_subject" json:"provider"`
+	Subject   string    `gorm:"type:text;not null;uniqueIndex:idx_identity_provider_subject" json:"-"`
+	Email     string    `gorm:"type:text;not null" json:"email"`
+	CreatedAt time.Time `json:"created_at"`
+}
@@ -0,0 +1,22 @@
+package models
+
+import "time"
+
+// Invitation asks someone, by email, to join a workspace or a shared list. Role is a
+// workspace role for workspace invitations and a share permission for list invitations.
+type Invitation struct {
+	ID          uint       `gorm:"primaryKey" json:"id"`
+	InviterID   uint       `gorm:"not null;index" json:"inviter_id"`
+	Email       string     `gorm:"type:text;not null" json:"email"`
+	WorkspaceID uint       `json:"workspace_id,omitempty"`
+	ListID      uint       `json:"list_id,omitempty"`
+	Role        string     `gorm:"type:text;not null" json:"role"`
+	ExpiresAt   time.Time  `gorm:"not null" json:"expires_at"`
+	AcceptedAt  *time.Time `json:"accepted_at,omitempty"`
+	DeclinedAt  *time.Time `json:"declined_at,omitempty"`
+	CreatedAt   time.Time  `json:"created_at"`
+}
+
+func (i *Invitation) Pending(now time.Time) bool {
+	return i.AcceptedAt == nil && i.DeclinedAt == nil && now.Before(i.ExpiresAt)
+}
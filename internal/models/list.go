@@ -0,0 +1,41 @@
+package models
+
+import "time"
+
+// Share permissions, from least to most privileged. Editors can change the list's
+// todos; admins can also grant and revoke shares.
+const (
+	SharePermissionView  = "view"
+	SharePermissionEdit  = "edit"
+	SharePermissionAdmin = "admin"
+)
+
+// ShareWriterPermissions may create, update and delete todos in a shared list.
+var ShareWriterPermissions = []string{SharePermissionEdit, SharePermissionAdmin}
+
+// TodoList groups todos inside a workspace. A list can be shared with individual
+// users who are not members of the workspace.
+type TodoList struct {
+	ID          uint      `gorm:"primaryKey" json:"id"`
+	WorkspaceID uint      `gorm:"not null;index" json:"workspace_id"`
+	OwnerID     uint      `gorm:"not null" json:"owner_id"`
+	Name        string    `gorm:"type:text;not null" json:"name"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+type ListShare struct {
+	ListID     uint      `gorm:"primaryKey;autoIncrement:false" json:"list_id"`
+	UserID     uint      `gorm:"primaryKey;autoIncrement:false;index" json:"user_id"`
+	Permission string    `gorm:"type:text;not null" json:"permission"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+// SharedList is a list as seen by a user it was shared with.
+type SharedList struct {
+	TodoList   `gorm:"embedded"`
+	Permission string `json:"permission"`
+}
+
+func CanWriteShared(permission string) bool {
+	return permission == SharePermissionEdit || permission == SharePermissionAdmin
+}
@@ -0,0 +1,11 @@
+package models
+
+import "time"
+
+// LoginAttempt counts consecutive failed logins for a key such as an account or client IP.
+type LoginAttempt struct {
+	Key         string `gorm:"primaryKey;type:text"`
+	Failures    int    `gorm:"not null;default:0"`
+	LockedUntil *time.Time
+	UpdatedAt   time.Time
+}
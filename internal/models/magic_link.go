@@ -0,0 +1,15 @@
+package models
+
+import "time"
+
+// MagicLink is a one-time login link. Only hashes are stored: TokenHash of the token
+// in the emailed URL and NonceHash of the nonce kept in the requesting browser's cookie.
+type MagicLink struct {
+	ID        uint      `gorm:"primaryKey"`
+	UserID    uint      `gorm:"not null;index"`
+	TokenHash string    `gorm:"type:text;not null;uniqueIndex"`
+	NonceHash string    `gorm:"type:text;not null"`
+	ExpiresAt time.Time `gorm:"not null"`
+	UsedAt    *time.Time
+	CreatedAt time.Time
+}
@@ -0,0 +1,12 @@
+package models
+
+import "time"
+
+// RecoveryCode is a single-use fallback for a user's TOTP device. Only the hash is stored.
+type RecoveryCode struct {
+	ID        uint   `gorm:"primaryKey"`
+	UserID    uint   `gorm:"not null;index"`
+	CodeHash  string `gorm:"type:text;not null"`
+	UsedAt    *time.Time
+	CreatedAt time.Time
+}
@@ -0,0 +1,76 @@
+package models
+
+import "time"
+
+// OAuthClient is a third-party application registered by a user. Confidential
+// clients authenticate to the token endpoint with a secret; public clients
+// (mobile and single-page apps) rely on PKCE alone.
+type OAuthClient struct {
+	ID         uint   `gorm:"primaryKey" json:"id"`
+	ClientID   string `gorm:"type:text;not null;uniqueIndex" json:"client_id"`
+	SecretHash string `gorm:"type:text" json:"-"`
+	OwnerID    uint   `gorm:"not null;index" json:"-"`
+	Name       string `gorm:"type:text;not null" json:"name"`
+	// RedirectURIs reuse ScopeList's space separated storage; URIs cannot contain spaces.
+	RedirectURIs ScopeList `gorm:"type:text;not null" json:"redirect_uris"`
+	// Scopes are the most a user can grant the client.
+	Scopes       ScopeList `gorm:"type:text;not null" json:"scopes"`
+	Confidential bool      `gorm:"not null" json:"confidential"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+// OAuthAuthorization records a user's consent for a client. Revoking it revokes
+// every token issued under it.
+type OAuthAuthorization struct {
+	ID        uint       `gorm:"primaryKey"`
+	UserID    uint       `gorm:"not null;uniqueIndex:idx_oauth_authorization"`
+	ClientID  uint       `gorm:"not null;uniqueIndex:idx_oauth_authorization"`
+	Scopes    ScopeList  `gorm:"type:text;not null"`
+	RevokedAt *time.Time `gorm:"index"`
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+// OAuthCode is a single-use authorization code. Only its hash is stored, along
+// with the PKCE challenge the token request has to answer.
+type OAuthCode struct {
+	ID              uint      `gorm:"primaryKey"`
+	CodeHash        string    `gorm:"type:text;not null;uniqueIndex"`
+	AuthorizationID uint      `gorm:"not null;index"`
+	RedirectURI     string    `gorm:"type:text;not null"`
+	Scopes          ScopeList `gorm:"type:text;not null"`
+	CodeChallenge   string    `gorm:"type:text;not null"`
+	ExpiresAt       time.Time `gorm:"not null"`
+	UsedAt          *time.Time
+	CreatedAt       time.Time
+}
+
+// OAuthToken is an access and refresh token pair. Refreshing revokes the pair
+// and issues a new one.
+type OAuthToken struct {
+	ID               uint      `gorm:"primaryKey"`
+	AuthorizationID  uint      `gorm:"not null;index"`
+	UserID           uint      `gorm:"not null;index"`
+	AccessHash       string    `gorm:"type:text;not null;uniqueIndex"`
+	RefreshHash      string    `gorm:"type:text;not null;uniqueIndex"`
+	Scopes           ScopeList `gorm:"type:text;not null"`
+	AccessExpiresAt  time.Time `gorm:"not null"`
+	RefreshExpiresAt time.Time `gorm:"not null"`
+	RevokedAt        *time.Time
+	CreatedAt        time.Time
+}
+
+// AuthorizedApp is a client the user has granted access to, as listed to the user.
+type AuthorizedApp struct {
+	ID           uint      `json:"id"`
+	ClientID     string    `json:"client_id"`
+	Name         string    `json:"name"`
+	Scopes       ScopeList `json:"scopes"`
+	AuthorizedAt time.Time `json:"authorized_at"`
+}
+
+// Table names spell OAuth as one word instead of GORM's default o_auth_*.
+func (OAuthClient) TableName() string        { return "oauth_clients" }
+func (OAuthAuthorization) TableName() string { return "oauth_authorizations" }
+func (OAuthCode) TableName() string          { return "oauth_codes" }
+func (OAuthToken) TableName() string         { return "oauth_tokens" }
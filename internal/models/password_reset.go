@@ -0,0 +1,13 @@
+package models
+
+import "time"
+
+// PasswordReset is a one-time password reset link. Only the hash of the emailed token is stored.
+type PasswordReset struct {
+	ID        uint      `gorm:"primaryKey"`
+	UserID    uint      `gorm:"not null;index"`
+	TokenHash string    `gorm:"type:text;not null;uniqueIndex"`
+	ExpiresAt time.Time `gorm:"not null"`
+	UsedAt    *time.Time
+	CreatedAt time.Time
+}
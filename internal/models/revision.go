@@ -0,0 +1,37 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// Revision actions, one for every way a todo can change.
+const (
+	RevisionCreate  = "create"
+	RevisionUpdate  = "update"
+	RevisionToggle  = "toggle"
+	RevisionDelete  = "delete"
+	RevisionRestore = "restore"
+	RevisionRevert  = "revert"
+)
+
+// TodoRevision is one change to a todo. Rev numbers the revisions of each todo
+// from 1, and the history is removed with the todo when it leaves the trash.
+type TodoRevision struct {
+	ID        uint          `gorm:"primaryKey" json:"-"`
+	TodoID    uint          `gorm:"not null;uniqueIndex:idx_todo_revisions_todo_rev" json:"todo_id"`
+	Todo      *Todo         `gorm:"foreignKey:TodoID;constraint:OnDelete:CASCADE" json:"-"`
+	Rev       uint          `gorm:"not null;uniqueIndex:idx_todo_revisions_todo_rev" json:"rev"`
+	UserID    uint          `gorm:"not null;index" json:"user_id"`
+	Action    string        `gorm:"type:text;not null" json:"action"`
+	Changes   []FieldChange `gorm:"type:text;not null;serializer:json" json:"changes"`
+	CreatedAt time.Time     `json:"created_at"`
+}
+
+// FieldChange is the JSON value of one todo field before and after a revision.
+// Before is null for a newly created todo.
+type FieldChange struct {
+	Field  string          `json:"field"`
+	Before json.RawMessage `json:"before" swaggertype:"object"`
+	After  json.RawMessage `json:"after" swaggertype:"object"`
+}
@@ -0,0 +1,18 @@
+package models
+
+import "time"
+
+// Session is one interactive login. Access tokens carry its ID in the "sid" claim and
+// stop working once it is revoked.
+type Session struct {
+	ID         uint       `gorm:"primaryKey" json:"id"`
+	UserID     uint       `gorm:"not null;index" json:"-"`
+	UserAgent  string     `gorm:"type:text" json:"user_agent"`
+	IP         string     `gorm:"type:text" json:"ip"`
+	CreatedAt  time.Time  `json:"created_at"`
+	LastSeenAt time.Time  `json:"last_seen_at"`
+	ExpiresAt  time.Time  `gorm:"not null" json:"expires_at"`
+	RevokedAt  *time.Time `json:"-"`
+	// Current marks the session of the token used for the request.
+	Current bool `gorm:"-" json:"current"`
+}
@@ -18,16 +18,199 @@ type LoginRequest struct {
 }
 
 type LoginResponse struct {
-    Token string `json:"token" example:"jwt.token.here"`
+    Token       string `json:"token,omitempty" example:"jwt.token.here"`
+    MFARequired bool   `json:"mfa_required,omitempty" example:"false"`
+    MFAToken    string `json:"mfa_token,omitempty" example:""`
+}
+
+type MagicLinkRequest struct {
+    Email string `json:"email" example:"user@example.com"`
+}
+
+type DeleteAccountRequest struct {
+    Password string `json:"password" example:"strongpassword"`
+}
+
+type ForgotPasswordRequest struct {
+    Email string `json:"email" example:"user@example.com"`
+}
+
+type ResetPasswordRequest struct {
+    Token    string `json:"token" example:"emailed-reset-token"`
+    Password string `json:"password" example:"correct horse battery staple"`
+}
+
+type ChangePasswordRequest struct {
+    CurrentPassword string `json:"current_password" example:"strongpassword"`
+    NewPassword     string `json:"new_password" example:"correct horse battery staple"`
+}
+
+type MFALoginRequest struct {
+    MFAToken string `json:"mfa_token" example:"jwt.challenge.here"`
+    Code     string `json:"code" example:"123456"`
+}
+
+// ----- Two-factor DTOs -----
+
+type TOTPEnrollmentResponse struct {
+    Secret     string `json:"secret" example:"JBSWY3DPEHPK3PXP"`
+    OTPAuthURI string `json:"otpauth_uri" example:"otpauth://totp/Todo%20API:user@example.com?secret=JBSWY3DPEHPK3PXP&issuer=Todo+API"`
+}
+
+type MFACodeRequest struct {
+    Code string `json:"code" example:"123456"`
+}
+
+type RecoveryCodesResponse struct {
+    RecoveryCodes []string `json:"recovery_codes" example:"abcde-fghij"`
 }
 
 // ----- Todo DTOs -----
 
 type CreateTodoRequest struct {
-    Title string `json:"title" example:"Buy milk"`
+    Title       string `json:"title" example:"Buy milk"`
+    Completed   bool   `json:"completed,omitempty" example:"false"`
+    WorkspaceID uint   `json:"workspace_id,omitempty" example:"0"`
+    ListID      uint   `json:"list_id,omitempty" example:"0"`
 }
 
 type UpdateTodoRequest struct {
     Title     string `json:"title" example:"Buy bread"`
     Completed bool   `json:"completed" example:"false"`
 }
+
+type EmptyTrashResponse struct {
+    Deleted int64 `json:"deleted" example:"3"`
+}
+
+// ----- Personal access token DTOs -----
+
+type CreateTokenRequest struct {
+    Name          string   `json:"name" example:"ci-pipeline"`
+    Scopes        []string `json:"scopes" example:"todos:read,todos:write"`
+    ExpiresInDays int      `json:"expires_in_days" example:"30"`
+}
+
+type CreateTokenResponse struct {
+    Token string              `json:"token" example:"tdl_3q2+7w..."`
+    Info  PersonalAccessToken `json:"info"`
+}
+
+type OIDCProvidersResponse struct {
+    Providers []string `json:"providers" example:"corp"`
+}
+
+// ----- Admin DTOs -----
+
+type AdminUserListResponse struct {
+    Users    []UserSummary `json:"users"`
+    Total    int64         `json:"total" example:"42"`
+    Page     int           `json:"page" example:"1"`
+    PageSize int           `json:"page_size" example:"20"`
+}
+
+type SetRoleRequest struct {
+    Role string `json:"role" example:"admin"`
+}
+
+// ----- Workspace DTOs -----
+
+type WorkspaceRequest struct {
+    Name string `json:"name" example:"Household"`
+}
+
+type AddMemberRequest struct {
+    UserID uint   `json:"user_id" example:"2"`
+    Role   string `json:"role" example:"member"`
+}
+
+type MemberRoleRequest struct {
+    Role string `json:"role" example:"viewer"`
+}
+
+// ----- List sharing DTOs -----
+
+type CreateListRequest struct {
+    Name        string `json:"name" example:"Groceries"`
+    WorkspaceID uint   `json:"workspace_id,omitempty" example:"0"`
+}
+
+type GrantShareRequest struct {
+    UserID     uint   `json:"user_id" example:"2"`
+    Permission string `json:"permission" example:"edit"`
+}
+
+type SharePermissionRequest struct {
+    Permission string `json:"permission" example:"view"`
+}
+
+// ----- Invitation DTOs -----
+
+type InviteRequest struct {
+    Email       string `json:"email" example:"colleague@example.com"`
+    Role        string `json:"role" example:"member"`
+    WorkspaceID uint   `json:"workspace_id,omitempty" example:"3"`
+    ListID      uint   `json:"list_id,omitempty" example:"0"`
+}
+
+type InvitationTokenRequest struct {
+    Token string `json:"token" example:"jwt.invitation.here"`
+}
+
+type InvitationRegisterRequest struct {
+    Token    string `json:"token" example:"jwt.invitation.here"`
+    Password string `json:"password" example:"strongpassword"`
+}
+
+// ----- OAuth DTOs -----
+
+type RegisterClientRequest struct {
+    Name         string   `json:"name" example:"Calendar Bridge"`
+    RedirectURIs []string `json:"redirect_uris" example:"https://bridge.example.com/callback"`
+    Scopes       []string `json:"scopes" example:"todos:read"`
+    Confidential bool     `json:"confidential" example:"true"`
+}
+
+type RegisterClientResponse struct {
+    Client       OAuthClient `json:"client"`
+    ClientSecret string      `json:"client_secret,omitempty" example:"only-shown-once"`
+}
+
+type ConsentClient struct {
+    ClientID string `json:"client_id" example:"tdc_3q2+7w"`
+    Name     string `json:"name" example:"Calendar Bridge"`
+}
+
+type ConsentResponse struct {
+    Client     ConsentClient `json:"client"`
+    Scopes     []string      `json:"scopes" example:"todos:read"`
+    Authorized bool          `json:"authorized" example:"false"`
+}
+
+type AuthorizeRequest struct {
+    ResponseType        string `json:"response_type" example:"code"`
+    ClientID            string `json:"client_id" example:"tdc_3q2+7w"`
+    RedirectURI         string `json:"redirect_uri" example:"https://bridge.example.com/callback"`
+    Scope               string `json:"scope" example:"todos:read"`
+    State               string `json:"state" example:"af0ifjsldkj"`
+    CodeChallenge       string `json:"code_challenge" example:"E9Melhoa2OwvFrEMTJguCHaoeK1t8URWbuGJSstw-cM"`
+    CodeChallengeMethod string `json:"code_challenge_method" example:"S256"`
+    Approve             bool   `json:"approve" example:"true"`
+}
+
+type AuthorizeResponse struct {
+    RedirectTo string `json:"redirect_to" example:"https://bridge.example.com/callback?code=...&state=af0ifjsldkj"`
+}
+
+type OAuthTokenResponse struct {
+    AccessToken  string `json:"access_token" example:"tdo_..."`
+    TokenType    string `json:"token_type" example:"Bearer"`
+    ExpiresIn    int    `json:"expires_in" example:"3600"`
+    RefreshToken string `json:"refresh_token" example:"tdr_..."`
+    Scope        string `json:"scope" example:"todos:read"`
+}
+
+type OAuthErrorResponse struct {
+    Error            string `json:"error" example:"invalid_grant"`
+    ErrorDescription string `json:"error_description" example:"authorization code is expired or already used"`
+}
@@ -3,9 +3,15 @@ package models
 import "time"
 
 type Todo struct {
-    ID        uint      `gorm:"primaryKey" json:"id"`
-    Title     string    `gorm:"type:text;not null" json:"title" binding:"required"`
-    Completed bool      `gorm:"not null" json:"completed"`
-    OwnerID   uint      `gorm:"not null" json:"owner_id"`
-    CreatedAt time.Time `json:"created_at"`
+    ID          uint      `gorm:"primaryKey" json:"id"`
+    Title       string    `gorm:"type:text;not null" json:"title" binding:"required"`
+    Completed   bool      `gorm:"not null" json:"completed"`
+    OwnerID     uint      `gorm:"not null;index" json:"owner_id"`
+    // Owner only declares the foreign key, so a user's todos are removed with the user.
+    Owner       *User     `gorm:"foreignKey:OwnerID;constraint:OnDelete:CASCADE" json:"-"`
+    WorkspaceID uint      `gorm:"index" json:"workspace_id"`
+    ListID      uint      `gorm:"index" json:"list_id"`
+    CreatedAt   time.Time `json:"created_at"`
+    // DeletedAt is set while the todo is in the trash.
+    DeletedAt   *time.Time `gorm:"index" json:"deleted_at,omitempty"`
 }
@@ -0,0 +1,12 @@
+package models
+
+import "time"
+
+// TodoCacheInvalidation tells the other server processes that the todos a
+// user can see have changed, so their caches drop that user's lists. Rows are
+// only kept for a short while.
+type TodoCacheInvalidation struct {
+	ID        uint      `gorm:"primaryKey"`
+	UserID    uint      `gorm:"not null"`
+	CreatedAt time.Time `gorm:"not null;index"`
+}
@@ -0,0 +1,60 @@
+package models
+
+import (
+	"database/sql/driver"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Scopes understood by the API. ScopeAccount is reserved for interactive
+// (password based) sessions and is never granted to personal access tokens.
+const (
+	ScopeTodosRead  = "todos:read"
+	ScopeTodosWrite = "todos:write"
+	ScopeAccount    = "account"
+)
+
+// ScopeList is stored as a space separated string and serialized as a JSON array.
+type ScopeList []string
+
+func (s ScopeList) Has(scope string) bool {
+	for _, v := range s {
+		if v == scope {
+			return true
+		}
+	}
+	return false
+}
+
+func (s ScopeList) Value() (driver.Value, error) {
+	return strings.Join(s, " "), nil
+}
+
+func (s *ScopeList) Scan(src interface{}) error {
+	var raw string
+	switch v := src.(type) {
+	case string:
+		raw = v
+	case []byte:
+		raw = string(v)
+	case nil:
+		raw = ""
+	default:
+		return fmt.Errorf("cannot scan %T into ScopeList", src)
+	}
+	*s = strings.Fields(raw)
+	return nil
+}
+
+type PersonalAccessToken struct {
+	ID         uint       `gorm:"primaryKey" json:"id"`
+	UserID     uint       `gorm:"not null;index" json:"-"`
+	Name       string     `gorm:"type:text;not null" json:"name"`
+	Prefix     string     `gorm:"type:text;not null" json:"prefix"`
+	TokenHash  string     `gorm:"type:text;not null;uniqueIndex" json:"-"`
+	Scopes     ScopeList  `gorm:"type:text;not null" json:"scopes"`
+	ExpiresAt  *time.Time `json:"expires_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
@@ -2,9 +2,29 @@ package models
 
 import "time"
 
+const (
+    RoleUser  = "user"
+    RoleAdmin = "admin"
+)
+
 type User struct {
-    ID           uint      `gorm:"primaryKey" json:"id"`
-    Email        string    `gorm:"type:text;not null;unique" json:"email" binding:"required,email"`
-    PasswordHash string    `gorm:"type:text;not null" json:"-"`
-    CreatedAt    time.Time `json:"created_at"`
+    ID           uint       `gorm:"primaryKey" json:"id"`
+    Email        string     `gorm:"type:text;not null;unique" json:"email" binding:"required,email"`
+    PasswordHash string     `gorm:"type:text;not null" json:"-"`
+    Role         string     `gorm:"type:text;not null;default:user" json:"role"`
+    DisabledAt   *time.Time `json:"disabled_at,omitempty"`
+    TOTPSecret   string     `gorm:"type:text" json:"-"`
+    TOTPEnabled  bool       `gorm:"not null;default:false" json:"totp_enabled"`
+    TOTPLastStep int64      `gorm:"not null;default:0" json:"-"`
+    CreatedAt    time.Time  `json:"created_at"`
+}
+
+func (u *User) Disabled() bool {
+    return u.DisabledAt != nil
+}
+
+// UserSummary is a user together with aggregate data for the admin API.
+type UserSummary struct {
+    User      `gorm:"embedded"`
+    TodoCount int64 `json:"todo_count"`
 }
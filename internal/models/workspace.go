@@ -0,0 +1,51 @@
+package models
+
+import "time"
+
+// Workspace roles, from most to least privileged. Owners and admins manage members,
+// members can change todos and viewers can only read them.
+const (
+	WorkspaceRoleOwner  = "owner"
+	WorkspaceRoleAdmin  = "admin"
+	WorkspaceRoleMember = "member"
+	WorkspaceRoleViewer = "viewer"
+)
+
+// TodoWriterRoles may create, update and delete todos in a workspace.
+var TodoWriterRoles = []string{WorkspaceRoleOwner, WorkspaceRoleAdmin, WorkspaceRoleMember}
+
+// Workspace groups todos shared by its members. Every user has exactly one personal
+// workspace, which holds their own todos and cannot have other members.
+type Workspace struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	Name      string    `gorm:"type:text;not null" json:"name"`
+	Personal  bool      `gorm:"not null;default:false" json:"personal"`
+	OwnerID   uint      `gorm:"not null;index;uniqueIndex:idx_personal_workspace,where:personal = true" json:"owner_id"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type Membership struct {
+	WorkspaceID uint      `gorm:"primaryKey;autoIncrement:false" json:"workspace_id"`
+	UserID      uint      `gorm:"primaryKey;autoIncrement:false;index" json:"user_id"`
+	Role        string    `gorm:"type:text;not null" json:"role"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// WorkspaceWithRole is a workspace as seen by one of its members.
+type WorkspaceWithRole struct {
+	Workspace `gorm:"embedded"`
+	Role      string `json:"role"`
+}
+
+func CanWriteTodos(role string) bool {
+	for _, r := range TodoWriterRoles {
+		if r == role {
+			return true
+		}
+	}
+	return false
+}
+
+func CanManageMembers(role string) bool {
+	return role == WorkspaceRoleOwner || role == WorkspaceRoleAdmin
+}
@@ -0,0 +1,211 @@
+package repository
+
+import (
+	"context"
+	"strings"
+
+	"gorm.io/gorm"
+
+	"github.com/ahmadjafari86/go-todo-list/internal/models"
+)
+
+// AccountRepository works on all of a user's data at once, for exports and deletion.
+type AccountRepository interface {
+	Export(ctx context.Context, userID uint) (*models.AccountExport, error)
+	// Delete removes the user together with everything they own in one transaction:
+	// workspaces they own with their lists and todos, todos they created elsewhere,
+	// memberships, shares, invitations they sent or that are addressed to their
+	// email, tokens, sessions, linked identities, OAuth clients they registered and
+	// apps they authorized.
+	Delete(ctx context.Context, userID uint) error
+}
+
+type GormAccountRepository struct {
+	db *gorm.DB
+}
+
+func NewGormAccountRepository(db *gorm.DB) AccountRepository {
+	return &GormAccountRepository{db: db}
+}
+
+func (r *GormAccountRepository) Export(ctx context.Context, userID uint) (*models.AccountExport, error) {
+	db := conn(ctx, r.db)
+	out := &models.AccountExport{}
+	if err := db.First(&out.Profile, userID).Error; err != nil {
+		return nil, err
+	}
+	steps := []func() error{
+		func() error { return db.Where("owner_id = ?", userID).Order("id").Find(&out.Todos).Error },
+		func() error {
+			return db.Model(&models.Workspace{}).
+				Select("workspaces.*, memberships.role AS role").
+				Joins("JOIN memberships ON memberships.workspace_id = workspaces.id").
+				Where("memberships.user_id = ?", userID).
+				Order("workspaces.id").
+				Scan(&out.Workspaces).Error
+		},
+		func() error { return db.Where("owner_id = ?", userID).Order("id").Find(&out.Lists).Error },
+		func() error {
+			return db.Model(&models.TodoList{}).
+				Select("todo_lists.*, list_shares.permission AS permission").
+				Joins("JOIN list_shares ON list_shares.list_id = todo_lists.id").
+				Where("list_shares.user_id = ?", userID).
+				Order("todo_lists.id").
+				Scan(&out.SharedLists).Error
+		},
+		func() error { return db.Where("inviter_id = ?", userID).Order("id").Find(&out.Invitations).Error },
+		func() error { return db.Where("user_id = ?", userID).Order("id").Find(&out.Tokens).Error },
+		func() error { return db.Where("user_id = ?", userID).Order("id").Find(&out.Sessions).Error },
+		func() error { return db.Where("user_id = ?", userID).Order("id").Find(&out.Identities).Error },
+		func() error { return db.Where("owner_id = ?", userID).Order("id").Find(&out.OAuthClients).Error },
+		func() (err error) {
+			out.AuthorizedApps, err = NewGormOAuthRepository(db).ListAuthorizedApps(ctx, userID)
+			return err
+		},
+	}
+	for _, step := range steps {
+		if err := step(); err != nil {
+			return nil, err
+		}
+	}
+	return out, nil
+}
+
+func (r *GormAccountRepository) Delete(ctx context.Context, userID uint) error {
+	return conn(ctx, r.db).Transaction(func(tx *gorm.DB) error {
+		var u models.User
+		if err := tx.Select("id", "email").First(&u, userID).Error; err != nil {
+			return err
+		}
+		sub := func() *gorm.DB { return tx.Session(&gorm.Session{NewDB: true}) }
+		owned := sub().Model(&models.Workspace{}).Select("id").Where("owner_id = ?", userID)
+		ownedLists := sub().Model(&models.TodoList{}).Select("id").Where("workspace_id IN (?)", owned)
+		clients := sub().Model(&models.OAuthClient{}).Select("id").Where("owner_id = ?", userID)
+		grants := sub().Model(&models.OAuthAuthorization{}).Select("id").Where("user_id = ? OR client_id IN (?)", userID, clients)
+
+		// each step runs only once the previous one succeeded
+		steps := []func() error{
+			func() error {
+				return tx.Where("workspace_id IN (?) OR owner_id = ?", owned, userID).Delete(&models.Todo{}).Error
+			},
+			func() error {
+				return tx.Where("list_id IN (?) OR user_id = ?", ownedLists, userID).Delete(&models.ListShare{}).Error
+			},
+			func() error { return tx.Where("workspace_id IN (?)", owned).Delete(&models.TodoList{}).Error },
+			func() error {
+				return tx.Where("workspace_id IN (?) OR user_id = ?", owned, userID).Delete(&models.Membership{}).Error
+			},
+			func() error {
+				return tx.Where("workspace_id IN (?) OR inviter_id = ? OR LOWER(email) = ?", owned, userID, strings.ToLower(u.Email)).Delete(&models.Invitation{}).Error
+			},
+			func() error { return tx.Where("owner_id = ?", userID).Delete(&models.Workspace{}).Error },
+			func() error { return tx.Where("user_id = ?", userID).Delete(&models.PersonalAccessToken{}).Error },
+			func() error { return tx.Where("user_id = ?", userID).Delete(&models.RecoveryCode{}).Error },
+			func() error { return tx.Where("user_id = ?", userID).Delete(&models.UserIdentity{}).Error },
+			func() error { return tx.Where("user_id = ?", userID).Delete(&models.Session{}).Error },
+			func() error { return tx.Where("user_id = ?", userID).Delete(&models.MagicLink{}).Error },
+			func() error { return tx.Where("user_id = ?", userID).Delete(&models.PasswordReset{}).Error },
+			func() error { return tx.Where("authorization_id IN (?)", grants).Delete(&models.OAuthToken{}).Error },
+			func() error { return tx.Where("authorization_id IN (?)", grants).Delete(&models.OAuthCode{}).Error },
+			func() error {
+				return tx.Where("user_id = ? OR client_id IN (?)", userID, clients).Delete(&models.OAuthAuthorization{}).Error
+			},
+			func() error { return tx.Where("owner_id = ?", userID).Delete(&models.OAuthClient{}).Error },
+			func() error { return tx.Where("user_id = ?", userID).Delete(&models.DataKey{}).Error },
+		}
+		for _, step := range steps {
+			if err := step(); err != nil {
+				return err
+			}
+		}
+		res := tx.Delete(&models.User{}, userID)
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+		return nil
+	})
+}
+
+type MemoryAccountRepository struct {
+	s *MemoryStore
+}
+
+func NewMemoryAccountRepository(s *MemoryStore) AccountRepository {
+	return &MemoryAccountRepository{s: s}
+}
+
+func (r *MemoryAccountRepository) Export(ctx context.Context, userID uint) (*models.AccountExport, error) {
+	if err := r.s.rlock(ctx); err != nil {
+		return nil, err
+	}
+	defer r.s.runlock(ctx)
+	profile := r.s.users.find(func(u *models.User) bool { return u.ID == userID })
+	if profile == nil {
+		return nil, gorm.ErrRecordNotFound
+	}
+	out := &models.AccountExport{
+		Profile:        *profile,
+		Todos:          r.s.todos.filter(func(t *models.Todo) bool { return t.OwnerID == userID }),
+		Workspaces:     []models.WorkspaceWithRole{},
+		Lists:          r.s.lists.filter(func(l *models.TodoList) bool { return l.OwnerID == userID }),
+		SharedLists:    r.s.sharedWith(userID),
+		Invitations:    r.s.invitations.filter(func(i *models.Invitation) bool { return i.InviterID == userID }),
+		Tokens:         r.s.tokens.filter(func(t *models.PersonalAccessToken) bool { return t.UserID == userID }),
+		Sessions:       r.s.sessions.filter(func(s *models.Session) bool { return s.UserID == userID }),
+		Identities:     r.s.identities.filter(func(i *models.UserIdentity) bool { return i.UserID == userID }),
+		OAuthClients:   r.s.oauthClients.filter(func(c *models.OAuthClient) bool { return c.OwnerID == userID }),
+		AuthorizedApps: r.s.authorizedApps(userID),
+	}
+	for _, ws := range r.s.workspaces.rows {
+		if role := r.s.memberRole(ws.ID, userID); role != "" {
+			out.Workspaces = append(out.Workspaces, models.WorkspaceWithRole{Workspace: ws, Role: role})
+		}
+	}
+	return out, nil
+}
+
+func (r *MemoryAccountRepository) Delete(ctx context.Context, userID uint) error {
+	if err := r.s.lock(ctx); err != nil {
+		return err
+	}
+	defer r.s.unlock(ctx)
+	u := r.s.users.find(func(u *models.User) bool { return u.ID == userID })
+	if u == nil {
+		return gorm.ErrRecordNotFound
+	}
+	var owned, ownedLists, clients []uint
+	for _, ws := range r.s.workspaces.filter(func(w *models.Workspace) bool { return w.OwnerID == userID }) {
+		owned = append(owned, ws.ID)
+	}
+	for _, l := range r.s.lists.filter(func(l *models.TodoList) bool { return containsID(owned, l.WorkspaceID) }) {
+		ownedLists = append(ownedLists, l.ID)
+	}
+	for _, c := range r.s.oauthClients.filter(func(c *models.OAuthClient) bool { return c.OwnerID == userID }) {
+		clients = append(clients, c.ID)
+	}
+
+	r.s.removeTodos(func(t *models.Todo) bool { return containsID(owned, t.WorkspaceID) || t.OwnerID == userID })
+	r.s.shares.remove(func(sh *models.ListShare) bool { return containsID(ownedLists, sh.ListID) || sh.UserID == userID })
+	r.s.lists.remove(func(l *models.TodoList) bool { return containsID(owned, l.WorkspaceID) })
+	r.s.memberships.remove(func(m *models.Membership) bool { return containsID(owned, m.WorkspaceID) || m.UserID == userID })
+	r.s.invitations.remove(func(i *models.Invitation) bool {
+		return containsID(owned, i.WorkspaceID) || i.InviterID == userID || strings.EqualFold(i.Email, u.Email)
+	})
+	r.s.workspaces.remove(func(w *models.Workspace) bool { return w.OwnerID == userID })
+	r.s.tokens.remove(func(t *models.PersonalAccessToken) bool { return t.UserID == userID })
+	r.s.recoveryCodes.remove(func(c *models.RecoveryCode) bool { return c.UserID == userID })
+	r.s.identities.remove(func(i *models.UserIdentity) bool { return i.UserID == userID })
+	r.s.sessions.remove(func(s *models.Session) bool { return s.UserID == userID })
+	r.s.magicLinks.remove(func(l *models.MagicLink) bool { return l.UserID == userID })
+	r.s.passwordResets.remove(func(pr *models.PasswordReset) bool { return pr.UserID == userID })
+	r.s.removeAuthorizations(func(a *models.OAuthAuthorization) bool {
+		return a.UserID == userID || containsID(clients, a.ClientID)
+	})
+	r.s.oauthClients.remove(func(c *models.OAuthClient) bool { return c.OwnerID == userID })
+	r.s.dataKeys.remove(func(k *models.DataKey) bool { return k.UserID == userID })
+	r.s.users.remove(func(u *models.User) bool { return u.ID == userID })
+	return nil
+}
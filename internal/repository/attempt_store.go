@@ -0,0 +1,120 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"github.com/ahmadjafari86/go-todo-list/internal/models"
+)
+
+// AttemptStore keeps failed-attempt counters. The Postgres implementation shares
+// counters across replicas; the in-memory one is for single instances and tests.
+type AttemptStore interface {
+	Get(ctx context.Context, key string) (*models.LoginAttempt, error)
+	// Increment atomically adds a failure for key and returns the new count. A
+	// counter last updated before staleBefore starts again from zero and loses
+	// its lock.
+	Increment(ctx context.Context, key string, at, staleBefore time.Time) (int, error)
+	Lock(ctx context.Context, key string, until time.Time) error
+	Reset(ctx context.Context, key string) error
+}
+
+type GormAttemptStore struct {
+	db *gorm.DB
+}
+
+func NewGormAttemptStore(db *gorm.DB) AttemptStore {
+	return &GormAttemptStore{db: db}
+}
+
+func (r *GormAttemptStore) Get(ctx context.Context, key string) (*models.LoginAttempt, error) {
+	var a models.LoginAttempt
+	if err := conn(ctx, r.db).Where("key = ?", key).First(&a).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &a, nil
+}
+
+func (r *GormAttemptStore) Increment(ctx context.Context, key string, at, staleBefore time.Time) (int, error) {
+	// a single upsert, so concurrent failures neither get lost nor reset each other
+	stale := gorm.Expr("login_attempts.updated_at < ?", staleBefore)
+	a := models.LoginAttempt{Key: key, Failures: 1, UpdatedAt: at}
+	err := conn(ctx, r.db).Clauses(clause.OnConflict{
+		Columns: []clause.Column{{Name: "key"}},
+		DoUpdates: clause.Assignments(map[string]interface{}{
+			"failures":     gorm.Expr("CASE WHEN ? THEN 1 ELSE login_attempts.failures + 1 END", stale),
+			"locked_until": gorm.Expr("CASE WHEN ? THEN NULL ELSE login_attempts.locked_until END", stale),
+			"updated_at":   at,
+		}),
+	}, clause.Returning{Columns: []clause.Column{{Name: "failures"}}}).Create(&a).Error
+	if err != nil {
+		return 0, err
+	}
+	return a.Failures, nil
+}
+
+func (r *GormAttemptStore) Lock(ctx context.Context, key string, until time.Time) error {
+	return conn(ctx, r.db).Model(&models.LoginAttempt{}).Where("key = ?", key).Update("locked_until", until).Error
+}
+
+func (r *GormAttemptStore) Reset(ctx context.Context, key string) error {
+	return conn(ctx, r.db).Where("key = ?", key).Delete(&models.LoginAttempt{}).Error
+}
+
+type MemoryAttemptStore struct {
+	mu       sync.Mutex
+	attempts map[string]models.LoginAttempt
+}
+
+func NewMemoryAttemptStore() AttemptStore {
+	return &MemoryAttemptStore{attempts: make(map[string]models.LoginAttempt)}
+}
+
+func (r *MemoryAttemptStore) Get(ctx context.Context, key string) (*models.LoginAttempt, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	a, ok := r.attempts[key]
+	if !ok {
+		return nil, nil
+	}
+	return &a, nil
+}
+
+func (r *MemoryAttemptStore) Increment(ctx context.Context, key string, at, staleBefore time.Time) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	a := r.attempts[key]
+	if a.UpdatedAt.Before(staleBefore) {
+		a = models.LoginAttempt{}
+	}
+	a.Key = key
+	a.Failures++
+	a.UpdatedAt = at
+	r.attempts[key] = a
+	return a.Failures, nil
+}
+
+func (r *MemoryAttemptStore) Lock(ctx context.Context, key string, until time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if a, ok := r.attempts[key]; ok {
+		a.LockedUntil = &until
+		r.attempts[key] = a
+	}
+	return nil
+}
+
+func (r *MemoryAttemptStore) Reset(ctx context.Context, key string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.attempts, key)
+	return nil
+}
@@ -0,0 +1,406 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	logrus "github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+
+	"github.com/ahmadjafari86/go-todo-list/internal/encryption"
+	"github.com/ahmadjafari86/go-todo-list/internal/models"
+)
+
+// ContentCipher encrypts todo content with the data key of the todo's owner.
+// A user's first data key is created on their first write, and a new one
+// whenever their newest key is wrapped by a master key version that is no
+// longer active. Unwrapped data keys are kept in memory.
+type ContentCipher struct {
+	keys   DataKeyRepository
+	master *encryption.MasterKeys
+
+	mu        sync.RWMutex
+	unwrapped map[uint][]byte
+}
+
+func NewContentCipher(keys DataKeyRepository, master *encryption.MasterKeys) *ContentCipher {
+	return &ContentCipher{keys: keys, master: master, unwrapped: map[uint][]byte{}}
+}
+
+// Encrypt seals plaintext with the current data key of userID.
+func (c *ContentCipher) Encrypt(ctx context.Context, userID uint, plaintext string) (string, error) {
+	seal, err := c.sealer(ctx, userID)
+	if err != nil {
+		return "", err
+	}
+	return seal(plaintext)
+}
+
+// Decrypt opens a sealed value. Values stored before encryption was turned on
+// are returned as they are.
+func (c *ContentCipher) Decrypt(ctx context.Context, value string) (string, error) {
+	if !encryption.IsSealed(value) {
+		return value, nil
+	}
+	id, ok := encryption.KeyID(value)
+	if !ok {
+		return "", encryption.ErrMalformed
+	}
+	key, err := c.dataKey(ctx, id)
+	if err != nil {
+		return "", err
+	}
+	return encryption.Open(key, value)
+}
+
+// Reencrypt moves the content of up to limit users whose data key is wrapped
+// by an old master key version to a new data key, encrypts the content of up
+// to limit users stored before encryption was turned on, and reports how many
+// values it rewrote. An old data key is deleted by the first pass that finds
+// nothing left to rewrite, so a value written with it while the previous pass
+// ran is not lost. The old master key versions must stay configured until
+// then. A user whose content fails to re-encrypt is logged and skipped, and
+// retried by the next pass.
+func (c *ContentCipher) Reencrypt(ctx context.Context, limit int) (int64, error) {
+	var total int64
+	stale, err := c.keys.ListStale(ctx, c.master.Active(), limit)
+	if err != nil {
+		return total, err
+	}
+	for i := range stale {
+		n, err := c.rotate(ctx, &stale[i])
+		total += n
+		if err != nil {
+			if ctx.Err() != nil {
+				return total, ctx.Err()
+			}
+			logrus.Errorf("failed to re-encrypt the content of user %d under data key %d: %v", stale[i].UserID, stale[i].ID, err)
+		}
+	}
+
+	owners, err := c.keys.PlaintextOwners(ctx, limit)
+	if err != nil {
+		return total, err
+	}
+	for _, owner := range owners {
+		n, err := c.sealPlaintext(ctx, owner)
+		total += n
+		if err != nil {
+			if ctx.Err() != nil {
+				return total, ctx.Err()
+			}
+			logrus.Errorf("failed to encrypt the content of user %d: %v", owner, err)
+		}
+	}
+	return total, nil
+}
+
+// rotate moves the content sealed with old to its user's current data key,
+// and deletes old once nothing uses it anymore.
+func (c *ContentCipher) rotate(ctx context.Context, old *models.DataKey) (int64, error) {
+	oldKey, err := c.unwrap(ctx, old)
+	if err != nil {
+		return 0, err
+	}
+	seal, err := c.sealer(ctx, old.UserID)
+	if err != nil {
+		return 0, err
+	}
+	n, err := c.keys.RewriteContent(ctx, old.UserID, func(value string) (string, error) {
+		if id, ok := encryption.KeyID(value); !ok || id != old.ID {
+			return value, nil
+		}
+		plaintext, err := encryption.Open(oldKey, value)
+		if err != nil {
+			return "", err
+		}
+		return seal(plaintext)
+	})
+	if err != nil || n > 0 {
+		return n, err
+	}
+	if err := c.keys.Delete(ctx, old.ID); err != nil {
+		return n, err
+	}
+	c.mu.Lock()
+	delete(c.unwrapped, old.ID)
+	c.mu.Unlock()
+	return n, nil
+}
+
+// sealPlaintext encrypts the user's content stored before encryption was
+// turned on.
+func (c *ContentCipher) sealPlaintext(ctx context.Context, userID uint) (int64, error) {
+	seal, err := c.sealer(ctx, userID)
+	if err != nil {
+		return 0, err
+	}
+	return c.keys.RewriteContent(ctx, userID, func(value string) (string, error) {
+		if encryption.IsSealed(value) {
+			return value, nil
+		}
+		return seal(value)
+	})
+}
+
+// sealer returns a function sealing values with the current data key of
+// userID, creating the key if needed.
+func (c *ContentCipher) sealer(ctx context.Context, userID uint) (func(string) (string, error), error) {
+	current, err := c.keys.Current(ctx, userID)
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+	if err != nil || current.MasterKeyVersion != c.master.Active() {
+		if current, err = c.newDataKey(ctx, userID); err != nil {
+			return nil, err
+		}
+	}
+	key, err := c.unwrap(ctx, current)
+	if err != nil {
+		return nil, err
+	}
+	return func(plaintext string) (string, error) {
+		return encryption.Seal(key, current.ID, plaintext)
+	}, nil
+}
+
+func (c *ContentCipher) newDataKey(ctx context.Context, userID uint) (*models.DataKey, error) {
+	key, err := encryption.NewDataKey()
+	if err != nil {
+		return nil, err
+	}
+	version, wrapped, err := c.master.Wrap(userID, key)
+	if err != nil {
+		return nil, err
+	}
+	dk := &models.DataKey{UserID: userID, MasterKeyVersion: version, WrappedKey: wrapped}
+	if err := c.keys.Create(ctx, dk); err != nil {
+		return nil, err
+	}
+	return dk, nil
+}
+
+func (c *ContentCipher) dataKey(ctx context.Context, id uint) ([]byte, error) {
+	c.mu.RLock()
+	key, ok := c.unwrapped[id]
+	c.mu.RUnlock()
+	if ok {
+		return key, nil
+	}
+	dk, err := c.keys.Get(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	return c.unwrap(ctx, dk)
+}
+
+// unwrap decrypts a data key and remembers it once the key is known to be
+// committed, as a rolled back key's ID may be handed out again.
+func (c *ContentCipher) unwrap(ctx context.Context, dk *models.DataKey) ([]byte, error) {
+	c.mu.RLock()
+	key, ok := c.unwrapped[dk.ID]
+	c.mu.RUnlock()
+	if ok {
+		return key, nil
+	}
+	key, err := c.master.Unwrap(dk.MasterKeyVersion, dk.UserID, dk.WrappedKey)
+	if err != nil {
+		return nil, err
+	}
+	afterCommit(ctx, func() {
+		c.mu.Lock()
+		c.unwrapped[dk.ID] = key
+		c.mu.Unlock()
+	})
+	return key, nil
+}
+
+// EncryptingTodoRepository stores todo titles encrypted and decrypts them on
+// the way out, so callers only ever see plaintext.
+type EncryptingTodoRepository struct {
+	next   TodoRepository
+	cipher *ContentCipher
+}
+
+func NewEncryptingTodoRepository(next TodoRepository, cipher *ContentCipher) TodoRepository {
+	return &EncryptingTodoRepository{next: next, cipher: cipher}
+}
+
+// sealed runs store with todo's title encrypted, and puts the plaintext
+// back afterwards.
+func (r *EncryptingTodoRepository) sealed(ctx context.Context, todo *models.Todo, ownerID uint, store func() error) error {
+	plaintext := todo.Title
+	title, err := r.cipher.Encrypt(ctx, ownerID, plaintext)
+	if err != nil {
+		return err
+	}
+	todo.Title = title
+	err = store()
+	todo.Title = plaintext
+	return err
+}
+
+func (r *EncryptingTodoRepository) open(ctx context.Context, todo *models.Todo) error {
+	title, err := r.cipher.Decrypt(ctx, todo.Title)
+	if err != nil {
+		return err
+	}
+	todo.Title = title
+	return nil
+}
+
+func (r *EncryptingTodoRepository) openAll(ctx context.Context, todos []models.Todo, err error) ([]models.Todo, error) {
+	if err != nil {
+		return nil, err
+	}
+	for i := range todos {
+		if err := r.open(ctx, &todos[i]); err != nil {
+			return nil, err
+		}
+	}
+	return todos, nil
+}
+
+func (r *EncryptingTodoRepository) openOne(ctx context.Context, todo *models.Todo, err error) (*models.Todo, error) {
+	if err != nil {
+		return nil, err
+	}
+	if err := r.open(ctx, todo); err != nil {
+		return nil, err
+	}
+	return todo, nil
+}
+
+func (r *EncryptingTodoRepository) Create(ctx context.Context, todo *models.Todo) error {
+	return r.sealed(ctx, todo, todo.OwnerID, func() error { return r.next.Create(ctx, todo) })
+}
+
+func (r *EncryptingTodoRepository) GetAll(ctx context.Context, userID uint, filter TodoFilter) ([]models.Todo, error) {
+	todos, err := r.next.GetAll(ctx, userID, filter)
+	return r.openAll(ctx, todos, err)
+}
+
+func (r *EncryptingTodoRepository) GetByID(ctx context.Context, id uint, userID uint) (*models.Todo, error) {
+	todo, err := r.next.GetByID(ctx, id, userID)
+	return r.openOne(ctx, todo, err)
+}
+
+func (r *EncryptingTodoRepository) Update(ctx context.Context, todo *models.Todo, userID uint) error {
+	ownerID := todo.OwnerID
+	if ownerID == 0 {
+		var err error
+		if ownerID, err = r.cipher.keys.TodoOwner(ctx, todo.ID); err != nil {
+			return err
+		}
+	}
+	return r.sealed(ctx, todo, ownerID, func() error { return r.next.Update(ctx, todo, userID) })
+}
+
+func (r *EncryptingTodoRepository) Delete(ctx context.Context, id uint, userID uint) error {
+	return r.next.Delete(ctx, id, userID)
+}
+
+func (r *EncryptingTodoRepository) GetTrashed(ctx context.Context, id uint, userID uint) (*models.Todo, error) {
+	todo, err := r.next.GetTrashed(ctx, id, userID)
+	return r.openOne(ctx, todo, err)
+}
+
+func (r *EncryptingTodoRepository) ListTrash(ctx context.Context, userID uint) ([]models.Todo, error) {
+	todos, err := r.next.ListTrash(ctx, userID)
+	return r.openAll(ctx, todos, err)
+}
+
+func (r *EncryptingTodoRepository) Restore(ctx context.Context, id uint, userID uint) error {
+	return r.next.Restore(ctx, id, userID)
+}
+
+func (r *EncryptingTodoRepository) EmptyTrash(ctx context.Context, userID uint) (int64, error) {
+	return r.next.EmptyTrash(ctx, userID)
+}
+
+func (r *EncryptingTodoRepository) PurgeTrash(ctx context.Context, before time.Time) (int64, error) {
+	return r.next.PurgeTrash(ctx, before)
+}
+
+// EncryptingRevisionRepository encrypts the values of encrypted fields in
+// todo histories with the data key of the todo's owner.
+type EncryptingRevisionRepository struct {
+	next   RevisionRepository
+	cipher *ContentCipher
+}
+
+func NewEncryptingRevisionRepository(next RevisionRepository, cipher *ContentCipher) RevisionRepository {
+	return &EncryptingRevisionRepository{next: next, cipher: cipher}
+}
+
+func (r *EncryptingRevisionRepository) Create(ctx context.Context, rev *models.TodoRevision) error {
+	ownerID, err := r.cipher.keys.TodoOwner(ctx, rev.TodoID)
+	if err != nil {
+		return err
+	}
+	seal, err := r.cipher.sealer(ctx, ownerID)
+	if err != nil {
+		return err
+	}
+	plain := rev.Changes
+	rev.Changes = cloneChanges(plain)
+	if _, err := rewriteChanges(rev.Changes, seal); err != nil {
+		rev.Changes = plain
+		return err
+	}
+	err = r.next.Create(ctx, rev)
+	rev.Changes = plain
+	return err
+}
+
+func (r *EncryptingRevisionRepository) ListByTodo(ctx context.Context, todoID uint) ([]models.TodoRevision, error) {
+	revs, err := r.next.ListByTodo(ctx, todoID)
+	if err != nil {
+		return nil, err
+	}
+	open := func(value string) (string, error) { return r.cipher.Decrypt(ctx, value) }
+	for i := range revs {
+		revs[i].Changes = cloneChanges(revs[i].Changes)
+		if _, err := rewriteChanges(revs[i].Changes, open); err != nil {
+			return nil, err
+		}
+	}
+	return revs, nil
+}
+
+// EncryptingAccountRepository decrypts the todos of account exports.
+type EncryptingAccountRepository struct {
+	next   AccountRepository
+	cipher *ContentCipher
+}
+
+func NewEncryptingAccountRepository(next AccountRepository, cipher *ContentCipher) AccountRepository {
+	return &EncryptingAccountRepository{next: next, cipher: cipher}
+}
+
+func (r *EncryptingAccountRepository) Export(ctx context.Context, userID uint) (*models.AccountExport, error) {
+	out, err := r.next.Export(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	for i := range out.Todos {
+		if out.Todos[i].Title, err = r.cipher.Decrypt(ctx, out.Todos[i].Title); err != nil {
+			return nil, err
+		}
+	}
+	return out, nil
+}
+
+func (r *EncryptingAccountRepository) Delete(ctx context.Context, userID uint) error {
+	return r.next.Delete(ctx, userID)
+}
+
+// EncryptContent makes repos store todo content encrypted with cipher. It
+// replaces the repositories that read or write that content.
+func EncryptContent(repos *Repositories, cipher *ContentCipher) {
+	repos.Todos = NewEncryptingTodoRepository(repos.Todos, cipher)
+	repos.Revisions = NewEncryptingRevisionRepository(repos.Revisions, cipher)
+	repos.Accounts = NewEncryptingAccountRepository(repos.Accounts, cipher)
+}
@@ -0,0 +1,340 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"slices"
+
+	"gorm.io/gorm"
+
+	"github.com/ahmadjafari86/go-todo-list/internal/encryption"
+	"github.com/ahmadjafari86/go-todo-list/internal/models"
+)
+
+// encryptedFields are the todo fields stored encrypted, by their name in
+// revision changes. A new content field is encrypted by adding it here and
+// to the encrypting repositories.
+var encryptedFields = map[string]bool{"title": true}
+
+// DataKeyRepository stores the users' data keys, and gives the re-encryption
+// job raw access to the encrypted content. It does no access checks.
+type DataKeyRepository interface {
+	Create(ctx context.Context, key *models.DataKey) error
+	Get(ctx context.Context, id uint) (*models.DataKey, error)
+	// Current returns the user's newest data key.
+	Current(ctx context.Context, userID uint) (*models.DataKey, error)
+	// ListStale returns up to limit keys wrapped by another master key version
+	// than masterKeyVersion.
+	ListStale(ctx context.Context, masterKeyVersion int, limit int) ([]models.DataKey, error)
+	Delete(ctx context.Context, id uint) error
+
+	// TodoOwner returns the owner of a todo, trashed or not.
+	TodoOwner(ctx context.Context, todoID uint) (uint, error)
+	// RewriteContent passes every encrypted field of the user's todos and of
+	// their histories to rewrite, stores the values it changed and reports how
+	// many there were. A todo changed meanwhile keeps its new value.
+	RewriteContent(ctx context.Context, ownerID uint, rewrite func(value string) (string, error)) (int64, error)
+	// PlaintextOwners returns up to limit users with todos or todo histories
+	// whose content is not encrypted yet.
+	PlaintextOwners(ctx context.Context, limit int) ([]uint, error)
+}
+
+type GormDataKeyRepository struct {
+	db *gorm.DB
+}
+
+func NewGormDataKeyRepository(db *gorm.DB) DataKeyRepository {
+	return &GormDataKeyRepository{db: db}
+}
+
+func (r *GormDataKeyRepository) Create(ctx context.Context, key *models.DataKey) error {
+	return conn(ctx, r.db).Create(key).Error
+}
+
+func (r *GormDataKeyRepository) Get(ctx context.Context, id uint) (*models.DataKey, error) {
+	var key models.DataKey
+	if err := conn(ctx, r.db).First(&key, id).Error; err != nil {
+		return nil, err
+	}
+	return &key, nil
+}
+
+func (r *GormDataKeyRepository) Current(ctx context.Context, userID uint) (*models.DataKey, error) {
+	var key models.DataKey
+	if err := conn(ctx, r.db).Where("user_id = ?", userID).Order("id DESC").First(&key).Error; err != nil {
+		return nil, err
+	}
+	return &key, nil
+}
+
+func (r *GormDataKeyRepository) ListStale(ctx context.Context, masterKeyVersion int, limit int) ([]models.DataKey, error) {
+	var keys []models.DataKey
+	err := conn(ctx, r.db).Where("master_key_version <> ?", masterKeyVersion).Order("id").Limit(limit).Find(&keys).Error
+	return keys, err
+}
+
+func (r *GormDataKeyRepository) Delete(ctx context.Context, id uint) error {
+	return conn(ctx, r.db).Delete(&models.DataKey{}, id).Error
+}
+
+func (r *GormDataKeyRepository) TodoOwner(ctx context.Context, todoID uint) (uint, error) {
+	var todo models.Todo
+	if err := conn(ctx, r.db).Select("owner_id").First(&todo, todoID).Error; err != nil {
+		return 0, err
+	}
+	return todo.OwnerID, nil
+}
+
+func (r *GormDataKeyRepository) RewriteContent(ctx context.Context, ownerID uint, rewrite func(string) (string, error)) (int64, error) {
+	db := conn(ctx, r.db)
+	var todos []models.Todo
+	if err := db.Select("id", "title").Where("owner_id = ?", ownerID).Order("id").Find(&todos).Error; err != nil {
+		return 0, err
+	}
+	var n int64
+	for _, t := range todos {
+		title, err := rewrite(t.Title)
+		if err != nil {
+			return n, err
+		}
+		if title == t.Title {
+			continue
+		}
+		// compare-and-set, so a concurrent update is not overwritten
+		res := db.Model(&models.Todo{}).Where("id = ? AND title = ?", t.ID, t.Title).Update("title", title)
+		if res.Error != nil {
+			return n, res.Error
+		}
+		n += res.RowsAffected
+	}
+
+	var revs []models.TodoRevision
+	owned := db.Session(&gorm.Session{NewDB: true}).Model(&models.Todo{}).Select("id").Where("owner_id = ?", ownerID)
+	if err := db.Where("todo_id IN (?)", owned).Order("id").Find(&revs).Error; err != nil {
+		return n, err
+	}
+	for _, rev := range revs {
+		changed, err := rewriteChanges(rev.Changes, rewrite)
+		if err != nil {
+			return n, err
+		}
+		if !changed {
+			continue
+		}
+		if err := db.Model(&rev).Select("changes").Updates(&rev).Error; err != nil {
+			return n, err
+		}
+		n++
+	}
+	return n, nil
+}
+
+func (r *GormDataKeyRepository) PlaintextOwners(ctx context.Context, limit int) ([]uint, error) {
+	db := conn(ctx, r.db)
+	// Changes are stored as JSON in FieldChange order, and a sealed title is
+	// "null" before the todo was created and a sealed string otherwise. Any
+	// other title change still holds plaintext.
+	sealed := encryption.SealedPrefix + "%"
+	revised := db.Session(&gorm.Session{NewDB: true}).Model(&models.TodoRevision{}).Select("todo_id").
+		Where("changes LIKE ?", `%"field":"title"%`).
+		Where("changes NOT LIKE ?", `%"field":"title","before":null,"after":"`+sealed).
+		Where("changes NOT LIKE ?", `%"field":"title","before":"`+encryption.SealedPrefix+`%","after":"`+sealed)
+	var owners []uint
+	err := db.Model(&models.Todo{}).Distinct("owner_id").
+		Where("title NOT LIKE ? OR id IN (?)", sealed, revised).Order("owner_id").Limit(limit).Pluck("owner_id", &owners).Error
+	return owners, err
+}
+
+// rewriteChanges rewrites the string values of encrypted fields in changes
+// in place and reports whether any changed.
+func rewriteChanges(changes []models.FieldChange, rewrite func(string) (string, error)) (bool, error) {
+	changed := false
+	for i := range changes {
+		if !encryptedFields[changes[i].Field] {
+			continue
+		}
+		for _, raw := range []*json.RawMessage{&changes[i].Before, &changes[i].After} {
+			var s string
+			if len(*raw) == 0 || (*raw)[0] != '"' || json.Unmarshal(*raw, &s) != nil {
+				continue
+			}
+			out, err := rewrite(s)
+			if err != nil {
+				return false, err
+			}
+			if out != s {
+				*raw = fieldJSON(out)
+				changed = true
+			}
+		}
+	}
+	return changed, nil
+}
+
+func fieldJSON(s string) json.RawMessage {
+	b, _ := json.Marshal(s)
+	return b
+}
+
+type MemoryDataKeyRepository struct {
+	s *MemoryStore
+}
+
+func NewMemoryDataKeyRepository(s *MemoryStore) DataKeyRepository {
+	return &MemoryDataKeyRepository{s: s}
+}
+
+func (r *MemoryDataKeyRepository) Create(ctx context.Context, key *models.DataKey) error {
+	if err := r.s.lock(ctx); err != nil {
+		return err
+	}
+	defer r.s.unlock(ctx)
+	if !r.s.users.exists(func(u *models.User) bool { return u.ID == key.UserID }) {
+		return gorm.ErrForeignKeyViolated
+	}
+	key.ID = r.s.dataKeys.id(key.ID)
+	stamp(&key.CreatedAt)
+	r.s.dataKeys.insert(*key)
+	return nil
+}
+
+func (r *MemoryDataKeyRepository) Get(ctx context.Context, id uint) (*models.DataKey, error) {
+	if err := r.s.rlock(ctx); err != nil {
+		return nil, err
+	}
+	defer r.s.runlock(ctx)
+	if key := r.s.dataKeys.find(func(k *models.DataKey) bool { return k.ID == id }); key != nil {
+		return key, nil
+	}
+	return nil, gorm.ErrRecordNotFound
+}
+
+func (r *MemoryDataKeyRepository) Current(ctx context.Context, userID uint) (*models.DataKey, error) {
+	if err := r.s.rlock(ctx); err != nil {
+		return nil, err
+	}
+	defer r.s.runlock(ctx)
+	keys := r.s.dataKeys.filter(func(k *models.DataKey) bool { return k.UserID == userID })
+	if len(keys) == 0 {
+		return nil, gorm.ErrRecordNotFound
+	}
+	return &keys[len(keys)-1], nil
+}
+
+func (r *MemoryDataKeyRepository) ListStale(ctx context.Context, masterKeyVersion int, limit int) ([]models.DataKey, error) {
+	if err := r.s.rlock(ctx); err != nil {
+		return nil, err
+	}
+	defer r.s.runlock(ctx)
+	keys := r.s.dataKeys.filter(func(k *models.DataKey) bool { return k.MasterKeyVersion != masterKeyVersion })
+	if len(keys) > limit {
+		keys = keys[:limit]
+	}
+	return keys, nil
+}
+
+func (r *MemoryDataKeyRepository) Delete(ctx context.Context, id uint) error {
+	if err := r.s.lock(ctx); err != nil {
+		return err
+	}
+	defer r.s.unlock(ctx)
+	r.s.dataKeys.remove(func(k *models.DataKey) bool { return k.ID == id })
+	return nil
+}
+
+func (r *MemoryDataKeyRepository) TodoOwner(ctx context.Context, todoID uint) (uint, error) {
+	if err := r.s.rlock(ctx); err != nil {
+		return 0, err
+	}
+	defer r.s.runlock(ctx)
+	if t := r.s.todos.find(func(t *models.Todo) bool { return t.ID == todoID }); t != nil {
+		return t.OwnerID, nil
+	}
+	return 0, gorm.ErrRecordNotFound
+}
+
+func (r *MemoryDataKeyRepository) RewriteContent(ctx context.Context, ownerID uint, rewrite func(string) (string, error)) (int64, error) {
+	if err := r.s.lock(ctx); err != nil {
+		return 0, err
+	}
+	defer r.s.unlock(ctx)
+	var n int64
+	var owned []uint
+	for i := range r.s.todos.rows {
+		t := &r.s.todos.rows[i]
+		if t.OwnerID != ownerID {
+			continue
+		}
+		owned = append(owned, t.ID)
+		title, err := rewrite(t.Title)
+		if err != nil {
+			return n, err
+		}
+		if title != t.Title {
+			t.Title = title
+			n++
+		}
+	}
+	for i := range r.s.revisions.rows {
+		rev := &r.s.revisions.rows[i]
+		if !containsID(owned, rev.TodoID) {
+			continue
+		}
+		// revisions may share their changes with snapshots and callers
+		changes := cloneChanges(rev.Changes)
+		changed, err := rewriteChanges(changes, rewrite)
+		if err != nil {
+			return n, err
+		}
+		if changed {
+			rev.Changes = changes
+			n++
+		}
+	}
+	return n, nil
+}
+
+func (r *MemoryDataKeyRepository) PlaintextOwners(ctx context.Context, limit int) ([]uint, error) {
+	if err := r.s.rlock(ctx); err != nil {
+		return nil, err
+	}
+	defer r.s.runlock(ctx)
+	var revised []uint
+	for _, rev := range r.s.revisions.rows {
+		if plaintextChanges(rev.Changes) {
+			revised = append(revised, rev.TodoID)
+		}
+	}
+	var owners []uint
+	for _, t := range r.s.todos.rows {
+		if !encryption.IsSealed(t.Title) || containsID(revised, t.ID) {
+			if !containsID(owners, t.OwnerID) {
+				owners = append(owners, t.OwnerID)
+			}
+		}
+	}
+	slices.Sort(owners)
+	if len(owners) > limit {
+		owners = owners[:limit]
+	}
+	return owners, nil
+}
+
+// plaintextChanges reports whether an encrypted field in changes holds a
+// value that is not sealed.
+func plaintextChanges(changes []models.FieldChange) bool {
+	plaintext := false
+	rewriteChanges(changes, func(value string) (string, error) {
+		if !encryption.IsSealed(value) {
+			plaintext = true
+		}
+		return value, nil
+	})
+	return plaintext
+}
+
+func cloneChanges(changes []models.FieldChange) []models.FieldChange {
+	out := make([]models.FieldChange, len(changes))
+	copy(out, changes)
+	return out
+}
@@ -0,0 +1,70 @@
+package repository
+
+import (
+	"context"
+	"errors"
+
+	"gorm.io/gorm"
+
+	"github.com/ahmadjafari86/go-todo-list/internal/models"
+)
+
+type IdentityRepository interface {
+	Create(ctx context.Context, identity *models.UserIdentity) error
+	Get(ctx context.Context, provider, subject string) (*models.UserIdentity, error)
+}
+
+type GormIdentityRepository struct {
+	db *gorm.DB
+}
+
+func NewGormIdentityRepository(db *gorm.DB) IdentityRepository {
+	return &GormIdentityRepository{db: db}
+}
+
+func (r *GormIdentityRepository) Create(ctx context.Context, identity *models.UserIdentity) error {
+	return conn(ctx, r.db).Create(identity).Error
+}
+
+func (r *GormIdentityRepository) Get(ctx context.Context, provider, subject string) (*models.UserIdentity, error) {
+	var i models.UserIdentity
+	if err := conn(ctx, r.db).Where("provider = ? AND subject = ?", provider, subject).First(&i).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &i, nil
+}
+
+type MemoryIdentityRepository struct {
+	s *MemoryStore
+}
+
+func NewMemoryIdentityRepository(s *MemoryStore) IdentityRepository {
+	return &MemoryIdentityRepository{s: s}
+}
+
+func (r *MemoryIdentityRepository) Create(ctx context.Context, identity *models.UserIdentity) error {
+	if err := r.s.lock(ctx); err != nil {
+		return err
+	}
+	defer r.s.unlock(ctx)
+	if r.s.identities.exists(func(i *models.UserIdentity) bool {
+		return i.Provider == identity.Provider && i.Subject == identity.Subject
+	}) {
+		return gorm.ErrDuplicatedKey
+	}
+	identity.ID = r.s.identities.id(identity.ID)
+	stamp(&identity.CreatedAt)
+	r.s.identities.insert(*identity)
+	return nil
+}
+
+func (r *MemoryIdentityRepository) Get(ctx context.Context, provider, subject string) (*models.UserIdentity, error) {
+	if err := r.s.rlock(ctx); err != nil {
+		return nil, err
+	}
+	defer r.s.runlock(ctx)
+	return r.s.identities.find(func(i *models.UserIdentity) bool { return i.Provider == provider && i.Subject == subject }), nil
+}
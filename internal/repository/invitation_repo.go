@@ -0,0 +1,149 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"time"
+
+	"gorm.io/gorm"
+
+	"github.com/ahmadjafari86/go-todo-list/internal/models"
+)
+
+type InvitationRepository interface {
+	Create(ctx context.Context, inv *models.Invitation) error
+	GetByID(ctx context.Context, id uint) (*models.Invitation, error)
+	ListPending(ctx context.Context, inviterID uint, now time.Time) ([]models.Invitation, error)
+	// Resolve marks a pending invitation accepted or declined. It returns
+	// gorm.ErrRecordNotFound if the invitation was already used or has expired, so
+	// each invitation can be resolved only once.
+	Resolve(ctx context.Context, id uint, accepted bool, at time.Time) error
+	Delete(ctx context.Context, id, inviterID uint) error
+}
+
+type GormInvitationRepository struct {
+	db *gorm.DB
+}
+
+func NewGormInvitationRepository(db *gorm.DB) InvitationRepository {
+	return &GormInvitationRepository{db: db}
+}
+
+func (r *GormInvitationRepository) Create(ctx context.Context, inv *models.Invitation) error {
+	return conn(ctx, r.db).Create(inv).Error
+}
+
+func (r *GormInvitationRepository) GetByID(ctx context.Context, id uint) (*models.Invitation, error) {
+	var inv models.Invitation
+	if err := conn(ctx, r.db).First(&inv, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &inv, nil
+}
+
+func (r *GormInvitationRepository) ListPending(ctx context.Context, inviterID uint, now time.Time) ([]models.Invitation, error) {
+	var invs []models.Invitation
+	err := conn(ctx, r.db).Where("inviter_id = ? AND accepted_at IS NULL AND declined_at IS NULL AND expires_at > ?", inviterID, now).
+		Order("created_at DESC").Find(&invs).Error
+	return invs, err
+}
+
+func (r *GormInvitationRepository) Resolve(ctx context.Context, id uint, accepted bool, at time.Time) error {
+	column := "declined_at"
+	if accepted {
+		column = "accepted_at"
+	}
+	res := conn(ctx, r.db).Model(&models.Invitation{}).
+		Where("id = ? AND accepted_at IS NULL AND declined_at IS NULL AND expires_at > ?", id, at).
+		Update(column, at)
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+func (r *GormInvitationRepository) Delete(ctx context.Context, id, inviterID uint) error {
+	res := conn(ctx, r.db).Where("id = ? AND inviter_id = ?", id, inviterID).Delete(&models.Invitation{})
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+type MemoryInvitationRepository struct {
+	s *MemoryStore
+}
+
+func NewMemoryInvitationRepository(s *MemoryStore) InvitationRepository {
+	return &MemoryInvitationRepository{s: s}
+}
+
+func (r *MemoryInvitationRepository) Create(ctx context.Context, inv *models.Invitation) error {
+	if err := r.s.lock(ctx); err != nil {
+		return err
+	}
+	defer r.s.unlock(ctx)
+	inv.ID = r.s.invitations.id(inv.ID)
+	stamp(&inv.CreatedAt)
+	r.s.invitations.insert(*inv)
+	return nil
+}
+
+func (r *MemoryInvitationRepository) GetByID(ctx context.Context, id uint) (*models.Invitation, error) {
+	if err := r.s.rlock(ctx); err != nil {
+		return nil, err
+	}
+	defer r.s.runlock(ctx)
+	return r.s.invitations.find(func(i *models.Invitation) bool { return i.ID == id }), nil
+}
+
+func (r *MemoryInvitationRepository) ListPending(ctx context.Context, inviterID uint, now time.Time) ([]models.Invitation, error) {
+	if err := r.s.rlock(ctx); err != nil {
+		return nil, err
+	}
+	defer r.s.runlock(ctx)
+	invs := r.s.invitations.filter(func(i *models.Invitation) bool { return i.InviterID == inviterID && i.Pending(now) })
+	sort.SliceStable(invs, func(i, j int) bool { return invs[i].CreatedAt.After(invs[j].CreatedAt) })
+	return invs, nil
+}
+
+func (r *MemoryInvitationRepository) Resolve(ctx context.Context, id uint, accepted bool, at time.Time) error {
+	if err := r.s.lock(ctx); err != nil {
+		return err
+	}
+	defer r.s.unlock(ctx)
+	n := r.s.invitations.update(func(i *models.Invitation) bool {
+		return i.ID == id && i.Pending(at)
+	}, func(i *models.Invitation) {
+		if accepted {
+			i.AcceptedAt = &at
+		} else {
+			i.DeclinedAt = &at
+		}
+	})
+	if n == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+func (r *MemoryInvitationRepository) Delete(ctx context.Context, id, inviterID uint) error {
+	if err := r.s.lock(ctx); err != nil {
+		return err
+	}
+	defer r.s.unlock(ctx)
+	if r.s.invitations.remove(func(i *models.Invitation) bool { return i.ID == id && i.InviterID == inviterID }) == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
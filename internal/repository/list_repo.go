@@ -0,0 +1,256 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"sort"
+
+	"gorm.io/gorm"
+
+	"github.com/ahmadjafari86/go-todo-list/internal/models"
+)
+
+type ListRepository interface {
+	Create(ctx context.Context, list *models.TodoList) error
+	GetByID(ctx context.Context, id uint) (*models.TodoList, error)
+	// ListForUser returns the lists of every workspace userID is a member of.
+	ListForUser(ctx context.Context, userID uint) ([]models.TodoList, error)
+	// ListSharedWith returns the lists shared with userID together with their permission.
+	ListSharedWith(ctx context.Context, userID uint) ([]models.SharedList, error)
+	// Delete removes the list together with its todos and shares.
+	Delete(ctx context.Context, id uint) error
+
+	GetShare(ctx context.Context, listID, userID uint) (*models.ListShare, error)
+	ListShares(ctx context.Context, listID uint) ([]models.ListShare, error)
+	AddShare(ctx context.Context, share *models.ListShare) error
+	UpdateShare(ctx context.Context, listID, userID uint, permission string) error
+	RemoveShare(ctx context.Context, listID, userID uint) error
+}
+
+type GormListRepository struct {
+	db *gorm.DB
+}
+
+func NewGormListRepository(db *gorm.DB) ListRepository {
+	return &GormListRepository{db: db}
+}
+
+// sharedLists is a subquery selecting the lists shared with userID, optionally
+// restricted to the given permissions.
+func sharedLists(db *gorm.DB, userID uint, permissions []string) *gorm.DB {
+	q := db.Session(&gorm.Session{NewDB: true}).Model(&models.ListShare{}).
+		Select("list_id").Where("user_id = ?", userID)
+	if len(permissions) > 0 {
+		q = q.Where("permission IN ?", permissions)
+	}
+	return q
+}
+
+func (r *GormListRepository) Create(ctx context.Context, list *models.TodoList) error {
+	return conn(ctx, r.db).Create(list).Error
+}
+
+func (r *GormListRepository) GetByID(ctx context.Context, id uint) (*models.TodoList, error) {
+	var l models.TodoList
+	if err := conn(ctx, r.db).First(&l, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &l, nil
+}
+
+func (r *GormListRepository) ListForUser(ctx context.Context, userID uint) ([]models.TodoList, error) {
+	var lists []models.TodoList
+	err := conn(ctx, r.db).Where("workspace_id IN (?)", memberWorkspaces(r.db, userID, nil)).
+		Order("id").Find(&lists).Error
+	return lists, err
+}
+
+func (r *GormListRepository) ListSharedWith(ctx context.Context, userID uint) ([]models.SharedList, error) {
+	out := []models.SharedList{}
+	err := conn(ctx, r.db).Model(&models.TodoList{}).
+		Select("todo_lists.*, list_shares.permission AS permission").
+		Joins("JOIN list_shares ON list_shares.list_id = todo_lists.id").
+		Where("list_shares.user_id = ?", userID).
+		Order("todo_lists.id").
+		Scan(&out).Error
+	return out, err
+}
+
+func (r *GormListRepository) Delete(ctx context.Context, id uint) error {
+	return conn(ctx, r.db).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("list_id = ?", id).Delete(&models.Todo{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("list_id = ?", id).Delete(&models.ListShare{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&models.TodoList{}, id).Error
+	})
+}
+
+func (r *GormListRepository) GetShare(ctx context.Context, listID, userID uint) (*models.ListShare, error) {
+	var s models.ListShare
+	if err := conn(ctx, r.db).Where("list_id = ? AND user_id = ?", listID, userID).First(&s).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &s, nil
+}
+
+func (r *GormListRepository) ListShares(ctx context.Context, listID uint) ([]models.ListShare, error) {
+	var shares []models.ListShare
+	err := conn(ctx, r.db).Where("list_id = ?", listID).Order("created_at").Find(&shares).Error
+	return shares, err
+}
+
+func (r *GormListRepository) AddShare(ctx context.Context, share *models.ListShare) error {
+	return conn(ctx, r.db).Create(share).Error
+}
+
+func (r *GormListRepository) UpdateShare(ctx context.Context, listID, userID uint, permission string) error {
+	res := conn(ctx, r.db).Model(&models.ListShare{}).
+		Where("list_id = ? AND user_id = ?", listID, userID).
+		Update("permission", permission)
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+func (r *GormListRepository) RemoveShare(ctx context.Context, listID, userID uint) error {
+	res := conn(ctx, r.db).Where("list_id = ? AND user_id = ?", listID, userID).Delete(&models.ListShare{})
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+type MemoryListRepository struct {
+	s *MemoryStore
+}
+
+func NewMemoryListRepository(s *MemoryStore) ListRepository {
+	return &MemoryListRepository{s: s}
+}
+
+func (r *MemoryListRepository) Create(ctx context.Context, list *models.TodoList) error {
+	if err := r.s.lock(ctx); err != nil {
+		return err
+	}
+	defer r.s.unlock(ctx)
+	list.ID = r.s.lists.id(list.ID)
+	stamp(&list.CreatedAt)
+	r.s.lists.insert(*list)
+	return nil
+}
+
+func (r *MemoryListRepository) GetByID(ctx context.Context, id uint) (*models.TodoList, error) {
+	if err := r.s.rlock(ctx); err != nil {
+		return nil, err
+	}
+	defer r.s.runlock(ctx)
+	return r.s.lists.find(func(l *models.TodoList) bool { return l.ID == id }), nil
+}
+
+func (r *MemoryListRepository) ListForUser(ctx context.Context, userID uint) ([]models.TodoList, error) {
+	if err := r.s.rlock(ctx); err != nil {
+		return nil, err
+	}
+	defer r.s.runlock(ctx)
+	return r.s.lists.filter(func(l *models.TodoList) bool { return r.s.memberRole(l.WorkspaceID, userID) != "" }), nil
+}
+
+func (r *MemoryListRepository) ListSharedWith(ctx context.Context, userID uint) ([]models.SharedList, error) {
+	if err := r.s.rlock(ctx); err != nil {
+		return nil, err
+	}
+	defer r.s.runlock(ctx)
+	return r.s.sharedWith(userID), nil
+}
+
+// sharedWith mirrors the list_shares join of ListSharedWith; the caller holds the lock.
+func (s *MemoryStore) sharedWith(userID uint) []models.SharedList {
+	out := []models.SharedList{}
+	for _, l := range s.lists.filter(func(l *models.TodoList) bool { return s.sharePermission(l.ID, userID) != "" }) {
+		out = append(out, models.SharedList{TodoList: l, Permission: s.sharePermission(l.ID, userID)})
+	}
+	return out
+}
+
+func (r *MemoryListRepository) Delete(ctx context.Context, id uint) error {
+	if err := r.s.lock(ctx); err != nil {
+		return err
+	}
+	defer r.s.unlock(ctx)
+	r.s.removeTodos(func(t *models.Todo) bool { return t.ListID == id })
+	r.s.shares.remove(func(sh *models.ListShare) bool { return sh.ListID == id })
+	r.s.lists.remove(func(l *models.TodoList) bool { return l.ID == id })
+	return nil
+}
+
+func (r *MemoryListRepository) GetShare(ctx context.Context, listID, userID uint) (*models.ListShare, error) {
+	if err := r.s.rlock(ctx); err != nil {
+		return nil, err
+	}
+	defer r.s.runlock(ctx)
+	return r.s.shares.find(func(sh *models.ListShare) bool { return sh.ListID == listID && sh.UserID == userID }), nil
+}
+
+func (r *MemoryListRepository) ListShares(ctx context.Context, listID uint) ([]models.ListShare, error) {
+	if err := r.s.rlock(ctx); err != nil {
+		return nil, err
+	}
+	defer r.s.runlock(ctx)
+	shares := r.s.shares.filter(func(sh *models.ListShare) bool { return sh.ListID == listID })
+	sort.SliceStable(shares, func(i, j int) bool { return shares[i].CreatedAt.Before(shares[j].CreatedAt) })
+	return shares, nil
+}
+
+func (r *MemoryListRepository) AddShare(ctx context.Context, share *models.ListShare) error {
+	if err := r.s.lock(ctx); err != nil {
+		return err
+	}
+	defer r.s.unlock(ctx)
+	if r.s.sharePermission(share.ListID, share.UserID) != "" {
+		return gorm.ErrDuplicatedKey
+	}
+	stamp(&share.CreatedAt)
+	r.s.shares.insert(*share)
+	return nil
+}
+
+func (r *MemoryListRepository) UpdateShare(ctx context.Context, listID, userID uint, permission string) error {
+	if err := r.s.lock(ctx); err != nil {
+		return err
+	}
+	defer r.s.unlock(ctx)
+	n := r.s.shares.update(func(sh *models.ListShare) bool {
+		return sh.ListID == listID && sh.UserID == userID
+	}, func(sh *models.ListShare) { sh.Permission = permission })
+	if n == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+func (r *MemoryListRepository) RemoveShare(ctx context.Context, listID, userID uint) error {
+	if err := r.s.lock(ctx); err != nil {
+		return err
+	}
+	defer r.s.unlock(ctx)
+	if r.s.shares.remove(func(sh *models.ListShare) bool { return sh.ListID == listID && sh.UserID == userID }) == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
@@ -0,0 +1,99 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+
+	"github.com/ahmadjafari86/go-todo-list/internal/models"
+)
+
+type MagicLinkRepository interface {
+	Create(ctx context.Context, link *models.MagicLink) error
+	GetByHash(ctx context.Context, tokenHash string) (*models.MagicLink, error)
+	// Consume marks an unused, unexpired link as used. It returns
+	// gorm.ErrRecordNotFound if the link was already used or has expired.
+	Consume(ctx context.Context, id uint, at time.Time) error
+}
+
+type GormMagicLinkRepository struct {
+	db *gorm.DB
+}
+
+func NewGormMagicLinkRepository(db *gorm.DB) MagicLinkRepository {
+	return &GormMagicLinkRepository{db: db}
+}
+
+func (r *GormMagicLinkRepository) Create(ctx context.Context, link *models.MagicLink) error {
+	return conn(ctx, r.db).Create(link).Error
+}
+
+func (r *GormMagicLinkRepository) GetByHash(ctx context.Context, tokenHash string) (*models.MagicLink, error) {
+	var l models.MagicLink
+	if err := conn(ctx, r.db).Where("token_hash = ?", tokenHash).First(&l).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &l, nil
+}
+
+func (r *GormMagicLinkRepository) Consume(ctx context.Context, id uint, at time.Time) error {
+	res := conn(ctx, r.db).Model(&models.MagicLink{}).
+		Where("id = ? AND used_at IS NULL AND expires_at > ?", id, at).
+		Update("used_at", at)
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+type MemoryMagicLinkRepository struct {
+	s *MemoryStore
+}
+
+func NewMemoryMagicLinkRepository(s *MemoryStore) MagicLinkRepository {
+	return &MemoryMagicLinkRepository{s: s}
+}
+
+func (r *MemoryMagicLinkRepository) Create(ctx context.Context, link *models.MagicLink) error {
+	if err := r.s.lock(ctx); err != nil {
+		return err
+	}
+	defer r.s.unlock(ctx)
+	if r.s.magicLinks.exists(func(l *models.MagicLink) bool { return l.TokenHash == link.TokenHash }) {
+		return gorm.ErrDuplicatedKey
+	}
+	link.ID = r.s.magicLinks.id(link.ID)
+	stamp(&link.CreatedAt)
+	r.s.magicLinks.insert(*link)
+	return nil
+}
+
+func (r *MemoryMagicLinkRepository) GetByHash(ctx context.Context, tokenHash string) (*models.MagicLink, error) {
+	if err := r.s.rlock(ctx); err != nil {
+		return nil, err
+	}
+	defer r.s.runlock(ctx)
+	return r.s.magicLinks.find(func(l *models.MagicLink) bool { return l.TokenHash == tokenHash }), nil
+}
+
+func (r *MemoryMagicLinkRepository) Consume(ctx context.Context, id uint, at time.Time) error {
+	if err := r.s.lock(ctx); err != nil {
+		return err
+	}
+	defer r.s.unlock(ctx)
+	n := r.s.magicLinks.update(func(l *models.MagicLink) bool {
+		return l.ID == id && l.UsedAt == nil && l.ExpiresAt.After(at)
+	}, func(l *models.MagicLink) { l.UsedAt = &at })
+	if n == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
@@ -0,0 +1,218 @@
+package repository
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/ahmadjafari86/go-todo-list/internal/models"
+)
+
+// MemoryStore holds every table of the in-memory repositories. Repositories
+// built on the same store see each other's rows, like GORM repositories sharing
+// a database, and a single lock keeps multi-table operations such as cascading
+// deletes atomic.
+type MemoryStore struct {
+	mu sync.RWMutex
+	memTables
+}
+
+type memTables struct {
+	users               memTable[models.User]
+	todos               memTable[models.Todo]
+	revisions           memTable[models.TodoRevision]
+	workspaces          memTable[models.Workspace]
+	memberships         memTable[models.Membership]
+	lists               memTable[models.TodoList]
+	shares              memTable[models.ListShare]
+	invitations         memTable[models.Invitation]
+	tokens              memTable[models.PersonalAccessToken]
+	recoveryCodes       memTable[models.RecoveryCode]
+	identities          memTable[models.UserIdentity]
+	sessions            memTable[models.Session]
+	magicLinks          memTable[models.MagicLink]
+	passwordResets      memTable[models.PasswordReset]
+	oauthClients        memTable[models.OAuthClient]
+	oauthAuthorizations memTable[models.OAuthAuthorization]
+	oauthCodes          memTable[models.OAuthCode]
+	oauthTokens         memTable[models.OAuthToken]
+	dataKeys            memTable[models.DataKey]
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{}
+}
+
+// lock takes the write lock unless ctx is already done, so cancelled requests
+// fail the same way as with a database. Inside a transaction the lock is
+// already held by WithinTx and is not taken again.
+func (s *MemoryStore) lock(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if !s.inTx(ctx) {
+		s.mu.Lock()
+	}
+	return nil
+}
+
+func (s *MemoryStore) unlock(ctx context.Context) {
+	if !s.inTx(ctx) {
+		s.mu.Unlock()
+	}
+}
+
+func (s *MemoryStore) rlock(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if !s.inTx(ctx) {
+		s.mu.RLock()
+	}
+	return nil
+}
+
+func (s *MemoryStore) runlock(ctx context.Context) {
+	if !s.inTx(ctx) {
+		s.mu.RUnlock()
+	}
+}
+
+// memTable is one table of a MemoryStore. Rows are kept in insertion order,
+// which is also primary key order. Callers hold the store lock.
+type memTable[T any] struct {
+	rows   []T
+	lastID uint
+}
+
+// id returns the primary key for a new row: id itself when the caller chose one,
+// otherwise the next value of the sequence.
+func (t *memTable[T]) id(id uint) uint {
+	if id == 0 {
+		t.lastID++
+		return t.lastID
+	}
+	if id > t.lastID {
+		t.lastID = id
+	}
+	return id
+}
+
+func (t *memTable[T]) insert(row T) {
+	t.rows = append(t.rows, row)
+}
+
+// find returns a copy of the first row matching match, or nil.
+func (t *memTable[T]) find(match func(*T) bool) *T {
+	for i := range t.rows {
+		if match(&t.rows[i]) {
+			row := t.rows[i]
+			return &row
+		}
+	}
+	return nil
+}
+
+func (t *memTable[T]) exists(match func(*T) bool) bool {
+	return t.find(match) != nil
+}
+
+// filter returns copies of the rows matching match. The result is never nil, so
+// it encodes as an empty JSON array like the slices GORM fills.
+func (t *memTable[T]) filter(match func(*T) bool) []T {
+	out := []T{}
+	for i := range t.rows {
+		if match(&t.rows[i]) {
+			out = append(out, t.rows[i])
+		}
+	}
+	return out
+}
+
+// update applies change to every row matching match and reports how many
+// rows it changed.
+func (t *memTable[T]) update(match func(*T) bool, change func(*T)) int64 {
+	var n int64
+	for i := range t.rows {
+		if match(&t.rows[i]) {
+			change(&t.rows[i])
+			n++
+		}
+	}
+	return n
+}
+
+// remove deletes every row matching match and reports how many there were.
+func (t *memTable[T]) remove(match func(*T) bool) int64 {
+	kept := t.rows[:0]
+	for _, row := range t.rows {
+		if !match(&row) {
+			kept = append(kept, row)
+		}
+	}
+	n := int64(len(t.rows) - len(kept))
+	var zero T
+	for i := len(kept); i < len(t.rows); i++ {
+		t.rows[i] = zero
+	}
+	t.rows = kept
+	return n
+}
+
+// stamp fills a zero timestamp with the current time, as GORM does for CreatedAt.
+func stamp(ts *time.Time) {
+	if ts.IsZero() {
+		*ts = time.Now()
+	}
+}
+
+func containsID(ids []uint, id uint) bool {
+	for _, v := range ids {
+		if v == id {
+			return true
+		}
+	}
+	return false
+}
+
+// removeTodos deletes the todos matching match with their revisions, like the
+// cascading foreign key does in the database, and reports how many there were.
+func (s *MemoryStore) removeTodos(match func(*models.Todo) bool) int64 {
+	var ids []uint
+	for _, t := range s.todos.filter(match) {
+		ids = append(ids, t.ID)
+	}
+	s.revisions.remove(func(v *models.TodoRevision) bool { return containsID(ids, v.TodoID) })
+	return s.todos.remove(match)
+}
+
+// memberRole returns userID's role in the workspace, or "" if they are not a member.
+func (s *MemoryStore) memberRole(workspaceID, userID uint) string {
+	if m := s.memberships.find(func(m *models.Membership) bool {
+		return m.WorkspaceID == workspaceID && m.UserID == userID
+	}); m != nil {
+		return m.Role
+	}
+	return ""
+}
+
+// sharePermission returns the permission the list is shared with userID, or "".
+func (s *MemoryStore) sharePermission(listID, userID uint) string {
+	if sh := s.shares.find(func(sh *models.ListShare) bool {
+		return sh.ListID == listID && sh.UserID == userID
+	}); sh != nil {
+		return sh.Permission
+	}
+	return ""
+}
+
+// todoReadable mirrors readableBy.
+func (s *MemoryStore) todoReadable(t *models.Todo, userID uint) bool {
+	return s.memberRole(t.WorkspaceID, userID) != "" || s.sharePermission(t.ListID, userID) != ""
+}
+
+// todoWritable mirrors writableBy.
+func (s *MemoryStore) todoWritable(t *models.Todo, userID uint) bool {
+	return models.CanWriteTodos(s.memberRole(t.WorkspaceID, userID)) ||
+		models.CanWriteShared(s.sharePermission(t.ListID, userID))
+}
@@ -0,0 +1,429 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"github.com/ahmadjafari86/go-todo-list/internal/models"
+)
+
+type OAuthRepository interface {
+	CreateClient(ctx context.Context, client *models.OAuthClient) error
+	GetClient(ctx context.Context, clientID string) (*models.OAuthClient, error)
+	ListClients(ctx context.Context, ownerID uint) ([]models.OAuthClient, error)
+	// DeleteClient removes the client with its authorizations, codes and tokens.
+	DeleteClient(ctx context.Context, id, ownerID uint) error
+
+	GetAuthorization(ctx context.Context, id uint) (*models.OAuthAuthorization, error)
+	// SaveAuthorization records consent for the user and client, replacing the
+	// scopes of an earlier (possibly revoked) authorization.
+	SaveAuthorization(ctx context.Context, a *models.OAuthAuthorization) error
+	ListAuthorizedApps(ctx context.Context, userID uint) ([]models.AuthorizedApp, error)
+	// RevokeAuthorization revokes the authorization and all of its tokens.
+	RevokeAuthorization(ctx context.Context, id, userID uint, at time.Time) error
+
+	CreateCode(ctx context.Context, code *models.OAuthCode) error
+	GetCodeByHash(ctx context.Context, hash string) (*models.OAuthCode, error)
+	// ConsumeCode marks an unused, unexpired code as used. It returns
+	// gorm.ErrRecordNotFound if the code was already used or has expired.
+	ConsumeCode(ctx context.Context, id uint, at time.Time) error
+
+	CreateToken(ctx context.Context, token *models.OAuthToken) error
+	GetTokenByAccessHash(ctx context.Context, hash string) (*models.OAuthToken, error)
+	GetTokenByRefreshHash(ctx context.Context, hash string) (*models.OAuthToken, error)
+	// RevokeToken revokes an active token pair. It returns gorm.ErrRecordNotFound
+	// if the pair was already revoked.
+	RevokeToken(ctx context.Context, id uint, at time.Time) error
+}
+
+type GormOAuthRepository struct {
+	db *gorm.DB
+}
+
+func NewGormOAuthRepository(db *gorm.DB) OAuthRepository {
+	return &GormOAuthRepository{db: db}
+}
+
+func (r *GormOAuthRepository) CreateClient(ctx context.Context, client *models.OAuthClient) error {
+	return conn(ctx, r.db).Create(client).Error
+}
+
+func (r *GormOAuthRepository) GetClient(ctx context.Context, clientID string) (*models.OAuthClient, error) {
+	var c models.OAuthClient
+	if err := conn(ctx, r.db).Where("client_id = ?", clientID).First(&c).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &c, nil
+}
+
+func (r *GormOAuthRepository) ListClients(ctx context.Context, ownerID uint) ([]models.OAuthClient, error) {
+	clients := []models.OAuthClient{}
+	err := conn(ctx, r.db).Where("owner_id = ?", ownerID).Order("id").Find(&clients).Error
+	return clients, err
+}
+
+func (r *GormOAuthRepository) DeleteClient(ctx context.Context, id, ownerID uint) error {
+	return conn(ctx, r.db).Transaction(func(tx *gorm.DB) error {
+		res := tx.Where("id = ? AND owner_id = ?", id, ownerID).Delete(&models.OAuthClient{})
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+		auths := tx.Session(&gorm.Session{NewDB: true}).Model(&models.OAuthAuthorization{}).Select("id").Where("client_id = ?", id)
+		if err := tx.Where("authorization_id IN (?)", auths).Delete(&models.OAuthToken{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("authorization_id IN (?)", auths).Delete(&models.OAuthCode{}).Error; err != nil {
+			return err
+		}
+		return tx.Where("client_id = ?", id).Delete(&models.OAuthAuthorization{}).Error
+	})
+}
+
+func (r *GormOAuthRepository) GetAuthorization(ctx context.Context, id uint) (*models.OAuthAuthorization, error) {
+	var a models.OAuthAuthorization
+	if err := conn(ctx, r.db).First(&a, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &a, nil
+}
+
+func (r *GormOAuthRepository) SaveAuthorization(ctx context.Context, a *models.OAuthAuthorization) error {
+	a.RevokedAt = nil
+	err := conn(ctx, r.db).Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "user_id"}, {Name: "client_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"scopes", "revoked_at", "updated_at"}),
+	}).Create(a).Error
+	if err != nil {
+		return err
+	}
+	// the upsert does not report the id of an existing row on every database
+	return conn(ctx, r.db).Where("user_id = ? AND client_id = ?", a.UserID, a.ClientID).First(a).Error
+}
+
+func (r *GormOAuthRepository) ListAuthorizedApps(ctx context.Context, userID uint) ([]models.AuthorizedApp, error) {
+	apps := []models.AuthorizedApp{}
+	err := conn(ctx, r.db).Model(&models.OAuthAuthorization{}).
+		Select("oauth_authorizations.id, oauth_clients.client_id, oauth_clients.name, "+
+			"oauth_authorizations.scopes, oauth_authorizations.updated_at AS authorized_at").
+		Joins("JOIN oauth_clients ON oauth_clients.id = oauth_authorizations.client_id").
+		Where("oauth_authorizations.user_id = ? AND oauth_authorizations.revoked_at IS NULL", userID).
+		Order("oauth_authorizations.id").
+		Scan(&apps).Error
+	return apps, err
+}
+
+func (r *GormOAuthRepository) RevokeAuthorization(ctx context.Context, id, userID uint, at time.Time) error {
+	return conn(ctx, r.db).Transaction(func(tx *gorm.DB) error {
+		res := tx.Model(&models.OAuthAuthorization{}).
+			Where("id = ? AND user_id = ? AND revoked_at IS NULL", id, userID).
+			Update("revoked_at", at)
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+		return tx.Model(&models.OAuthToken{}).
+			Where("authorization_id = ? AND revoked_at IS NULL", id).
+			Update("revoked_at", at).Error
+	})
+}
+
+func (r *GormOAuthRepository) CreateCode(ctx context.Context, code *models.OAuthCode) error {
+	return conn(ctx, r.db).Create(code).Error
+}
+
+func (r *GormOAuthRepository) GetCodeByHash(ctx context.Context, hash string) (*models.OAuthCode, error) {
+	var c models.OAuthCode
+	if err := conn(ctx, r.db).Where("code_hash = ?", hash).First(&c).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &c, nil
+}
+
+func (r *GormOAuthRepository) ConsumeCode(ctx context.Context, id uint, at time.Time) error {
+	res := conn(ctx, r.db).Model(&models.OAuthCode{}).
+		Where("id = ? AND used_at IS NULL AND expires_at > ?", id, at).
+		Update("used_at", at)
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+func (r *GormOAuthRepository) CreateToken(ctx context.Context, token *models.OAuthToken) error {
+	return conn(ctx, r.db).Create(token).Error
+}
+
+func (r *GormOAuthRepository) GetTokenByAccessHash(ctx context.Context, hash string) (*models.OAuthToken, error) {
+	return r.tokenWhere(ctx, "access_hash = ?", hash)
+}
+
+func (r *GormOAuthRepository) GetTokenByRefreshHash(ctx context.Context, hash string) (*models.OAuthToken, error) {
+	return r.tokenWhere(ctx, "refresh_hash = ?", hash)
+}
+
+func (r *GormOAuthRepository) tokenWhere(ctx context.Context, query string, args ...interface{}) (*models.OAuthToken, error) {
+	var t models.OAuthToken
+	if err := conn(ctx, r.db).Where(query, args...).First(&t).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &t, nil
+}
+
+func (r *GormOAuthRepository) RevokeToken(ctx context.Context, id uint, at time.Time) error {
+	res := conn(ctx, r.db).Model(&models.OAuthToken{}).
+		Where("id = ? AND revoked_at IS NULL", id).
+		Update("revoked_at", at)
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+type MemoryOAuthRepository struct {
+	s *MemoryStore
+}
+
+func NewMemoryOAuthRepository(s *MemoryStore) OAuthRepository {
+	return &MemoryOAuthRepository{s: s}
+}
+
+func (r *MemoryOAuthRepository) CreateClient(ctx context.Context, client *models.OAuthClient) error {
+	if err := r.s.lock(ctx); err != nil {
+		return err
+	}
+	defer r.s.unlock(ctx)
+	if r.s.oauthClients.exists(func(c *models.OAuthClient) bool { return c.ClientID == client.ClientID }) {
+		return gorm.ErrDuplicatedKey
+	}
+	client.ID = r.s.oauthClients.id(client.ID)
+	stamp(&client.CreatedAt)
+	r.s.oauthClients.insert(*client)
+	return nil
+}
+
+func (r *MemoryOAuthRepository) GetClient(ctx context.Context, clientID string) (*models.OAuthClient, error) {
+	if err := r.s.rlock(ctx); err != nil {
+		return nil, err
+	}
+	defer r.s.runlock(ctx)
+	return r.s.oauthClients.find(func(c *models.OAuthClient) bool { return c.ClientID == clientID }), nil
+}
+
+func (r *MemoryOAuthRepository) ListClients(ctx context.Context, ownerID uint) ([]models.OAuthClient, error) {
+	if err := r.s.rlock(ctx); err != nil {
+		return nil, err
+	}
+	defer r.s.runlock(ctx)
+	return r.s.oauthClients.filter(func(c *models.OAuthClient) bool { return c.OwnerID == ownerID }), nil
+}
+
+func (r *MemoryOAuthRepository) DeleteClient(ctx context.Context, id, ownerID uint) error {
+	if err := r.s.lock(ctx); err != nil {
+		return err
+	}
+	defer r.s.unlock(ctx)
+	if r.s.oauthClients.remove(func(c *models.OAuthClient) bool { return c.ID == id && c.OwnerID == ownerID }) == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	r.s.removeAuthorizations(func(a *models.OAuthAuthorization) bool { return a.ClientID == id })
+	return nil
+}
+
+// removeAuthorizations deletes the matching authorizations with their codes and
+// tokens; the caller holds the lock.
+func (s *MemoryStore) removeAuthorizations(match func(*models.OAuthAuthorization) bool) {
+	var ids []uint
+	for _, a := range s.oauthAuthorizations.filter(match) {
+		ids = append(ids, a.ID)
+	}
+	s.oauthTokens.remove(func(t *models.OAuthToken) bool { return containsID(ids, t.AuthorizationID) })
+	s.oauthCodes.remove(func(c *models.OAuthCode) bool { return containsID(ids, c.AuthorizationID) })
+	s.oauthAuthorizations.remove(match)
+}
+
+func (r *MemoryOAuthRepository) GetAuthorization(ctx context.Context, id uint) (*models.OAuthAuthorization, error) {
+	if err := r.s.rlock(ctx); err != nil {
+		return nil, err
+	}
+	defer r.s.runlock(ctx)
+	return r.s.oauthAuthorizations.find(func(a *models.OAuthAuthorization) bool { return a.ID == id }), nil
+}
+
+func (r *MemoryOAuthRepository) SaveAuthorization(ctx context.Context, a *models.OAuthAuthorization) error {
+	if err := r.s.lock(ctx); err != nil {
+		return err
+	}
+	defer r.s.unlock(ctx)
+	now := time.Now()
+	match := func(row *models.OAuthAuthorization) bool { return row.UserID == a.UserID && row.ClientID == a.ClientID }
+	n := r.s.oauthAuthorizations.update(match, func(row *models.OAuthAuthorization) {
+		row.Scopes = a.Scopes
+		row.RevokedAt = nil
+		row.UpdatedAt = now
+	})
+	if n == 0 {
+		a.ID = r.s.oauthAuthorizations.id(a.ID)
+		a.RevokedAt = nil
+		stamp(&a.CreatedAt)
+		a.UpdatedAt = now
+		r.s.oauthAuthorizations.insert(*a)
+	}
+	*a = *r.s.oauthAuthorizations.find(match)
+	return nil
+}
+
+func (r *MemoryOAuthRepository) ListAuthorizedApps(ctx context.Context, userID uint) ([]models.AuthorizedApp, error) {
+	if err := r.s.rlock(ctx); err != nil {
+		return nil, err
+	}
+	defer r.s.runlock(ctx)
+	return r.s.authorizedApps(userID), nil
+}
+
+// authorizedApps mirrors the oauth_clients join of ListAuthorizedApps; the
+// caller holds the lock.
+func (s *MemoryStore) authorizedApps(userID uint) []models.AuthorizedApp {
+	apps := []models.AuthorizedApp{}
+	for _, a := range s.oauthAuthorizations.filter(func(a *models.OAuthAuthorization) bool {
+		return a.UserID == userID && a.RevokedAt == nil
+	}) {
+		c := s.oauthClients.find(func(c *models.OAuthClient) bool { return c.ID == a.ClientID })
+		if c == nil {
+			continue
+		}
+		apps = append(apps, models.AuthorizedApp{
+			ID:           a.ID,
+			ClientID:     c.ClientID,
+			Name:         c.Name,
+			Scopes:       a.Scopes,
+			AuthorizedAt: a.UpdatedAt,
+		})
+	}
+	return apps
+}
+
+func (r *MemoryOAuthRepository) RevokeAuthorization(ctx context.Context, id, userID uint, at time.Time) error {
+	if err := r.s.lock(ctx); err != nil {
+		return err
+	}
+	defer r.s.unlock(ctx)
+	n := r.s.oauthAuthorizations.update(func(a *models.OAuthAuthorization) bool {
+		return a.ID == id && a.UserID == userID && a.RevokedAt == nil
+	}, func(a *models.OAuthAuthorization) { a.RevokedAt = &at })
+	if n == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	r.s.oauthTokens.update(func(t *models.OAuthToken) bool {
+		return t.AuthorizationID == id && t.RevokedAt == nil
+	}, func(t *models.OAuthToken) { t.RevokedAt = &at })
+	return nil
+}
+
+func (r *MemoryOAuthRepository) CreateCode(ctx context.Context, code *models.OAuthCode) error {
+	if err := r.s.lock(ctx); err != nil {
+		return err
+	}
+	defer r.s.unlock(ctx)
+	if r.s.oauthCodes.exists(func(c *models.OAuthCode) bool { return c.CodeHash == code.CodeHash }) {
+		return gorm.ErrDuplicatedKey
+	}
+	code.ID = r.s.oauthCodes.id(code.ID)
+	stamp(&code.CreatedAt)
+	r.s.oauthCodes.insert(*code)
+	return nil
+}
+
+func (r *MemoryOAuthRepository) GetCodeByHash(ctx context.Context, hash string) (*models.OAuthCode, error) {
+	if err := r.s.rlock(ctx); err != nil {
+		return nil, err
+	}
+	defer r.s.runlock(ctx)
+	return r.s.oauthCodes.find(func(c *models.OAuthCode) bool { return c.CodeHash == hash }), nil
+}
+
+func (r *MemoryOAuthRepository) ConsumeCode(ctx context.Context, id uint, at time.Time) error {
+	if err := r.s.lock(ctx); err != nil {
+		return err
+	}
+	defer r.s.unlock(ctx)
+	n := r.s.oauthCodes.update(func(c *models.OAuthCode) bool {
+		return c.ID == id && c.UsedAt == nil && c.ExpiresAt.After(at)
+	}, func(c *models.OAuthCode) { c.UsedAt = &at })
+	if n == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+func (r *MemoryOAuthRepository) CreateToken(ctx context.Context, token *models.OAuthToken) error {
+	if err := r.s.lock(ctx); err != nil {
+		return err
+	}
+	defer r.s.unlock(ctx)
+	if r.s.oauthTokens.exists(func(t *models.OAuthToken) bool {
+		return t.AccessHash == token.AccessHash || t.RefreshHash == token.RefreshHash
+	}) {
+		return gorm.ErrDuplicatedKey
+	}
+	token.ID = r.s.oauthTokens.id(token.ID)
+	stamp(&token.CreatedAt)
+	r.s.oauthTokens.insert(*token)
+	return nil
+}
+
+func (r *MemoryOAuthRepository) GetTokenByAccessHash(ctx context.Context, hash string) (*models.OAuthToken, error) {
+	if err := r.s.rlock(ctx); err != nil {
+		return nil, err
+	}
+	defer r.s.runlock(ctx)
+	return r.s.oauthTokens.find(func(t *models.OAuthToken) bool { return t.AccessHash == hash }), nil
+}
+
+func (r *MemoryOAuthRepository) GetTokenByRefreshHash(ctx context.Context, hash string) (*models.OAuthToken, error) {
+	if err := r.s.rlock(ctx); err != nil {
+		return nil, err
+	}
+	defer r.s.runlock(ctx)
+	return r.s.oauthTokens.find(func(t *models.OAuthToken) bool { return t.RefreshHash == hash }), nil
+}
+
+func (r *MemoryOAuthRepository) RevokeToken(ctx context.Context, id uint, at time.Time) error {
+	if err := r.s.lock(ctx); err != nil {
+		return err
+	}
+	defer r.s.unlock(ctx)
+	n := r.s.oauthTokens.update(func(t *models.OAuthToken) bool {
+		return t.ID == id && t.RevokedAt == nil
+	}, func(t *models.OAuthToken) { t.RevokedAt = &at })
+	if n == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
@@ -0,0 +1,118 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+
+	"github.com/ahmadjafari86/go-todo-list/internal/models"
+)
+
+type PasswordResetRepository interface {
+	Create(ctx context.Context, reset *models.PasswordReset) error
+	GetByHash(ctx context.Context, tokenHash string) (*models.PasswordReset, error)
+	// Consume marks an unused, unexpired reset as used. It returns
+	// gorm.ErrRecordNotFound if the reset was already used or has expired.
+	Consume(ctx context.Context, id uint, at time.Time) error
+	// ConsumeAllForUser invalidates the user's outstanding resets.
+	ConsumeAllForUser(ctx context.Context, userID uint, at time.Time) error
+}
+
+type GormPasswordResetRepository struct {
+	db *gorm.DB
+}
+
+func NewGormPasswordResetRepository(db *gorm.DB) PasswordResetRepository {
+	return &GormPasswordResetRepository{db: db}
+}
+
+func (r *GormPasswordResetRepository) Create(ctx context.Context, reset *models.PasswordReset) error {
+	return conn(ctx, r.db).Create(reset).Error
+}
+
+func (r *GormPasswordResetRepository) GetByHash(ctx context.Context, tokenHash string) (*models.PasswordReset, error) {
+	var pr models.PasswordReset
+	if err := conn(ctx, r.db).Where("token_hash = ?", tokenHash).First(&pr).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &pr, nil
+}
+
+func (r *GormPasswordResetRepository) Consume(ctx context.Context, id uint, at time.Time) error {
+	res := conn(ctx, r.db).Model(&models.PasswordReset{}).
+		Where("id = ? AND used_at IS NULL AND expires_at > ?", id, at).
+		Update("used_at", at)
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+func (r *GormPasswordResetRepository) ConsumeAllForUser(ctx context.Context, userID uint, at time.Time) error {
+	return conn(ctx, r.db).Model(&models.PasswordReset{}).
+		Where("user_id = ? AND used_at IS NULL", userID).
+		Update("used_at", at).Error
+}
+
+type MemoryPasswordResetRepository struct {
+	s *MemoryStore
+}
+
+func NewMemoryPasswordResetRepository(s *MemoryStore) PasswordResetRepository {
+	return &MemoryPasswordResetRepository{s: s}
+}
+
+func (r *MemoryPasswordResetRepository) Create(ctx context.Context, reset *models.PasswordReset) error {
+	if err := r.s.lock(ctx); err != nil {
+		return err
+	}
+	defer r.s.unlock(ctx)
+	if r.s.passwordResets.exists(func(pr *models.PasswordReset) bool { return pr.TokenHash == reset.TokenHash }) {
+		return gorm.ErrDuplicatedKey
+	}
+	reset.ID = r.s.passwordResets.id(reset.ID)
+	stamp(&reset.CreatedAt)
+	r.s.passwordResets.insert(*reset)
+	return nil
+}
+
+func (r *MemoryPasswordResetRepository) GetByHash(ctx context.Context, tokenHash string) (*models.PasswordReset, error) {
+	if err := r.s.rlock(ctx); err != nil {
+		return nil, err
+	}
+	defer r.s.runlock(ctx)
+	return r.s.passwordResets.find(func(pr *models.PasswordReset) bool { return pr.TokenHash == tokenHash }), nil
+}
+
+func (r *MemoryPasswordResetRepository) Consume(ctx context.Context, id uint, at time.Time) error {
+	if err := r.s.lock(ctx); err != nil {
+		return err
+	}
+	defer r.s.unlock(ctx)
+	n := r.s.passwordResets.update(func(pr *models.PasswordReset) bool {
+		return pr.ID == id && pr.UsedAt == nil && pr.ExpiresAt.After(at)
+	}, func(pr *models.PasswordReset) { pr.UsedAt = &at })
+	if n == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+func (r *MemoryPasswordResetRepository) ConsumeAllForUser(ctx context.Context, userID uint, at time.Time) error {
+	if err := r.s.lock(ctx); err != nil {
+		return err
+	}
+	defer r.s.unlock(ctx)
+	r.s.passwordResets.update(func(pr *models.PasswordReset) bool {
+		return pr.UserID == userID && pr.UsedAt == nil
+	}, func(pr *models.PasswordReset) { pr.UsedAt = &at })
+	return nil
+}
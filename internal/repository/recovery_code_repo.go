@@ -0,0 +1,94 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"gorm.io/gorm"
+
+	"github.com/ahmadjafari86/go-todo-list/internal/models"
+)
+
+type RecoveryCodeRepository interface {
+	// Replace deletes every existing code for the user and stores codes in their place.
+	Replace(ctx context.Context, userID uint, codes []models.RecoveryCode) error
+	// Consume marks an unused code as used and reports whether one matched.
+	Consume(ctx context.Context, userID uint, codeHash string, at time.Time) (bool, error)
+	DeleteAll(ctx context.Context, userID uint) error
+}
+
+type GormRecoveryCodeRepository struct {
+	db *gorm.DB
+}
+
+func NewGormRecoveryCodeRepository(db *gorm.DB) RecoveryCodeRepository {
+	return &GormRecoveryCodeRepository{db: db}
+}
+
+func (r *GormRecoveryCodeRepository) Replace(ctx context.Context, userID uint, codes []models.RecoveryCode) error {
+	return conn(ctx, r.db).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("user_id = ?", userID).Delete(&models.RecoveryCode{}).Error; err != nil {
+			return err
+		}
+		if len(codes) == 0 {
+			return nil
+		}
+		return tx.Create(&codes).Error
+	})
+}
+
+func (r *GormRecoveryCodeRepository) Consume(ctx context.Context, userID uint, codeHash string, at time.Time) (bool, error) {
+	res := conn(ctx, r.db).Model(&models.RecoveryCode{}).
+		Where("user_id = ? AND code_hash = ? AND used_at IS NULL", userID, codeHash).
+		Update("used_at", at)
+	if res.Error != nil {
+		return false, res.Error
+	}
+	return res.RowsAffected == 1, nil
+}
+
+func (r *GormRecoveryCodeRepository) DeleteAll(ctx context.Context, userID uint) error {
+	return conn(ctx, r.db).Where("user_id = ?", userID).Delete(&models.RecoveryCode{}).Error
+}
+
+type MemoryRecoveryCodeRepository struct {
+	s *MemoryStore
+}
+
+func NewMemoryRecoveryCodeRepository(s *MemoryStore) RecoveryCodeRepository {
+	return &MemoryRecoveryCodeRepository{s: s}
+}
+
+func (r *MemoryRecoveryCodeRepository) Replace(ctx context.Context, userID uint, codes []models.RecoveryCode) error {
+	if err := r.s.lock(ctx); err != nil {
+		return err
+	}
+	defer r.s.unlock(ctx)
+	r.s.recoveryCodes.remove(func(c *models.RecoveryCode) bool { return c.UserID == userID })
+	for i := range codes {
+		codes[i].ID = r.s.recoveryCodes.id(codes[i].ID)
+		stamp(&codes[i].CreatedAt)
+		r.s.recoveryCodes.insert(codes[i])
+	}
+	return nil
+}
+
+func (r *MemoryRecoveryCodeRepository) Consume(ctx context.Context, userID uint, codeHash string, at time.Time) (bool, error) {
+	if err := r.s.lock(ctx); err != nil {
+		return false, err
+	}
+	defer r.s.unlock(ctx)
+	n := r.s.recoveryCodes.update(func(c *models.RecoveryCode) bool {
+		return c.UserID == userID && c.CodeHash == codeHash && c.UsedAt == nil
+	}, func(c *models.RecoveryCode) { c.UsedAt = &at })
+	return n == 1, nil
+}
+
+func (r *MemoryRecoveryCodeRepository) DeleteAll(ctx context.Context, userID uint) error {
+	if err := r.s.lock(ctx); err != nil {
+		return err
+	}
+	defer r.s.unlock(ctx)
+	r.s.recoveryCodes.remove(func(c *models.RecoveryCode) bool { return c.UserID == userID })
+	return nil
+}
@@ -0,0 +1,73 @@
+package repository
+
+import "gorm.io/gorm"
+
+// Repositories is one implementation of every repository, so the storage
+// backend is chosen in a single place.
+type Repositories struct {
+	Users          UserRepository
+	Todos          TodoRepository
+	Revisions      RevisionRepository
+	Tokens         TokenRepository
+	RecoveryCodes  RecoveryCodeRepository
+	Identities     IdentityRepository
+	Workspaces     WorkspaceRepository
+	Lists          ListRepository
+	Invitations    InvitationRepository
+	Sessions       SessionRepository
+	MagicLinks     MagicLinkRepository
+	Accounts       AccountRepository
+	PasswordResets PasswordResetRepository
+	OAuth          OAuthRepository
+	DataKeys       DataKeyRepository
+	Attempts       AttemptStore
+	Tx             TxManager
+}
+
+func NewGormRepositories(db *gorm.DB) *Repositories {
+	return &Repositories{
+		Users:          NewGormUserRepository(db),
+		Todos:          NewGormTodoRepository(db),
+		Revisions:      NewGormRevisionRepository(db),
+		Tokens:         NewGormTokenRepository(db),
+		RecoveryCodes:  NewGormRecoveryCodeRepository(db),
+		Identities:     NewGormIdentityRepository(db),
+		Workspaces:     NewGormWorkspaceRepository(db),
+		Lists:          NewGormListRepository(db),
+		Invitations:    NewGormInvitationRepository(db),
+		Sessions:       NewGormSessionRepository(db),
+		MagicLinks:     NewGormMagicLinkRepository(db),
+		Accounts:       NewGormAccountRepository(db),
+		PasswordResets: NewGormPasswordResetRepository(db),
+		OAuth:          NewGormOAuthRepository(db),
+		DataKeys:       NewGormDataKeyRepository(db),
+		Attempts:       NewGormAttemptStore(db),
+		Tx:             NewGormTxManager(db),
+	}
+}
+
+// NewMemoryRepositories keeps everything in process memory. Data is lost on
+// restart and not shared between replicas; it is meant for tests, demos and
+// local development without a database.
+func NewMemoryRepositories() *Repositories {
+	s := NewMemoryStore()
+	return &Repositories{
+		Users:          NewMemoryUserRepository(s),
+		Todos:          NewMemoryTodoRepository(s),
+		Revisions:      NewMemoryRevisionRepository(s),
+		Tokens:         NewMemoryTokenRepository(s),
+		RecoveryCodes:  NewMemoryRecoveryCodeRepository(s),
+		Identities:     NewMemoryIdentityRepository(s),
+		Workspaces:     NewMemoryWorkspaceRepository(s),
+		Lists:          NewMemoryListRepository(s),
+		Invitations:    NewMemoryInvitationRepository(s),
+		Sessions:       NewMemorySessionRepository(s),
+		MagicLinks:     NewMemoryMagicLinkRepository(s),
+		Accounts:       NewMemoryAccountRepository(s),
+		PasswordResets: NewMemoryPasswordResetRepository(s),
+		OAuth:          NewMemoryOAuthRepository(s),
+		DataKeys:       NewMemoryDataKeyRepository(s),
+		Attempts:       NewMemoryAttemptStore(),
+		Tx:             NewMemoryTxManager(s),
+	}
+}
@@ -0,0 +1,82 @@
+package repository
+
+import (
+	"context"
+
+	"gorm.io/gorm"
+
+	"github.com/ahmadjafari86/go-todo-list/internal/models"
+)
+
+// RevisionRepository stores todo histories. It does no access checks; callers
+// check that the user may read the todo first.
+type RevisionRepository interface {
+	// Create saves rev as the todo's next revision and sets rev.Rev. Two
+	// revisions of one todo saved at the same time conflict on the unique
+	// (todo_id, rev) index, so callers lock the todo row first.
+	Create(ctx context.Context, rev *models.TodoRevision) error
+	// ListByTodo returns the todo's revisions, oldest first.
+	ListByTodo(ctx context.Context, todoID uint) ([]models.TodoRevision, error)
+}
+
+type GormRevisionRepository struct {
+	db *gorm.DB
+}
+
+func NewGormRevisionRepository(db *gorm.DB) RevisionRepository {
+	return &GormRevisionRepository{db: db}
+}
+
+func (r *GormRevisionRepository) Create(ctx context.Context, rev *models.TodoRevision) error {
+	var last uint
+	err := conn(WithLock(ctx, LockNone), r.db).Model(&models.TodoRevision{}).
+		Where("todo_id = ?", rev.TodoID).
+		Select("COALESCE(MAX(rev), 0)").Scan(&last).Error
+	if err != nil {
+		return err
+	}
+	rev.Rev = last + 1
+	return conn(ctx, r.db).Create(rev).Error
+}
+
+func (r *GormRevisionRepository) ListByTodo(ctx context.Context, todoID uint) ([]models.TodoRevision, error) {
+	var revs []models.TodoRevision
+	err := conn(ctx, r.db).Where("todo_id = ?", todoID).Order("rev").Find(&revs).Error
+	return revs, err
+}
+
+type MemoryRevisionRepository struct {
+	s *MemoryStore
+}
+
+func NewMemoryRevisionRepository(s *MemoryStore) RevisionRepository {
+	return &MemoryRevisionRepository{s: s}
+}
+
+func (r *MemoryRevisionRepository) Create(ctx context.Context, rev *models.TodoRevision) error {
+	if err := r.s.lock(ctx); err != nil {
+		return err
+	}
+	defer r.s.unlock(ctx)
+	if !r.s.todos.exists(func(t *models.Todo) bool { return t.ID == rev.TodoID }) {
+		return gorm.ErrForeignKeyViolated
+	}
+	rev.Rev = 1
+	for _, existing := range r.s.revisions.filter(func(v *models.TodoRevision) bool { return v.TodoID == rev.TodoID }) {
+		if existing.Rev >= rev.Rev {
+			rev.Rev = existing.Rev + 1
+		}
+	}
+	rev.ID = r.s.revisions.id(rev.ID)
+	stamp(&rev.CreatedAt)
+	r.s.revisions.insert(*rev)
+	return nil
+}
+
+func (r *MemoryRevisionRepository) ListByTodo(ctx context.Context, todoID uint) ([]models.TodoRevision, error) {
+	if err := r.s.rlock(ctx); err != nil {
+		return nil, err
+	}
+	defer r.s.runlock(ctx)
+	return r.s.revisions.filter(func(v *models.TodoRevision) bool { return v.TodoID == todoID }), nil
+}
@@ -0,0 +1,168 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"time"
+
+	"gorm.io/gorm"
+
+	"github.com/ahmadjafari86/go-todo-list/internal/models"
+)
+
+type SessionRepository interface {
+	Create(ctx context.Context, s *models.Session) error
+	GetByID(ctx context.Context, id uint) (*models.Session, error)
+	// ListActive returns the user's sessions that are neither revoked nor expired.
+	ListActive(ctx context.Context, userID uint, now time.Time) ([]models.Session, error)
+	TouchLastSeen(ctx context.Context, id uint, at time.Time) error
+	Revoke(ctx context.Context, id, userID uint, at time.Time) error
+	// RevokeAll signs the user out everywhere.
+	RevokeAll(ctx context.Context, userID uint, at time.Time) error
+	// RevokeOthers signs the user out everywhere but session keepID.
+	RevokeOthers(ctx context.Context, userID, keepID uint, at time.Time) error
+}
+
+type GormSessionRepository struct {
+	db *gorm.DB
+}
+
+func NewGormSessionRepository(db *gorm.DB) SessionRepository {
+	return &GormSessionRepository{db: db}
+}
+
+func (r *GormSessionRepository) Create(ctx context.Context, s *models.Session) error {
+	return conn(ctx, r.db).Create(s).Error
+}
+
+func (r *GormSessionRepository) GetByID(ctx context.Context, id uint) (*models.Session, error) {
+	var s models.Session
+	if err := conn(ctx, r.db).First(&s, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &s, nil
+}
+
+func (r *GormSessionRepository) ListActive(ctx context.Context, userID uint, now time.Time) ([]models.Session, error) {
+	var sessions []models.Session
+	err := conn(ctx, r.db).Where("user_id = ? AND revoked_at IS NULL AND expires_at > ?", userID, now).
+		Order("last_seen_at DESC").Find(&sessions).Error
+	return sessions, err
+}
+
+func (r *GormSessionRepository) TouchLastSeen(ctx context.Context, id uint, at time.Time) error {
+	return conn(ctx, r.db).Model(&models.Session{}).Where("id = ?", id).Update("last_seen_at", at).Error
+}
+
+func (r *GormSessionRepository) Revoke(ctx context.Context, id, userID uint, at time.Time) error {
+	res := conn(ctx, r.db).Model(&models.Session{}).
+		Where("id = ? AND user_id = ? AND revoked_at IS NULL", id, userID).
+		Update("revoked_at", at)
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+func (r *GormSessionRepository) RevokeAll(ctx context.Context, userID uint, at time.Time) error {
+	return conn(ctx, r.db).Model(&models.Session{}).
+		Where("user_id = ? AND revoked_at IS NULL", userID).
+		Update("revoked_at", at).Error
+}
+
+func (r *GormSessionRepository) RevokeOthers(ctx context.Context, userID, keepID uint, at time.Time) error {
+	return conn(ctx, r.db).Model(&models.Session{}).
+		Where("user_id = ? AND id <> ? AND revoked_at IS NULL", userID, keepID).
+		Update("revoked_at", at).Error
+}
+
+type MemorySessionRepository struct {
+	s *MemoryStore
+}
+
+func NewMemorySessionRepository(s *MemoryStore) SessionRepository {
+	return &MemorySessionRepository{s: s}
+}
+
+func (r *MemorySessionRepository) Create(ctx context.Context, s *models.Session) error {
+	if err := r.s.lock(ctx); err != nil {
+		return err
+	}
+	defer r.s.unlock(ctx)
+	s.ID = r.s.sessions.id(s.ID)
+	stamp(&s.CreatedAt)
+	r.s.sessions.insert(*s)
+	return nil
+}
+
+func (r *MemorySessionRepository) GetByID(ctx context.Context, id uint) (*models.Session, error) {
+	if err := r.s.rlock(ctx); err != nil {
+		return nil, err
+	}
+	defer r.s.runlock(ctx)
+	return r.s.sessions.find(func(s *models.Session) bool { return s.ID == id }), nil
+}
+
+func (r *MemorySessionRepository) ListActive(ctx context.Context, userID uint, now time.Time) ([]models.Session, error) {
+	if err := r.s.rlock(ctx); err != nil {
+		return nil, err
+	}
+	defer r.s.runlock(ctx)
+	sessions := r.s.sessions.filter(func(s *models.Session) bool {
+		return s.UserID == userID && s.RevokedAt == nil && s.ExpiresAt.After(now)
+	})
+	sort.SliceStable(sessions, func(i, j int) bool { return sessions[i].LastSeenAt.After(sessions[j].LastSeenAt) })
+	return sessions, nil
+}
+
+func (r *MemorySessionRepository) TouchLastSeen(ctx context.Context, id uint, at time.Time) error {
+	if err := r.s.lock(ctx); err != nil {
+		return err
+	}
+	defer r.s.unlock(ctx)
+	r.s.sessions.update(func(s *models.Session) bool { return s.ID == id }, func(s *models.Session) { s.LastSeenAt = at })
+	return nil
+}
+
+func (r *MemorySessionRepository) Revoke(ctx context.Context, id, userID uint, at time.Time) error {
+	if err := r.s.lock(ctx); err != nil {
+		return err
+	}
+	defer r.s.unlock(ctx)
+	n := r.s.sessions.update(func(s *models.Session) bool {
+		return s.ID == id && s.UserID == userID && s.RevokedAt == nil
+	}, func(s *models.Session) { s.RevokedAt = &at })
+	if n == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+func (r *MemorySessionRepository) RevokeAll(ctx context.Context, userID uint, at time.Time) error {
+	if err := r.s.lock(ctx); err != nil {
+		return err
+	}
+	defer r.s.unlock(ctx)
+	r.s.sessions.update(func(s *models.Session) bool {
+		return s.UserID == userID && s.RevokedAt == nil
+	}, func(s *models.Session) { s.RevokedAt = &at })
+	return nil
+}
+
+func (r *MemorySessionRepository) RevokeOthers(ctx context.Context, userID, keepID uint, at time.Time) error {
+	if err := r.s.lock(ctx); err != nil {
+		return err
+	}
+	defer r.s.unlock(ctx)
+	r.s.sessions.update(func(s *models.Session) bool {
+		return s.UserID == userID && s.ID != keepID && s.RevokedAt == nil
+	}, func(s *models.Session) { s.RevokedAt = &at })
+	return nil
+}
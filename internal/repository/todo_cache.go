@@ -0,0 +1,287 @@
+package repository
+
+import (
+	"container/list"
+	"context"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	logrus "github.com/sirupsen/logrus"
+
+	"github.com/ahmadjafari86/go-todo-list/internal/models"
+)
+
+// TodoCacheConfig configures NewCachingTodoRepository.
+type TodoCacheConfig struct {
+	// MaxUsers is how many users' todo lists are kept; the least recently
+	// used are evicted first.
+	MaxUsers int
+	// TTL bounds how long a list is served from the cache. Changes the cache
+	// does not see, made without the repositories returned by Workspaces and
+	// Lists, show up after at most this long.
+	TTL time.Duration
+	// Bus, if set, shares invalidations with the caches of other processes.
+	Bus TodoCacheBus
+}
+
+// TodoCacheStats counts cache activity since startup.
+type TodoCacheStats struct {
+	Hits          uint64 `json:"hits"`
+	Misses        uint64 `json:"misses"`
+	Invalidations uint64 `json:"invalidations"`
+	Evictions     uint64 `json:"evictions"`
+	Users         int    `json:"users"`
+}
+
+// TodoCacheBus connects the todo caches of several server processes. Every
+// process publishes the users whose visible todos it changed and drops the
+// cached lists of the users the others publish. Receiving a process's own
+// messages back is harmless.
+type TodoCacheBus interface {
+	Publish(ctx context.Context, userIDs []uint) error
+	// Subscribe calls fn with published users until ctx is done. It calls fn
+	// with nil when some may have been missed, which drops every cached list.
+	Subscribe(ctx context.Context, fn func(userIDs []uint)) error
+}
+
+// CachingTodoRepository serves GetAll, the polling hot path, from an
+// in-process LRU of each user's lists. Every write through it invalidates
+// all users who can see the todo: the workspace's members and the users its
+// list is shared with. Changes to who can see what invalidate through the
+// repositories returned by Workspaces and Lists. Writes inside a transaction
+// invalidate again once it commits. Reads inside a transaction and all other
+// methods go straight to the wrapped repository.
+type CachingTodoRepository struct {
+	next       TodoRepository
+	workspaces WorkspaceRepository
+	lists      ListRepository
+	cfg        TodoCacheConfig
+
+	mu    sync.Mutex
+	lru   *list.List // of *todoCacheEntry, most recently used first
+	users map[uint]*list.Element
+	// epoch grows with every invalidation. A list read from the database is
+	// only cached if no invalidation happened meanwhile, since it may predate
+	// the change.
+	epoch uint64
+
+	hits, misses, invalidations, evictions atomic.Uint64
+}
+
+type todoCacheEntry struct {
+	userID uint
+	lists  map[TodoFilter]cachedTodos
+}
+
+type cachedTodos struct {
+	todos   []models.Todo
+	expires time.Time
+}
+
+func NewCachingTodoRepository(next TodoRepository, workspaces WorkspaceRepository, lists ListRepository, cfg TodoCacheConfig) *CachingTodoRepository {
+	return &CachingTodoRepository{
+		next:       next,
+		workspaces: workspaces,
+		lists:      lists,
+		cfg:        cfg,
+		lru:        list.New(),
+		users:      map[uint]*list.Element{},
+	}
+}
+
+func (r *CachingTodoRepository) Stats() TodoCacheStats {
+	r.mu.Lock()
+	users := r.lru.Len()
+	r.mu.Unlock()
+	return TodoCacheStats{
+		Hits:          r.hits.Load(),
+		Misses:        r.misses.Load(),
+		Invalidations: r.invalidations.Load(),
+		Evictions:     r.evictions.Load(),
+		Users:         users,
+	}
+}
+
+// Run applies the invalidations published by other processes until ctx is
+// done. Without a bus it returns immediately.
+func (r *CachingTodoRepository) Run(ctx context.Context) {
+	if r.cfg.Bus == nil {
+		return
+	}
+	if err := r.cfg.Bus.Subscribe(ctx, r.invalidate); err != nil && ctx.Err() == nil {
+		logrus.Errorf("todo cache stopped receiving invalidations: %v", err)
+	}
+}
+
+func (r *CachingTodoRepository) GetAll(ctx context.Context, userID uint, filter TodoFilter) ([]models.Todo, error) {
+	if inTx(ctx) {
+		return r.next.GetAll(ctx, userID, filter)
+	}
+	r.mu.Lock()
+	if el, ok := r.users[userID]; ok {
+		if c, ok := el.Value.(*todoCacheEntry).lists[filter]; ok && time.Now().Before(c.expires) {
+			r.lru.MoveToFront(el)
+			r.mu.Unlock()
+			r.hits.Add(1)
+			return slices.Clone(c.todos), nil
+		}
+	}
+	epoch := r.epoch
+	r.mu.Unlock()
+	r.misses.Add(1)
+
+	todos, err := r.next.GetAll(ctx, userID, filter)
+	if err != nil {
+		return nil, err
+	}
+	r.store(userID, filter, todos, epoch)
+	return todos, nil
+}
+
+func (r *CachingTodoRepository) store(userID uint, filter TodoFilter, todos []models.Todo, epoch uint64) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.epoch != epoch || r.cfg.MaxUsers <= 0 {
+		return
+	}
+	c := cachedTodos{todos: slices.Clone(todos), expires: time.Now().Add(r.cfg.TTL)}
+	if el, ok := r.users[userID]; ok {
+		el.Value.(*todoCacheEntry).lists[filter] = c
+		r.lru.MoveToFront(el)
+		return
+	}
+	r.users[userID] = r.lru.PushFront(&todoCacheEntry{userID: userID, lists: map[TodoFilter]cachedTodos{filter: c}})
+	for r.lru.Len() > r.cfg.MaxUsers {
+		oldest := r.lru.Back()
+		r.lru.Remove(oldest)
+		delete(r.users, oldest.Value.(*todoCacheEntry).userID)
+		r.evictions.Add(1)
+	}
+}
+
+// invalidate drops the cached lists of the given users, or of everyone for
+// nil.
+func (r *CachingTodoRepository) invalidate(userIDs []uint) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.epoch++
+	r.invalidations.Add(1)
+	if userIDs == nil {
+		r.lru.Init()
+		clear(r.users)
+		return
+	}
+	for _, id := range userIDs {
+		if el, ok := r.users[id]; ok {
+			r.lru.Remove(el)
+			delete(r.users, id)
+		}
+	}
+}
+
+// changed invalidates the users who can see the todos.
+func (r *CachingTodoRepository) changed(ctx context.Context, actorID uint, todos ...*models.Todo) error {
+	users := []uint{actorID}
+	for _, todo := range todos {
+		users = append(users, todo.OwnerID)
+		members, err := r.workspaces.ListMembers(ctx, todo.WorkspaceID)
+		if err != nil {
+			return err
+		}
+		for _, m := range members {
+			users = append(users, m.UserID)
+		}
+		if todo.ListID != 0 {
+			shares, err := r.lists.ListShares(ctx, todo.ListID)
+			if err != nil {
+				return err
+			}
+			for _, sh := range shares {
+				users = append(users, sh.UserID)
+			}
+		}
+	}
+	r.invalidateUsers(ctx, users)
+	return nil
+}
+
+// invalidateUsers drops the cached lists of users now and again after the
+// surrounding transaction commits, and tells the other processes once the
+// change is visible to them.
+func (r *CachingTodoRepository) invalidateUsers(ctx context.Context, users []uint) {
+	if len(users) == 0 {
+		return
+	}
+	slices.Sort(users)
+	users = slices.Compact(users)
+
+	r.invalidate(users)
+	afterCommit(ctx, func() {
+		r.invalidate(users)
+		if r.cfg.Bus != nil {
+			if err := r.cfg.Bus.Publish(context.WithoutCancel(ctx), users); err != nil {
+				logrus.Errorf("failed to publish todo cache invalidation: %v", err)
+			}
+		}
+	})
+}
+
+func (r *CachingTodoRepository) Create(ctx context.Context, todo *models.Todo) error {
+	if err := r.next.Create(ctx, todo); err != nil {
+		return err
+	}
+	return r.changed(ctx, todo.OwnerID, todo)
+}
+
+func (r *CachingTodoRepository) GetByID(ctx context.Context, id uint, userID uint) (*models.Todo, error) {
+	return r.next.GetByID(ctx, id, userID)
+}
+
+func (r *CachingTodoRepository) Update(ctx context.Context, todo *models.Todo, userID uint) error {
+	if err := r.next.Update(ctx, todo, userID); err != nil {
+		return err
+	}
+	return r.changed(ctx, userID, todo)
+}
+
+func (r *CachingTodoRepository) Delete(ctx context.Context, id uint, userID uint) error {
+	existing, err := r.next.GetByID(ctx, id, userID)
+	if err != nil {
+		return err
+	}
+	if err := r.next.Delete(ctx, id, userID); err != nil {
+		return err
+	}
+	return r.changed(ctx, userID, existing)
+}
+
+func (r *CachingTodoRepository) GetTrashed(ctx context.Context, id uint, userID uint) (*models.Todo, error) {
+	return r.next.GetTrashed(ctx, id, userID)
+}
+
+func (r *CachingTodoRepository) ListTrash(ctx context.Context, userID uint) ([]models.Todo, error) {
+	return r.next.ListTrash(ctx, userID)
+}
+
+func (r *CachingTodoRepository) Restore(ctx context.Context, id uint, userID uint) error {
+	trashed, err := r.next.GetTrashed(ctx, id, userID)
+	if err != nil {
+		return err
+	}
+	if err := r.next.Restore(ctx, id, userID); err != nil {
+		return err
+	}
+	return r.changed(ctx, userID, trashed)
+}
+
+// EmptyTrash and PurgeTrash only remove trashed todos, which GetAll never
+// returns, so cached lists stay valid.
+func (r *CachingTodoRepository) EmptyTrash(ctx context.Context, userID uint) (int64, error) {
+	return r.next.EmptyTrash(ctx, userID)
+}
+
+func (r *CachingTodoRepository) PurgeTrash(ctx context.Context, before time.Time) (int64, error) {
+	return r.next.PurgeTrash(ctx, before)
+}
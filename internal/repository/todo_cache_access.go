@@ -0,0 +1,175 @@
+package repository
+
+import (
+	"context"
+
+	"github.com/ahmadjafari86/go-todo-list/internal/models"
+)
+
+// Workspaces wraps next so that changes to a workspace's members, and
+// deleting it, invalidate the users whose todos change.
+func (r *CachingTodoRepository) Workspaces(next WorkspaceRepository) WorkspaceRepository {
+	return &todoCacheWorkspaces{next: next, cache: r}
+}
+
+// Lists wraps next so that sharing, unsharing and deleting a list invalidate
+// the users whose todos change.
+func (r *CachingTodoRepository) Lists(next ListRepository) ListRepository {
+	return &todoCacheLists{next: next, cache: r}
+}
+
+type todoCacheWorkspaces struct {
+	next  WorkspaceRepository
+	cache *CachingTodoRepository
+}
+
+func (w *todoCacheWorkspaces) Create(ctx context.Context, ws *models.Workspace) error {
+	return w.next.Create(ctx, ws)
+}
+
+func (w *todoCacheWorkspaces) EnsurePersonal(ctx context.Context, userID uint) (*models.Workspace, error) {
+	return w.next.EnsurePersonal(ctx, userID)
+}
+
+func (w *todoCacheWorkspaces) GetByID(ctx context.Context, id uint) (*models.Workspace, error) {
+	return w.next.GetByID(ctx, id)
+}
+
+func (w *todoCacheWorkspaces) ListForUser(ctx context.Context, userID uint) ([]models.WorkspaceWithRole, error) {
+	return w.next.ListForUser(ctx, userID)
+}
+
+func (w *todoCacheWorkspaces) Rename(ctx context.Context, id uint, name string) error {
+	return w.next.Rename(ctx, id, name)
+}
+
+func (w *todoCacheWorkspaces) Delete(ctx context.Context, id uint) error {
+	members, err := w.next.ListMembers(ctx, id)
+	if err != nil {
+		return err
+	}
+	if err := w.next.Delete(ctx, id); err != nil {
+		return err
+	}
+	users := make([]uint, len(members))
+	for i, m := range members {
+		users[i] = m.UserID
+	}
+	w.cache.invalidateUsers(ctx, users)
+	return nil
+}
+
+func (w *todoCacheWorkspaces) GetMembership(ctx context.Context, workspaceID, userID uint) (*models.Membership, error) {
+	return w.next.GetMembership(ctx, workspaceID, userID)
+}
+
+func (w *todoCacheWorkspaces) ListMembers(ctx context.Context, workspaceID uint) ([]models.Membership, error) {
+	return w.next.ListMembers(ctx, workspaceID)
+}
+
+func (w *todoCacheWorkspaces) AddMember(ctx context.Context, m *models.Membership) error {
+	if err := w.next.AddMember(ctx, m); err != nil {
+		return err
+	}
+	w.cache.invalidateUsers(ctx, []uint{m.UserID})
+	return nil
+}
+
+// UpdateMemberRole leaves what the member can see unchanged.
+func (w *todoCacheWorkspaces) UpdateMemberRole(ctx context.Context, workspaceID, userID uint, role string) error {
+	return w.next.UpdateMemberRole(ctx, workspaceID, userID, role)
+}
+
+func (w *todoCacheWorkspaces) RemoveMember(ctx context.Context, workspaceID, userID uint) error {
+	if err := w.next.RemoveMember(ctx, workspaceID, userID); err != nil {
+		return err
+	}
+	w.cache.invalidateUsers(ctx, []uint{userID})
+	return nil
+}
+
+// BackfillPersonal runs at startup, before anything is cached.
+func (w *todoCacheWorkspaces) BackfillPersonal(ctx context.Context) error {
+	return w.next.BackfillPersonal(ctx)
+}
+
+type todoCacheLists struct {
+	next  ListRepository
+	cache *CachingTodoRepository
+}
+
+func (l *todoCacheLists) Create(ctx context.Context, list *models.TodoList) error {
+	return l.next.Create(ctx, list)
+}
+
+func (l *todoCacheLists) GetByID(ctx context.Context, id uint) (*models.TodoList, error) {
+	return l.next.GetByID(ctx, id)
+}
+
+func (l *todoCacheLists) ListForUser(ctx context.Context, userID uint) ([]models.TodoList, error) {
+	return l.next.ListForUser(ctx, userID)
+}
+
+func (l *todoCacheLists) ListSharedWith(ctx context.Context, userID uint) ([]models.SharedList, error) {
+	return l.next.ListSharedWith(ctx, userID)
+}
+
+// Delete removes the list's todos, which its workspace's members and the
+// users it is shared with could see.
+func (l *todoCacheLists) Delete(ctx context.Context, id uint) error {
+	list, err := l.next.GetByID(ctx, id)
+	if err != nil {
+		return err
+	}
+	var users []uint
+	if list != nil {
+		members, err := l.cache.workspaces.ListMembers(ctx, list.WorkspaceID)
+		if err != nil {
+			return err
+		}
+		for _, m := range members {
+			users = append(users, m.UserID)
+		}
+		shares, err := l.next.ListShares(ctx, id)
+		if err != nil {
+			return err
+		}
+		for _, sh := range shares {
+			users = append(users, sh.UserID)
+		}
+	}
+	if err := l.next.Delete(ctx, id); err != nil {
+		return err
+	}
+	l.cache.invalidateUsers(ctx, users)
+	return nil
+}
+
+func (l *todoCacheLists) GetShare(ctx context.Context, listID, userID uint) (*models.ListShare, error) {
+	return l.next.GetShare(ctx, listID, userID)
+}
+
+func (l *todoCacheLists) ListShares(ctx context.Context, listID uint) ([]models.ListShare, error) {
+	return l.next.ListShares(ctx, listID)
+}
+
+func (l *todoCacheLists) AddShare(ctx context.Context, share *models.ListShare) error {
+	if err := l.next.AddShare(ctx, share); err != nil {
+		return err
+	}
+	l.cache.invalidateUsers(ctx, []uint{share.UserID})
+	return nil
+}
+
+// UpdateShare leaves what the user can see unchanged.
+func (l *todoCacheLists) UpdateShare(ctx context.Context, listID, userID uint, permission string) error {
+	return l.next.UpdateShare(ctx, listID, userID, permission)
+}
+
+func (l *todoCacheLists) RemoveShare(ctx context.Context, listID, userID uint) error {
+	if err := l.next.RemoveShare(ctx, listID, userID); err != nil {
+		return err
+	}
+	l.cache.invalidateUsers(ctx, []uint{userID})
+	return nil
+}
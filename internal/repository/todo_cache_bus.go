@@ -0,0 +1,134 @@
+package repository
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	logrus "github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+
+	"github.com/ahmadjafari86/go-todo-list/internal/models"
+)
+
+// todoCacheBusWindow is how far back GormTodoCacheBus looks for
+// invalidations on every poll, beyond the poll interval. It covers
+// transactions that commit a while after their row got its timestamp and
+// clock differences between servers.
+const todoCacheBusWindow = time.Minute
+
+// todoCacheBusMaxBackoff caps the wait between failed polls.
+const todoCacheBusMaxBackoff = 30 * time.Second
+
+// GormTodoCacheBus shares cache invalidations through the
+// todo_cache_invalidations table, which every process polls. Rows are pruned
+// once no poll can pick them up anymore.
+type GormTodoCacheBus struct {
+	db       *gorm.DB
+	interval time.Duration
+}
+
+func NewGormTodoCacheBus(db *gorm.DB, pollInterval time.Duration) TodoCacheBus {
+	return &GormTodoCacheBus{db: db, interval: pollInterval}
+}
+
+func (b *GormTodoCacheBus) Publish(ctx context.Context, userIDs []uint) error {
+	if len(userIDs) == 0 {
+		return nil
+	}
+	rows := make([]models.TodoCacheInvalidation, len(userIDs))
+	for i, id := range userIDs {
+		rows[i].UserID = id
+	}
+	return conn(ctx, b.db).Create(&rows).Error
+}
+
+// Subscribe keeps polling through database errors, backing off up to
+// todoCacheBusMaxBackoff. When polls failed for longer than the window,
+// invalidations may have been missed and fn is called with nil.
+func (b *GormTodoCacheBus) Subscribe(ctx context.Context, fn func(userIDs []uint)) error {
+	window := b.interval + todoCacheBusWindow
+	seen := map[uint]time.Time{}
+	delay := b.interval
+	lastPoll := time.Now()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(delay):
+		}
+		now := time.Now()
+		var rows []models.TodoCacheInvalidation
+		if err := b.db.WithContext(ctx).Where("created_at >= ?", now.Add(-window)).Order("id").Find(&rows).Error; err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			delay = min(2*delay, todoCacheBusMaxBackoff)
+			logrus.Errorf("failed to poll todo cache invalidations, retrying in %s: %v", delay, err)
+			continue
+		}
+		delay = b.interval
+		if now.Sub(lastPoll) > window {
+			fn(nil)
+		}
+		lastPoll = now
+
+		var users []uint
+		for _, row := range rows {
+			if _, ok := seen[row.ID]; !ok {
+				seen[row.ID] = row.CreatedAt
+				users = append(users, row.UserID)
+			}
+		}
+		if len(users) > 0 {
+			fn(users)
+		}
+		for id, at := range seen {
+			if now.Sub(at) > window {
+				delete(seen, id)
+			}
+		}
+		if err := b.db.WithContext(ctx).Where("created_at < ?", now.Add(-2*window)).Delete(&models.TodoCacheInvalidation{}).Error; err != nil && ctx.Err() == nil {
+			logrus.Warnf("failed to prune todo cache invalidations: %v", err)
+		}
+	}
+}
+
+// MemoryTodoCacheBus delivers invalidations between caches in the same
+// process, for tests and for running several caches side by side.
+type MemoryTodoCacheBus struct {
+	mu          sync.Mutex
+	subscribers map[int]func(userIDs []uint)
+	next        int
+}
+
+func NewMemoryTodoCacheBus() TodoCacheBus {
+	return &MemoryTodoCacheBus{subscribers: map[int]func(userIDs []uint){}}
+}
+
+func (b *MemoryTodoCacheBus) Publish(ctx context.Context, userIDs []uint) error {
+	b.mu.Lock()
+	subscribers := make([]func(userIDs []uint), 0, len(b.subscribers))
+	for _, fn := range b.subscribers {
+		subscribers = append(subscribers, fn)
+	}
+	b.mu.Unlock()
+	for _, fn := range subscribers {
+		fn(userIDs)
+	}
+	return nil
+}
+
+func (b *MemoryTodoCacheBus) Subscribe(ctx context.Context, fn func(userIDs []uint)) error {
+	b.mu.Lock()
+	id := b.next
+	b.next++
+	b.subscribers[id] = fn
+	b.mu.Unlock()
+
+	<-ctx.Done()
+	b.mu.Lock()
+	delete(b.subscribers, id)
+	b.mu.Unlock()
+	return ctx.Err()
+}
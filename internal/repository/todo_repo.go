@@ -1,17 +1,50 @@
 package repository
 
 import (
+	"context"
+	"sort"
+	"time"
+
 	"gorm.io/gorm"
 
+	appdb "github.com/ahmadjafari86/go-todo-list/internal/db"
 	"github.com/ahmadjafari86/go-todo-list/internal/models"
 )
 
+// TodoFilter narrows GetAll. Zero values mean "no restriction".
+type TodoFilter struct {
+	WorkspaceID uint
+	ListID      uint
+}
+
+// TodoRepository resolves access through workspace membership and list shares: userID
+// may read the todos of every workspace they belong to and of every list shared with
+// them, and change them when their role or share permission allows it.
+//
+// GetAll and GetByID may read from a replica outside transactions; see
+// appdb.ReadFromReplica.
+//
+// Update writes only the title and completed flag; todo carries the stored
+// owner, workspace and list, which decorators rely on.
+//
+// Delete moves a todo to the trash. Trashed todos are only seen by the trash
+// methods until they are restored or removed for good by EmptyTrash or PurgeTrash.
 type TodoRepository interface {
-	Create(todo *models.Todo) error
-	GetAll(ownerID uint) ([]models.Todo, error)
-	GetByID(id uint, ownerID uint) (*models.Todo, error)
-	Update(todo *models.Todo, ownerID uint) error
-	Delete(id uint, ownerID uint) error
+	Create(ctx context.Context, todo *models.Todo) error
+	GetAll(ctx context.Context, userID uint, filter TodoFilter) ([]models.Todo, error)
+	GetByID(ctx context.Context, id uint, userID uint) (*models.Todo, error)
+	Update(ctx context.Context, todo *models.Todo, userID uint) error
+	Delete(ctx context.Context, id uint, userID uint) error
+
+	// GetTrashed and ListTrash return trashed todos userID may read, the latter
+	// most recently deleted first.
+	GetTrashed(ctx context.Context, id uint, userID uint) (*models.Todo, error)
+	ListTrash(ctx context.Context, userID uint) ([]models.Todo, error)
+	Restore(ctx context.Context, id uint, userID uint) error
+	// EmptyTrash permanently deletes the trashed todos userID may change.
+	EmptyTrash(ctx context.Context, userID uint) (int64, error)
+	// PurgeTrash permanently deletes todos trashed before the given time.
+	PurgeTrash(ctx context.Context, before time.Time) (int64, error)
 }
 
 type GormTodoRepository struct {
@@ -22,30 +55,239 @@ func NewGormTodoRepository(db *gorm.DB) TodoRepository {
 	return &GormTodoRepository{db: db}
 }
 
-func (r *GormTodoRepository) Create(todo *models.Todo) error {
-	return r.db.Create(todo).Error
+// readableBy matches todos userID may read.
+func readableBy(db *gorm.DB, userID uint) *gorm.DB {
+	return db.Session(&gorm.Session{NewDB: true}).
+		Where("workspace_id IN (?)", memberWorkspaces(db, userID, nil)).
+		Or("list_id IN (?)", sharedLists(db, userID, nil))
+}
+
+// writableBy matches todos userID may change.
+func writableBy(db *gorm.DB, userID uint) *gorm.DB {
+	return db.Session(&gorm.Session{NewDB: true}).
+		Where("workspace_id IN (?)", memberWorkspaces(db, userID, models.TodoWriterRoles)).
+		Or("list_id IN (?)", sharedLists(db, userID, models.ShareWriterPermissions))
+}
+
+func (r *GormTodoRepository) Create(ctx context.Context, todo *models.Todo) error {
+	return conn(ctx, r.db).Create(todo).Error
 }
 
-func (r *GormTodoRepository) GetAll(ownerID uint) ([]models.Todo, error) {
+func (r *GormTodoRepository) GetAll(ctx context.Context, userID uint, filter TodoFilter) ([]models.Todo, error) {
 	var todos []models.Todo
-	err := r.db.Where("owner_id = ?", ownerID).Find(&todos).Error
+	q := conn(ctx, r.db).Clauses(appdb.ReadFromReplica).Where("deleted_at IS NULL").Where(readableBy(r.db, userID))
+	if filter.WorkspaceID != 0 {
+		q = q.Where("workspace_id = ?", filter.WorkspaceID)
+	}
+	if filter.ListID != 0 {
+		q = q.Where("list_id = ?", filter.ListID)
+	}
+	err := q.Order("id").Find(&todos).Error
 	return todos, err
 }
 
-func (r *GormTodoRepository) GetByID(id uint, ownerID uint) (*models.Todo, error) {
+func (r *GormTodoRepository) GetByID(ctx context.Context, id uint, userID uint) (*models.Todo, error) {
+	var t models.Todo
+	err := conn(ctx, r.db).Clauses(appdb.ReadFromReplica).
+		Where("id = ? AND deleted_at IS NULL", id).Where(readableBy(r.db, userID)).First(&t).Error
+	if err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
+
+func (r *GormTodoRepository) Update(ctx context.Context, todo *models.Todo, userID uint) error {
+	res := conn(ctx, r.db).Model(&models.Todo{}).
+		Where("id = ? AND deleted_at IS NULL", todo.ID).Where(writableBy(r.db, userID)).
+		Select("title", "completed").
+		Updates(todo)
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+func (r *GormTodoRepository) Delete(ctx context.Context, id uint, userID uint) error {
+	res := conn(ctx, r.db).Model(&models.Todo{}).
+		Where("id = ? AND deleted_at IS NULL", id).Where(writableBy(r.db, userID)).
+		Update("deleted_at", time.Now())
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+func (r *GormTodoRepository) GetTrashed(ctx context.Context, id uint, userID uint) (*models.Todo, error) {
 	var t models.Todo
-	if err := r.db.Where("id = ? AND owner_id = ?", id, ownerID).First(&t).Error; err != nil {
+	err := conn(ctx, r.db).Where("id = ? AND deleted_at IS NOT NULL", id).Where(readableBy(r.db, userID)).First(&t).Error
+	if err != nil {
 		return nil, err
 	}
 	return &t, nil
 }
 
-func (r *GormTodoRepository) Update(todo *models.Todo, ownerID uint) error {
-	return r.db.Model(&models.Todo{}).
-		Where("id = ? AND owner_id = ?", todo.ID, ownerID).
-		Updates(todo).Error
+func (r *GormTodoRepository) ListTrash(ctx context.Context, userID uint) ([]models.Todo, error) {
+	var todos []models.Todo
+	err := conn(ctx, r.db).Where("deleted_at IS NOT NULL").Where(readableBy(r.db, userID)).
+		Order("deleted_at DESC, id").Find(&todos).Error
+	return todos, err
+}
+
+func (r *GormTodoRepository) Restore(ctx context.Context, id uint, userID uint) error {
+	res := conn(ctx, r.db).Model(&models.Todo{}).
+		Where("id = ? AND deleted_at IS NOT NULL", id).Where(writableBy(r.db, userID)).
+		Update("deleted_at", nil)
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+func (r *GormTodoRepository) EmptyTrash(ctx context.Context, userID uint) (int64, error) {
+	res := conn(ctx, r.db).Where("deleted_at IS NOT NULL").Where(writableBy(r.db, userID)).Delete(&models.Todo{})
+	return res.RowsAffected, res.Error
+}
+
+func (r *GormTodoRepository) PurgeTrash(ctx context.Context, before time.Time) (int64, error) {
+	res := conn(ctx, r.db).Where("deleted_at < ?", before).Delete(&models.Todo{})
+	return res.RowsAffected, res.Error
+}
+
+type MemoryTodoRepository struct {
+	s *MemoryStore
+}
+
+func NewMemoryTodoRepository(s *MemoryStore) TodoRepository {
+	return &MemoryTodoRepository{s: s}
 }
 
-func (r *GormTodoRepository) Delete(id uint, ownerID uint) error {
-	return r.db.Where("id = ? AND owner_id = ?", id, ownerID).Delete(&models.Todo{}).Error
+func (r *MemoryTodoRepository) Create(ctx context.Context, todo *models.Todo) error {
+	if err := r.s.lock(ctx); err != nil {
+		return err
+	}
+	defer r.s.unlock(ctx)
+	if !r.s.users.exists(func(u *models.User) bool { return u.ID == todo.OwnerID }) {
+		return gorm.ErrForeignKeyViolated
+	}
+	todo.ID = r.s.todos.id(todo.ID)
+	stamp(&todo.CreatedAt)
+	r.s.todos.insert(*todo)
+	return nil
+}
+
+func (r *MemoryTodoRepository) GetAll(ctx context.Context, userID uint, filter TodoFilter) ([]models.Todo, error) {
+	if err := r.s.rlock(ctx); err != nil {
+		return nil, err
+	}
+	defer r.s.runlock(ctx)
+	return r.s.todos.filter(func(t *models.Todo) bool {
+		return t.DeletedAt == nil && r.s.todoReadable(t, userID) &&
+			(filter.WorkspaceID == 0 || t.WorkspaceID == filter.WorkspaceID) &&
+			(filter.ListID == 0 || t.ListID == filter.ListID)
+	}), nil
+}
+
+func (r *MemoryTodoRepository) GetByID(ctx context.Context, id uint, userID uint) (*models.Todo, error) {
+	if err := r.s.rlock(ctx); err != nil {
+		return nil, err
+	}
+	defer r.s.runlock(ctx)
+	t := r.s.todos.find(func(t *models.Todo) bool { return t.ID == id && t.DeletedAt == nil && r.s.todoReadable(t, userID) })
+	if t == nil {
+		return nil, gorm.ErrRecordNotFound
+	}
+	return t, nil
+}
+
+func (r *MemoryTodoRepository) Update(ctx context.Context, todo *models.Todo, userID uint) error {
+	if err := r.s.lock(ctx); err != nil {
+		return err
+	}
+	defer r.s.unlock(ctx)
+	n := r.s.todos.update(func(t *models.Todo) bool {
+		return t.ID == todo.ID && t.DeletedAt == nil && r.s.todoWritable(t, userID)
+	}, func(t *models.Todo) {
+		t.Title = todo.Title
+		t.Completed = todo.Completed
+	})
+	if n == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+func (r *MemoryTodoRepository) Delete(ctx context.Context, id uint, userID uint) error {
+	if err := r.s.lock(ctx); err != nil {
+		return err
+	}
+	defer r.s.unlock(ctx)
+	now := time.Now()
+	n := r.s.todos.update(func(t *models.Todo) bool {
+		return t.ID == id && t.DeletedAt == nil && r.s.todoWritable(t, userID)
+	}, func(t *models.Todo) { t.DeletedAt = &now })
+	if n == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+func (r *MemoryTodoRepository) GetTrashed(ctx context.Context, id uint, userID uint) (*models.Todo, error) {
+	if err := r.s.rlock(ctx); err != nil {
+		return nil, err
+	}
+	defer r.s.runlock(ctx)
+	t := r.s.todos.find(func(t *models.Todo) bool { return t.ID == id && t.DeletedAt != nil && r.s.todoReadable(t, userID) })
+	if t == nil {
+		return nil, gorm.ErrRecordNotFound
+	}
+	return t, nil
+}
+
+func (r *MemoryTodoRepository) ListTrash(ctx context.Context, userID uint) ([]models.Todo, error) {
+	if err := r.s.rlock(ctx); err != nil {
+		return nil, err
+	}
+	defer r.s.runlock(ctx)
+	todos := r.s.todos.filter(func(t *models.Todo) bool { return t.DeletedAt != nil && r.s.todoReadable(t, userID) })
+	sort.SliceStable(todos, func(i, j int) bool { return todos[i].DeletedAt.After(*todos[j].DeletedAt) })
+	return todos, nil
+}
+
+func (r *MemoryTodoRepository) Restore(ctx context.Context, id uint, userID uint) error {
+	if err := r.s.lock(ctx); err != nil {
+		return err
+	}
+	defer r.s.unlock(ctx)
+	n := r.s.todos.update(func(t *models.Todo) bool {
+		return t.ID == id && t.DeletedAt != nil && r.s.todoWritable(t, userID)
+	}, func(t *models.Todo) { t.DeletedAt = nil })
+	if n == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+func (r *MemoryTodoRepository) EmptyTrash(ctx context.Context, userID uint) (int64, error) {
+	if err := r.s.lock(ctx); err != nil {
+		return 0, err
+	}
+	defer r.s.unlock(ctx)
+	return r.s.removeTodos(func(t *models.Todo) bool { return t.DeletedAt != nil && r.s.todoWritable(t, userID) }), nil
+}
+
+func (r *MemoryTodoRepository) PurgeTrash(ctx context.Context, before time.Time) (int64, error) {
+	if err := r.s.lock(ctx); err != nil {
+		return 0, err
+	}
+	defer r.s.unlock(ctx)
+	return r.s.removeTodos(func(t *models.Todo) bool { return t.DeletedAt != nil && t.DeletedAt.Before(before) }), nil
 }
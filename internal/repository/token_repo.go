@@ -0,0 +1,124 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"time"
+
+	"gorm.io/gorm"
+
+	"github.com/ahmadjafari86/go-todo-list/internal/models"
+)
+
+type TokenRepository interface {
+	Create(ctx context.Context, token *models.PersonalAccessToken) error
+	GetByHash(ctx context.Context, hash string) (*models.PersonalAccessToken, error)
+	ListByUser(ctx context.Context, userID uint) ([]models.PersonalAccessToken, error)
+	TouchLastUsed(ctx context.Context, id uint, at time.Time) error
+	Delete(ctx context.Context, id uint, userID uint) error
+}
+
+type GormTokenRepository struct {
+	db *gorm.DB
+}
+
+func NewGormTokenRepository(db *gorm.DB) TokenRepository {
+	return &GormTokenRepository{db: db}
+}
+
+func (r *GormTokenRepository) Create(ctx context.Context, token *models.PersonalAccessToken) error {
+	return conn(ctx, r.db).Create(token).Error
+}
+
+func (r *GormTokenRepository) GetByHash(ctx context.Context, hash string) (*models.PersonalAccessToken, error) {
+	var t models.PersonalAccessToken
+	if err := conn(ctx, r.db).Where("token_hash = ?", hash).First(&t).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &t, nil
+}
+
+func (r *GormTokenRepository) ListByUser(ctx context.Context, userID uint) ([]models.PersonalAccessToken, error) {
+	var tokens []models.PersonalAccessToken
+	err := conn(ctx, r.db).Where("user_id = ?", userID).Order("created_at DESC").Find(&tokens).Error
+	return tokens, err
+}
+
+func (r *GormTokenRepository) TouchLastUsed(ctx context.Context, id uint, at time.Time) error {
+	return conn(ctx, r.db).Model(&models.PersonalAccessToken{}).Where("id = ?", id).Update("last_used_at", at).Error
+}
+
+func (r *GormTokenRepository) Delete(ctx context.Context, id uint, userID uint) error {
+	res := conn(ctx, r.db).Where("id = ? AND user_id = ?", id, userID).Delete(&models.PersonalAccessToken{})
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+type MemoryTokenRepository struct {
+	s *MemoryStore
+}
+
+func NewMemoryTokenRepository(s *MemoryStore) TokenRepository {
+	return &MemoryTokenRepository{s: s}
+}
+
+func (r *MemoryTokenRepository) Create(ctx context.Context, token *models.PersonalAccessToken) error {
+	if err := r.s.lock(ctx); err != nil {
+		return err
+	}
+	defer r.s.unlock(ctx)
+	if r.s.tokens.exists(func(t *models.PersonalAccessToken) bool { return t.TokenHash == token.TokenHash }) {
+		return gorm.ErrDuplicatedKey
+	}
+	token.ID = r.s.tokens.id(token.ID)
+	stamp(&token.CreatedAt)
+	r.s.tokens.insert(*token)
+	return nil
+}
+
+func (r *MemoryTokenRepository) GetByHash(ctx context.Context, hash string) (*models.PersonalAccessToken, error) {
+	if err := r.s.rlock(ctx); err != nil {
+		return nil, err
+	}
+	defer r.s.runlock(ctx)
+	return r.s.tokens.find(func(t *models.PersonalAccessToken) bool { return t.TokenHash == hash }), nil
+}
+
+func (r *MemoryTokenRepository) ListByUser(ctx context.Context, userID uint) ([]models.PersonalAccessToken, error) {
+	if err := r.s.rlock(ctx); err != nil {
+		return nil, err
+	}
+	defer r.s.runlock(ctx)
+	tokens := r.s.tokens.filter(func(t *models.PersonalAccessToken) bool { return t.UserID == userID })
+	sort.SliceStable(tokens, func(i, j int) bool { return tokens[i].CreatedAt.After(tokens[j].CreatedAt) })
+	return tokens, nil
+}
+
+func (r *MemoryTokenRepository) TouchLastUsed(ctx context.Context, id uint, at time.Time) error {
+	if err := r.s.lock(ctx); err != nil {
+		return err
+	}
+	defer r.s.unlock(ctx)
+	r.s.tokens.update(func(t *models.PersonalAccessToken) bool { return t.ID == id }, func(t *models.PersonalAccessToken) { t.LastUsedAt = &at })
+	return nil
+}
+
+func (r *MemoryTokenRepository) Delete(ctx context.Context, id uint, userID uint) error {
+	if err := r.s.lock(ctx); err != nil {
+		return err
+	}
+	defer r.s.unlock(ctx)
+	if r.s.tokens.remove(func(t *models.PersonalAccessToken) bool { return t.ID == id && t.UserID == userID }) == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
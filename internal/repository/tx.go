@@ -0,0 +1,252 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"slices"
+	"time"
+
+	"github.com/cenkalti/backoff/v4"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// DefaultTxRetries is how often WithinTx reruns a transaction that lost a
+// serialization conflict when TxOptions.MaxRetries is zero.
+const DefaultTxRetries = 3
+
+// TxOptions configure a transaction started by TxManager.WithinTx.
+type TxOptions struct {
+	// Isolation is the isolation level; the zero value is the database default
+	// (READ COMMITTED on Postgres, SERIALIZABLE on SQLite).
+	Isolation sql.IsolationLevel
+	ReadOnly  bool
+	// MaxRetries is how often the whole function is rerun after a
+	// serialization failure or deadlock; 0 means DefaultTxRetries and a
+	// negative value disables retrying.
+	MaxRetries int
+}
+
+// TxManager runs a function across several repositories in one transaction.
+// fn receives a context carrying the transaction: every repository call made
+// with it, on any repository of the same backend, joins the transaction. The
+// transaction commits when fn returns nil and rolls back otherwise. fn may run
+// more than once, so it must not have side effects outside the repositories.
+//
+// Calling WithinTx with a context that already carries a transaction runs fn
+// in that transaction; only the outermost call commits and retries.
+type TxManager interface {
+	WithinTx(ctx context.Context, opts TxOptions, fn func(ctx context.Context) error) error
+}
+
+// LockMode selects the row lock taken by reads made inside a transaction.
+type LockMode int
+
+const (
+	LockNone LockMode = iota
+	// LockForUpdate blocks other writers and lockers until the transaction ends
+	// (SELECT ... FOR UPDATE).
+	LockForUpdate
+	// LockForShare blocks writers but not other readers (SELECT ... FOR SHARE).
+	LockForShare
+)
+
+type txKey struct{}
+type lockKey struct{}
+
+// WithLock makes repository reads done with the returned context lock the rows
+// they return. It only has an effect inside WithinTx, and on SQLite, which
+// locks the whole database for writing instead, not at all.
+func WithLock(ctx context.Context, mode LockMode) context.Context {
+	return context.WithValue(ctx, lockKey{}, mode)
+}
+
+// conn returns the handle GORM repositories query with: the transaction ctx
+// carries, if any, bound to ctx and carrying its row lock.
+func conn(ctx context.Context, db *gorm.DB) *gorm.DB {
+	tx, ok := ctx.Value(txKey{}).(*gorm.DB)
+	if !ok {
+		return db.WithContext(ctx)
+	}
+	tx = tx.WithContext(ctx)
+	switch ctx.Value(lockKey{}) {
+	case LockForUpdate:
+		tx = tx.Clauses(clause.Locking{Strength: clause.LockingStrengthUpdate})
+	case LockForShare:
+		tx = tx.Clauses(clause.Locking{Strength: clause.LockingStrengthShare})
+	}
+	return tx
+}
+
+type GormTxManager struct {
+	db *gorm.DB
+}
+
+func NewGormTxManager(db *gorm.DB) TxManager {
+	return &GormTxManager{db: db}
+}
+
+func (m *GormTxManager) WithinTx(ctx context.Context, opts TxOptions, fn func(ctx context.Context) error) error {
+	if _, ok := ctx.Value(txKey{}).(*gorm.DB); ok {
+		return fn(ctx)
+	}
+	sqlOpts := &sql.TxOptions{Isolation: opts.Isolation, ReadOnly: opts.ReadOnly}
+	var hooks *commitHooks
+	err := retryTx(ctx, opts, func() error {
+		hooks = &commitHooks{}
+		return m.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+			return fn(context.WithValue(context.WithValue(ctx, txKey{}, tx), hooksKey{}, hooks))
+		}, sqlOpts)
+	})
+	if err != nil {
+		return err
+	}
+	hooks.run()
+	return nil
+}
+
+type hooksKey struct{}
+
+// commitHooks are functions to run once a transaction has committed.
+type commitHooks struct {
+	fns []func()
+}
+
+func (h *commitHooks) run() {
+	for _, fn := range h.fns {
+		fn()
+	}
+}
+
+// afterCommit runs fn when the transaction ctx carries commits, or right away
+// outside a transaction. A rolled back attempt drops its functions.
+func afterCommit(ctx context.Context, fn func()) {
+	if h, ok := ctx.Value(hooksKey{}).(*commitHooks); ok {
+		h.fns = append(h.fns, fn)
+		return
+	}
+	fn()
+}
+
+// inTx reports whether ctx carries a transaction of any backend.
+func inTx(ctx context.Context) bool {
+	return ctx.Value(txKey{}) != nil
+}
+
+// retryTx runs attempt until it succeeds, fails with an error other than a
+// serialization conflict, or runs out of retries.
+func retryTx(ctx context.Context, opts TxOptions, attempt func() error) error {
+	retries := opts.MaxRetries
+	if retries == 0 {
+		retries = DefaultTxRetries
+	}
+	if retries < 0 {
+		return attempt()
+	}
+	b := backoff.NewExponentialBackOff()
+	b.InitialInterval = 10 * time.Millisecond
+	b.MaxInterval = 200 * time.Millisecond
+	return backoff.Retry(func() error {
+		err := attempt()
+		if err != nil && !IsSerializationFailure(err) {
+			return backoff.Permanent(err)
+		}
+		return err
+	}, backoff.WithContext(backoff.WithMaxRetries(b, uint64(retries)), ctx))
+}
+
+// IsSerializationFailure reports whether err means the transaction conflicted
+// with a concurrent one and succeeds if rerun: a Postgres serialization
+// failure or deadlock, or SQLite reporting the database busy or locked.
+func IsSerializationFailure(err error) bool {
+	var pgErr interface{ SQLState() string }
+	if errors.As(err, &pgErr) {
+		switch pgErr.SQLState() {
+		case "40001", "40P01":
+			return true
+		}
+	}
+	var sqliteErr interface{ Code() int }
+	if errors.As(err, &sqliteErr) {
+		// primary result codes SQLITE_BUSY and SQLITE_LOCKED, with any extended code
+		switch sqliteErr.Code() & 0xff {
+		case 5, 6:
+			return true
+		}
+	}
+	return false
+}
+
+// MemoryTxManager runs transactions on a MemoryStore. A transaction holds the
+// store's write lock throughout, so transactions are serializable and never
+// need retrying, and rolls back by restoring a copy of the tables taken when
+// it began. Row locks are implied.
+type MemoryTxManager struct {
+	s *MemoryStore
+}
+
+func NewMemoryTxManager(s *MemoryStore) TxManager {
+	return &MemoryTxManager{s: s}
+}
+
+func (m *MemoryTxManager) WithinTx(ctx context.Context, _ TxOptions, fn func(ctx context.Context) error) error {
+	if m.s.inTx(ctx) {
+		return fn(ctx)
+	}
+	if err := m.s.lock(ctx); err != nil {
+		return err
+	}
+	hooks := &commitHooks{}
+	err := func() error {
+		defer m.s.mu.Unlock()
+		saved := m.s.snapshot()
+		if err := fn(context.WithValue(context.WithValue(ctx, txKey{}, m.s), hooksKey{}, hooks)); err != nil {
+			m.s.memTables = saved
+			return err
+		}
+		return nil
+	}()
+	if err != nil {
+		return err
+	}
+	hooks.run()
+	return nil
+}
+
+// inTx reports whether ctx carries a transaction on s, whose lock is then
+// already held.
+func (s *MemoryStore) inTx(ctx context.Context) bool {
+	tx, _ := ctx.Value(txKey{}).(*MemoryStore)
+	return tx == s
+}
+
+// snapshot copies every table. Rows are copied, not shared, because memTable
+// updates and removals work in place.
+func (s *MemoryStore) snapshot() memTables {
+	t := s.memTables
+	cloneRows(&t.users)
+	cloneRows(&t.todos)
+	cloneRows(&t.revisions)
+	cloneRows(&t.workspaces)
+	cloneRows(&t.memberships)
+	cloneRows(&t.lists)
+	cloneRows(&t.shares)
+	cloneRows(&t.invitations)
+	cloneRows(&t.tokens)
+	cloneRows(&t.recoveryCodes)
+	cloneRows(&t.identities)
+	cloneRows(&t.sessions)
+	cloneRows(&t.magicLinks)
+	cloneRows(&t.passwordResets)
+	cloneRows(&t.oauthClients)
+	cloneRows(&t.oauthAuthorizations)
+	cloneRows(&t.oauthCodes)
+	cloneRows(&t.oauthTokens)
+	cloneRows(&t.dataKeys)
+	return t
+}
+
+func cloneRows[T any](t *memTable[T]) {
+	t.rows = slices.Clone(t.rows)
+}
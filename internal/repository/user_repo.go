@@ -1,7 +1,10 @@
 package repository
 
 import (
+	"context"
 	"errors"
+	"strings"
+	"time"
 
 	"gorm.io/gorm"
 
@@ -9,8 +12,24 @@ import (
 )
 
 type UserRepository interface {
-	Create(user *models.User) error
-	GetByEmail(email string) (*models.User, error)
+	Create(ctx context.Context, user *models.User) error
+	GetByEmail(ctx context.Context, email string) (*models.User, error)
+	GetByID(ctx context.Context, id uint) (*models.User, error)
+	Update(ctx context.Context, user *models.User) error
+	UpdatePasswordHash(ctx context.Context, id uint, hash string) error
+	// AdvanceTOTPStep records step as the user's last used TOTP step unless it
+	// is not past the recorded one, and reports whether it was recorded. Of two
+	// concurrent logins with the same code only one succeeds.
+	AdvanceTOTPStep(ctx context.Context, id uint, step int64) (bool, error)
+	SetRole(ctx context.Context, id uint, role string) error
+	// SetDisabledAt disables the user at the given time, or enables them when it is nil.
+	SetDisabledAt(ctx context.Context, id uint, at *time.Time) error
+	// SetTOTP writes only the two-factor columns, leaving the rest of the row alone.
+	SetTOTP(ctx context.Context, id uint, secret string, enabled bool, lastStep int64) error
+	// Search pages through users whose email contains query, with their todo counts.
+	Search(ctx context.Context, query string, offset, limit int) ([]models.UserSummary, int64, error)
+	GetSummary(ctx context.Context, id uint) (*models.UserSummary, error)
+	SetRoleByEmail(ctx context.Context, emails []string, role string) error
 }
 
 type GormUserRepository struct {
@@ -21,13 +40,16 @@ func NewGormUserRepository(db *gorm.DB) UserRepository {
 	return &GormUserRepository{db: db}
 }
 
-func (r *GormUserRepository) Create(user *models.User) error {
-	return r.db.Create(user).Error
+func (r *GormUserRepository) Create(ctx context.Context, user *models.User) error {
+	return conn(ctx, r.db).Create(user).Error
 }
 
-func (r *GormUserRepository) GetByEmail(email string) (*models.User, error) {
+// GetByEmail always reads from the primary: it serves login, registration and
+// password resets, which must see the current password hash, MFA settings and
+// disabled flag rather than a lagging replica's copy.
+func (r *GormUserRepository) GetByEmail(ctx context.Context, email string) (*models.User, error) {
 	var u models.User
-	if err := r.db.Where("email = ?", email).First(&u).Error; err != nil {
+	if err := conn(ctx, r.db).Where("email = ?", email).First(&u).Error; err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
 			return nil, nil
 		}
@@ -35,3 +57,243 @@ func (r *GormUserRepository) GetByEmail(email string) (*models.User, error) {
 	}
 	return &u, nil
 }
+
+func (r *GormUserRepository) GetByID(ctx context.Context, id uint) (*models.User, error) {
+	var u models.User
+	if err := conn(ctx, r.db).First(&u, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &u, nil
+}
+
+func (r *GormUserRepository) Update(ctx context.Context, user *models.User) error {
+	return conn(ctx, r.db).Save(user).Error
+}
+
+func (r *GormUserRepository) UpdatePasswordHash(ctx context.Context, id uint, hash string) error {
+	return conn(ctx, r.db).Model(&models.User{}).Where("id = ?", id).Update("password_hash", hash).Error
+}
+
+func (r *GormUserRepository) AdvanceTOTPStep(ctx context.Context, id uint, step int64) (bool, error) {
+	res := conn(ctx, r.db).Model(&models.User{}).Where("id = ? AND totp_last_step < ?", id, step).Update("totp_last_step", step)
+	return res.RowsAffected == 1, res.Error
+}
+
+func (r *GormUserRepository) SetRole(ctx context.Context, id uint, role string) error {
+	return conn(ctx, r.db).Model(&models.User{}).Where("id = ?", id).Update("role", role).Error
+}
+
+func (r *GormUserRepository) SetDisabledAt(ctx context.Context, id uint, at *time.Time) error {
+	return conn(ctx, r.db).Model(&models.User{}).Where("id = ?", id).Update("disabled_at", at).Error
+}
+
+func (r *GormUserRepository) SetTOTP(ctx context.Context, id uint, secret string, enabled bool, lastStep int64) error {
+	return conn(ctx, r.db).Model(&models.User{}).Where("id = ?", id).
+		Updates(map[string]any{"totp_secret": secret, "totp_enabled": enabled, "totp_last_step": lastStep}).Error
+}
+
+func (r *GormUserRepository) summaries(ctx context.Context) *gorm.DB {
+	return conn(ctx, r.db).Model(&models.User{}).
+		Select("users.*, COUNT(todos.id) AS todo_count").
+		Joins("LEFT JOIN todos ON todos.owner_id = users.id AND todos.deleted_at IS NULL").
+		Group("users.id")
+}
+
+func (r *GormUserRepository) Search(ctx context.Context, query string, offset, limit int) ([]models.UserSummary, int64, error) {
+	match := func(db *gorm.DB) *gorm.DB {
+		if query == "" {
+			return db
+		}
+		return db.Where(`LOWER(users.email) LIKE ? ESCAPE '\'`, "%"+escapeLike(strings.ToLower(query))+"%")
+	}
+	var total int64
+	if err := conn(ctx, r.db).Model(&models.User{}).Scopes(match).Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	var out []models.UserSummary
+	err := r.summaries(ctx).Scopes(match).Order("users.id").Offset(offset).Limit(limit).Scan(&out).Error
+	return out, total, err
+}
+
+// likeEscaper escapes the LIKE wildcards, for patterns used with ESCAPE '\'.
+var likeEscaper = strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`)
+
+func escapeLike(s string) string {
+	return likeEscaper.Replace(s)
+}
+
+func (r *GormUserRepository) GetSummary(ctx context.Context, id uint) (*models.UserSummary, error) {
+	var out []models.UserSummary
+	if err := r.summaries(ctx).Where("users.id = ?", id).Scan(&out).Error; err != nil {
+		return nil, err
+	}
+	if len(out) == 0 {
+		return nil, nil
+	}
+	return &out[0], nil
+}
+
+func (r *GormUserRepository) SetRoleByEmail(ctx context.Context, emails []string, role string) error {
+	if len(emails) == 0 {
+		return nil
+	}
+	return conn(ctx, r.db).Model(&models.User{}).Where("email IN ?", emails).Update("role", role).Error
+}
+
+type MemoryUserRepository struct {
+	s *MemoryStore
+}
+
+func NewMemoryUserRepository(s *MemoryStore) UserRepository {
+	return &MemoryUserRepository{s: s}
+}
+
+func (r *MemoryUserRepository) Create(ctx context.Context, user *models.User) error {
+	if err := r.s.lock(ctx); err != nil {
+		return err
+	}
+	defer r.s.unlock(ctx)
+	if r.s.users.exists(func(u *models.User) bool { return u.Email == user.Email }) {
+		return gorm.ErrDuplicatedKey
+	}
+	user.ID = r.s.users.id(user.ID)
+	if user.Role == "" {
+		user.Role = models.RoleUser
+	}
+	stamp(&user.CreatedAt)
+	r.s.users.insert(*user)
+	return nil
+}
+
+func (r *MemoryUserRepository) GetByEmail(ctx context.Context, email string) (*models.User, error) {
+	if err := r.s.rlock(ctx); err != nil {
+		return nil, err
+	}
+	defer r.s.runlock(ctx)
+	return r.s.users.find(func(u *models.User) bool { return u.Email == email }), nil
+}
+
+func (r *MemoryUserRepository) GetByID(ctx context.Context, id uint) (*models.User, error) {
+	if err := r.s.rlock(ctx); err != nil {
+		return nil, err
+	}
+	defer r.s.runlock(ctx)
+	return r.s.users.find(func(u *models.User) bool { return u.ID == id }), nil
+}
+
+func (r *MemoryUserRepository) Update(ctx context.Context, user *models.User) error {
+	if err := r.s.lock(ctx); err != nil {
+		return err
+	}
+	defer r.s.unlock(ctx)
+	if r.s.users.exists(func(u *models.User) bool { return u.Email == user.Email && u.ID != user.ID }) {
+		return gorm.ErrDuplicatedKey
+	}
+	if r.s.users.update(func(u *models.User) bool { return u.ID == user.ID }, func(u *models.User) { *u = *user }) == 0 {
+		// Save inserts rows it cannot find
+		user.ID = r.s.users.id(user.ID)
+		stamp(&user.CreatedAt)
+		r.s.users.insert(*user)
+	}
+	return nil
+}
+
+func (r *MemoryUserRepository) UpdatePasswordHash(ctx context.Context, id uint, hash string) error {
+	if err := r.s.lock(ctx); err != nil {
+		return err
+	}
+	defer r.s.unlock(ctx)
+	r.s.users.update(func(u *models.User) bool { return u.ID == id }, func(u *models.User) { u.PasswordHash = hash })
+	return nil
+}
+
+func (r *MemoryUserRepository) AdvanceTOTPStep(ctx context.Context, id uint, step int64) (bool, error) {
+	if err := r.s.lock(ctx); err != nil {
+		return false, err
+	}
+	defer r.s.unlock(ctx)
+	n := r.s.users.update(func(u *models.User) bool { return u.ID == id && u.TOTPLastStep < step }, func(u *models.User) { u.TOTPLastStep = step })
+	return n == 1, nil
+}
+
+func (r *MemoryUserRepository) SetRole(ctx context.Context, id uint, role string) error {
+	if err := r.s.lock(ctx); err != nil {
+		return err
+	}
+	defer r.s.unlock(ctx)
+	r.s.users.update(func(u *models.User) bool { return u.ID == id }, func(u *models.User) { u.Role = role })
+	return nil
+}
+
+func (r *MemoryUserRepository) SetDisabledAt(ctx context.Context, id uint, at *time.Time) error {
+	if err := r.s.lock(ctx); err != nil {
+		return err
+	}
+	defer r.s.unlock(ctx)
+	r.s.users.update(func(u *models.User) bool { return u.ID == id }, func(u *models.User) { u.DisabledAt = at })
+	return nil
+}
+
+func (r *MemoryUserRepository) SetTOTP(ctx context.Context, id uint, secret string, enabled bool, lastStep int64) error {
+	if err := r.s.lock(ctx); err != nil {
+		return err
+	}
+	defer r.s.unlock(ctx)
+	r.s.users.update(func(u *models.User) bool { return u.ID == id }, func(u *models.User) {
+		u.TOTPSecret, u.TOTPEnabled, u.TOTPLastStep = secret, enabled, lastStep
+	})
+	return nil
+}
+
+func (r *MemoryUserRepository) summary(u models.User) models.UserSummary {
+	todos := r.s.todos.filter(func(t *models.Todo) bool { return t.OwnerID == u.ID && t.DeletedAt == nil })
+	return models.UserSummary{User: u, TodoCount: int64(len(todos))}
+}
+
+func (r *MemoryUserRepository) Search(ctx context.Context, query string, offset, limit int) ([]models.UserSummary, int64, error) {
+	if err := r.s.rlock(ctx); err != nil {
+		return nil, 0, err
+	}
+	defer r.s.runlock(ctx)
+	query = strings.ToLower(query)
+	matched := r.s.users.filter(func(u *models.User) bool { return strings.Contains(strings.ToLower(u.Email), query) })
+	total := int64(len(matched))
+	if offset > 0 {
+		matched = matched[min(offset, len(matched)):]
+	}
+	if limit >= 0 {
+		matched = matched[:min(limit, len(matched))]
+	}
+	out := make([]models.UserSummary, 0, len(matched))
+	for _, u := range matched {
+		out = append(out, r.summary(u))
+	}
+	return out, total, nil
+}
+
+func (r *MemoryUserRepository) GetSummary(ctx context.Context, id uint) (*models.UserSummary, error) {
+	if err := r.s.rlock(ctx); err != nil {
+		return nil, err
+	}
+	defer r.s.runlock(ctx)
+	u := r.s.users.find(func(u *models.User) bool { return u.ID == id })
+	if u == nil {
+		return nil, nil
+	}
+	sum := r.summary(*u)
+	return &sum, nil
+}
+
+func (r *MemoryUserRepository) SetRoleByEmail(ctx context.Context, emails []string, role string) error {
+	if err := r.s.lock(ctx); err != nil {
+		return err
+	}
+	defer r.s.unlock(ctx)
+	for _, email := range emails {
+		r.s.users.update(func(u *models.User) bool { return u.Email == email }, func(u *models.User) { u.Role = role })
+	}
+	return nil
+}
@@ -0,0 +1,379 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"sort"
+
+	"gorm.io/gorm"
+
+	"github.com/ahmadjafari86/go-todo-list/internal/models"
+)
+
+const personalWorkspaceName = "Personal"
+
+type WorkspaceRepository interface {
+	// Create stores a workspace and makes ws.OwnerID its owner.
+	Create(ctx context.Context, ws *models.Workspace) error
+	// EnsurePersonal returns the user's personal workspace, creating it if needed.
+	EnsurePersonal(ctx context.Context, userID uint) (*models.Workspace, error)
+	GetByID(ctx context.Context, id uint) (*models.Workspace, error)
+	ListForUser(ctx context.Context, userID uint) ([]models.WorkspaceWithRole, error)
+	Rename(ctx context.Context, id uint, name string) error
+	// Delete removes the workspace together with its memberships, lists and todos.
+	Delete(ctx context.Context, id uint) error
+
+	GetMembership(ctx context.Context, workspaceID, userID uint) (*models.Membership, error)
+	ListMembers(ctx context.Context, workspaceID uint) ([]models.Membership, error)
+	AddMember(ctx context.Context, m *models.Membership) error
+	UpdateMemberRole(ctx context.Context, workspaceID, userID uint, role string) error
+	RemoveMember(ctx context.Context, workspaceID, userID uint) error
+
+	// BackfillPersonal moves todos created before workspaces existed into their
+	// owner's personal workspace.
+	BackfillPersonal(ctx context.Context) error
+}
+
+type GormWorkspaceRepository struct {
+	db *gorm.DB
+}
+
+func NewGormWorkspaceRepository(db *gorm.DB) WorkspaceRepository {
+	return &GormWorkspaceRepository{db: db}
+}
+
+// memberWorkspaces is a subquery selecting the workspaces userID belongs to,
+// optionally restricted to the given roles.
+func memberWorkspaces(db *gorm.DB, userID uint, roles []string) *gorm.DB {
+	q := db.Session(&gorm.Session{NewDB: true}).Model(&models.Membership{}).
+		Select("workspace_id").Where("user_id = ?", userID)
+	if len(roles) > 0 {
+		q = q.Where("role IN ?", roles)
+	}
+	return q
+}
+
+func (r *GormWorkspaceRepository) Create(ctx context.Context, ws *models.Workspace) error {
+	return conn(ctx, r.db).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(ws).Error; err != nil {
+			return err
+		}
+		return tx.Create(&models.Membership{
+			WorkspaceID: ws.ID,
+			UserID:      ws.OwnerID,
+			Role:        models.WorkspaceRoleOwner,
+		}).Error
+	})
+}
+
+func (r *GormWorkspaceRepository) EnsurePersonal(ctx context.Context, userID uint) (*models.Workspace, error) {
+	find := func() (*models.Workspace, error) {
+		var ws models.Workspace
+		err := conn(ctx, r.db).Where("owner_id = ? AND personal = ?", userID, true).First(&ws).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		return &ws, nil
+	}
+	ws, err := find()
+	if err != nil || ws != nil {
+		return ws, err
+	}
+	ws = &models.Workspace{Name: personalWorkspaceName, Personal: true, OwnerID: userID}
+	if err := r.Create(ctx, ws); err != nil {
+		// a concurrent request may have created it first; the unique index decides
+		if existing, ferr := find(); ferr == nil && existing != nil {
+			return existing, nil
+		}
+		return nil, err
+	}
+	return ws, nil
+}
+
+func (r *GormWorkspaceRepository) GetByID(ctx context.Context, id uint) (*models.Workspace, error) {
+	var ws models.Workspace
+	if err := conn(ctx, r.db).First(&ws, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &ws, nil
+}
+
+func (r *GormWorkspaceRepository) ListForUser(ctx context.Context, userID uint) ([]models.WorkspaceWithRole, error) {
+	out := []models.WorkspaceWithRole{}
+	err := conn(ctx, r.db).Model(&models.Workspace{}).
+		Select("workspaces.*, memberships.role AS role").
+		Joins("JOIN memberships ON memberships.workspace_id = workspaces.id").
+		Where("memberships.user_id = ?", userID).
+		Order("workspaces.personal DESC, workspaces.id").
+		Scan(&out).Error
+	return out, err
+}
+
+func (r *GormWorkspaceRepository) Rename(ctx context.Context, id uint, name string) error {
+	return conn(ctx, r.db).Model(&models.Workspace{}).Where("id = ?", id).Update("name", name).Error
+}
+
+func (r *GormWorkspaceRepository) Delete(ctx context.Context, id uint) error {
+	return conn(ctx, r.db).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("workspace_id = ?", id).Delete(&models.Todo{}).Error; err != nil {
+			return err
+		}
+		lists := tx.Session(&gorm.Session{NewDB: true}).Model(&models.TodoList{}).Select("id").Where("workspace_id = ?", id)
+		if err := tx.Where("list_id IN (?)", lists).Delete(&models.ListShare{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("workspace_id = ?", id).Delete(&models.TodoList{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("workspace_id = ?", id).Delete(&models.Membership{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&models.Workspace{}, id).Error
+	})
+}
+
+func (r *GormWorkspaceRepository) GetMembership(ctx context.Context, workspaceID, userID uint) (*models.Membership, error) {
+	var m models.Membership
+	if err := conn(ctx, r.db).Where("workspace_id = ? AND user_id = ?", workspaceID, userID).First(&m).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &m, nil
+}
+
+func (r *GormWorkspaceRepository) ListMembers(ctx context.Context, workspaceID uint) ([]models.Membership, error) {
+	var members []models.Membership
+	err := conn(ctx, r.db).Where("workspace_id = ?", workspaceID).Order("created_at").Find(&members).Error
+	return members, err
+}
+
+func (r *GormWorkspaceRepository) AddMember(ctx context.Context, m *models.Membership) error {
+	return conn(ctx, r.db).Create(m).Error
+}
+
+func (r *GormWorkspaceRepository) UpdateMemberRole(ctx context.Context, workspaceID, userID uint, role string) error {
+	res := conn(ctx, r.db).Model(&models.Membership{}).
+		Where("workspace_id = ? AND user_id = ?", workspaceID, userID).
+		Update("role", role)
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+func (r *GormWorkspaceRepository) RemoveMember(ctx context.Context, workspaceID, userID uint) error {
+	res := conn(ctx, r.db).Where("workspace_id = ? AND user_id = ?", workspaceID, userID).Delete(&models.Membership{})
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+func (r *GormWorkspaceRepository) BackfillPersonal(ctx context.Context) error {
+	var ownerIDs []uint
+	err := conn(ctx, r.db).Model(&models.Todo{}).
+		Where("workspace_id IS NULL OR workspace_id = 0").
+		Distinct().Pluck("owner_id", &ownerIDs).Error
+	if err != nil {
+		return err
+	}
+	for _, ownerID := range ownerIDs {
+		ws, err := r.EnsurePersonal(ctx, ownerID)
+		if err != nil {
+			return err
+		}
+		err = conn(ctx, r.db).Model(&models.Todo{}).
+			Where("owner_id = ? AND (workspace_id IS NULL OR workspace_id = 0)", ownerID).
+			Update("workspace_id", ws.ID).Error
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type MemoryWorkspaceRepository struct {
+	s *MemoryStore
+}
+
+func NewMemoryWorkspaceRepository(s *MemoryStore) WorkspaceRepository {
+	return &MemoryWorkspaceRepository{s: s}
+}
+
+// create stores ws and its owner membership; the caller holds the lock.
+func (r *MemoryWorkspaceRepository) create(ws *models.Workspace) error {
+	if ws.Personal && r.s.workspaces.exists(func(w *models.Workspace) bool {
+		return w.Personal && w.OwnerID == ws.OwnerID
+	}) {
+		return gorm.ErrDuplicatedKey
+	}
+	ws.ID = r.s.workspaces.id(ws.ID)
+	stamp(&ws.CreatedAt)
+	r.s.workspaces.insert(*ws)
+	return r.addMember(&models.Membership{WorkspaceID: ws.ID, UserID: ws.OwnerID, Role: models.WorkspaceRoleOwner})
+}
+
+func (r *MemoryWorkspaceRepository) addMember(m *models.Membership) error {
+	if r.s.memberRole(m.WorkspaceID, m.UserID) != "" {
+		return gorm.ErrDuplicatedKey
+	}
+	stamp(&m.CreatedAt)
+	r.s.memberships.insert(*m)
+	return nil
+}
+
+func (r *MemoryWorkspaceRepository) Create(ctx context.Context, ws *models.Workspace) error {
+	if err := r.s.lock(ctx); err != nil {
+		return err
+	}
+	defer r.s.unlock(ctx)
+	return r.create(ws)
+}
+
+func (r *MemoryWorkspaceRepository) ensurePersonal(userID uint) (*models.Workspace, error) {
+	if ws := r.s.workspaces.find(func(w *models.Workspace) bool { return w.OwnerID == userID && w.Personal }); ws != nil {
+		return ws, nil
+	}
+	ws := &models.Workspace{Name: personalWorkspaceName, Personal: true, OwnerID: userID}
+	if err := r.create(ws); err != nil {
+		return nil, err
+	}
+	return ws, nil
+}
+
+func (r *MemoryWorkspaceRepository) EnsurePersonal(ctx context.Context, userID uint) (*models.Workspace, error) {
+	if err := r.s.lock(ctx); err != nil {
+		return nil, err
+	}
+	defer r.s.unlock(ctx)
+	return r.ensurePersonal(userID)
+}
+
+func (r *MemoryWorkspaceRepository) GetByID(ctx context.Context, id uint) (*models.Workspace, error) {
+	if err := r.s.rlock(ctx); err != nil {
+		return nil, err
+	}
+	defer r.s.runlock(ctx)
+	return r.s.workspaces.find(func(w *models.Workspace) bool { return w.ID == id }), nil
+}
+
+func (r *MemoryWorkspaceRepository) ListForUser(ctx context.Context, userID uint) ([]models.WorkspaceWithRole, error) {
+	if err := r.s.rlock(ctx); err != nil {
+		return nil, err
+	}
+	defer r.s.runlock(ctx)
+	out := []models.WorkspaceWithRole{}
+	for _, ws := range r.s.workspaces.filter(func(w *models.Workspace) bool { return r.s.memberRole(w.ID, userID) != "" }) {
+		out = append(out, models.WorkspaceWithRole{Workspace: ws, Role: r.s.memberRole(ws.ID, userID)})
+	}
+	sort.SliceStable(out, func(i, j int) bool { return out[i].Personal && !out[j].Personal })
+	return out, nil
+}
+
+func (r *MemoryWorkspaceRepository) Rename(ctx context.Context, id uint, name string) error {
+	if err := r.s.lock(ctx); err != nil {
+		return err
+	}
+	defer r.s.unlock(ctx)
+	r.s.workspaces.update(func(w *models.Workspace) bool { return w.ID == id }, func(w *models.Workspace) { w.Name = name })
+	return nil
+}
+
+func (r *MemoryWorkspaceRepository) Delete(ctx context.Context, id uint) error {
+	if err := r.s.lock(ctx); err != nil {
+		return err
+	}
+	defer r.s.unlock(ctx)
+	r.s.removeTodos(func(t *models.Todo) bool { return t.WorkspaceID == id })
+	var lists []uint
+	for _, l := range r.s.lists.filter(func(l *models.TodoList) bool { return l.WorkspaceID == id }) {
+		lists = append(lists, l.ID)
+	}
+	r.s.shares.remove(func(sh *models.ListShare) bool { return containsID(lists, sh.ListID) })
+	r.s.lists.remove(func(l *models.TodoList) bool { return l.WorkspaceID == id })
+	r.s.memberships.remove(func(m *models.Membership) bool { return m.WorkspaceID == id })
+	r.s.workspaces.remove(func(w *models.Workspace) bool { return w.ID == id })
+	return nil
+}
+
+func (r *MemoryWorkspaceRepository) GetMembership(ctx context.Context, workspaceID, userID uint) (*models.Membership, error) {
+	if err := r.s.rlock(ctx); err != nil {
+		return nil, err
+	}
+	defer r.s.runlock(ctx)
+	return r.s.memberships.find(func(m *models.Membership) bool {
+		return m.WorkspaceID == workspaceID && m.UserID == userID
+	}), nil
+}
+
+func (r *MemoryWorkspaceRepository) ListMembers(ctx context.Context, workspaceID uint) ([]models.Membership, error) {
+	if err := r.s.rlock(ctx); err != nil {
+		return nil, err
+	}
+	defer r.s.runlock(ctx)
+	members := r.s.memberships.filter(func(m *models.Membership) bool { return m.WorkspaceID == workspaceID })
+	sort.SliceStable(members, func(i, j int) bool { return members[i].CreatedAt.Before(members[j].CreatedAt) })
+	return members, nil
+}
+
+func (r *MemoryWorkspaceRepository) AddMember(ctx context.Context, m *models.Membership) error {
+	if err := r.s.lock(ctx); err != nil {
+		return err
+	}
+	defer r.s.unlock(ctx)
+	return r.addMember(m)
+}
+
+func (r *MemoryWorkspaceRepository) UpdateMemberRole(ctx context.Context, workspaceID, userID uint, role string) error {
+	if err := r.s.lock(ctx); err != nil {
+		return err
+	}
+	defer r.s.unlock(ctx)
+	n := r.s.memberships.update(func(m *models.Membership) bool {
+		return m.WorkspaceID == workspaceID && m.UserID == userID
+	}, func(m *models.Membership) { m.Role = role })
+	if n == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+func (r *MemoryWorkspaceRepository) RemoveMember(ctx context.Context, workspaceID, userID uint) error {
+	if err := r.s.lock(ctx); err != nil {
+		return err
+	}
+	defer r.s.unlock(ctx)
+	if r.s.memberships.remove(func(m *models.Membership) bool { return m.WorkspaceID == workspaceID && m.UserID == userID }) == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+func (r *MemoryWorkspaceRepository) BackfillPersonal(ctx context.Context) error {
+	if err := r.s.lock(ctx); err != nil {
+		return err
+	}
+	defer r.s.unlock(ctx)
+	for _, t := range r.s.todos.filter(func(t *models.Todo) bool { return t.WorkspaceID == 0 }) {
+		ws, err := r.ensurePersonal(t.OwnerID)
+		if err != nil {
+			return err
+		}
+		r.s.todos.update(func(row *models.Todo) bool { return row.ID == t.ID }, func(row *models.Todo) { row.WorkspaceID = ws.ID })
+	}
+	return nil
+}
@@ -0,0 +1,112 @@
+package service
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+
+	"gorm.io/gorm"
+
+	"github.com/ahmadjafari86/go-todo-list/internal/repository"
+)
+
+// ErrPasswordNotSet is returned when an action needs the password of an account
+// that signs in through an identity provider or magic links only.
+var ErrPasswordNotSet = errors.New("account has no password")
+
+type AccountService interface {
+	// Export returns a zip archive with one JSON file per kind of data stored about the user.
+	Export(ctx context.Context, userID uint) ([]byte, error)
+	// DeleteAccount removes the user and everything they own after checking their
+	// password, along with the attempt counters kept for their email.
+	DeleteAccount(ctx context.Context, userID uint, password string) error
+}
+
+type accountService struct {
+	users    repository.UserRepository
+	accounts repository.AccountRepository
+	attempts repository.AttemptStore
+	hasher   PasswordHasher
+	tx       repository.TxManager
+}
+
+func NewAccountService(users repository.UserRepository, accounts repository.AccountRepository, attempts repository.AttemptStore,
+	hasher PasswordHasher, tx repository.TxManager) AccountService {
+	return &accountService{users: users, accounts: accounts, attempts: attempts, hasher: hasher, tx: tx}
+}
+
+func (s *accountService) Export(ctx context.Context, userID uint) ([]byte, error) {
+	data, err := s.accounts.Export(ctx, userID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrUserNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	files := []struct {
+		name string
+		v    any
+	}{
+		{"profile.json", data.Profile},
+		{"todos.json", data.Todos},
+		{"workspaces.json", data.Workspaces},
+		{"lists.json", data.Lists},
+		{"shared_lists.json", data.SharedLists},
+		{"invitations.json", data.Invitations},
+		{"tokens.json", data.Tokens},
+		{"sessions.json", data.Sessions},
+		{"identities.json", data.Identities},
+		{"oauth_clients.json", data.OAuthClients},
+		{"authorized_apps.json", data.AuthorizedApps},
+	}
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for _, f := range files {
+		w, err := zw.Create(f.name)
+		if err != nil {
+			return nil, err
+		}
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(f.v); err != nil {
+			return nil, err
+		}
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (s *accountService) DeleteAccount(ctx context.Context, userID uint, password string) error {
+	u, err := s.users.GetByID(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if u == nil {
+		return ErrUserNotFound
+	}
+	if u.PasswordHash == "" {
+		return ErrPasswordNotSet
+	}
+	if ok, _ := s.hasher.Verify(password, u.PasswordHash); !ok {
+		return ErrInvalidCredentials
+	}
+	err = s.tx.WithinTx(ctx, repository.TxOptions{}, func(ctx context.Context) error {
+		if err := s.accounts.Delete(ctx, userID); err != nil {
+			return err
+		}
+		for _, key := range []string{accountKey(u.Email), magicLinkKey(u.Email), resetKey(u.Email)} {
+			if err := s.attempts.Reset(ctx, key); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return ErrUserNotFound
+	}
+	return err
+}
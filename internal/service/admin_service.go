@@ -0,0 +1,95 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/ahmadjafari86/go-todo-list/internal/models"
+	"github.com/ahmadjafari86/go-todo-list/internal/repository"
+)
+
+var ErrUserNotFound = errors.New("user not found")
+
+type AdminService interface {
+	ListUsers(ctx context.Context, query string, offset, limit int) ([]models.UserSummary, int64, error)
+	GetUser(ctx context.Context, id uint) (*models.UserSummary, error)
+	DisableUser(ctx context.Context, id, actorID uint) error
+	EnableUser(ctx context.Context, id uint) error
+	SetRole(ctx context.Context, id, actorID uint, role string) error
+	// PromoteAdmins grants the admin role to existing users with the given emails.
+	PromoteAdmins(ctx context.Context, emails []string) error
+}
+
+type adminService struct {
+	users repository.UserRepository
+}
+
+func NewAdminService(users repository.UserRepository) AdminService {
+	return &adminService{users: users}
+}
+
+func (s *adminService) ListUsers(ctx context.Context, query string, offset, limit int) ([]models.UserSummary, int64, error) {
+	return s.users.Search(ctx, query, offset, limit)
+}
+
+func (s *adminService) GetUser(ctx context.Context, id uint) (*models.UserSummary, error) {
+	u, err := s.users.GetSummary(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if u == nil {
+		return nil, ErrUserNotFound
+	}
+	return u, nil
+}
+
+func (s *adminService) DisableUser(ctx context.Context, id, actorID uint) error {
+	if id == actorID {
+		return errors.New("admins cannot disable themselves")
+	}
+	u, err := s.load(ctx, id)
+	if err != nil {
+		return err
+	}
+	if u.Disabled() {
+		return nil
+	}
+	now := time.Now()
+	return s.users.SetDisabledAt(ctx, u.ID, &now)
+}
+
+func (s *adminService) EnableUser(ctx context.Context, id uint) error {
+	if _, err := s.load(ctx, id); err != nil {
+		return err
+	}
+	return s.users.SetDisabledAt(ctx, id, nil)
+}
+
+func (s *adminService) SetRole(ctx context.Context, id, actorID uint, role string) error {
+	if role != models.RoleUser && role != models.RoleAdmin {
+		return errors.New("unknown role")
+	}
+	if id == actorID && role != models.RoleAdmin {
+		return errors.New("admins cannot demote themselves")
+	}
+	if _, err := s.load(ctx, id); err != nil {
+		return err
+	}
+	return s.users.SetRole(ctx, id, role)
+}
+
+func (s *adminService) PromoteAdmins(ctx context.Context, emails []string) error {
+	return s.users.SetRoleByEmail(ctx, emails, models.RoleAdmin)
+}
+
+func (s *adminService) load(ctx context.Context, id uint) (*models.User, error) {
+	u, err := s.users.GetByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if u == nil {
+		return nil, ErrUserNotFound
+	}
+	return u, nil
+}
@@ -1,96 +1,315 @@
 package service
 
 import (
+	"context"
 	"errors"
 	"fmt"
-	"os"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
-	"golang.org/x/crypto/bcrypt"
 
 	"github.com/ahmadjafari86/go-todo-list/internal/models"
 	"github.com/ahmadjafari86/go-todo-list/internal/repository"
 )
 
+// Token types carried in the "typ" claim. Only access tokens are accepted by ParseToken.
+const (
+	tokenTypeAccess       = "access"
+	tokenTypeMFAChallenge = "mfa_challenge"
+	tokenTypeInvitation   = "invitation"
+)
+
+const mfaChallengeTTL = 5 * time.Minute
+
+// sessionTouchInterval throttles last-seen writes for busy sessions.
+const sessionTouchInterval = time.Minute
+
+var (
+	ErrInvalidCredentials = errors.New("invalid credentials")
+	ErrAccountDisabled    = errors.New("account is disabled")
+	ErrSessionRevoked     = errors.New("session has been revoked")
+	ErrInvalidChallenge   = errors.New("invalid or expired challenge")
+)
+
+// Claims are the JWT claims issued by authService.
+type Claims struct {
+	jwt.RegisteredClaims
+	TokenType string `json:"typ,omitempty"`
+	Role      string `json:"role,omitempty"`
+	SessionID string `json:"sid,omitempty"`
+}
+
+// ClientInfo describes the client a session is created for.
+type ClientInfo struct {
+	UserAgent string
+	IP        string
+}
+
+// LoginResult holds either the access token or, for accounts with two-factor
+// authentication enabled, a short-lived challenge token for CompleteMFALogin.
+type LoginResult struct {
+	Token       string
+	MFARequired bool
+	MFAToken    string
+}
+
 type AuthService interface {
-	Register(email, password string) (*models.User, error)
-	Login(email, password string) (string, error)
-	ParseToken(tokenStr string) (*jwt.RegisteredClaims, error)
+	Register(ctx context.Context, email, password string) (*models.User, error)
+	// Login checks the credentials and, unless a second factor is required, starts a
+	// session for the client.
+	Login(ctx context.Context, email, password string, client ClientInfo) (*LoginResult, error)
+	CompleteMFALogin(ctx context.Context, mfaToken, code string, client ClientInfo) (string, error)
+	// ChallengedAccount returns the email of the account an mfa_token was issued
+	// for, so that failed codes count against it.
+	ChallengedAccount(ctx context.Context, mfaToken string) (string, error)
+	// IssueLogin finishes a login for a user authenticated by other means, such as
+	// an external identity provider. Two-factor authentication still applies.
+	IssueLogin(ctx context.Context, u *models.User, client ClientInfo) (*LoginResult, error)
+	// ParseToken verifies an access token. Tokens whose session was revoked are rejected.
+	ParseToken(ctx context.Context, tokenStr string) (*Claims, error)
+}
+
+// JWTConfig configures the tokens issued by AuthService.
+type JWTConfig struct {
+	Keys      *KeySet
+	Issuer    string
+	Audience  string
+	AccessTTL time.Duration
 }
 
 type authService struct {
-	users         repository.UserRepository
-	jwtSecret     string
-	jwtExpMinutes int
+	users    repository.UserRepository
+	sessions repository.SessionRepository
+	mfa      MFAService
+	hasher   PasswordHasher
+	policy   PasswordPolicy
+	jwt      JWTConfig
 }
 
-func NewAuthService(users repository.UserRepository) AuthService {
-	secret := os.Getenv("JWT_SECRET")
-	if secret == "" {
-		secret = "change_this_in_prod"
-	}
-	exp := 60
-	if v := os.Getenv("JWT_EXP_MINUTES"); v != "" {
-		fmt.Sscanf(v, "%d", &exp)
-	}
-	return &authService{users: users, jwtSecret: secret, jwtExpMinutes: exp}
+func NewAuthService(users repository.UserRepository, sessions repository.SessionRepository, mfa MFAService,
+	hasher PasswordHasher, policy PasswordPolicy, jwtCfg JWTConfig) AuthService {
+	return &authService{users: users, sessions: sessions, mfa: mfa, hasher: hasher, policy: policy, jwt: jwtCfg}
 }
 
-func (s *authService) Register(email, password string) (*models.User, error) {
-	ex, err := s.users.GetByEmail(email)
+func (s *authService) Register(ctx context.Context, email, password string) (*models.User, error) {
+	ex, err := s.users.GetByEmail(ctx, email)
 	if err != nil {
 		return nil, err
 	}
 	if ex != nil {
 		return nil, errors.New("email already registered")
 	}
-	hpw, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err := s.policy.Check(password, email); err != nil {
+		return nil, err
+	}
+	hpw, err := s.hasher.Hash(password)
 	if err != nil {
 		return nil, err
 	}
-	u := &models.User{Email: email, PasswordHash: string(hpw)}
-	if err := s.users.Create(u); err != nil {
+	u := &models.User{Email: email, PasswordHash: hpw, Role: models.RoleUser}
+	if err := s.users.Create(ctx, u); err != nil {
 		return nil, err
 	}
 	return u, nil
 }
 
-func (s *authService) Login(email, password string) (string, error) {
-	u, err := s.users.GetByEmail(email)
+func (s *authService) Login(ctx context.Context, email, password string, client ClientInfo) (*LoginResult, error) {
+	u, err := s.users.GetByEmail(ctx, email)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 	if u == nil {
-		return "", errors.New("invalid credentials")
+		return nil, ErrInvalidCredentials
+	}
+	if ok, _ := s.hasher.Verify(password, u.PasswordHash); !ok {
+		return nil, ErrInvalidCredentials
+	}
+	if s.hasher.NeedsRehash(u.PasswordHash) {
+		// upgrade old algorithms and parameters while the plain password is at hand;
+		// a failure only postpones the upgrade to the next login
+		if hpw, err := s.hasher.Hash(password); err == nil && s.users.UpdatePasswordHash(ctx, u.ID, hpw) == nil {
+			u.PasswordHash = hpw
+		}
+	}
+	return s.IssueLogin(ctx, u, client)
+}
+
+func (s *authService) IssueLogin(ctx context.Context, u *models.User, client ClientInfo) (*LoginResult, error) {
+	if u.Disabled() {
+		return nil, ErrAccountDisabled
+	}
+	if u.TOTPEnabled {
+		challenge, err := s.sign(u, tokenTypeMFAChallenge, mfaChallengeTTL)
+		if err != nil {
+			return nil, err
+		}
+		return &LoginResult{MFARequired: true, MFAToken: challenge}, nil
+	}
+
+	tokStr, err := s.startSession(ctx, u, client)
+	if err != nil {
+		return nil, err
+	}
+	return &LoginResult{Token: tokStr}, nil
+}
+
+func (s *authService) CompleteMFALogin(ctx context.Context, mfaToken, code string, client ClientInfo) (string, error) {
+	u, err := s.challengedUser(ctx, mfaToken)
+	if err != nil {
+		return "", err
+	}
+	if u.Disabled() {
+		return "", ErrAccountDisabled
+	}
+	if err := s.mfa.Verify(ctx, u, code); err != nil {
+		if errors.Is(err, ErrInvalidMFACode) {
+			return "", ErrInvalidCredentials
+		}
+		return "", err
+	}
+	return s.startSession(ctx, u, client)
+}
+
+func (s *authService) ChallengedAccount(ctx context.Context, mfaToken string) (string, error) {
+	u, err := s.challengedUser(ctx, mfaToken)
+	if err != nil {
+		return "", err
+	}
+	return u.Email, nil
+}
+
+func (s *authService) challengedUser(ctx context.Context, mfaToken string) (*models.User, error) {
+	claims, err := s.parse(mfaToken, tokenTypeMFAChallenge)
+	if err != nil {
+		return nil, ErrInvalidChallenge
 	}
-	if err := bcrypt.CompareHashAndPassword([]byte(u.PasswordHash), []byte(password)); err != nil {
-		return "", errors.New("invalid credentials")
+	var id uint
+	if _, err := fmt.Sscanf(claims.Subject, "%d", &id); err != nil {
+		return nil, ErrInvalidChallenge
 	}
+	u, err := s.users.GetByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if u == nil || !u.TOTPEnabled {
+		return nil, ErrInvalidChallenge
+	}
+	return u, nil
+}
 
-	exp := time.Now().Add(time.Duration(s.jwtExpMinutes) * time.Minute)
-	claims := jwt.RegisteredClaims{
-		Subject:   fmt.Sprint(u.ID),
-		ExpiresAt: jwt.NewNumericDate(exp),
-		IssuedAt:  jwt.NewNumericDate(time.Now()),
+// ParseToken verifies an access token and that its user still exists and is enabled.
+// The role claim is refreshed from the user record so demotions apply immediately.
+func (s *authService) ParseToken(ctx context.Context, tokenStr string) (*Claims, error) {
+	claims, err := s.parse(tokenStr, tokenTypeAccess)
+	if err != nil {
+		return nil, err
 	}
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	tokStr, err := token.SignedString([]byte(s.jwtSecret))
+	var id uint
+	if _, err := fmt.Sscanf(claims.Subject, "%d", &id); err != nil {
+		return nil, errors.New("invalid token")
+	}
+	u, err := s.users.GetByID(ctx, id)
 	if err != nil {
+		return nil, err
+	}
+	if u == nil {
+		return nil, errors.New("invalid token")
+	}
+	if u.Disabled() {
+		return nil, ErrAccountDisabled
+	}
+	if err := s.checkSession(ctx, claims.SessionID, u.ID); err != nil {
+		return nil, err
+	}
+	claims.Role = u.Role
+	return claims, nil
+}
+
+// startSession records a session for the client and issues an access token bound to it.
+func (s *authService) startSession(ctx context.Context, u *models.User, client ClientInfo) (string, error) {
+	now := time.Now()
+	sess := &models.Session{
+		UserID:     u.ID,
+		UserAgent:  truncate(client.UserAgent, 512),
+		IP:         client.IP,
+		LastSeenAt: now,
+		ExpiresAt:  now.Add(s.jwt.AccessTTL),
+	}
+	if err := s.sessions.Create(ctx, sess); err != nil {
 		return "", err
 	}
-	return tokStr, nil
+	return s.jwt.issue(Claims{
+		RegisteredClaims: jwt.RegisteredClaims{Subject: fmt.Sprint(u.ID)},
+		TokenType:        tokenTypeAccess,
+		Role:             u.Role,
+		SessionID:        fmt.Sprint(sess.ID),
+	}, s.jwt.AccessTTL)
+}
+
+// checkSession rejects tokens without a live session of their user and records
+// activity.
+func (s *authService) checkSession(ctx context.Context, sid string, userID uint) error {
+	var id uint
+	if _, err := fmt.Sscanf(sid, "%d", &id); err != nil {
+		return ErrSessionRevoked
+	}
+	sess, err := s.sessions.GetByID(ctx, id)
+	if err != nil {
+		return err
+	}
+	if sess == nil || sess.UserID != userID || sess.RevokedAt != nil {
+		return ErrSessionRevoked
+	}
+	if now := time.Now(); now.Sub(sess.LastSeenAt) > sessionTouchInterval {
+		if err := s.sessions.TouchLastSeen(ctx, sess.ID, now); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *authService) sign(u *models.User, typ string, ttl time.Duration) (string, error) {
+	return s.jwt.issue(Claims{
+		RegisteredClaims: jwt.RegisteredClaims{Subject: fmt.Sprint(u.ID)},
+		TokenType:        typ,
+		Role:             u.Role,
+	}, ttl)
+}
+
+func (s *authService) parse(tokenStr, typ string) (*Claims, error) {
+	return s.jwt.parse(tokenStr, typ)
 }
 
-func (s *authService) ParseToken(tokenStr string) (*jwt.RegisteredClaims, error) {
-	token, err := jwt.ParseWithClaims(tokenStr, &jwt.RegisteredClaims{}, func(t *jwt.Token) (interface{}, error) {
-		return []byte(s.jwtSecret), nil
-	})
+// issue fills in the issuer, audience and lifetime and signs the claims. Other services
+// use it for their own short-lived tokens so that every token shares the same keys,
+// issuer and audience.
+func (c JWTConfig) issue(claims Claims, ttl time.Duration) (string, error) {
+	now := time.Now()
+	claims.Issuer = c.Issuer
+	claims.Audience = jwt.ClaimStrings{c.Audience}
+	claims.ExpiresAt = jwt.NewNumericDate(now.Add(ttl))
+	claims.IssuedAt = jwt.NewNumericDate(now)
+	return c.Keys.sign(claims)
+}
+
+func (c JWTConfig) parse(tokenStr, typ string) (*Claims, error) {
+	token, err := jwt.ParseWithClaims(tokenStr, &Claims{}, c.Keys.keyFunc,
+		jwt.WithIssuer(c.Issuer),
+		jwt.WithAudience(c.Audience),
+		jwt.WithExpirationRequired(),
+	)
 	if err != nil {
 		return nil, err
 	}
-	if claims, ok := token.Claims.(*jwt.RegisteredClaims); ok && token.Valid {
+	if claims, ok := token.Claims.(*Claims); ok && token.Valid && claims.TokenType == typ {
 		return claims, nil
 	}
 	return nil, errors.New("invalid token")
 }
+
+func truncate(s string, n int) string {
+	if len(s) > n {
+		return s[:n]
+	}
+	return s
+}
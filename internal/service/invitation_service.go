@@ -0,0 +1,309 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"gorm.io/gorm"
+
+	"github.com/ahmadjafari86/go-todo-list/internal/mail"
+	"github.com/ahmadjafari86/go-todo-list/internal/models"
+	"github.com/ahmadjafari86/go-todo-list/internal/repository"
+)
+
+var (
+	ErrInvitationInvalid  = errors.New("invitation is invalid, expired or already used")
+	ErrInvitationNotFound = errors.New("invitation not found")
+	ErrInvitationMismatch = errors.New("invitation was sent to a different email address")
+)
+
+// InvitationConfig configures invitation links.
+type InvitationConfig struct {
+	JWT JWTConfig
+	TTL time.Duration
+	// AcceptURL is the page that receives the token, e.g. https://app.example.com/invitations/accept.
+	AcceptURL string
+}
+
+// InviteRequest targets exactly one of WorkspaceID or ListID.
+type InviteRequest struct {
+	Email       string
+	Role        string
+	WorkspaceID uint
+	ListID      uint
+}
+
+type InvitationService interface {
+	Invite(ctx context.Context, inviterID uint, req InviteRequest) (*models.Invitation, error)
+	ListPending(ctx context.Context, inviterID uint) ([]models.Invitation, error)
+	Revoke(ctx context.Context, id, inviterID uint) error
+	// Accept adds an existing account to the invitation's workspace or list. The
+	// account's email must match the invited address, and the inviter must still
+	// be allowed to grant the role. The invitation is used up and access granted
+	// in one transaction.
+	Accept(ctx context.Context, token string, userID uint) (*models.Invitation, error)
+	// AcceptAndRegister creates an account for the invited address and accepts,
+	// in one transaction.
+	AcceptAndRegister(ctx context.Context, token, password string) (*models.User, error)
+	Decline(ctx context.Context, token string) error
+}
+
+type invitationService struct {
+	invitations repository.InvitationRepository
+	workspaces  repository.WorkspaceRepository
+	lists       repository.ListRepository
+	users       repository.UserRepository
+	auth        AuthService
+	mailer      mail.Mailer
+	tx          repository.TxManager
+	cfg         InvitationConfig
+}
+
+func NewInvitationService(invitations repository.InvitationRepository, workspaces repository.WorkspaceRepository, lists repository.ListRepository,
+	users repository.UserRepository, auth AuthService, mailer mail.Mailer, tx repository.TxManager, cfg InvitationConfig) InvitationService {
+	return &invitationService{invitations: invitations, workspaces: workspaces, lists: lists, users: users, auth: auth, mailer: mailer, tx: tx, cfg: cfg}
+}
+
+func (s *invitationService) Invite(ctx context.Context, inviterID uint, req InviteRequest) (*models.Invitation, error) {
+	if (req.WorkspaceID == 0) == (req.ListID == 0) {
+		return nil, errors.New("exactly one of workspace_id or list_id is required")
+	}
+	inviter, err := s.users.GetByID(ctx, inviterID)
+	if err != nil {
+		return nil, err
+	}
+	if inviter == nil {
+		return nil, ErrUserNotFound
+	}
+	target, err := s.authorizeInvite(ctx, inviterID, req)
+	if err != nil {
+		return nil, err
+	}
+
+	inv := &models.Invitation{
+		InviterID:   inviterID,
+		Email:       strings.TrimSpace(req.Email),
+		WorkspaceID: req.WorkspaceID,
+		ListID:      req.ListID,
+		Role:        req.Role,
+		ExpiresAt:   time.Now().Add(s.cfg.TTL),
+	}
+	if err := s.invitations.Create(ctx, inv); err != nil {
+		return nil, err
+	}
+	token, err := s.cfg.JWT.issue(Claims{
+		RegisteredClaims: jwt.RegisteredClaims{Subject: fmt.Sprint(inv.ID)},
+		TokenType:        tokenTypeInvitation,
+	}, s.cfg.TTL)
+	if err != nil {
+		return nil, err
+	}
+	link := s.cfg.AcceptURL + "?token=" + url.QueryEscape(token)
+	err = s.mailer.Send(mail.Message{
+		To:      inv.Email,
+		Subject: fmt.Sprintf("%s invited you to %s", inviter.Email, target),
+		Body: fmt.Sprintf("%s invited you to %s as %s.\n\nAccept the invitation: %s\n\nThe link expires on %s.\n",
+			inviter.Email, target, inv.Role, link, inv.ExpiresAt.UTC().Format(time.RFC1123)),
+	})
+	if err != nil {
+		// the invitation nobody received must not stay pending
+		if derr := s.invitations.Delete(ctx, inv.ID, inviterID); derr != nil {
+			return nil, errors.Join(fmt.Errorf("sending invitation: %w", err), fmt.Errorf("removing unsent invitation %d: %w", inv.ID, derr))
+		}
+		return nil, fmt.Errorf("sending invitation: %w", err)
+	}
+	return inv, nil
+}
+
+// authorizeInvite checks that the inviter may grant the requested role and returns a
+// description of the target for the email.
+func (s *invitationService) authorizeInvite(ctx context.Context, inviterID uint, req InviteRequest) (string, error) {
+	if req.WorkspaceID != 0 {
+		if err := validateMemberRole(req.Role); err != nil {
+			return "", err
+		}
+		m, err := s.workspaces.GetMembership(ctx, req.WorkspaceID, inviterID)
+		if err != nil {
+			return "", err
+		}
+		if m == nil {
+			return "", ErrWorkspaceNotFound
+		}
+		if !models.CanManageMembers(m.Role) {
+			return "", ErrForbidden
+		}
+		ws, err := s.workspaces.GetByID(ctx, req.WorkspaceID)
+		if err != nil {
+			return "", err
+		}
+		if ws.Personal {
+			return "", errors.New("personal workspaces cannot be shared")
+		}
+		return fmt.Sprintf("the workspace %q", ws.Name), nil
+	}
+
+	if err := validateSharePermission(req.Role); err != nil {
+		return "", err
+	}
+	list, err := s.lists.GetByID(ctx, req.ListID)
+	if err != nil {
+		return "", err
+	}
+	if list == nil {
+		return "", ErrListNotFound
+	}
+	a, err := resolveListAccess(ctx, s.workspaces, s.lists, list, inviterID)
+	if err != nil {
+		return "", err
+	}
+	if !a.read {
+		return "", ErrListNotFound
+	}
+	if !a.share {
+		return "", ErrForbidden
+	}
+	return fmt.Sprintf("the list %q", list.Name), nil
+}
+
+func (s *invitationService) ListPending(ctx context.Context, inviterID uint) ([]models.Invitation, error) {
+	return s.invitations.ListPending(ctx, inviterID, time.Now())
+}
+
+func (s *invitationService) Revoke(ctx context.Context, id, inviterID uint) error {
+	err := s.invitations.Delete(ctx, id, inviterID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return ErrInvitationNotFound
+	}
+	return err
+}
+
+func (s *invitationService) Accept(ctx context.Context, token string, userID uint) (*models.Invitation, error) {
+	var inv *models.Invitation
+	err := s.tx.WithinTx(ctx, repository.TxOptions{}, func(ctx context.Context) error {
+		var err error
+		if inv, err = s.pending(ctx, token); err != nil {
+			return err
+		}
+		u, err := s.users.GetByID(ctx, userID)
+		if err != nil {
+			return err
+		}
+		if u == nil {
+			return ErrUserNotFound
+		}
+		if !strings.EqualFold(u.Email, inv.Email) {
+			return ErrInvitationMismatch
+		}
+		if err := s.stillAuthorized(ctx, inv); err != nil {
+			return err
+		}
+		if err := s.resolve(ctx, inv, true); err != nil {
+			return err
+		}
+		return s.grant(ctx, inv, userID)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return inv, nil
+}
+
+func (s *invitationService) AcceptAndRegister(ctx context.Context, token, password string) (*models.User, error) {
+	var u *models.User
+	err := s.tx.WithinTx(ctx, repository.TxOptions{}, func(ctx context.Context) error {
+		inv, err := s.pending(ctx, token)
+		if err != nil {
+			return err
+		}
+		if err := s.stillAuthorized(ctx, inv); err != nil {
+			return err
+		}
+		if u, err = s.auth.Register(ctx, inv.Email, password); err != nil {
+			return err
+		}
+		if err := s.resolve(ctx, inv, true); err != nil {
+			return err
+		}
+		return s.grant(ctx, inv, u.ID)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return u, nil
+}
+
+func (s *invitationService) Decline(ctx context.Context, token string) error {
+	inv, err := s.pending(ctx, token)
+	if err != nil {
+		return err
+	}
+	return s.resolve(ctx, inv, false)
+}
+
+// pending verifies the token's signature and expiry and loads its invitation.
+func (s *invitationService) pending(ctx context.Context, token string) (*models.Invitation, error) {
+	claims, err := s.cfg.JWT.parse(token, tokenTypeInvitation)
+	if err != nil {
+		return nil, ErrInvitationInvalid
+	}
+	var id uint
+	if _, err := fmt.Sscanf(claims.Subject, "%d", &id); err != nil {
+		return nil, ErrInvitationInvalid
+	}
+	inv, err := s.invitations.GetByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if inv == nil || !inv.Pending(time.Now()) {
+		return nil, ErrInvitationInvalid
+	}
+	return inv, nil
+}
+
+// stillAuthorized checks that the inviter may still grant the invited role: an
+// invitation from someone since demoted or removed no longer lets anyone in.
+func (s *invitationService) stillAuthorized(ctx context.Context, inv *models.Invitation) error {
+	_, err := s.authorizeInvite(ctx, inv.InviterID, InviteRequest{Role: inv.Role, WorkspaceID: inv.WorkspaceID, ListID: inv.ListID})
+	if errors.Is(err, ErrForbidden) || errors.Is(err, ErrWorkspaceNotFound) || errors.Is(err, ErrListNotFound) {
+		return ErrInvitationInvalid
+	}
+	return err
+}
+
+func (s *invitationService) resolve(ctx context.Context, inv *models.Invitation, accepted bool) error {
+	now := time.Now()
+	err := s.invitations.Resolve(ctx, inv.ID, accepted, now)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return ErrInvitationInvalid
+	}
+	if err != nil {
+		return err
+	}
+	if accepted {
+		inv.AcceptedAt = &now
+	} else {
+		inv.DeclinedAt = &now
+	}
+	return nil
+}
+
+// grant gives userID the invited role. Users who already have access keep it unchanged.
+func (s *invitationService) grant(ctx context.Context, inv *models.Invitation, userID uint) error {
+	if inv.WorkspaceID != 0 {
+		m, err := s.workspaces.GetMembership(ctx, inv.WorkspaceID, userID)
+		if err != nil || m != nil {
+			return err
+		}
+		return s.workspaces.AddMember(ctx, &models.Membership{WorkspaceID: inv.WorkspaceID, UserID: userID, Role: inv.Role})
+	}
+	share, err := s.lists.GetShare(ctx, inv.ListID, userID)
+	if err != nil || share != nil {
+		return err
+	}
+	return s.lists.AddShare(ctx, &models.ListShare{ListID: inv.ListID, UserID: userID, Permission: inv.Role})
+}
@@ -0,0 +1,184 @@
+package service
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// SigningKey is one entry of a KeySet. Keys loaded from a public-key PEM can only verify.
+type SigningKey struct {
+	ID     string
+	Method jwt.SigningMethod
+	// private is a crypto.Signer for RSA/Ed25519 or a []byte secret for HS256.
+	private interface{}
+	public  crypto.PublicKey
+}
+
+func (k *SigningKey) CanSign() bool {
+	return k.private != nil
+}
+
+// KeySet holds every key tokens may be verified with and the one new tokens are signed with.
+// Rotating means adding the new key, publishing it, then switching the active key ID while
+// the old key stays loaded until the tokens it signed have expired.
+type KeySet struct {
+	active *SigningKey
+	keys   map[string]*SigningKey
+	order  []string
+}
+
+// LoadKeySet reads RS256 or EdDSA keys from PEM files. The key ID of each file is its base
+// name without extension. activeKID defaults to the first file.
+func LoadKeySet(paths []string, activeKID string) (*KeySet, error) {
+	if len(paths) == 0 {
+		return nil, errors.New("no signing keys configured")
+	}
+	ks := &KeySet{keys: make(map[string]*SigningKey)}
+	for _, p := range paths {
+		key, err := loadPEMKey(p)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", p, err)
+		}
+		if _, dup := ks.keys[key.ID]; dup {
+			return nil, fmt.Errorf("duplicate key id %q", key.ID)
+		}
+		ks.keys[key.ID] = key
+		ks.order = append(ks.order, key.ID)
+	}
+	if activeKID == "" {
+		activeKID = ks.order[0]
+	}
+	active, ok := ks.keys[activeKID]
+	if !ok {
+		return nil, fmt.Errorf("active key %q not found", activeKID)
+	}
+	if !active.CanSign() {
+		return nil, fmt.Errorf("active key %q has no private key", activeKID)
+	}
+	ks.active = active
+	return ks, nil
+}
+
+// NewHMACKeySet returns a single shared-secret HS256 key. Such keys are never published.
+func NewHMACKeySet(secret string) (*KeySet, error) {
+	if secret == "" {
+		return nil, errors.New("JWT secret is empty")
+	}
+	key := &SigningKey{ID: "hs256", Method: jwt.SigningMethodHS256, private: []byte(secret)}
+	return &KeySet{active: key, keys: map[string]*SigningKey{key.ID: key}, order: []string{key.ID}}, nil
+}
+
+func loadPEMKey(path string) (*SigningKey, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(raw)
+	if block == nil {
+		return nil, errors.New("no PEM block found")
+	}
+	kid := strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+
+	var parsed interface{}
+	switch block.Type {
+	case "PRIVATE KEY":
+		parsed, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	case "RSA PRIVATE KEY":
+		parsed, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "PUBLIC KEY":
+		parsed, err = x509.ParsePKIXPublicKey(block.Bytes)
+	default:
+		return nil, fmt.Errorf("unsupported PEM block %q", block.Type)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	switch k := parsed.(type) {
+	case *rsa.PrivateKey:
+		return &SigningKey{ID: kid, Method: jwt.SigningMethodRS256, private: k, public: &k.PublicKey}, nil
+	case *rsa.PublicKey:
+		return &SigningKey{ID: kid, Method: jwt.SigningMethodRS256, public: k}, nil
+	case ed25519.PrivateKey:
+		return &SigningKey{ID: kid, Method: jwt.SigningMethodEdDSA, private: k, public: k.Public()}, nil
+	case ed25519.PublicKey:
+		return &SigningKey{ID: kid, Method: jwt.SigningMethodEdDSA, public: k}, nil
+	default:
+		return nil, fmt.Errorf("unsupported key type %T", parsed)
+	}
+}
+
+// sign signs claims with the active key and sets the kid header.
+func (ks *KeySet) sign(claims jwt.Claims) (string, error) {
+	token := jwt.NewWithClaims(ks.active.Method, claims)
+	token.Header["kid"] = ks.active.ID
+	return token.SignedString(ks.active.private)
+}
+
+// keyFunc resolves the verification key from the kid header and refuses any algorithm
+// other than the one the key was loaded for.
+func (ks *KeySet) keyFunc(t *jwt.Token) (interface{}, error) {
+	kid, _ := t.Header["kid"].(string)
+	key, ok := ks.keys[kid]
+	if !ok {
+		return nil, fmt.Errorf("unknown key id %q", kid)
+	}
+	if t.Method.Alg() != key.Method.Alg() {
+		return nil, fmt.Errorf("unexpected signing method %s", t.Method.Alg())
+	}
+	if key.public == nil {
+		return key.private, nil
+	}
+	return key.public, nil
+}
+
+// JWK is a public key in RFC 7517 form.
+type JWK struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+}
+
+type JWKS struct {
+	Keys []JWK `json:"keys"`
+}
+
+// JWKS lists the public half of every asymmetric key. Shared secrets are never included.
+func (ks *KeySet) JWKS() JWKS {
+	set := JWKS{Keys: []JWK{}}
+	b64 := base64.RawURLEncoding
+	for _, kid := range ks.order {
+		key := ks.keys[kid]
+		switch pub := key.public.(type) {
+		case *rsa.PublicKey:
+			set.Keys = append(set.Keys, JWK{
+				Kty: "RSA", Kid: kid, Use: "sig", Alg: key.Method.Alg(),
+				N: b64.EncodeToString(pub.N.Bytes()),
+				E: b64.EncodeToString(big.NewInt(int64(pub.E)).Bytes()),
+			})
+		case ed25519.PublicKey:
+			set.Keys = append(set.Keys, JWK{
+				Kty: "OKP", Kid: kid, Use: "sig", Alg: key.Method.Alg(),
+				Crv: "Ed25519", X: b64.EncodeToString(pub),
+			})
+		}
+	}
+	return set
+}
@@ -0,0 +1,240 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	"github.com/ahmadjafari86/go-todo-list/internal/models"
+	"github.com/ahmadjafari86/go-todo-list/internal/repository"
+)
+
+var (
+	ErrListNotFound  = errors.New("list not found")
+	ErrShareNotFound = errors.New("share not found")
+)
+
+type ListService interface {
+	CreateList(ctx context.Context, name string, workspaceID, userID uint) (*models.TodoList, error)
+	// ListLists returns the lists of the user's workspaces.
+	ListLists(ctx context.Context, userID uint) ([]models.TodoList, error)
+	// SharedWithMe returns the lists other users shared with userID.
+	SharedWithMe(ctx context.Context, userID uint) ([]models.SharedList, error)
+	DeleteList(ctx context.Context, id, userID uint) error
+
+	// ListShares is for users who may change the list's todos; viewers do not
+	// get to see who else it is shared with.
+	ListShares(ctx context.Context, listID, userID uint) ([]models.ListShare, error)
+	Grant(ctx context.Context, listID, actorID, userID uint, permission string) (*models.ListShare, error)
+	ChangeShare(ctx context.Context, listID, actorID, userID uint, permission string) error
+	// Revoke removes userID's share. Users may always remove a list shared with them.
+	Revoke(ctx context.Context, listID, actorID, userID uint) error
+}
+
+type listService struct {
+	lists      repository.ListRepository
+	workspaces repository.WorkspaceRepository
+	users      repository.UserRepository
+}
+
+func NewListService(lists repository.ListRepository, workspaces repository.WorkspaceRepository, users repository.UserRepository) ListService {
+	return &listService{lists: lists, workspaces: workspaces, users: users}
+}
+
+// listAccess is what a user may do with a list, combining their workspace role with
+// any share they were granted.
+type listAccess struct {
+	read   bool
+	write  bool
+	share  bool
+	delete bool
+}
+
+func resolveListAccess(ctx context.Context, workspaces repository.WorkspaceRepository, lists repository.ListRepository, list *models.TodoList, userID uint) (listAccess, error) {
+	var a listAccess
+	m, err := workspaces.GetMembership(ctx, list.WorkspaceID, userID)
+	if err != nil {
+		return a, err
+	}
+	if m != nil {
+		a.read = true
+		a.write = models.CanWriteTodos(m.Role)
+		a.delete = models.CanManageMembers(m.Role) || (a.write && list.OwnerID == userID)
+		a.share = a.delete
+	}
+	s, err := lists.GetShare(ctx, list.ID, userID)
+	if err != nil {
+		return a, err
+	}
+	if s != nil {
+		a.read = true
+		a.write = a.write || models.CanWriteShared(s.Permission)
+		a.share = a.share || s.Permission == models.SharePermissionAdmin
+	}
+	return a, nil
+}
+
+func (s *listService) CreateList(ctx context.Context, name string, workspaceID, userID uint) (*models.TodoList, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return nil, errors.New("name is required")
+	}
+	if workspaceID == 0 {
+		ws, err := s.workspaces.EnsurePersonal(ctx, userID)
+		if err != nil {
+			return nil, err
+		}
+		workspaceID = ws.ID
+	} else {
+		m, err := s.workspaces.GetMembership(ctx, workspaceID, userID)
+		if err != nil {
+			return nil, err
+		}
+		if m == nil {
+			return nil, ErrWorkspaceNotFound
+		}
+		if !models.CanWriteTodos(m.Role) {
+			return nil, ErrForbidden
+		}
+	}
+	list := &models.TodoList{Name: name, WorkspaceID: workspaceID, OwnerID: userID}
+	if err := s.lists.Create(ctx, list); err != nil {
+		return nil, err
+	}
+	return list, nil
+}
+
+func (s *listService) ListLists(ctx context.Context, userID uint) ([]models.TodoList, error) {
+	return s.lists.ListForUser(ctx, userID)
+}
+
+func (s *listService) SharedWithMe(ctx context.Context, userID uint) ([]models.SharedList, error) {
+	return s.lists.ListSharedWith(ctx, userID)
+}
+
+func (s *listService) DeleteList(ctx context.Context, id, userID uint) error {
+	_, a, err := s.access(ctx, id, userID)
+	if err != nil {
+		return err
+	}
+	if !a.delete {
+		return ErrForbidden
+	}
+	return s.lists.Delete(ctx, id)
+}
+
+func (s *listService) ListShares(ctx context.Context, listID, userID uint) ([]models.ListShare, error) {
+	_, a, err := s.access(ctx, listID, userID)
+	if err != nil {
+		return nil, err
+	}
+	if !a.write {
+		return nil, ErrForbidden
+	}
+	return s.lists.ListShares(ctx, listID)
+}
+
+func (s *listService) Grant(ctx context.Context, listID, actorID, userID uint, permission string) (*models.ListShare, error) {
+	if err := validateSharePermission(permission); err != nil {
+		return nil, err
+	}
+	_, a, err := s.access(ctx, listID, actorID)
+	if err != nil {
+		return nil, err
+	}
+	if !a.share {
+		return nil, ErrForbidden
+	}
+	if actorID == userID {
+		return nil, errors.New("cannot share a list with yourself")
+	}
+	u, err := s.users.GetByID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if u == nil {
+		return nil, ErrUserNotFound
+	}
+	existing, err := s.lists.GetShare(ctx, listID, userID)
+	if err != nil {
+		return nil, err
+	}
+	if existing != nil {
+		return nil, errors.New("list is already shared with this user")
+	}
+	share := &models.ListShare{ListID: listID, UserID: userID, Permission: permission}
+	if err := s.lists.AddShare(ctx, share); err != nil {
+		return nil, err
+	}
+	return share, nil
+}
+
+func (s *listService) ChangeShare(ctx context.Context, listID, actorID, userID uint, permission string) error {
+	if err := validateSharePermission(permission); err != nil {
+		return err
+	}
+	_, a, err := s.access(ctx, listID, actorID)
+	if err != nil {
+		return err
+	}
+	if !a.share {
+		return ErrForbidden
+	}
+	if err := s.requireShare(ctx, listID, userID); err != nil {
+		return err
+	}
+	return s.lists.UpdateShare(ctx, listID, userID, permission)
+}
+
+func (s *listService) Revoke(ctx context.Context, listID, actorID, userID uint) error {
+	_, a, err := s.access(ctx, listID, actorID)
+	if err != nil {
+		return err
+	}
+	if actorID != userID && !a.share {
+		return ErrForbidden
+	}
+	if err := s.requireShare(ctx, listID, userID); err != nil {
+		return err
+	}
+	return s.lists.RemoveShare(ctx, listID, userID)
+}
+
+// access loads a list and the caller's access to it. Users who cannot read the list
+// get ErrListNotFound so that list IDs are not disclosed.
+func (s *listService) access(ctx context.Context, id, userID uint) (*models.TodoList, listAccess, error) {
+	list, err := s.lists.GetByID(ctx, id)
+	if err != nil {
+		return nil, listAccess{}, err
+	}
+	if list == nil {
+		return nil, listAccess{}, ErrListNotFound
+	}
+	a, err := resolveListAccess(ctx, s.workspaces, s.lists, list, userID)
+	if err != nil {
+		return nil, a, err
+	}
+	if !a.read {
+		return nil, a, ErrListNotFound
+	}
+	return list, a, nil
+}
+
+func (s *listService) requireShare(ctx context.Context, listID, userID uint) error {
+	share, err := s.lists.GetShare(ctx, listID, userID)
+	if err != nil {
+		return err
+	}
+	if share == nil {
+		return ErrShareNotFound
+	}
+	return nil
+}
+
+func validateSharePermission(permission string) error {
+	switch permission {
+	case models.SharePermissionView, models.SharePermissionEdit, models.SharePermissionAdmin:
+		return nil
+	}
+	return errors.New("unknown permission")
+}
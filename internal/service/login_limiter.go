@@ -0,0 +1,111 @@
+package service
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/ahmadjafari86/go-todo-list/internal/repository"
+)
+
+// LimiterConfig controls failed-login lockouts. Once a key reaches its threshold it is
+// locked for BaseLockout, doubling with every further failure up to MaxLockout.
+// Counters that have not seen a failure for ResetAfter start again from zero.
+type LimiterConfig struct {
+	MaxAccountFailures int
+	MaxIPFailures      int
+	BaseLockout        time.Duration
+	MaxLockout         time.Duration
+	ResetAfter         time.Duration
+}
+
+type LoginLimiter interface {
+	// Check returns how long the caller has to wait before trying again, or zero.
+	// An empty account only checks the IP.
+	Check(ctx context.Context, account, ip string) (time.Duration, error)
+	// Fail records a failed attempt and returns the resulting lockout, if any.
+	Fail(ctx context.Context, account, ip string) (time.Duration, error)
+	// Succeed clears the account counter.
+	Succeed(ctx context.Context, account string) error
+}
+
+type loginLimiter struct {
+	store repository.AttemptStore
+	cfg   LimiterConfig
+}
+
+func NewLoginLimiter(store repository.AttemptStore, cfg LimiterConfig) LoginLimiter {
+	return &loginLimiter{store: store, cfg: cfg}
+}
+
+func accountKey(account string) string {
+	return "account:" + strings.ToLower(strings.TrimSpace(account))
+}
+
+func ipKey(ip string) string {
+	return "ip:" + ip
+}
+
+func (l *loginLimiter) Check(ctx context.Context, account, ip string) (time.Duration, error) {
+	wait, err := l.remaining(ctx, ipKey(ip))
+	if err != nil || account == "" {
+		return wait, err
+	}
+	acctWait, err := l.remaining(ctx, accountKey(account))
+	if err != nil {
+		return 0, err
+	}
+	if acctWait > wait {
+		wait = acctWait
+	}
+	return wait, nil
+}
+
+func (l *loginLimiter) Fail(ctx context.Context, account, ip string) (time.Duration, error) {
+	wait, err := l.fail(ctx, ipKey(ip), l.cfg.MaxIPFailures)
+	if err != nil || account == "" {
+		return wait, err
+	}
+	acctWait, err := l.fail(ctx, accountKey(account), l.cfg.MaxAccountFailures)
+	if err != nil {
+		return 0, err
+	}
+	if acctWait > wait {
+		wait = acctWait
+	}
+	return wait, nil
+}
+
+func (l *loginLimiter) Succeed(ctx context.Context, account string) error {
+	return l.store.Reset(ctx, accountKey(account))
+}
+
+func (l *loginLimiter) remaining(ctx context.Context, key string) (time.Duration, error) {
+	a, err := l.store.Get(ctx, key)
+	if err != nil || a == nil || a.LockedUntil == nil {
+		return 0, err
+	}
+	if wait := time.Until(*a.LockedUntil); wait > 0 {
+		return wait, nil
+	}
+	return 0, nil
+}
+
+func (l *loginLimiter) fail(ctx context.Context, key string, threshold int) (time.Duration, error) {
+	now := time.Now()
+	failures, err := l.store.Increment(ctx, key, now, now.Add(-l.cfg.ResetAfter))
+	if err != nil {
+		return 0, err
+	}
+	if threshold <= 0 || failures < threshold {
+		return 0, nil
+	}
+	lockout := l.cfg.BaseLockout
+	for i := threshold; i < failures && lockout < l.cfg.MaxLockout; i++ {
+		lockout *= 2
+	}
+	if lockout > l.cfg.MaxLockout {
+		lockout = l.cfg.MaxLockout
+	}
+	return lockout, l.store.Lock(ctx, key, now.Add(lockout))
+}
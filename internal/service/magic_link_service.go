@@ -0,0 +1,159 @@
+package service
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+
+	"github.com/ahmadjafari86/go-todo-list/internal/mail"
+	"github.com/ahmadjafari86/go-todo-list/internal/models"
+	"github.com/ahmadjafari86/go-todo-list/internal/repository"
+)
+
+var ErrMagicLinkInvalid = errors.New("login link is invalid, expired or already used")
+
+// MagicLinkConfig configures passwordless login. At most MaxPerWindow links are sent
+// to an address per Window.
+type MagicLinkConfig struct {
+	TTL          time.Duration
+	MaxPerWindow int
+	Window       time.Duration
+	// CallbackURL is the callback endpoint included in the email.
+	CallbackURL string
+}
+
+// MagicLinkRequest is returned to the browser that asked for a link. The nonce must
+// be presented together with the emailed token, so links only work in that browser.
+type MagicLinkRequest struct {
+	Nonce string
+	// RetryAfter is set when the address has been sent too many links recently.
+	RetryAfter time.Duration
+}
+
+type MagicLinkService interface {
+	// Request emails a login link to the address. To avoid disclosing which addresses
+	// have accounts it behaves the same whether or not the user exists.
+	Request(ctx context.Context, email string) (*MagicLinkRequest, error)
+	Complete(ctx context.Context, token, nonce string, client ClientInfo) (*LoginResult, error)
+}
+
+type magicLinkService struct {
+	links    repository.MagicLinkRepository
+	users    repository.UserRepository
+	attempts repository.AttemptStore
+	auth     AuthService
+	mailer   mail.Mailer
+	cfg      MagicLinkConfig
+}
+
+func NewMagicLinkService(links repository.MagicLinkRepository, users repository.UserRepository, attempts repository.AttemptStore,
+	auth AuthService, mailer mail.Mailer, cfg MagicLinkConfig) MagicLinkService {
+	return &magicLinkService{links: links, users: users, attempts: attempts, auth: auth, mailer: mailer, cfg: cfg}
+}
+
+func (s *magicLinkService) Request(ctx context.Context, email string) (*MagicLinkRequest, error) {
+	wait, err := throttle(ctx, s.attempts, magicLinkKey(email), s.cfg.MaxPerWindow, s.cfg.Window)
+	if err != nil {
+		return nil, err
+	}
+	if wait > 0 {
+		return &MagicLinkRequest{RetryAfter: wait}, nil
+	}
+	nonce, err := randomToken(24)
+	if err != nil {
+		return nil, err
+	}
+	req := &MagicLinkRequest{Nonce: nonce}
+
+	u, err := s.users.GetByEmail(ctx, email)
+	if err != nil {
+		return nil, err
+	}
+	if u == nil || u.Disabled() {
+		return req, nil
+	}
+	token, err := randomToken(32)
+	if err != nil {
+		return nil, err
+	}
+	link := &models.MagicLink{
+		UserID:    u.ID,
+		TokenHash: hashToken(token),
+		NonceHash: hashToken(nonce),
+		ExpiresAt: time.Now().Add(s.cfg.TTL),
+	}
+	if err := s.links.Create(ctx, link); err != nil {
+		return nil, err
+	}
+	err = s.mailer.Send(mail.Message{
+		To:      u.Email,
+		Subject: "Your login link",
+		Body: fmt.Sprintf("Log in to your account: %s\n\nThe link works once, in the browser you requested it from, and expires in %d minutes.\n"+
+			"If you did not request it you can ignore this email.\n",
+			s.cfg.CallbackURL+"?token="+url.QueryEscape(token), int(s.cfg.TTL.Minutes())),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("sending login link: %w", err)
+	}
+	return req, nil
+}
+
+func (s *magicLinkService) Complete(ctx context.Context, token, nonce string, client ClientInfo) (*LoginResult, error) {
+	if token == "" || nonce == "" {
+		return nil, ErrMagicLinkInvalid
+	}
+	link, err := s.links.GetByHash(ctx, hashToken(token))
+	if err != nil {
+		return nil, err
+	}
+	if link == nil || subtle.ConstantTimeCompare([]byte(link.NonceHash), []byte(hashToken(nonce))) != 1 {
+		return nil, ErrMagicLinkInvalid
+	}
+	if err := s.links.Consume(ctx, link.ID, time.Now()); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrMagicLinkInvalid
+		}
+		return nil, err
+	}
+	u, err := s.users.GetByID(ctx, link.UserID)
+	if err != nil {
+		return nil, err
+	}
+	if u == nil {
+		return nil, ErrMagicLinkInvalid
+	}
+	return s.auth.IssueLogin(ctx, u, client)
+}
+
+func magicLinkKey(email string) string {
+	return "magic:" + strings.ToLower(strings.TrimSpace(email))
+}
+
+// throttle counts a request under key and returns how long the caller has to wait
+// once max requests were made within window.
+func throttle(ctx context.Context, attempts repository.AttemptStore, key string, max int, window time.Duration) (time.Duration, error) {
+	now := time.Now()
+	a, err := attempts.Get(ctx, key)
+	if err != nil {
+		return 0, err
+	}
+	if a != nil && a.LockedUntil != nil && now.Before(*a.LockedUntil) {
+		return a.LockedUntil.Sub(now), nil
+	}
+	n, err := attempts.Increment(ctx, key, now, now.Add(-window))
+	if err != nil {
+		return 0, err
+	}
+	if n >= max {
+		if err := attempts.Lock(ctx, key, now.Add(window)); err != nil {
+			return 0, err
+		}
+	}
+	return 0, nil
+}
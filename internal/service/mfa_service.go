@@ -0,0 +1,167 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base32"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/ahmadjafari86/go-todo-list/internal/models"
+	"github.com/ahmadjafari86/go-todo-list/internal/repository"
+)
+
+const recoveryCodeCount = 10
+
+var ErrInvalidMFACode = errors.New("invalid verification code")
+
+var recoveryEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+type MFAService interface {
+	BeginTOTPEnrollment(ctx context.Context, userID uint) (secret string, uri string, err error)
+	ConfirmTOTPEnrollment(ctx context.Context, userID uint, code string) ([]string, error)
+	DisableTOTP(ctx context.Context, userID uint, code string) error
+	RegenerateRecoveryCodes(ctx context.Context, userID uint, code string) ([]string, error)
+	// Verify accepts either a current TOTP code or an unused recovery code.
+	Verify(ctx context.Context, user *models.User, code string) error
+}
+
+type mfaService struct {
+	users  repository.UserRepository
+	codes  repository.RecoveryCodeRepository
+	issuer string
+}
+
+func NewMFAService(users repository.UserRepository, codes repository.RecoveryCodeRepository, issuer string) MFAService {
+	return &mfaService{users: users, codes: codes, issuer: issuer}
+}
+
+func (s *mfaService) BeginTOTPEnrollment(ctx context.Context, userID uint) (string, string, error) {
+	u, err := s.loadUser(ctx, userID)
+	if err != nil {
+		return "", "", err
+	}
+	if u.TOTPEnabled {
+		return "", "", errors.New("two-factor authentication is already enabled")
+	}
+	secret, err := generateTOTPSecret()
+	if err != nil {
+		return "", "", err
+	}
+	if err := s.users.SetTOTP(ctx, u.ID, secret, false, 0); err != nil {
+		return "", "", err
+	}
+	return secret, totpURI(s.issuer, u.Email, secret), nil
+}
+
+func (s *mfaService) ConfirmTOTPEnrollment(ctx context.Context, userID uint, code string) ([]string, error) {
+	u, err := s.loadUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if u.TOTPEnabled {
+		return nil, errors.New("two-factor authentication is already enabled")
+	}
+	if u.TOTPSecret == "" {
+		return nil, errors.New("enrollment has not been started")
+	}
+	step, ok := verifyTOTP(u.TOTPSecret, code, time.Now(), u.TOTPLastStep)
+	if !ok {
+		return nil, ErrInvalidMFACode
+	}
+	if err := s.users.SetTOTP(ctx, u.ID, u.TOTPSecret, true, step); err != nil {
+		return nil, err
+	}
+	return s.issueRecoveryCodes(ctx, u.ID)
+}
+
+func (s *mfaService) DisableTOTP(ctx context.Context, userID uint, code string) error {
+	u, err := s.loadUser(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if !u.TOTPEnabled {
+		return errors.New("two-factor authentication is not enabled")
+	}
+	if err := s.Verify(ctx, u, code); err != nil {
+		return err
+	}
+	if err := s.users.SetTOTP(ctx, u.ID, "", false, 0); err != nil {
+		return err
+	}
+	return s.codes.DeleteAll(ctx, u.ID)
+}
+
+func (s *mfaService) RegenerateRecoveryCodes(ctx context.Context, userID uint, code string) ([]string, error) {
+	u, err := s.loadUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if !u.TOTPEnabled {
+		return nil, errors.New("two-factor authentication is not enabled")
+	}
+	if err := s.Verify(ctx, u, code); err != nil {
+		return nil, err
+	}
+	return s.issueRecoveryCodes(ctx, u.ID)
+}
+
+func (s *mfaService) Verify(ctx context.Context, u *models.User, code string) error {
+	code = strings.TrimSpace(code)
+	if step, ok := verifyTOTP(u.TOTPSecret, code, time.Now(), u.TOTPLastStep); ok {
+		// u may be stale: the conditional update is what stops a replay
+		advanced, err := s.users.AdvanceTOTPStep(ctx, u.ID, step)
+		if err != nil {
+			return err
+		}
+		if !advanced {
+			return ErrInvalidMFACode
+		}
+		u.TOTPLastStep = step
+		return nil
+	}
+	ok, err := s.codes.Consume(ctx, u.ID, hashToken(normalizeRecoveryCode(code)), time.Now())
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return ErrInvalidMFACode
+	}
+	return nil
+}
+
+func (s *mfaService) loadUser(ctx context.Context, userID uint) (*models.User, error) {
+	u, err := s.users.GetByID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if u == nil {
+		return nil, errors.New("user not found")
+	}
+	return u, nil
+}
+
+func (s *mfaService) issueRecoveryCodes(ctx context.Context, userID uint) ([]string, error) {
+	plain := make([]string, 0, recoveryCodeCount)
+	rows := make([]models.RecoveryCode, 0, recoveryCodeCount)
+	for i := 0; i < recoveryCodeCount; i++ {
+		buf := make([]byte, 7)
+		if _, err := rand.Read(buf); err != nil {
+			return nil, err
+		}
+		raw := strings.ToLower(recoveryEncoding.EncodeToString(buf))[:10]
+		plain = append(plain, raw[:5]+"-"+raw[5:])
+		rows = append(rows, models.RecoveryCode{UserID: userID, CodeHash: hashToken(raw)})
+	}
+	if err := s.codes.Replace(ctx, userID, rows); err != nil {
+		return nil, err
+	}
+	return plain, nil
+}
+
+func normalizeRecoveryCode(code string) string {
+	code = strings.ToLower(code)
+	code = strings.ReplaceAll(code, "-", "")
+	return strings.ReplaceAll(code, " ", "")
+}
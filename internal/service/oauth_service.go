@@ -0,0 +1,499 @@
+package service
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+
+	"github.com/ahmadjafari86/go-todo-list/internal/models"
+	"github.com/ahmadjafari86/go-todo-list/internal/repository"
+)
+
+// Prefixes of the opaque tokens issued to OAuth clients. AuthMiddleware routes
+// bearer tokens starting with OAuthAccessTokenPrefix to Authenticate.
+const (
+	OAuthAccessTokenPrefix  = "tdo_"
+	OAuthRefreshTokenPrefix = "tdr_"
+	oauthClientIDPrefix     = "tdc_"
+)
+
+const oauthCodeTTL = 10 * time.Minute
+
+// oauthScopes are the scopes third-party clients may request.
+var oauthScopes = []string{models.ScopeTodosRead, models.ScopeTodosWrite}
+
+var (
+	ErrOAuthClientNotFound = errors.New("oauth client not found")
+	// ErrOAuthRedirectURI means the redirect URI is not registered for the client.
+	// Errors about the authorization request are only reported to the client once
+	// its redirect URI is known to be genuine.
+	ErrOAuthRedirectURI      = errors.New("redirect_uri is not registered for this client")
+	ErrAuthorizedAppNotFound = errors.New("authorized app not found")
+	ErrOAuthInvalidToken     = errors.New("invalid token")
+)
+
+// OAuthError is an RFC 6749 error, returned to the client either in the
+// redirect (authorization endpoint) or in the JSON body (token endpoint).
+type OAuthError struct {
+	Code        string
+	Description string
+}
+
+func (e *OAuthError) Error() string {
+	return e.Code + ": " + e.Description
+}
+
+func oauthErr(code, format string, args ...interface{}) *OAuthError {
+	return &OAuthError{Code: code, Description: fmt.Sprintf(format, args...)}
+}
+
+// OAuthConfig configures the lifetime of issued tokens.
+type OAuthConfig struct {
+	AccessTTL  time.Duration
+	RefreshTTL time.Duration
+}
+
+// AuthorizationRequest holds the parameters of the authorization endpoint.
+type AuthorizationRequest struct {
+	ResponseType        string
+	ClientID            string
+	RedirectURI         string
+	Scope               string
+	State               string
+	CodeChallenge       string
+	CodeChallengeMethod string
+}
+
+// ConsentPrompt is what the user is asked to approve.
+type ConsentPrompt struct {
+	Client *models.OAuthClient
+	Scopes []string
+	// Authorized is set when the user already granted the client these scopes.
+	Authorized bool
+}
+
+// TokenRequest holds the parameters of the token endpoint.
+type TokenRequest struct {
+	GrantType    string
+	Code         string
+	RedirectURI  string
+	CodeVerifier string
+	RefreshToken string
+	ClientID     string
+	ClientSecret string
+}
+
+// TokenResponse is the RFC 6749 access token response.
+type TokenResponse struct {
+	AccessToken  string `json:"access_token"`
+	TokenType    string `json:"token_type"`
+	ExpiresIn    int    `json:"expires_in"`
+	RefreshToken string `json:"refresh_token"`
+	Scope        string `json:"scope"`
+}
+
+type OAuthService interface {
+	// RegisterClient returns the client secret for confidential clients. It is only shown once.
+	RegisterClient(ctx context.Context, ownerID uint, name string, redirectURIs, scopes []string, confidential bool) (string, *models.OAuthClient, error)
+	ListClients(ctx context.Context, ownerID uint) ([]models.OAuthClient, error)
+	DeleteClient(ctx context.Context, id, ownerID uint) error
+
+	// PrepareAuthorization validates an authorization request for the consent screen.
+	PrepareAuthorization(ctx context.Context, userID uint, req AuthorizationRequest) (*ConsentPrompt, error)
+	// Authorize records the user's decision and returns the URL to send the browser to,
+	// carrying either an authorization code or an access_denied error.
+	Authorize(ctx context.Context, userID uint, req AuthorizationRequest, approve bool) (string, error)
+	// Token runs the authorization_code and refresh_token grants.
+	Token(ctx context.Context, req TokenRequest) (*TokenResponse, error)
+	// Authenticate resolves an access token issued by Token.
+	Authenticate(ctx context.Context, raw string) (*models.OAuthToken, error)
+
+	ListAuthorizedApps(ctx context.Context, userID uint) ([]models.AuthorizedApp, error)
+	RevokeAuthorizedApp(ctx context.Context, id, userID uint) error
+}
+
+type oauthService struct {
+	repo  repository.OAuthRepository
+	users repository.UserRepository
+	cfg   OAuthConfig
+}
+
+func NewOAuthService(repo repository.OAuthRepository, users repository.UserRepository, cfg OAuthConfig) OAuthService {
+	return &oauthService{repo: repo, users: users, cfg: cfg}
+}
+
+func (s *oauthService) RegisterClient(ctx context.Context, ownerID uint, name string, redirectURIs, scopes []string, confidential bool) (string, *models.OAuthClient, error) {
+	if len(redirectURIs) == 0 {
+		return "", nil, errors.New("at least one redirect URI is required")
+	}
+	for _, raw := range redirectURIs {
+		u, err := url.Parse(raw)
+		if err != nil || !u.IsAbs() || u.Fragment != "" || strings.ContainsAny(raw, " \t\n") {
+			return "", nil, fmt.Errorf("invalid redirect URI %q", raw)
+		}
+		if !allowedRedirectScheme(u) {
+			return "", nil, fmt.Errorf("redirect URI %q must use https, http on localhost or a private-use scheme", raw)
+		}
+	}
+	if len(scopes) == 0 {
+		return "", nil, errors.New("at least one scope is required")
+	}
+	for _, sc := range scopes {
+		if !models.ScopeList(oauthScopes).Has(sc) {
+			return "", nil, fmt.Errorf("unknown scope %q", sc)
+		}
+	}
+	id, err := randomToken(16)
+	if err != nil {
+		return "", nil, err
+	}
+	client := &models.OAuthClient{
+		ClientID:     oauthClientIDPrefix + id,
+		OwnerID:      ownerID,
+		Name:         name,
+		RedirectURIs: models.ScopeList(redirectURIs),
+		Scopes:       models.ScopeList(scopes),
+		Confidential: confidential,
+	}
+	var secret string
+	if confidential {
+		if secret, err = randomToken(32); err != nil {
+			return "", nil, err
+		}
+		client.SecretHash = hashToken(secret)
+	}
+	if err := s.repo.CreateClient(ctx, client); err != nil {
+		return "", nil, err
+	}
+	return secret, client, nil
+}
+
+// allowedRedirectScheme accepts https, http on the loopback interface for
+// native apps, and private-use schemes in reverse domain notation such as
+// com.example.app (RFC 8252). Anything else, javascript: and data: included,
+// could run in or leave the web client when it follows redirect_to.
+func allowedRedirectScheme(u *url.URL) bool {
+	switch u.Scheme {
+	case "https":
+		return u.Host != ""
+	case "http":
+		switch u.Hostname() {
+		case "localhost", "127.0.0.1", "::1":
+			return true
+		}
+		return false
+	}
+	return strings.Contains(u.Scheme, ".")
+}
+
+func (s *oauthService) ListClients(ctx context.Context, ownerID uint) ([]models.OAuthClient, error) {
+	return s.repo.ListClients(ctx, ownerID)
+}
+
+func (s *oauthService) DeleteClient(ctx context.Context, id, ownerID uint) error {
+	err := s.repo.DeleteClient(ctx, id, ownerID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return ErrOAuthClientNotFound
+	}
+	return err
+}
+
+// validate checks an authorization request. Errors other than *OAuthError mean
+// the client or redirect URI could not be trusted.
+func (s *oauthService) validate(ctx context.Context, req AuthorizationRequest) (*models.OAuthClient, []string, error) {
+	client, err := s.repo.GetClient(ctx, req.ClientID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if client == nil {
+		return nil, nil, ErrOAuthClientNotFound
+	}
+	// clients registered before the scheme check may hold unsafe URIs
+	if !client.RedirectURIs.Has(req.RedirectURI) {
+		return nil, nil, ErrOAuthRedirectURI
+	}
+	if u, err := url.Parse(req.RedirectURI); err != nil || !allowedRedirectScheme(u) {
+		return nil, nil, ErrOAuthRedirectURI
+	}
+	if req.ResponseType != "code" {
+		return client, nil, oauthErr("unsupported_response_type", "only the code response type is supported")
+	}
+	if req.CodeChallenge == "" || req.CodeChallengeMethod != "S256" {
+		return client, nil, oauthErr("invalid_request", "PKCE with code_challenge_method S256 is required")
+	}
+	scopes := strings.Fields(req.Scope)
+	if len(scopes) == 0 {
+		scopes = client.Scopes
+	}
+	for _, sc := range scopes {
+		if !client.Scopes.Has(sc) {
+			return client, nil, oauthErr("invalid_scope", "scope %q is not available to this client", sc)
+		}
+	}
+	return client, scopes, nil
+}
+
+func (s *oauthService) PrepareAuthorization(ctx context.Context, userID uint, req AuthorizationRequest) (*ConsentPrompt, error) {
+	client, scopes, err := s.validate(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	prompt := &ConsentPrompt{Client: client, Scopes: scopes, Authorized: true}
+	apps, err := s.repo.ListAuthorizedApps(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	var granted models.ScopeList
+	for _, a := range apps {
+		if a.ClientID == client.ClientID {
+			granted = a.Scopes
+		}
+	}
+	for _, sc := range scopes {
+		if !granted.Has(sc) {
+			prompt.Authorized = false
+		}
+	}
+	return prompt, nil
+}
+
+func (s *oauthService) Authorize(ctx context.Context, userID uint, req AuthorizationRequest, approve bool) (string, error) {
+	client, scopes, err := s.validate(ctx, req)
+	var oerr *OAuthError
+	if errors.As(err, &oerr) {
+		return redirectWith(req.RedirectURI, url.Values{"error": {oerr.Code}, "error_description": {oerr.Description}}, req.State), nil
+	}
+	if err != nil {
+		return "", err
+	}
+	if !approve {
+		return redirectWith(req.RedirectURI, url.Values{"error": {"access_denied"}}, req.State), nil
+	}
+
+	auth := &models.OAuthAuthorization{UserID: userID, ClientID: client.ID, Scopes: models.ScopeList(scopes)}
+	if err := s.repo.SaveAuthorization(ctx, auth); err != nil {
+		return "", err
+	}
+	code, err := randomToken(32)
+	if err != nil {
+		return "", err
+	}
+	err = s.repo.CreateCode(ctx, &models.OAuthCode{
+		CodeHash:        hashToken(code),
+		AuthorizationID: auth.ID,
+		RedirectURI:     req.RedirectURI,
+		Scopes:          models.ScopeList(scopes),
+		CodeChallenge:   req.CodeChallenge,
+		ExpiresAt:       time.Now().Add(oauthCodeTTL),
+	})
+	if err != nil {
+		return "", err
+	}
+	return redirectWith(req.RedirectURI, url.Values{"code": {code}}, req.State), nil
+}
+
+func redirectWith(redirectURI string, params url.Values, state string) string {
+	u, _ := url.Parse(redirectURI)
+	q := u.Query()
+	for k, v := range params {
+		q[k] = v
+	}
+	if state != "" {
+		q.Set("state", state)
+	}
+	u.RawQuery = q.Encode()
+	return u.String()
+}
+
+func (s *oauthService) Token(ctx context.Context, req TokenRequest) (*TokenResponse, error) {
+	client, err := s.authenticateClient(ctx, req.ClientID, req.ClientSecret)
+	if err != nil {
+		return nil, err
+	}
+	switch req.GrantType {
+	case "authorization_code":
+		return s.exchangeCode(ctx, client, req)
+	case "refresh_token":
+		return s.refresh(ctx, client, req)
+	}
+	return nil, oauthErr("unsupported_grant_type", "grant_type must be authorization_code or refresh_token")
+}
+
+func (s *oauthService) authenticateClient(ctx context.Context, clientID, secret string) (*models.OAuthClient, error) {
+	client, err := s.repo.GetClient(ctx, clientID)
+	if err != nil {
+		return nil, err
+	}
+	if client == nil {
+		return nil, oauthErr("invalid_client", "unknown client")
+	}
+	if client.Confidential && subtle.ConstantTimeCompare([]byte(client.SecretHash), []byte(hashToken(secret))) != 1 {
+		return nil, oauthErr("invalid_client", "client authentication failed")
+	}
+	return client, nil
+}
+
+// authorizationFor loads the active authorization behind a code or token and
+// checks that it belongs to client.
+func (s *oauthService) authorizationFor(ctx context.Context, id uint, client *models.OAuthClient) (*models.OAuthAuthorization, error) {
+	auth, err := s.repo.GetAuthorization(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if auth == nil || auth.ClientID != client.ID || auth.RevokedAt != nil {
+		return nil, oauthErr("invalid_grant", "the grant has been revoked")
+	}
+	return auth, nil
+}
+
+func (s *oauthService) exchangeCode(ctx context.Context, client *models.OAuthClient, req TokenRequest) (*TokenResponse, error) {
+	code, err := s.repo.GetCodeByHash(ctx, hashToken(req.Code))
+	if err != nil {
+		return nil, err
+	}
+	if code == nil {
+		return nil, oauthErr("invalid_grant", "unknown authorization code")
+	}
+	auth, err := s.authorizationFor(ctx, code.AuthorizationID, client)
+	if err != nil {
+		return nil, err
+	}
+	if code.RedirectURI != req.RedirectURI {
+		return nil, oauthErr("invalid_grant", "redirect_uri does not match the authorization request")
+	}
+	if !validVerifier(req.CodeVerifier) {
+		return nil, oauthErr("invalid_request", "code_verifier must be 43 to 128 unreserved characters")
+	}
+	sum := sha256.Sum256([]byte(req.CodeVerifier))
+	if base64.RawURLEncoding.EncodeToString(sum[:]) != code.CodeChallenge {
+		return nil, oauthErr("invalid_grant", "code_verifier does not match the code challenge")
+	}
+	now := time.Now()
+	if err := s.repo.ConsumeCode(ctx, code.ID, now); err != nil {
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, err
+		}
+		if code.UsedAt != nil {
+			// a replayed code may have leaked; revoke what was issued for it
+			if err := s.repo.RevokeAuthorization(ctx, auth.ID, auth.UserID, now); err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+				return nil, err
+			}
+		}
+		return nil, oauthErr("invalid_grant", "authorization code is expired or already used")
+	}
+	return s.issue(ctx, auth, code.Scopes, now)
+}
+
+func validVerifier(v string) bool {
+	if len(v) < 43 || len(v) > 128 {
+		return false
+	}
+	for _, r := range v {
+		ok := r >= 'A' && r <= 'Z' || r >= 'a' && r <= 'z' || r >= '0' && r <= '9' || strings.ContainsRune("-._~", r)
+		if !ok {
+			return false
+		}
+	}
+	return true
+}
+
+func (s *oauthService) refresh(ctx context.Context, client *models.OAuthClient, req TokenRequest) (*TokenResponse, error) {
+	tok, err := s.repo.GetTokenByRefreshHash(ctx, hashToken(req.RefreshToken))
+	if err != nil {
+		return nil, err
+	}
+	if tok == nil {
+		return nil, oauthErr("invalid_grant", "unknown refresh token")
+	}
+	auth, err := s.authorizationFor(ctx, tok.AuthorizationID, client)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	if !now.Before(tok.RefreshExpiresAt) {
+		return nil, oauthErr("invalid_grant", "refresh token has expired")
+	}
+	if err := s.repo.RevokeToken(ctx, tok.ID, now); err != nil {
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, err
+		}
+		// refresh tokens rotate on every use, so reuse means one was stolen
+		if err := s.repo.RevokeAuthorization(ctx, auth.ID, auth.UserID, now); err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, err
+		}
+		return nil, oauthErr("invalid_grant", "refresh token was already used; the grant has been revoked")
+	}
+	return s.issue(ctx, auth, tok.Scopes, now)
+}
+
+func (s *oauthService) issue(ctx context.Context, auth *models.OAuthAuthorization, scopes models.ScopeList, now time.Time) (*TokenResponse, error) {
+	access, err := randomToken(32)
+	if err != nil {
+		return nil, err
+	}
+	refresh, err := randomToken(32)
+	if err != nil {
+		return nil, err
+	}
+	access, refresh = OAuthAccessTokenPrefix+access, OAuthRefreshTokenPrefix+refresh
+	err = s.repo.CreateToken(ctx, &models.OAuthToken{
+		AuthorizationID:  auth.ID,
+		UserID:           auth.UserID,
+		AccessHash:       hashToken(access),
+		RefreshHash:      hashToken(refresh),
+		Scopes:           scopes,
+		AccessExpiresAt:  now.Add(s.cfg.AccessTTL),
+		RefreshExpiresAt: now.Add(s.cfg.RefreshTTL),
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &TokenResponse{
+		AccessToken:  access,
+		TokenType:    "Bearer",
+		ExpiresIn:    int(s.cfg.AccessTTL.Seconds()),
+		RefreshToken: refresh,
+		Scope:        strings.Join(scopes, " "),
+	}, nil
+}
+
+func (s *oauthService) Authenticate(ctx context.Context, raw string) (*models.OAuthToken, error) {
+	if !strings.HasPrefix(raw, OAuthAccessTokenPrefix) {
+		return nil, ErrOAuthInvalidToken
+	}
+	tok, err := s.repo.GetTokenByAccessHash(ctx, hashToken(raw))
+	if err != nil {
+		return nil, err
+	}
+	if tok == nil || tok.RevokedAt != nil || !time.Now().Before(tok.AccessExpiresAt) {
+		return nil, ErrOAuthInvalidToken
+	}
+	u, err := s.users.GetByID(ctx, tok.UserID)
+	if err != nil {
+		return nil, err
+	}
+	if u == nil || u.Disabled() {
+		return nil, ErrAccountDisabled
+	}
+	return tok, nil
+}
+
+func (s *oauthService) ListAuthorizedApps(ctx context.Context, userID uint) ([]models.AuthorizedApp, error) {
+	return s.repo.ListAuthorizedApps(ctx, userID)
+}
+
+func (s *oauthService) RevokeAuthorizedApp(ctx context.Context, id, userID uint) error {
+	err := s.repo.RevokeAuthorization(ctx, id, userID, time.Now())
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return ErrAuthorizedAppNotFound
+	}
+	return err
+}
@@ -0,0 +1,146 @@
+package service
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/ahmadjafari86/go-todo-list/internal/models"
+	"github.com/ahmadjafari86/go-todo-list/internal/repository"
+)
+
+var ErrUnknownProvider = errors.New("unknown identity provider")
+
+// OIDCAuthRequest carries the per-login secrets the caller must keep, typically in a
+// cookie, until the provider redirects back.
+type OIDCAuthRequest struct {
+	URL      string
+	State    string
+	Nonce    string
+	Verifier string
+}
+
+type OIDCService interface {
+	Providers() []string
+	// Begin starts an authorization-code flow with PKCE.
+	Begin(ctx context.Context, provider string) (*OIDCAuthRequest, error)
+	// Complete redeems the code, then logs in the user linked to the provider account,
+	// linking or creating one by verified email on first login.
+	Complete(ctx context.Context, provider, code, verifier, nonce string, clientInfo ClientInfo) (*LoginResult, error)
+}
+
+type oidcService struct {
+	clients    map[string]*oidcClient
+	users      repository.UserRepository
+	identities repository.IdentityRepository
+	auth       AuthService
+}
+
+func NewOIDCService(providers []OIDCProvider, users repository.UserRepository, identities repository.IdentityRepository, auth AuthService) OIDCService {
+	clients := make(map[string]*oidcClient, len(providers))
+	httpClient := newHTTPClient()
+	for _, p := range providers {
+		clients[p.Name] = newOIDCClient(p, httpClient)
+	}
+	return &oidcService{clients: clients, users: users, identities: identities, auth: auth}
+}
+
+func (s *oidcService) Providers() []string {
+	names := make([]string, 0, len(s.clients))
+	for name := range s.clients {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func (s *oidcService) Begin(ctx context.Context, provider string) (*OIDCAuthRequest, error) {
+	client, ok := s.clients[provider]
+	if !ok {
+		return nil, ErrUnknownProvider
+	}
+	req := &OIDCAuthRequest{}
+	var err error
+	if req.State, err = randomToken(24); err != nil {
+		return nil, err
+	}
+	if req.Nonce, err = randomToken(24); err != nil {
+		return nil, err
+	}
+	if req.Verifier, err = randomToken(48); err != nil {
+		return nil, err
+	}
+	sum := sha256.Sum256([]byte(req.Verifier))
+	challenge := base64.RawURLEncoding.EncodeToString(sum[:])
+	if req.URL, err = client.authURL(ctx, req.State, req.Nonce, challenge); err != nil {
+		return nil, err
+	}
+	return req, nil
+}
+
+func (s *oidcService) Complete(ctx context.Context, provider, code, verifier, nonce string, clientInfo ClientInfo) (*LoginResult, error) {
+	client, ok := s.clients[provider]
+	if !ok {
+		return nil, ErrUnknownProvider
+	}
+	claims, err := client.exchange(ctx, code, verifier, nonce)
+	if err != nil {
+		return nil, err
+	}
+	u, err := s.resolveUser(ctx, provider, claims)
+	if err != nil {
+		return nil, err
+	}
+	return s.auth.IssueLogin(ctx, u, clientInfo)
+}
+
+func (s *oidcService) resolveUser(ctx context.Context, provider string, claims *oidcIDClaims) (*models.User, error) {
+	if claims.Subject == "" {
+		return nil, errors.New("id_token has no subject")
+	}
+	ident, err := s.identities.Get(ctx, provider, claims.Subject)
+	if err != nil {
+		return nil, err
+	}
+	if ident != nil {
+		u, err := s.users.GetByID(ctx, ident.UserID)
+		if err != nil {
+			return nil, err
+		}
+		if u == nil {
+			return nil, errors.New("linked user no longer exists")
+		}
+		return u, nil
+	}
+
+	// First login with this provider account: only a verified email may be trusted
+	// to link to, or create, a local user.
+	email := strings.TrimSpace(claims.Email)
+	if email == "" || !claims.EmailVerified {
+		return nil, fmt.Errorf("%s did not supply a verified email address", provider)
+	}
+	u, err := s.users.GetByEmail(ctx, email)
+	if err != nil {
+		return nil, err
+	}
+	if u == nil {
+		// no local password: the account can only log in through a provider
+		u = &models.User{Email: email, Role: models.RoleUser}
+		if err := s.users.Create(ctx, u); err != nil {
+			return nil, err
+		}
+	}
+	if err := s.identities.Create(ctx, &models.UserIdentity{
+		UserID:   u.ID,
+		Provider: provider,
+		Subject:  claims.Subject,
+		Email:    email,
+	}); err != nil {
+		return nil, err
+	}
+	return u, nil
+}
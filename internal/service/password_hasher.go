@@ -0,0 +1,235 @@
+package service
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Password hashing algorithms accepted by PasswordHashConfig.
+const (
+	HashArgon2id = "argon2id"
+	HashBcrypt   = "bcrypt"
+)
+
+var ErrUnknownHashFormat = errors.New("unknown password hash format")
+
+// PasswordHasher hashes passwords into self-describing PHC strings.
+type PasswordHasher interface {
+	Hash(password string) (string, error)
+	// Verify reports whether password matches encoded. An error means encoded
+	// could not be parsed.
+	Verify(password, encoded string) (bool, error)
+	// NeedsRehash reports whether encoded was produced by another algorithm or
+	// with weaker parameters than the hasher's current ones.
+	NeedsRehash(encoded string) bool
+}
+
+// Argon2Params are the argon2id cost parameters. Memory is in KiB.
+type Argon2Params struct {
+	Memory      uint32
+	Iterations  uint32
+	Parallelism uint8
+	SaltLength  uint32
+	KeyLength   uint32
+}
+
+// DefaultArgon2Params follow the OWASP recommendation for argon2id.
+var DefaultArgon2Params = Argon2Params{
+	Memory:      64 * 1024,
+	Iterations:  3,
+	Parallelism: 2,
+	SaltLength:  16,
+	KeyLength:   32,
+}
+
+// minArgon2Memory is the least memory, in KiB, accepted for hashing. Less
+// would make the hashes cheap to brute-force.
+const minArgon2Memory = 1024
+
+// Validate rejects parameters argon2 cannot run with, which would otherwise
+// panic on the first hash, and memory below minArgon2Memory.
+func (p Argon2Params) Validate() error {
+	switch {
+	case p.Iterations < 1:
+		return errors.New("argon2 iterations must be at least 1")
+	case p.Parallelism < 1:
+		return errors.New("argon2 parallelism must be at least 1")
+	case p.Memory < minArgon2Memory:
+		return fmt.Errorf("argon2 memory must be at least %d KiB", minArgon2Memory)
+	case p.Memory < 8*uint32(p.Parallelism):
+		return fmt.Errorf("argon2 memory must be at least 8 KiB per lane, %d KiB for parallelism %d", 8*uint32(p.Parallelism), p.Parallelism)
+	case p.SaltLength < 8 || p.KeyLength < 16:
+		return errors.New("argon2 salts must be at least 8 bytes and keys at least 16")
+	}
+	return nil
+}
+
+// Argon2idHasher produces hashes such as
+// $argon2id$v=19$m=65536,t=3,p=2$<salt>$<key> with unpadded base64 salt and key.
+type Argon2idHasher struct {
+	Params Argon2Params
+}
+
+func NewArgon2idHasher(params Argon2Params) *Argon2idHasher {
+	return &Argon2idHasher{Params: params}
+}
+
+func (h *Argon2idHasher) Hash(password string) (string, error) {
+	salt := make([]byte, h.Params.SaltLength)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+	key := argon2.IDKey([]byte(password), salt, h.Params.Iterations, h.Params.Memory, h.Params.Parallelism, h.Params.KeyLength)
+	return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s",
+		argon2.Version, h.Params.Memory, h.Params.Iterations, h.Params.Parallelism,
+		base64.RawStdEncoding.EncodeToString(salt), base64.RawStdEncoding.EncodeToString(key)), nil
+}
+
+func (h *Argon2idHasher) Verify(password, encoded string) (bool, error) {
+	p, salt, key, err := decodeArgon2id(encoded)
+	if err != nil {
+		return false, err
+	}
+	other := argon2.IDKey([]byte(password), salt, p.Iterations, p.Memory, p.Parallelism, p.KeyLength)
+	return subtle.ConstantTimeCompare(key, other) == 1, nil
+}
+
+func (h *Argon2idHasher) NeedsRehash(encoded string) bool {
+	p, _, _, err := decodeArgon2id(encoded)
+	if err != nil {
+		return true
+	}
+	return p.Memory < h.Params.Memory ||
+		p.Iterations < h.Params.Iterations ||
+		p.Parallelism < h.Params.Parallelism ||
+		p.SaltLength < h.Params.SaltLength ||
+		p.KeyLength < h.Params.KeyLength
+}
+
+func decodeArgon2id(encoded string) (Argon2Params, []byte, []byte, error) {
+	var p Argon2Params
+	// "", "argon2id", "v=19", "m=…,t=…,p=…", salt, key
+	parts := strings.Split(encoded, "$")
+	if len(parts) != 6 || parts[1] != HashArgon2id {
+		return p, nil, nil, ErrUnknownHashFormat
+	}
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return p, nil, nil, ErrUnknownHashFormat
+	}
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &p.Memory, &p.Iterations, &p.Parallelism); err != nil {
+		return p, nil, nil, ErrUnknownHashFormat
+	}
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return p, nil, nil, ErrUnknownHashFormat
+	}
+	key, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil || len(key) == 0 {
+		return p, nil, nil, ErrUnknownHashFormat
+	}
+	p.SaltLength = uint32(len(salt))
+	p.KeyLength = uint32(len(key))
+	return p, salt, key, nil
+}
+
+// BcryptHasher keeps bcrypt's own $2a$/$2b$ encoding, which the PHC format
+// specification accepts as is.
+type BcryptHasher struct {
+	Cost int
+}
+
+func NewBcryptHasher(cost int) *BcryptHasher {
+	return &BcryptHasher{Cost: cost}
+}
+
+func (h *BcryptHasher) Hash(password string) (string, error) {
+	b, err := bcrypt.GenerateFromPassword([]byte(password), h.Cost)
+	return string(b), err
+}
+
+func (h *BcryptHasher) Verify(password, encoded string) (bool, error) {
+	err := bcrypt.CompareHashAndPassword([]byte(encoded), []byte(password))
+	if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+		return false, nil
+	}
+	if err != nil {
+		return false, ErrUnknownHashFormat
+	}
+	return true, nil
+}
+
+func (h *BcryptHasher) NeedsRehash(encoded string) bool {
+	cost, err := bcrypt.Cost([]byte(encoded))
+	return err != nil || cost < h.Cost
+}
+
+// PasswordHashConfig selects the algorithm new hashes are made with.
+type PasswordHashConfig struct {
+	Algorithm  string
+	Argon2     Argon2Params
+	BcryptCost int
+}
+
+// NewPasswordHasher hashes with the configured algorithm and verifies hashes of
+// every supported algorithm, so existing users keep working after a switch.
+// Hashes made by another algorithm always need rehashing.
+func NewPasswordHasher(cfg PasswordHashConfig) (PasswordHasher, error) {
+	argon := NewArgon2idHasher(cfg.Argon2)
+	bc := NewBcryptHasher(cfg.BcryptCost)
+	switch cfg.Algorithm {
+	case HashArgon2id:
+		if err := cfg.Argon2.Validate(); err != nil {
+			return nil, err
+		}
+		return &multiHasher{current: argon, currentName: HashArgon2id, argon2id: argon, bcrypt: bc}, nil
+	case HashBcrypt:
+		if cfg.BcryptCost < bcrypt.MinCost || cfg.BcryptCost > bcrypt.MaxCost {
+			return nil, fmt.Errorf("bcrypt cost must be between %d and %d", bcrypt.MinCost, bcrypt.MaxCost)
+		}
+		return &multiHasher{current: bc, currentName: HashBcrypt, argon2id: argon, bcrypt: bc}, nil
+	}
+	return nil, fmt.Errorf("unsupported password hash algorithm %q", cfg.Algorithm)
+}
+
+type multiHasher struct {
+	current     PasswordHasher
+	currentName string
+	argon2id    *Argon2idHasher
+	bcrypt      *BcryptHasher
+}
+
+// algorithm identifies the hasher that produced encoded.
+func (h *multiHasher) algorithm(encoded string) (string, PasswordHasher) {
+	switch {
+	case strings.HasPrefix(encoded, "$argon2id$"):
+		return HashArgon2id, h.argon2id
+	case strings.HasPrefix(encoded, "$2a$"), strings.HasPrefix(encoded, "$2b$"), strings.HasPrefix(encoded, "$2y$"):
+		return HashBcrypt, h.bcrypt
+	}
+	return "", nil
+}
+
+func (h *multiHasher) Hash(password string) (string, error) {
+	return h.current.Hash(password)
+}
+
+func (h *multiHasher) Verify(password, encoded string) (bool, error) {
+	_, hasher := h.algorithm(encoded)
+	if hasher == nil {
+		return false, ErrUnknownHashFormat
+	}
+	return hasher.Verify(password, encoded)
+}
+
+func (h *multiHasher) NeedsRehash(encoded string) bool {
+	name, _ := h.algorithm(encoded)
+	return name != h.currentName || h.current.NeedsRehash(encoded)
+}
@@ -0,0 +1,135 @@
+package service
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/nbutton23/zxcvbn-go"
+)
+
+// PasswordPolicyError lists every rule a password breaks.
+type PasswordPolicyError struct {
+	Violations []string
+}
+
+func (e *PasswordPolicyError) Error() string {
+	return "password rejected: " + strings.Join(e.Violations, "; ")
+}
+
+// BreachedPasswords reports whether a password appears in a breach corpus.
+type BreachedPasswords interface {
+	Contains(password string) (bool, error)
+}
+
+// BreachCorpus is an offline copy of a breached-password corpus in the
+// Have I Been Pwned range format: one file per five-character SHA-1 prefix
+// (e.g. 5BAA6.txt) holding "SUFFIX:COUNT" lines. A lookup reads a single small
+// file, so the corpus never has to fit in memory and no network calls are made.
+type BreachCorpus struct {
+	dir string
+}
+
+func NewBreachCorpus(dir string) (*BreachCorpus, error) {
+	info, err := os.Stat(dir)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		return nil, fmt.Errorf("%s is not a directory", dir)
+	}
+	return &BreachCorpus{dir: dir}, nil
+}
+
+func (c *BreachCorpus) Contains(password string) (bool, error) {
+	sum := sha1.Sum([]byte(password))
+	digest := strings.ToUpper(hex.EncodeToString(sum[:]))
+	prefix, suffix := digest[:5], digest[5:]
+
+	f, err := os.Open(filepath.Join(c.dir, prefix+".txt"))
+	if errors.Is(err, os.ErrNotExist) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		line, _, _ := strings.Cut(strings.TrimSpace(sc.Text()), ":")
+		if strings.EqualFold(line, suffix) {
+			return true, nil
+		}
+	}
+	return false, sc.Err()
+}
+
+// PasswordPolicyConfig configures PasswordPolicy. MinScore is a zxcvbn score
+// from 0 (too guessable) to 4 (very unguessable). Breached is optional.
+type PasswordPolicyConfig struct {
+	MinLength int
+	MinScore  int
+	Breached  BreachedPasswords
+}
+
+type PasswordPolicy interface {
+	// Check returns a *PasswordPolicyError when password is not acceptable for
+	// the account with the given email.
+	Check(password, email string) error
+}
+
+type passwordPolicy struct {
+	cfg PasswordPolicyConfig
+}
+
+func NewPasswordPolicy(cfg PasswordPolicyConfig) PasswordPolicy {
+	return &passwordPolicy{cfg: cfg}
+}
+
+func (p *passwordPolicy) Check(password, email string) error {
+	var violations []string
+	if n := len([]rune(password)); n < p.cfg.MinLength {
+		violations = append(violations, fmt.Sprintf("must be at least %d characters", p.cfg.MinLength))
+	}
+
+	lower := strings.ToLower(password)
+	local, domain, _ := strings.Cut(strings.ToLower(strings.TrimSpace(email)), "@")
+	// very short local parts would match too many passwords to be useful
+	if len(local) >= 3 && strings.Contains(lower, local) {
+		violations = append(violations, "must not contain your email address")
+	}
+
+	if password != "" {
+		result := zxcvbn.PasswordStrength(password, []string{email, local, strings.Split(domain, ".")[0]})
+		for _, m := range result.MatchSequence {
+			common := (m.Pattern == "dictionary" || m.Pattern == "l33t") && m.DictionaryName != "user_inputs"
+			if common && m.I == 0 && m.J == len(password)-1 {
+				violations = append(violations, "must not be a common word")
+				break
+			}
+		}
+		if result.Score < p.cfg.MinScore {
+			violations = append(violations, "is too easy to guess; add more words or characters")
+		}
+	}
+
+	if p.cfg.Breached != nil && password != "" {
+		breached, err := p.cfg.Breached.Contains(password)
+		if err != nil {
+			return fmt.Errorf("checking breached passwords: %w", err)
+		}
+		if breached {
+			violations = append(violations, "has appeared in a data breach; choose another one")
+		}
+	}
+
+	if len(violations) > 0 {
+		return &PasswordPolicyError{Violations: violations}
+	}
+	return nil
+}
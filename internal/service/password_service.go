@@ -0,0 +1,174 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+
+	"github.com/ahmadjafari86/go-todo-list/internal/mail"
+	"github.com/ahmadjafari86/go-todo-list/internal/models"
+	"github.com/ahmadjafari86/go-todo-list/internal/repository"
+)
+
+var ErrPasswordResetInvalid = errors.New("reset link is invalid, expired or already used")
+
+// PasswordResetConfig configures password reset emails. At most MaxPerWindow
+// emails are sent to an address per Window.
+type PasswordResetConfig struct {
+	TTL          time.Duration
+	MaxPerWindow int
+	Window       time.Duration
+	// ResetURL is the web client page the emailed link points to.
+	ResetURL string
+}
+
+type PasswordService interface {
+	// RequestReset emails a reset link to the address. It behaves the same whether
+	// or not the user exists; a positive duration means the address has to wait.
+	RequestReset(ctx context.Context, email string) (time.Duration, error)
+	// ResetPassword sets a new password with an emailed token and signs the user
+	// out of every session, in one transaction.
+	ResetPassword(ctx context.Context, token, password string) error
+	// ChangePassword sets a new password after checking the current one and signs
+	// the user out of every session but sessionID, the caller's (0 for none).
+	ChangePassword(ctx context.Context, userID, sessionID uint, current, password string) error
+}
+
+type passwordService struct {
+	users    repository.UserRepository
+	resets   repository.PasswordResetRepository
+	sessions repository.SessionRepository
+	attempts repository.AttemptStore
+	hasher   PasswordHasher
+	policy   PasswordPolicy
+	mailer   mail.Mailer
+	tx       repository.TxManager
+	cfg      PasswordResetConfig
+}
+
+func NewPasswordService(users repository.UserRepository, resets repository.PasswordResetRepository, sessions repository.SessionRepository,
+	attempts repository.AttemptStore, hasher PasswordHasher, policy PasswordPolicy, mailer mail.Mailer, tx repository.TxManager,
+	cfg PasswordResetConfig) PasswordService {
+	return &passwordService{users: users, resets: resets, sessions: sessions, attempts: attempts,
+		hasher: hasher, policy: policy, mailer: mailer, tx: tx, cfg: cfg}
+}
+
+func resetKey(email string) string {
+	return "reset:" + strings.ToLower(strings.TrimSpace(email))
+}
+
+func (s *passwordService) RequestReset(ctx context.Context, email string) (time.Duration, error) {
+	wait, err := throttle(ctx, s.attempts, resetKey(email), s.cfg.MaxPerWindow, s.cfg.Window)
+	if err != nil || wait > 0 {
+		return wait, err
+	}
+	u, err := s.users.GetByEmail(ctx, email)
+	if err != nil {
+		return 0, err
+	}
+	if u == nil || u.Disabled() {
+		return 0, nil
+	}
+	token, err := randomToken(32)
+	if err != nil {
+		return 0, err
+	}
+	reset := &models.PasswordReset{
+		UserID:    u.ID,
+		TokenHash: hashToken(token),
+		ExpiresAt: time.Now().Add(s.cfg.TTL),
+	}
+	if err := s.resets.Create(ctx, reset); err != nil {
+		return 0, err
+	}
+	err = s.mailer.Send(mail.Message{
+		To:      u.Email,
+		Subject: "Reset your password",
+		Body: fmt.Sprintf("Choose a new password: %s\n\nThe link works once and expires in %d minutes.\n"+
+			"If you did not ask to reset your password you can ignore this email.\n",
+			s.cfg.ResetURL+"?token="+url.QueryEscape(token), int(s.cfg.TTL.Minutes())),
+	})
+	if err != nil {
+		return 0, fmt.Errorf("sending reset link: %w", err)
+	}
+	return 0, nil
+}
+
+func (s *passwordService) ResetPassword(ctx context.Context, token, password string) error {
+	if token == "" {
+		return ErrPasswordResetInvalid
+	}
+	reset, err := s.resets.GetByHash(ctx, hashToken(token))
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	if reset == nil || reset.UsedAt != nil || !now.Before(reset.ExpiresAt) {
+		return ErrPasswordResetInvalid
+	}
+	u, err := s.users.GetByID(ctx, reset.UserID)
+	if err != nil {
+		return err
+	}
+	if u == nil {
+		return ErrPasswordResetInvalid
+	}
+	// check the policy before consuming the token so a rejected password can be retried
+	if err := s.policy.Check(password, u.Email); err != nil {
+		return err
+	}
+	// hashed outside the transaction, which it would hold open for a while
+	hash, err := s.hasher.Hash(password)
+	if err != nil {
+		return err
+	}
+	return s.tx.WithinTx(ctx, repository.TxOptions{}, func(ctx context.Context) error {
+		if err := s.resets.Consume(ctx, reset.ID, now); err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return ErrPasswordResetInvalid
+			}
+			return err
+		}
+		if err := s.users.UpdatePasswordHash(ctx, u.ID, hash); err != nil {
+			return err
+		}
+		if err := s.resets.ConsumeAllForUser(ctx, u.ID, now); err != nil {
+			return err
+		}
+		return s.sessions.RevokeAll(ctx, u.ID, now)
+	})
+}
+
+func (s *passwordService) ChangePassword(ctx context.Context, userID, sessionID uint, current, password string) error {
+	u, err := s.users.GetByID(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if u == nil {
+		return ErrUserNotFound
+	}
+	if u.PasswordHash == "" {
+		return ErrPasswordNotSet
+	}
+	if ok, _ := s.hasher.Verify(current, u.PasswordHash); !ok {
+		return ErrInvalidCredentials
+	}
+	if err := s.policy.Check(password, u.Email); err != nil {
+		return err
+	}
+	hash, err := s.hasher.Hash(password)
+	if err != nil {
+		return err
+	}
+	return s.tx.WithinTx(ctx, repository.TxOptions{}, func(ctx context.Context) error {
+		if err := s.users.UpdatePasswordHash(ctx, u.ID, hash); err != nil {
+			return err
+		}
+		return s.sessions.RevokeOthers(ctx, u.ID, sessionID, time.Now())
+	})
+}
@@ -0,0 +1,63 @@
+package service
+
+import (
+	"context"
+	"time"
+
+	logrus "github.com/sirupsen/logrus"
+
+	"github.com/ahmadjafari86/go-todo-list/internal/repository"
+)
+
+// ReencryptConfig controls the re-encryption job. Every Interval (an hour if
+// unset) it handles up to BatchSize users (100 if unset) of each kind: those
+// with content under a data key wrapped by a retired master key version, and
+// those with content stored before encryption was turned on.
+type ReencryptConfig struct {
+	Interval  time.Duration
+	BatchSize int
+}
+
+type Reencryptor interface {
+	// Reencrypt runs one batch and reports how many values it rewrote.
+	Reencrypt(ctx context.Context) (int64, error)
+	// Run re-encrypts every Interval until ctx is done. Failures are logged
+	// and retried at the next interval.
+	Run(ctx context.Context)
+}
+
+type reencryptor struct {
+	cipher *repository.ContentCipher
+	cfg    ReencryptConfig
+}
+
+func NewReencryptor(cipher *repository.ContentCipher, cfg ReencryptConfig) Reencryptor {
+	if cfg.Interval <= 0 {
+		cfg.Interval = time.Hour
+	}
+	if cfg.BatchSize <= 0 {
+		cfg.BatchSize = 100
+	}
+	return &reencryptor{cipher: cipher, cfg: cfg}
+}
+
+func (j *reencryptor) Reencrypt(ctx context.Context) (int64, error) {
+	return j.cipher.Reencrypt(ctx, j.cfg.BatchSize)
+}
+
+func (j *reencryptor) Run(ctx context.Context) {
+	ticker := time.NewTicker(j.cfg.Interval)
+	defer ticker.Stop()
+	for {
+		if n, err := j.Reencrypt(ctx); err != nil && ctx.Err() == nil {
+			logrus.Errorf("failed to re-encrypt todo content: %v", err)
+		} else if n > 0 {
+			logrus.Infof("re-encrypted %d todo value(s)", n)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
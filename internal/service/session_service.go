@@ -0,0 +1,47 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+
+	"github.com/ahmadjafari86/go-todo-list/internal/models"
+	"github.com/ahmadjafari86/go-todo-list/internal/repository"
+)
+
+var ErrSessionNotFound = errors.New("session not found")
+
+type SessionService interface {
+	// ListSessions returns the user's active sessions, flagging currentID.
+	ListSessions(ctx context.Context, userID, currentID uint) ([]models.Session, error)
+	RevokeSession(ctx context.Context, id, userID uint) error
+}
+
+type sessionService struct {
+	sessions repository.SessionRepository
+}
+
+func NewSessionService(sessions repository.SessionRepository) SessionService {
+	return &sessionService{sessions: sessions}
+}
+
+func (s *sessionService) ListSessions(ctx context.Context, userID, currentID uint) ([]models.Session, error) {
+	list, err := s.sessions.ListActive(ctx, userID, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	for i := range list {
+		list[i].Current = list[i].ID == currentID
+	}
+	return list, nil
+}
+
+func (s *sessionService) RevokeSession(ctx context.Context, id, userID uint) error {
+	err := s.sessions.Revoke(ctx, id, userID, time.Now())
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return ErrSessionNotFound
+	}
+	return err
+}
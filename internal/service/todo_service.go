@@ -1,56 +1,368 @@
 package service
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+
+	"gorm.io/gorm"
+
 	"github.com/ahmadjafari86/go-todo-list/internal/models"
 	"github.com/ahmadjafari86/go-todo-list/internal/repository"
 )
 
+var (
+	ErrTodoNotFound     = errors.New("todo not found")
+	ErrRevisionNotFound = errors.New("revision not found")
+)
+
+// TodoService authorizes every call through workspace membership and list shares. Todos
+// created without a workspace or list land in the caller's personal workspace.
+// DeleteTodo moves a todo to the trash, from which anyone who may change it can
+// restore it or delete it for good.
+//
+// Every change is recorded as a revision in the same transaction, so the history
+// covers all code paths. Mutations lock the todo row to keep revision numbers
+// and before values consistent under concurrent changes.
 type TodoService interface {
-	CreateTodo(todo *models.Todo, ownerID uint) error
-	ListTodos(ownerID uint) ([]models.Todo, error)
-	GetTodo(id, ownerID uint) (*models.Todo, error)
-	UpdateTodo(todo *models.Todo, ownerID uint) error
-	ToggleComplete(id, ownerID uint) (*models.Todo, error)
-	DeleteTodo(id, ownerID uint) error
+	CreateTodo(ctx context.Context, todo *models.Todo, userID uint) error
+	ListTodos(ctx context.Context, userID uint, filter repository.TodoFilter) ([]models.Todo, error)
+	GetTodo(ctx context.Context, id, userID uint) (*models.Todo, error)
+	UpdateTodo(ctx context.Context, todo *models.Todo, userID uint) error
+	ToggleComplete(ctx context.Context, id, userID uint) (*models.Todo, error)
+	DeleteTodo(ctx context.Context, id, userID uint) error
+
+	ListTrash(ctx context.Context, userID uint) ([]models.Todo, error)
+	RestoreTodo(ctx context.Context, id, userID uint) (*models.Todo, error)
+	EmptyTrash(ctx context.Context, userID uint) (int64, error)
+
+	History(ctx context.Context, id, userID uint) ([]models.TodoRevision, error)
+	// RevertTodo sets the todo's fields back to their values right after the
+	// given revision. The revert is itself recorded as a new revision.
+	RevertTodo(ctx context.Context, id, rev, userID uint) (*models.Todo, error)
 }
 
 type todoService struct {
-	repo repository.TodoRepository
+	repo       repository.TodoRepository
+	workspaces repository.WorkspaceRepository
+	lists      repository.ListRepository
+	revisions  repository.RevisionRepository
+	tx         repository.TxManager
+}
+
+func NewTodoService(repo repository.TodoRepository, workspaces repository.WorkspaceRepository, lists repository.ListRepository, revisions repository.RevisionRepository, tx repository.TxManager) TodoService {
+	return &todoService{repo: repo, workspaces: workspaces, lists: lists, revisions: revisions, tx: tx}
+}
+
+func (s *todoService) CreateTodo(ctx context.Context, todo *models.Todo, userID uint) error {
+	if todo.ListID != 0 {
+		list, err := s.lists.GetByID(ctx, todo.ListID)
+		if err != nil {
+			return err
+		}
+		if list == nil {
+			return ErrListNotFound
+		}
+		a, err := resolveListAccess(ctx, s.workspaces, s.lists, list, userID)
+		if err != nil {
+			return err
+		}
+		if !a.read {
+			return ErrListNotFound
+		}
+		if !a.write {
+			return ErrForbidden
+		}
+		todo.WorkspaceID = list.WorkspaceID
+	} else if todo.WorkspaceID == 0 {
+		ws, err := s.workspaces.EnsurePersonal(ctx, userID)
+		if err != nil {
+			return err
+		}
+		todo.WorkspaceID = ws.ID
+	} else if err := s.requireWriter(ctx, todo.WorkspaceID, userID); err != nil {
+		return err
+	}
+	todo.OwnerID = userID
+	return s.tx.WithinTx(ctx, repository.TxOptions{}, func(ctx context.Context) error {
+		if err := s.repo.Create(ctx, todo); err != nil {
+			return err
+		}
+		return s.record(ctx, models.RevisionCreate, nil, todo, userID)
+	})
+}
+
+func (s *todoService) ListTodos(ctx context.Context, userID uint, filter repository.TodoFilter) ([]models.Todo, error) {
+	return s.repo.GetAll(ctx, userID, filter)
+}
+
+func (s *todoService) GetTodo(ctx context.Context, id, userID uint) (*models.Todo, error) {
+	t, err := s.repo.GetByID(ctx, id, userID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrTodoNotFound
+	}
+	return t, err
 }
 
-func NewTodoService(repo repository.TodoRepository) TodoService {
-	return &todoService{repo: repo}
+func (s *todoService) UpdateTodo(ctx context.Context, todo *models.Todo, userID uint) error {
+	return s.tx.WithinTx(ctx, repository.TxOptions{}, func(ctx context.Context) error {
+		existing, err := s.writable(repository.WithLock(ctx, repository.LockForUpdate), todo.ID, userID)
+		if err != nil {
+			return err
+		}
+		todo.OwnerID = existing.OwnerID
+		todo.WorkspaceID = existing.WorkspaceID
+		todo.ListID = existing.ListID
+		todo.CreatedAt = existing.CreatedAt
+		if err := s.update(ctx, todo, userID); err != nil {
+			return err
+		}
+		return s.record(ctx, models.RevisionUpdate, existing, todo, userID)
+	})
+}
+
+// ToggleComplete reads and flips the flag in one transaction with the row locked,
+// so concurrent toggles apply one after the other instead of both writing the
+// same value.
+func (s *todoService) ToggleComplete(ctx context.Context, id, userID uint) (*models.Todo, error) {
+	var t *models.Todo
+	err := s.tx.WithinTx(ctx, repository.TxOptions{}, func(ctx context.Context) error {
+		var err error
+		t, err = s.writable(repository.WithLock(ctx, repository.LockForUpdate), id, userID)
+		if err != nil {
+			return err
+		}
+		before := *t
+		t.Completed = !t.Completed
+		if err := s.update(ctx, t, userID); err != nil {
+			return err
+		}
+		return s.record(ctx, models.RevisionToggle, &before, t, userID)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+func (s *todoService) DeleteTodo(ctx context.Context, id, userID uint) error {
+	return s.tx.WithinTx(ctx, repository.TxOptions{}, func(ctx context.Context) error {
+		before, err := s.writable(repository.WithLock(ctx, repository.LockForUpdate), id, userID)
+		if err != nil {
+			return err
+		}
+		err = s.repo.Delete(ctx, id, userID)
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrTodoNotFound
+		}
+		if err != nil {
+			return err
+		}
+		after, err := s.repo.GetTrashed(ctx, id, userID)
+		if err != nil {
+			return err
+		}
+		return s.record(ctx, models.RevisionDelete, before, after, userID)
+	})
+}
+
+func (s *todoService) ListTrash(ctx context.Context, userID uint) ([]models.Todo, error) {
+	return s.repo.ListTrash(ctx, userID)
+}
+
+func (s *todoService) RestoreTodo(ctx context.Context, id, userID uint) (*models.Todo, error) {
+	var t *models.Todo
+	err := s.tx.WithinTx(ctx, repository.TxOptions{}, func(ctx context.Context) error {
+		before, err := s.repo.GetTrashed(repository.WithLock(ctx, repository.LockForUpdate), id, userID)
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrTodoNotFound
+		}
+		if err != nil {
+			return err
+		}
+		if err := s.canWrite(ctx, before, userID); err != nil {
+			return err
+		}
+		err = s.repo.Restore(ctx, id, userID)
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrTodoNotFound
+		}
+		if err != nil {
+			return err
+		}
+		restored := *before
+		restored.DeletedAt = nil
+		t = &restored
+		return s.record(ctx, models.RevisionRestore, before, t, userID)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return t, nil
 }
 
-func (s *todoService) CreateTodo(todo *models.Todo, ownerID uint) error {
-	todo.OwnerID = ownerID
-	return s.repo.Create(todo)
+func (s *todoService) EmptyTrash(ctx context.Context, userID uint) (int64, error) {
+	return s.repo.EmptyTrash(ctx, userID)
 }
 
-func (s *todoService) ListTodos(ownerID uint) ([]models.Todo, error) {
-	return s.repo.GetAll(ownerID)
+func (s *todoService) History(ctx context.Context, id, userID uint) ([]models.TodoRevision, error) {
+	if _, err := s.GetTodo(ctx, id, userID); err != nil {
+		return nil, err
+	}
+	return s.revisions.ListByTodo(ctx, id)
 }
 
-func (s *todoService) GetTodo(id, ownerID uint) (*models.Todo, error) {
-	return s.repo.GetByID(id, ownerID)
+func (s *todoService) RevertTodo(ctx context.Context, id, rev, userID uint) (*models.Todo, error) {
+	var t *models.Todo
+	err := s.tx.WithinTx(ctx, repository.TxOptions{}, func(ctx context.Context) error {
+		before, err := s.writable(repository.WithLock(ctx, repository.LockForUpdate), id, userID)
+		if err != nil {
+			return err
+		}
+		revs, err := s.revisions.ListByTodo(ctx, id)
+		if err != nil {
+			return err
+		}
+		reverted := *before
+		if err := revertFields(&reverted, revs, rev); err != nil {
+			return err
+		}
+		if err := s.update(ctx, &reverted, userID); err != nil {
+			return err
+		}
+		t = &reverted
+		return s.record(ctx, models.RevisionRevert, before, t, userID)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return t, nil
 }
 
-func (s *todoService) UpdateTodo(todo *models.Todo, ownerID uint) error {
-	return s.repo.Update(todo, ownerID)
+func (s *todoService) update(ctx context.Context, todo *models.Todo, userID uint) error {
+	err := s.repo.Update(ctx, todo, userID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return ErrTodoNotFound
+	}
+	return err
 }
 
-func (s *todoService) ToggleComplete(id, ownerID uint) (*models.Todo, error) {
-	t, err := s.repo.GetByID(id, ownerID)
+// writable loads a todo the user can see and checks that they may change it.
+func (s *todoService) writable(ctx context.Context, id, userID uint) (*models.Todo, error) {
+	t, err := s.GetTodo(ctx, id, userID)
 	if err != nil {
 		return nil, err
 	}
-	t.Completed = !t.Completed
-	if err := s.repo.Update(t, ownerID); err != nil {
+	// only the todo row is locked
+	if err := s.canWrite(repository.WithLock(ctx, repository.LockNone), t, userID); err != nil {
 		return nil, err
 	}
 	return t, nil
 }
 
-func (s *todoService) DeleteTodo(id, ownerID uint) error {
-	return s.repo.Delete(id, ownerID)
+// canWrite checks that the user's workspace role or, for todos in a shared list,
+// their share permission lets them change t.
+func (s *todoService) canWrite(ctx context.Context, t *models.Todo, userID uint) error {
+	m, err := s.workspaces.GetMembership(ctx, t.WorkspaceID, userID)
+	if err != nil {
+		return err
+	}
+	if m != nil && models.CanWriteTodos(m.Role) {
+		return nil
+	}
+	if t.ListID != 0 {
+		share, err := s.lists.GetShare(ctx, t.ListID, userID)
+		if err != nil {
+			return err
+		}
+		if share != nil && models.CanWriteShared(share.Permission) {
+			return nil
+		}
+	}
+	return ErrForbidden
+}
+
+func (s *todoService) requireWriter(ctx context.Context, workspaceID, userID uint) error {
+	m, err := s.workspaces.GetMembership(ctx, workspaceID, userID)
+	if err != nil {
+		return err
+	}
+	if m == nil {
+		return ErrWorkspaceNotFound
+	}
+	if !models.CanWriteTodos(m.Role) {
+		return ErrForbidden
+	}
+	return nil
+}
+
+// revisionFields are the todo fields recorded in revisions, by JSON name.
+var revisionFields = []struct {
+	name string
+	get  func(*models.Todo) any
+	// revertable fields are set back by RevertTodo; the trash has its own endpoints.
+	revertable bool
+}{
+	{"title", func(t *models.Todo) any { return t.Title }, true},
+	{"completed", func(t *models.Todo) any { return t.Completed }, true},
+	{"deleted_at", func(t *models.Todo) any { return t.DeletedAt }, false},
+}
+
+// record saves the fields that differ between before and after as the todo's
+// next revision. before is nil for a new todo. Nothing is saved when no field changed.
+func (s *todoService) record(ctx context.Context, action string, before, after *models.Todo, userID uint) error {
+	changes := []models.FieldChange{}
+	for _, f := range revisionFields {
+		old := json.RawMessage("null")
+		if before != nil {
+			old = fieldJSON(f.get(before))
+		}
+		cur := fieldJSON(f.get(after))
+		if !bytes.Equal(old, cur) {
+			changes = append(changes, models.FieldChange{Field: f.name, Before: old, After: cur})
+		}
+	}
+	if len(changes) == 0 {
+		return nil
+	}
+	return s.revisions.Create(ctx, &models.TodoRevision{TodoID: after.ID, UserID: userID, Action: action, Changes: changes})
+}
+
+// fieldJSON encodes a field value. Todo fields are strings, bools and times,
+// which always encode.
+func fieldJSON(v any) json.RawMessage {
+	b, _ := json.Marshal(v)
+	return b
+}
+
+// revertFields replays the revisions up to and including rev onto t, leaving
+// each revertable field at the last value those revisions gave it.
+func revertFields(t *models.Todo, revs []models.TodoRevision, rev uint) error {
+	values := map[string]json.RawMessage{}
+	found := false
+	for _, r := range revs {
+		if r.Rev > rev {
+			break
+		}
+		found = found || r.Rev == rev
+		for _, c := range r.Changes {
+			values[c.Field] = c.After
+		}
+	}
+	if !found {
+		return ErrRevisionNotFound
+	}
+	fields := map[string]json.RawMessage{}
+	for _, f := range revisionFields {
+		if v, ok := values[f.name]; ok && f.revertable {
+			fields[f.name] = v
+		}
+	}
+	// the fields are keyed by their JSON names, so they decode straight into t
+	b, err := json.Marshal(fields)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(b, t)
 }
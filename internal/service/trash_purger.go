@@ -0,0 +1,59 @@
+package service
+
+import (
+	"context"
+	"time"
+
+	logrus "github.com/sirupsen/logrus"
+
+	"github.com/ahmadjafari86/go-todo-list/internal/repository"
+)
+
+// TrashConfig controls how long deleted todos can be restored. Every Interval
+// (an hour if unset) the purger permanently deletes todos trashed more than
+// Retention ago.
+type TrashConfig struct {
+	Retention time.Duration
+	Interval  time.Duration
+}
+
+type TrashPurger interface {
+	// Purge deletes the expired todos once and reports how many there were.
+	Purge(ctx context.Context) (int64, error)
+	// Run purges every Interval until ctx is done. Failures are logged and
+	// retried at the next interval.
+	Run(ctx context.Context)
+}
+
+type trashPurger struct {
+	todos repository.TodoRepository
+	cfg   TrashConfig
+}
+
+func NewTrashPurger(todos repository.TodoRepository, cfg TrashConfig) TrashPurger {
+	if cfg.Interval <= 0 {
+		cfg.Interval = time.Hour
+	}
+	return &trashPurger{todos: todos, cfg: cfg}
+}
+
+func (p *trashPurger) Purge(ctx context.Context) (int64, error) {
+	return p.todos.PurgeTrash(ctx, time.Now().Add(-p.cfg.Retention))
+}
+
+func (p *trashPurger) Run(ctx context.Context) {
+	ticker := time.NewTicker(p.cfg.Interval)
+	defer ticker.Stop()
+	for {
+		if n, err := p.Purge(ctx); err != nil && ctx.Err() == nil {
+			logrus.Errorf("failed to purge trash: %v", err)
+		} else if n > 0 {
+			logrus.Infof("purged %d todo(s) from the trash", n)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,217 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	"github.com/ahmadjafari86/go-todo-list/internal/models"
+	"github.com/ahmadjafari86/go-todo-list/internal/repository"
+)
+
+var (
+	ErrWorkspaceNotFound = errors.New("workspace not found")
+	ErrMemberNotFound    = errors.New("member not found")
+	// ErrForbidden means the caller can see the resource but their role does not allow the change.
+	ErrForbidden = errors.New("insufficient workspace role")
+)
+
+type WorkspaceService interface {
+	CreateWorkspace(ctx context.Context, name string, ownerID uint) (*models.Workspace, error)
+	ListWorkspaces(ctx context.Context, userID uint) ([]models.WorkspaceWithRole, error)
+	GetWorkspace(ctx context.Context, id, userID uint) (*models.WorkspaceWithRole, error)
+	RenameWorkspace(ctx context.Context, id, userID uint, name string) error
+	DeleteWorkspace(ctx context.Context, id, userID uint) error
+
+	ListMembers(ctx context.Context, workspaceID, userID uint) ([]models.Membership, error)
+	AddMember(ctx context.Context, workspaceID, actorID, userID uint, role string) (*models.Membership, error)
+	UpdateMemberRole(ctx context.Context, workspaceID, actorID, userID uint, role string) error
+	// RemoveMember removes userID from the workspace. Members may always remove themselves.
+	RemoveMember(ctx context.Context, workspaceID, actorID, userID uint) error
+}
+
+type workspaceService struct {
+	workspaces repository.WorkspaceRepository
+	users      repository.UserRepository
+}
+
+func NewWorkspaceService(workspaces repository.WorkspaceRepository, users repository.UserRepository) WorkspaceService {
+	return &workspaceService{workspaces: workspaces, users: users}
+}
+
+func (s *workspaceService) CreateWorkspace(ctx context.Context, name string, ownerID uint) (*models.Workspace, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return nil, errors.New("name is required")
+	}
+	ws := &models.Workspace{Name: name, OwnerID: ownerID}
+	if err := s.workspaces.Create(ctx, ws); err != nil {
+		return nil, err
+	}
+	return ws, nil
+}
+
+func (s *workspaceService) ListWorkspaces(ctx context.Context, userID uint) ([]models.WorkspaceWithRole, error) {
+	if _, err := s.workspaces.EnsurePersonal(ctx, userID); err != nil {
+		return nil, err
+	}
+	return s.workspaces.ListForUser(ctx, userID)
+}
+
+func (s *workspaceService) GetWorkspace(ctx context.Context, id, userID uint) (*models.WorkspaceWithRole, error) {
+	ws, m, err := s.access(ctx, id, userID)
+	if err != nil {
+		return nil, err
+	}
+	return &models.WorkspaceWithRole{Workspace: *ws, Role: m.Role}, nil
+}
+
+func (s *workspaceService) RenameWorkspace(ctx context.Context, id, userID uint, name string) error {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return errors.New("name is required")
+	}
+	_, m, err := s.access(ctx, id, userID)
+	if err != nil {
+		return err
+	}
+	if !models.CanManageMembers(m.Role) {
+		return ErrForbidden
+	}
+	return s.workspaces.Rename(ctx, id, name)
+}
+
+func (s *workspaceService) DeleteWorkspace(ctx context.Context, id, userID uint) error {
+	ws, m, err := s.access(ctx, id, userID)
+	if err != nil {
+		return err
+	}
+	if m.Role != models.WorkspaceRoleOwner {
+		return ErrForbidden
+	}
+	if ws.Personal {
+		return errors.New("personal workspaces cannot be deleted")
+	}
+	return s.workspaces.Delete(ctx, id)
+}
+
+func (s *workspaceService) ListMembers(ctx context.Context, workspaceID, userID uint) ([]models.Membership, error) {
+	if _, _, err := s.access(ctx, workspaceID, userID); err != nil {
+		return nil, err
+	}
+	return s.workspaces.ListMembers(ctx, workspaceID)
+}
+
+func (s *workspaceService) AddMember(ctx context.Context, workspaceID, actorID, userID uint, role string) (*models.Membership, error) {
+	if err := validateMemberRole(role); err != nil {
+		return nil, err
+	}
+	ws, m, err := s.access(ctx, workspaceID, actorID)
+	if err != nil {
+		return nil, err
+	}
+	if !models.CanManageMembers(m.Role) {
+		return nil, ErrForbidden
+	}
+	if ws.Personal {
+		return nil, errors.New("personal workspaces cannot be shared")
+	}
+	u, err := s.users.GetByID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if u == nil {
+		return nil, ErrUserNotFound
+	}
+	existing, err := s.workspaces.GetMembership(ctx, workspaceID, userID)
+	if err != nil {
+		return nil, err
+	}
+	if existing != nil {
+		return nil, errors.New("user is already a member")
+	}
+	member := &models.Membership{WorkspaceID: workspaceID, UserID: userID, Role: role}
+	if err := s.workspaces.AddMember(ctx, member); err != nil {
+		return nil, err
+	}
+	return member, nil
+}
+
+func (s *workspaceService) UpdateMemberRole(ctx context.Context, workspaceID, actorID, userID uint, role string) error {
+	if err := validateMemberRole(role); err != nil {
+		return err
+	}
+	_, m, err := s.access(ctx, workspaceID, actorID)
+	if err != nil {
+		return err
+	}
+	if !models.CanManageMembers(m.Role) {
+		return ErrForbidden
+	}
+	target, err := s.member(ctx, workspaceID, userID)
+	if err != nil {
+		return err
+	}
+	if target.Role == models.WorkspaceRoleOwner {
+		return errors.New("the owner's role cannot be changed")
+	}
+	return s.workspaces.UpdateMemberRole(ctx, workspaceID, userID, role)
+}
+
+func (s *workspaceService) RemoveMember(ctx context.Context, workspaceID, actorID, userID uint) error {
+	_, m, err := s.access(ctx, workspaceID, actorID)
+	if err != nil {
+		return err
+	}
+	if actorID != userID && !models.CanManageMembers(m.Role) {
+		return ErrForbidden
+	}
+	target, err := s.member(ctx, workspaceID, userID)
+	if err != nil {
+		return err
+	}
+	if target.Role == models.WorkspaceRoleOwner {
+		return errors.New("the owner cannot leave the workspace")
+	}
+	return s.workspaces.RemoveMember(ctx, workspaceID, userID)
+}
+
+// access loads a workspace together with userID's membership. Non-members get
+// ErrWorkspaceNotFound so that workspace IDs are not disclosed.
+func (s *workspaceService) access(ctx context.Context, id, userID uint) (*models.Workspace, *models.Membership, error) {
+	m, err := s.workspaces.GetMembership(ctx, id, userID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if m == nil {
+		return nil, nil, ErrWorkspaceNotFound
+	}
+	ws, err := s.workspaces.GetByID(ctx, id)
+	if err != nil {
+		return nil, nil, err
+	}
+	if ws == nil {
+		return nil, nil, ErrWorkspaceNotFound
+	}
+	return ws, m, nil
+}
+
+func (s *workspaceService) member(ctx context.Context, workspaceID, userID uint) (*models.Membership, error) {
+	m, err := s.workspaces.GetMembership(ctx, workspaceID, userID)
+	if err != nil {
+		return nil, err
+	}
+	if m == nil {
+		return nil, ErrMemberNotFound
+	}
+	return m, nil
+}
+
+// validateMemberRole accepts the roles that can be granted. Ownership is fixed at creation.
+func validateMemberRole(role string) error {
+	switch role {
+	case models.WorkspaceRoleAdmin, models.WorkspaceRoleMember, models.WorkspaceRoleViewer:
+		return nil
+	}
+	return errors.New("unknown role")
+}
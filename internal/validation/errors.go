@@ -1,7 +1,14 @@
 package validation
 
 import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"unicode"
+
 	"github.com/gin-gonic/gin"
+	"github.com/go-playground/validator/v10"
 )
 
 // ProblemDetails defines RFC7807 Problem+JSON structure
@@ -11,6 +18,14 @@ type ProblemDetails struct {
 	Status   int    `json:"status"`
 	Detail   string `json:"detail,omitempty"`
 	Instance string `json:"instance,omitempty"`
+	// Errors is an RFC7807 extension member listing problems with individual request fields.
+	Errors []FieldError `json:"errors,omitempty"`
+}
+
+// FieldError describes why a single request field was rejected.
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
 }
 
 func NewProblem(status int, title string, detail string, instance string) ProblemDetails {
@@ -24,8 +39,86 @@ func NewProblem(status int, title string, detail string, instance string) Proble
 }
 
 func RespondProblem(c *gin.Context, status int, title, detail string) {
+	RespondFieldProblem(c, status, title, detail, nil)
+}
+
+// StatusClientClosedRequest is the non-standard status nginx popularised for
+// requests the client gave up on before a response was written.
+const StatusClientClosedRequest = 499
+
+// IsContextError reports whether err comes from a cancelled or expired
+// context rather than from the operation itself.
+func IsContextError(err error) bool {
+	return errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded)
+}
+
+// RespondServerError reports an unexpected error. Errors caused by the request
+// context are told apart: a query deadline yields 504, a client disconnect or
+// server shutdown 499; anything else is a 500.
+func RespondServerError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, context.DeadlineExceeded):
+		RespondProblem(c, http.StatusGatewayTimeout, "Timeout", "the request did not complete in time")
+	case errors.Is(err, context.Canceled), c.Request.Context().Err() != nil:
+		RespondProblem(c, StatusClientClosedRequest, "Request Cancelled", "the request was cancelled before it completed")
+	default:
+		RespondProblem(c, http.StatusInternalServerError, "Server Error", err.Error())
+	}
+}
+
+// RespondFieldProblem responds like RespondProblem and lists the offending fields.
+func RespondFieldProblem(c *gin.Context, status int, title, detail string, fields []FieldError) {
 	problem := NewProblem(status, title, detail, c.Request.RequestURI)
+	problem.Errors = fields
 	c.Header("Content-Type", "application/problem+json")
 	c.JSON(status, problem)
 	c.Abort()
 }
+
+// FieldErrors converts binding validation errors into field errors named after
+// the JSON fields, e.g. NewPassword becomes new_password. Other errors yield nil.
+func FieldErrors(err error) []FieldError {
+	var errs validator.ValidationErrors
+	if !errors.As(err, &errs) {
+		return nil
+	}
+	out := make([]FieldError, 0, len(errs))
+	for _, fe := range errs {
+		out = append(out, FieldError{Field: snakeCase(fe.Field()), Message: message(fe)})
+	}
+	return out
+}
+
+func message(fe validator.FieldError) string {
+	switch fe.Tag() {
+	case "required":
+		return "is required"
+	case "email":
+		return "must be a valid email address"
+	case "min":
+		return "must be at least " + fe.Param() + " characters"
+	case "max":
+		return "must be at most " + fe.Param() + " characters"
+	case "oneof":
+		return "must be one of: " + fe.Param()
+	}
+	return "failed the " + fe.Tag() + " check"
+}
+
+func snakeCase(s string) string {
+	var b strings.Builder
+	prevLower := false
+	for _, r := range s {
+		if unicode.IsUpper(r) {
+			if prevLower {
+				b.WriteByte('_')
+			}
+			r = unicode.ToLower(r)
+			prevLower = false
+		} else {
+			prevLower = true
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
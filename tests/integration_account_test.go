@@ -0,0 +1,126 @@
+package tests
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tidwall/gjson"
+	"gorm.io/gorm"
+
+	"github.com/ahmadjafari86/go-todo-list/internal/models"
+)
+
+func TestExportContainsTheUsersData(t *testing.T) {
+	setupAuthDB(t)
+	setupAuthRouter()
+
+	registerUser(t, "packer@example.com", "pass1234")
+	token := loginUserAndGetToken(t, "packer@example.com", "pass1234")
+	postJSON(`{"title":"take me with you"}`, "/api/todos", token)
+
+	w := sendJSON("POST", "", "/api/me/export", token)
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "application/zip", w.Header().Get("Content-Type"))
+	assert.Contains(t, w.Header().Get("Content-Disposition"), "attachment")
+
+	zr, err := zip.NewReader(bytes.NewReader(w.Body.Bytes()), int64(w.Body.Len()))
+	require.NoError(t, err)
+	files := map[string]string{}
+	for _, f := range zr.File {
+		rc, err := f.Open()
+		require.NoError(t, err)
+		b, _ := io.ReadAll(rc)
+		rc.Close()
+		files[f.Name] = string(b)
+	}
+	assert.Equal(t, "packer@example.com", gjson.Get(files["profile.json"], "email").String())
+	assert.NotContains(t, files["profile.json"], "password")
+	assert.Equal(t, "take me with you", gjson.Get(files["todos.json"], "0.title").String())
+	assert.Equal(t, "owner", gjson.Get(files["workspaces.json"], "0.role").String())
+	assert.Equal(t, int64(1), gjson.Get(files["sessions.json"], "#").Int())
+}
+
+func TestDeleteAccountRemovesEverythingTheUserOwns(t *testing.T) {
+	setupAuthDB(t)
+	setupAuthRouter()
+
+	registerUser(t, "leaver@example.com", "pass1234")
+	registerUser(t, "stayer@example.com", "pass1234")
+	leaver := loginUserAndGetToken(t, "leaver@example.com", "pass1234")
+	stayer := loginUserAndGetToken(t, "stayer@example.com", "pass1234")
+
+	// The stayer's team workspace has a todo from each of them
+	w := postJSON(`{"name":"Team"}`, "/api/workspaces", stayer)
+	teamID := gjson.Get(w.Body.String(), "id").Int()
+	leaverUser, _ := testRepos.Users.GetByEmail(context.Background(), "leaver@example.com")
+	stayerUser, _ := testRepos.Users.GetByEmail(context.Background(), "stayer@example.com")
+	w = postJSON(fmt.Sprintf(`{"user_id":%d,"role":"member"}`, leaverUser.ID), fmt.Sprintf("/api/workspaces/%d/members", teamID), stayer)
+	require.Equal(t, http.StatusCreated, w.Code)
+	w = postJSON(fmt.Sprintf(`{"title":"leaver in team","workspace_id":%d}`, teamID), "/api/todos", leaver)
+	leaverTodos := []uint{uint(gjson.Get(w.Body.String(), "id").Int())}
+	postJSON(fmt.Sprintf(`{"title":"stayer in team","workspace_id":%d}`, teamID), "/api/todos", stayer)
+	w = postJSON(`{"title":"leaver personal"}`, "/api/todos", leaver)
+	leaverTodos = append(leaverTodos, uint(gjson.Get(w.Body.String(), "id").Int()))
+	postJSON(`{"title":"stayer personal"}`, "/api/todos", stayer)
+
+	// An invitation addressed to the leaver and a failed login of theirs
+	invitation := &models.Invitation{InviterID: stayerUser.ID, Email: "Leaver@Example.com", WorkspaceID: uint(teamID),
+		Role: models.WorkspaceRoleViewer, ExpiresAt: time.Now().Add(time.Hour)}
+	require.NoError(t, testRepos.Invitations.Create(context.Background(), invitation))
+	w = postJSON(`{"email":"leaver@example.com","password":"wrong"}`, "/auth/login", "")
+	require.Equal(t, http.StatusUnauthorized, w.Code)
+
+	// The password is required
+	assert.Equal(t, http.StatusBadRequest, sendJSON("DELETE", `{}`, "/api/me", leaver).Code)
+	assert.Equal(t, http.StatusForbidden, sendJSON("DELETE", `{"password":"wrong"}`, "/api/me", leaver).Code)
+	assert.Equal(t, http.StatusOK, getWithToken("/api/todos", leaver).Code)
+
+	assert.Equal(t, http.StatusNoContent, sendJSON("DELETE", `{"password":"pass1234"}`, "/api/me", leaver).Code)
+	assert.Equal(t, http.StatusUnauthorized, getWithToken("/api/todos", leaver).Code)
+	inv, err := testRepos.Invitations.GetByID(context.Background(), invitation.ID)
+	require.NoError(t, err)
+	assert.Nil(t, inv, "invitations addressed to the deleted email go too")
+	attempt, err := testRepos.Attempts.Get(context.Background(), "account:leaver@example.com")
+	require.NoError(t, err)
+	assert.Nil(t, attempt, "failed logins are not kept for the deleted email")
+	w = postJSON(`{"email":"leaver@example.com","password":"pass1234"}`, "/auth/login", "")
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	for _, id := range leaverTodos {
+		require.NotZero(t, id)
+		_, err := testRepos.DataKeys.TodoOwner(context.Background(), id)
+		assert.ErrorIs(t, err, gorm.ErrRecordNotFound, "todo %d is gone", id)
+	}
+	members, err := testRepos.Workspaces.ListMembers(context.Background(), uint(teamID))
+	require.NoError(t, err)
+	assert.Len(t, members, 1)
+
+	// The other user's data is untouched
+	w = getWithToken("/api/todos", stayer)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, int64(2), gjson.Get(w.Body.String(), "#").Int())
+}
+
+func TestDeletingAUserCascadesToTheirTodos(t *testing.T) {
+	requireDatabase(t)
+	setupAuthDB(t)
+	ctx := context.Background()
+	owner := createTestUser(t, testRepos, "owner@example.com")
+	ws, err := testRepos.Workspaces.EnsurePersonal(ctx, owner.ID)
+	require.NoError(t, err)
+	createTestTodo(t, testRepos, owner, ws.ID, 0, "goes with its owner")
+
+	// fk_todos_owner removes the todos of a user deleted outside the account repository
+	require.NoError(t, dbAuth.Exec("DELETE FROM users WHERE id = ?", owner.ID).Error)
+	var left int64
+	require.NoError(t, dbAuth.Model(&models.Todo{}).Where("owner_id = ?", owner.ID).Count(&left).Error)
+	assert.Zero(t, left)
+}
@@ -0,0 +1,84 @@
+package tests
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tidwall/gjson"
+
+	"github.com/ahmadjafari86/go-todo-list/internal/models"
+	"github.com/ahmadjafari86/go-todo-list/internal/repository"
+	"github.com/ahmadjafari86/go-todo-list/internal/service"
+)
+
+func TestAdminCanDisableAndEnableUsers(t *testing.T) {
+	setupAuthDB(t)
+	setupAuthRouter()
+
+	registerUser(t, "boss@example.com", "pass1234")
+	registerUser(t, "worker@example.com", "pass1234")
+	testRepos.Users.SetRoleByEmail(context.Background(), []string{"boss@example.com"}, models.RoleAdmin)
+
+	adminToken := loginUserAndGetToken(t, "boss@example.com", "pass1234")
+	userToken := loginUserAndGetToken(t, "worker@example.com", "pass1234")
+	postJSON(`{"title":"one"}`, "/api/todos", userToken)
+	postJSON(`{"title":"two"}`, "/api/todos", userToken)
+
+	// Regular users cannot reach the admin API
+	assert.Equal(t, http.StatusForbidden, getWithToken("/admin/users", userToken).Code)
+
+	w := getWithToken("/admin/users?q=WORKER", adminToken)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, int64(1), gjson.Get(w.Body.String(), "total").Int())
+	assert.Equal(t, int64(2), gjson.Get(w.Body.String(), "users.0.todo_count").Int())
+	workerID := gjson.Get(w.Body.String(), "users.0.id").Int()
+
+	// Disabling rejects the existing token and new logins
+	w = postJSON(``, fmt.Sprintf("/admin/users/%d/disable", workerID), adminToken)
+	assert.Equal(t, http.StatusNoContent, w.Code)
+	assert.Equal(t, http.StatusUnauthorized, getWithToken("/api/todos", userToken).Code)
+	w = postJSON(`{"email":"worker@example.com","password":"pass1234"}`, "/auth/login", "")
+	assert.Equal(t, http.StatusForbidden, w.Code)
+
+	w = postJSON(``, fmt.Sprintf("/admin/users/%d/enable", workerID), adminToken)
+	assert.Equal(t, http.StatusNoContent, w.Code)
+	assert.Equal(t, http.StatusOK, getWithToken("/api/todos", userToken).Code)
+
+	// The test router runs without a todo cache
+	assert.Equal(t, http.StatusNotFound, getWithToken("/admin/todo-cache", adminToken).Code)
+	assert.Equal(t, http.StatusForbidden, getWithToken("/admin/todo-cache", userToken).Code)
+}
+
+func TestAdminChangesKeepConcurrentUserWrites(t *testing.T) {
+	forEachRepositoryImplementation(t, func(t *testing.T, repos *repository.Repositories) {
+		ctx := context.Background()
+		admin := createTestUser(t, repos, "root@example.com")
+		target := createTestUser(t, repos, "resetting@example.com")
+		hashes := 0
+		users := racingUsers{UserRepository: repos.Users, meanwhile: func(ctx context.Context, id uint) {
+			hashes++
+			require.NoError(t, repos.Users.UpdatePasswordHash(ctx, id, fmt.Sprintf("hash-%d", hashes)))
+		}}
+		svc := service.NewAdminService(users)
+
+		steps := map[string]func() error{
+			"role":    func() error { return svc.SetRole(ctx, target.ID, admin.ID, models.RoleAdmin) },
+			"disable": func() error { return svc.DisableUser(ctx, target.ID, admin.ID) },
+			"enable":  func() error { return svc.EnableUser(ctx, target.ID) },
+		}
+		for _, name := range []string{"role", "disable", "enable"} {
+			require.NoError(t, steps[name](), name)
+			u, err := repos.Users.GetByID(ctx, target.ID)
+			require.NoError(t, err)
+			assert.Equal(t, fmt.Sprintf("hash-%d", hashes), u.PasswordHash, name)
+		}
+		u, err := repos.Users.GetByID(ctx, target.ID)
+		require.NoError(t, err)
+		assert.Equal(t, models.RoleAdmin, u.Role)
+		assert.False(t, u.Disabled())
+	})
+}
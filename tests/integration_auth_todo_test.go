@@ -2,10 +2,13 @@ package tests
 
 import (
 	"context"
+	"log"
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"path/filepath"
 	"strings"
+	"sync"
 	"testing"
 	"time"
 
@@ -13,9 +16,12 @@ import (
 	"github.com/stretchr/testify/assert"
 	"github.com/testcontainers/testcontainers-go"
 	"github.com/testcontainers/testcontainers-go/wait"
+	"golang.org/x/crypto/bcrypt"
 	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
 
+	"github.com/ahmadjafari86/go-todo-list/config"
+	appdb "github.com/ahmadjafari86/go-todo-list/internal/db"
 	"github.com/ahmadjafari86/go-todo-list/internal/handlers"
 	"github.com/ahmadjafari86/go-todo-list/internal/middleware"
 	"github.com/ahmadjafari86/go-todo-list/internal/models"
@@ -28,7 +34,98 @@ import (
 var dbAuth *gorm.DB
 var routerAuth *gin.Engine
 
+// testRepos is what setupAuthRouter wires into the router: the GORM repositories
+// on dbAuth, or the in-memory ones when TEST_DB=memory (dbAuth is then nil).
+var testRepos *repository.Repositories
+
+// oidcProviders are wired into the router by setupAuthRouter.
+var oidcProviders []service.OIDCProvider
+
+// publicURL is the address setupAuthRouter scopes login cookies to.
+var publicURL = "http://localhost"
+
+var testArgon2Params = service.Argon2Params{Memory: 1024, Iterations: 2, Parallelism: 1, SaltLength: 16, KeyLength: 32}
+
+// testPasswordPolicy is wired into the router by setupAuthRouter. It is lenient so
+// the other tests can use short passwords.
+var testPasswordPolicy = service.PasswordPolicyConfig{MinLength: 8}
+
+// setupAuthDB gives each test a fresh, migrated database. TEST_DB selects
+// "postgres" (a Testcontainers container), "sqlite" (a temporary file) or
+// "memory" (the in-memory repositories, no database at all); when it is unset
+// Postgres is used if Docker is reachable, SQLite otherwise. In CI, where the
+// CI variable is set, an unreachable Docker fails the run instead, so a
+// pipeline meant to test Postgres cannot quietly test SQLite.
 func setupAuthDB(t *testing.T) {
+	var db *gorm.DB
+	switch testDatabase() {
+	case config.StorageMemory:
+		dbAuth = nil
+		testRepos = repository.NewMemoryRepositories()
+		return
+	case appdb.DialectSQLite:
+		db = setupSQLiteDB(t)
+	default:
+		db = setupPostgresDB(t)
+	}
+
+	migrateTestDB(t, db)
+
+	dbAuth = db
+	testRepos = repository.NewGormRepositories(db)
+}
+
+// requireDatabase skips tests that inspect the SQL schema when TEST_DB=memory.
+func requireDatabase(t *testing.T) {
+	if testDatabase() == config.StorageMemory {
+		t.Skip("needs a database; TEST_DB=memory")
+	}
+}
+
+var (
+	testDBOnce sync.Once
+	testDBName string
+)
+
+func testDatabase() string {
+	testDBOnce.Do(func() {
+		testDBName = os.Getenv("TEST_DB")
+		if testDBName != "" {
+			return
+		}
+		testDBName = appdb.DialectPostgres
+		provider, err := testcontainers.NewDockerProvider()
+		if err == nil {
+			err = provider.Health(context.Background())
+		}
+		if err != nil && os.Getenv("CI") != "" {
+			log.Fatalf("Docker is not available (%v); set TEST_DB to choose the database in CI", err)
+		}
+		if err != nil {
+			log.Printf("Docker is not available (%v); running the integration tests on SQLite", err)
+			testDBName = appdb.DialectSQLite
+		}
+	})
+	return testDBName
+}
+
+func setupSQLiteDB(t *testing.T) *gorm.DB {
+	dsn := "sqlite://" + filepath.Join(t.TempDir(), "test.db")
+	os.Setenv("DATABASE_URL", dsn)
+
+	db, err := appdb.New(dsn, appdb.Options{Pool: appdb.Pool{MaxOpenConns: 10, MaxIdleConns: 10, ConnMaxLifetime: 5 * time.Minute}})
+	if err != nil {
+		t.Fatalf("failed to open sqlite db: %v", err)
+	}
+	t.Cleanup(func() {
+		if sqlDB, err := db.DB(); err == nil {
+			sqlDB.Close()
+		}
+	})
+	return db
+}
+
+func setupPostgresDB(t *testing.T) *gorm.DB {
 	ctx := context.Background()
 
 	req := testcontainers.ContainerRequest{
@@ -59,8 +156,6 @@ func setupAuthDB(t *testing.T) {
 
 	dsn := "postgres://testuser:testpass@" + host + ":" + port.Port() + "/testdb?sslmode=disable"
 	os.Setenv("DATABASE_URL", dsn)
-	os.Setenv("JWT_SECRET", "testsecret")
-	os.Setenv("JWT_EXP_MINUTES", "15")
 
 	db, err := gorm.Open(postgres.Open(dsn), &gorm.Config{})
 	if err != nil {
@@ -75,31 +170,178 @@ func setupAuthDB(t *testing.T) {
 	if err != nil {
 		t.Fatalf("failed to connect db after retries: %v", err)
 	}
+	return db
+}
 
-	db.AutoMigrate(&models.User{}, &models.Todo{})
-
-	dbAuth = db
+// migrateTestDB builds the schema with the same migrations the server runs.
+func migrateTestDB(t *testing.T, gdb *gorm.DB) {
+	migrator, err := appdb.NewMigrator(gdb)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := migrator.Up(context.Background()); err != nil {
+		t.Fatalf("failed to migrate: %v", err)
+	}
 }
 
 func setupAuthRouter() {
-	userRepo := repository.NewGormUserRepository(dbAuth)
-	todoRepo := repository.NewGormTodoRepository(dbAuth)
+	keys, _ := service.NewHMACKeySet("testsecret")
+	setupAuthRouterWithKeys(keys)
+}
+
+func setupAuthRouterWithKeys(keys *service.KeySet) {
+	userRepo := testRepos.Users
+	todoRepo := testRepos.Todos
+	revisionRepo := testRepos.Revisions
+	tokenRepo := testRepos.Tokens
+	recoveryRepo := testRepos.RecoveryCodes
+	identityRepo := testRepos.Identities
+	workspaceRepo := testRepos.Workspaces
+	listRepo := testRepos.Lists
+	invitationRepo := testRepos.Invitations
+	sessionRepo := testRepos.Sessions
+	magicLinkRepo := testRepos.MagicLinks
+	accountRepo := testRepos.Accounts
+	passwordResetRepo := testRepos.PasswordResets
+	oauthRepo := testRepos.OAuth
+	txManager := testRepos.Tx
 
-	authSvc := service.NewAuthService(userRepo)
-	todoSvc := service.NewTodoService(todoRepo)
+	// cheap parameters keep the suite fast; production uses DefaultArgon2Params
+	hasher, _ := service.NewPasswordHasher(service.PasswordHashConfig{
+		Algorithm:  service.HashArgon2id,
+		Argon2:     testArgon2Params,
+		BcryptCost: bcrypt.MinCost,
+	})
+	policy := service.NewPasswordPolicy(testPasswordPolicy)
+	mfaSvc := service.NewMFAService(userRepo, recoveryRepo, "Todo API")
+	jwtCfg := service.JWTConfig{
+		Keys:      keys,
+		Issuer:    "todo-api",
+		Audience:  "todo-api",
+		AccessTTL: 15 * time.Minute,
+	}
+	authSvc := service.NewAuthService(userRepo, sessionRepo, mfaSvc, hasher, policy, jwtCfg)
+	todoSvc := service.NewTodoService(todoRepo, workspaceRepo, listRepo, revisionRepo, txManager)
+	workspaceSvc := service.NewWorkspaceService(workspaceRepo, userRepo)
+	listSvc := service.NewListService(listRepo, workspaceRepo, userRepo)
+	sentMail = &mailbox{}
+	invitationSvc := service.NewInvitationService(invitationRepo, workspaceRepo, listRepo, userRepo, authSvc, sentMail, txManager, service.InvitationConfig{
+		JWT:       jwtCfg,
+		TTL:       time.Hour,
+		AcceptURL: "http://localhost/invitations/accept",
+	})
+	tokenSvc := service.NewTokenService(tokenRepo, userRepo)
+	sessionSvc := service.NewSessionService(sessionRepo)
+	oauthSvc := service.NewOAuthService(oauthRepo, userRepo, service.OAuthConfig{AccessTTL: time.Hour, RefreshTTL: 24 * time.Hour})
+	accountSvc := service.NewAccountService(userRepo, accountRepo, testRepos.Attempts, hasher, txManager)
+	adminSvc := service.NewAdminService(userRepo)
+	oidcSvc := service.NewOIDCService(oidcProviders, userRepo, identityRepo, authSvc)
+	magicLinkSvc := service.NewMagicLinkService(magicLinkRepo, userRepo, testRepos.Attempts, authSvc, sentMail, service.MagicLinkConfig{
+		TTL:          15 * time.Minute,
+		MaxPerWindow: 3,
+		Window:       15 * time.Minute,
+		CallbackURL:  "http://localhost/auth/magic-link/callback",
+	})
+	passwordSvc := service.NewPasswordService(userRepo, passwordResetRepo, sessionRepo, testRepos.Attempts, hasher, policy, sentMail, txManager, service.PasswordResetConfig{
+		TTL:          30 * time.Minute,
+		MaxPerWindow: 3,
+		Window:       15 * time.Minute,
+		ResetURL:     "http://localhost/reset-password",
+	})
+	limiter := service.NewLoginLimiter(testRepos.Attempts, service.LimiterConfig{
+		MaxAccountFailures: 3,
+		MaxIPFailures:      100,
+		BaseLockout:        time.Minute,
+		MaxLockout:         time.Hour,
+		ResetAfter:         time.Hour,
+	})
 
-	authHandler := handlers.NewAuthHandler(authSvc)
+	cookies, _ := handlers.NewCookieScope(publicURL)
+	authHandler := handlers.NewAuthHandler(authSvc, limiter)
 	todoHandler := handlers.NewTodoHandler(todoSvc)
+	tokenHandler := handlers.NewTokenHandler(tokenSvc)
+	mfaHandler := handlers.NewMFAHandler(mfaSvc)
+	jwksHandler := handlers.NewJWKSHandler(keys)
+	oidcHandler := handlers.NewOIDCHandler(oidcSvc, cookies)
+	adminHandler := handlers.NewAdminHandler(adminSvc, nil)
+	workspaceHandler := handlers.NewWorkspaceHandler(workspaceSvc)
+	listHandler := handlers.NewListHandler(listSvc)
+	invitationHandler := handlers.NewInvitationHandler(invitationSvc)
+	magicLinkHandler := handlers.NewMagicLinkHandler(magicLinkSvc, cookies, 900)
+	sessionHandler := handlers.NewSessionHandler(sessionSvc)
+	accountHandler := handlers.NewAccountHandler(accountSvc)
+	passwordHandler := handlers.NewPasswordHandler(passwordSvc)
+	oauthHandler := handlers.NewOAuthHandler(oauthSvc)
 
 	r := gin.Default()
+	r.GET("/.well-known/jwks.json", jwksHandler.JWKS)
 	r.POST("/auth/register", authHandler.Register)
 	r.POST("/auth/login", authHandler.Login)
+	r.POST("/auth/login/mfa", authHandler.LoginMFA)
+	r.GET("/auth/oidc/:provider/login", oidcHandler.Login)
+	r.GET("/auth/oidc/:provider/callback", oidcHandler.Callback)
+	r.POST("/auth/magic-link", magicLinkHandler.Request)
+	r.GET("/auth/magic-link/callback", magicLinkHandler.Callback)
+	r.POST("/auth/invitations/accept", invitationHandler.AcceptAndRegister)
+	r.POST("/auth/invitations/decline", invitationHandler.Decline)
+	r.POST("/auth/password/forgot", passwordHandler.Forgot)
+	r.POST("/auth/password/reset", passwordHandler.Reset)
+	r.POST("/oauth/token", oauthHandler.Token)
 
 	api := r.Group("/api")
-	api.Use(middleware.AuthMiddleware(authSvc))
+	api.Use(middleware.AuthMiddleware(authSvc, tokenSvc, oauthSvc))
+	{
+		api.POST("/todos", middleware.RequireScope(models.ScopeTodosWrite), todoHandler.CreateTodo)
+		api.GET("/todos", middleware.RequireScope(models.ScopeTodosRead), todoHandler.ListTodos)
+		api.POST("/tokens", middleware.RequireScope(models.ScopeAccount), tokenHandler.CreateToken)
+		api.DELETE("/tokens/:id", middleware.RequireScope(models.ScopeAccount), tokenHandler.RevokeToken)
+		api.POST("/me/mfa/totp", middleware.RequireScope(models.ScopeAccount), mfaHandler.BeginTOTP)
+		api.POST("/me/mfa/totp/confirm", middleware.RequireScope(models.ScopeAccount), mfaHandler.ConfirmTOTP)
+		api.PATCH("/todos/:id/complete", middleware.RequireScope(models.ScopeTodosWrite), todoHandler.ToggleComplete)
+		api.DELETE("/todos/:id", middleware.RequireScope(models.ScopeTodosWrite), todoHandler.DeleteTodo)
+		api.GET("/workspaces", middleware.RequireScope(models.ScopeTodosRead), workspaceHandler.ListWorkspaces)
+		api.POST("/workspaces", middleware.RequireScope(models.ScopeAccount), workspaceHandler.CreateWorkspace)
+		api.POST("/workspaces/:id/members", middleware.RequireScope(models.ScopeAccount), workspaceHandler.AddMember)
+		api.PUT("/workspaces/:id/members/:user_id", middleware.RequireScope(models.ScopeAccount), workspaceHandler.UpdateMember)
+		api.DELETE("/workspaces/:id/members/:user_id", middleware.RequireScope(models.ScopeAccount), workspaceHandler.RemoveMember)
+		api.GET("/todos/:id", middleware.RequireScope(models.ScopeTodosRead), todoHandler.GetTodo)
+		api.PUT("/todos/:id", middleware.RequireScope(models.ScopeTodosWrite), todoHandler.UpdateTodo)
+		api.GET("/todos/:id/history", middleware.RequireScope(models.ScopeTodosRead), todoHandler.History)
+		api.POST("/todos/:id/revert/:rev", middleware.RequireScope(models.ScopeTodosWrite), todoHandler.RevertTodo)
+		api.GET("/trash", middleware.RequireScope(models.ScopeTodosRead), todoHandler.ListTrash)
+		api.POST("/trash/:id/restore", middleware.RequireScope(models.ScopeTodosWrite), todoHandler.RestoreTodo)
+		api.DELETE("/trash", middleware.RequireScope(models.ScopeTodosWrite), todoHandler.EmptyTrash)
+		api.POST("/lists", middleware.RequireScope(models.ScopeTodosWrite), listHandler.CreateList)
+		api.GET("/lists/shared", middleware.RequireScope(models.ScopeTodosRead), listHandler.SharedWithMe)
+		api.GET("/lists/:id/shares", middleware.RequireScope(models.ScopeTodosRead), listHandler.ListShares)
+		api.POST("/lists/:id/shares", middleware.RequireScope(models.ScopeAccount), listHandler.Grant)
+		api.PUT("/lists/:id/shares/:user_id", middleware.RequireScope(models.ScopeAccount), listHandler.ChangeShare)
+		api.DELETE("/lists/:id/shares/:user_id", middleware.RequireScope(models.ScopeAccount), listHandler.Revoke)
+		api.GET("/invitations", middleware.RequireScope(models.ScopeAccount), invitationHandler.ListInvitations)
+		api.POST("/invitations", middleware.RequireScope(models.ScopeAccount), invitationHandler.Invite)
+		api.DELETE("/invitations/:id", middleware.RequireScope(models.ScopeAccount), invitationHandler.RevokeInvitation)
+		api.POST("/invitations/accept", middleware.RequireScope(models.ScopeAccount), invitationHandler.Accept)
+		api.GET("/me/sessions", middleware.RequireScope(models.ScopeAccount), sessionHandler.ListSessions)
+		api.DELETE("/me/sessions/:id", middleware.RequireScope(models.ScopeAccount), sessionHandler.RevokeSession)
+		api.POST("/me/export", middleware.RequireScope(models.ScopeAccount), accountHandler.Export)
+		api.DELETE("/me", middleware.RequireScope(models.ScopeAccount), accountHandler.DeleteAccount)
+		api.POST("/me/password", middleware.RequireScope(models.ScopeAccount), passwordHandler.Change)
+		api.GET("/me/authorized-apps", middleware.RequireScope(models.ScopeAccount), oauthHandler.ListAuthorizedApps)
+		api.DELETE("/me/authorized-apps/:id", middleware.RequireScope(models.ScopeAccount), oauthHandler.RevokeAuthorizedApp)
+		api.POST("/oauth/clients", middleware.RequireScope(models.ScopeAccount), oauthHandler.RegisterClient)
+		api.GET("/oauth/clients", middleware.RequireScope(models.ScopeAccount), oauthHandler.ListClients)
+		api.DELETE("/oauth/clients/:id", middleware.RequireScope(models.ScopeAccount), oauthHandler.DeleteClient)
+		api.GET("/oauth/authorize", middleware.RequireScope(models.ScopeAccount), oauthHandler.AuthorizePrompt)
+		api.POST("/oauth/authorize", middleware.RequireScope(models.ScopeAccount), oauthHandler.Authorize)
+	}
+
+	admin := r.Group("/admin")
+	admin.Use(middleware.AuthMiddleware(authSvc, tokenSvc, oauthSvc), middleware.RequireScope(models.ScopeAccount), middleware.RequireRole(models.RoleAdmin))
 	{
-		api.POST("/todos", todoHandler.CreateTodo)
-		api.GET("/todos", todoHandler.ListTodos)
+		admin.GET("/users", adminHandler.ListUsers)
+		admin.POST("/users/:id/disable", adminHandler.DisableUser)
+		admin.POST("/users/:id/enable", adminHandler.EnableUser)
+		admin.GET("/todo-cache", adminHandler.TodoCacheStats)
 	}
 	routerAuth = r
 }
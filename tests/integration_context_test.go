@@ -0,0 +1,118 @@
+package tests
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tidwall/gjson"
+
+	appdb "github.com/ahmadjafari86/go-todo-list/internal/db"
+	"github.com/ahmadjafari86/go-todo-list/internal/handlers"
+	"github.com/ahmadjafari86/go-todo-list/internal/models"
+	"github.com/ahmadjafari86/go-todo-list/internal/repository"
+	"github.com/ahmadjafari86/go-todo-list/internal/service"
+	"github.com/ahmadjafari86/go-todo-list/internal/validation"
+)
+
+func TestRepositoriesStopOnCancelledContext(t *testing.T) {
+	forEachRepositoryImplementation(t, func(t *testing.T, repos *repository.Repositories) {
+		owner := createTestUser(t, repos, "owner@example.com")
+
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		_, err := repos.Users.GetByEmail(ctx, owner.Email)
+		assert.ErrorIs(t, err, context.Canceled)
+		_, err = repos.Todos.GetAll(ctx, owner.ID, repository.TodoFilter{})
+		assert.ErrorIs(t, err, context.Canceled)
+		err = repos.Todos.Create(ctx, &models.Todo{Title: "never stored", OwnerID: owner.ID})
+		assert.ErrorIs(t, err, context.Canceled)
+
+		todos, err := repos.Todos.GetAll(context.Background(), owner.ID, repository.TodoFilter{})
+		require.NoError(t, err)
+		assert.Empty(t, todos)
+	})
+}
+
+func TestCancelledRequestGetsProblemResponse(t *testing.T) {
+	setupAuthDB(t)
+	setupAuthRouter()
+	registerUser(t, "ctx@example.com", "pass1234")
+	token := loginUserAndGetToken(t, "ctx@example.com", "pass1234")
+
+	// the client went away before the handler reached the database
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequestWithContext(ctx, "GET", "/api/todos", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	routerAuth.ServeHTTP(w, req)
+	assert.Equal(t, validation.StatusClientClosedRequest, w.Code)
+	assert.Equal(t, "application/problem+json", w.Header().Get("Content-Type"))
+	assert.Equal(t, "Request Cancelled", gjson.Get(w.Body.String(), "title").String())
+
+	// the request ran out of time
+	ctx, cancel = context.WithDeadline(context.Background(), time.Now().Add(-time.Second))
+	defer cancel()
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequestWithContext(ctx, "GET", "/api/todos", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	routerAuth.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusGatewayTimeout, w.Code)
+	assert.Equal(t, "Timeout", gjson.Get(w.Body.String(), "title").String())
+}
+
+func TestQueryTimeoutBoundsEachStatement(t *testing.T) {
+	requireDatabase(t)
+	setupAuthDB(t)
+
+	// plugins register callbacks on the whole *gorm.DB, so use connections of our own
+	open := func(timeout time.Duration) repository.UserRepository {
+		conn, err := appdb.New(os.Getenv("DATABASE_URL"), appdb.Options{Pool: appdb.Pool{MaxOpenConns: 2, MaxIdleConns: 2}})
+		require.NoError(t, err)
+		t.Cleanup(func() {
+			if sqlDB, err := conn.DB(); err == nil {
+				sqlDB.Close()
+			}
+		})
+		require.NoError(t, conn.Use(appdb.QueryTimeout(timeout)))
+		return repository.NewGormUserRepository(conn)
+	}
+
+	_, err := open(time.Nanosecond).GetByEmail(context.Background(), "nobody@example.com")
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+
+	// a generous timeout leaves queries alone
+	u, err := open(time.Minute).GetByEmail(context.Background(), "nobody@example.com")
+	assert.NoError(t, err)
+	assert.Nil(t, u)
+}
+
+func TestGetTodoReportsCancellationRatherThanNotFound(t *testing.T) {
+	setupAuthDB(t)
+	owner := createTestUser(t, testRepos, "owner@example.com")
+	ws, err := testRepos.Workspaces.EnsurePersonal(context.Background(), owner.ID)
+	require.NoError(t, err)
+	todo := createTestTodo(t, testRepos, owner, ws.ID, 0, "still here")
+	h := handlers.NewTodoHandler(service.NewTodoService(testRepos.Todos, testRepos.Workspaces, testRepos.Lists, testRepos.Revisions, testRepos.Tx))
+
+	// the handler is called directly, as the auth middleware would already
+	// stop a cancelled request
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request, _ = http.NewRequestWithContext(ctx, "GET", fmt.Sprintf("/api/todos/%d", todo.ID), nil)
+	c.Params = gin.Params{{Key: "id", Value: fmt.Sprint(todo.ID)}}
+	c.Set("user_id", fmt.Sprint(owner.ID))
+	h.GetTodo(c)
+	assert.Equal(t, validation.StatusClientClosedRequest, w.Code)
+}
@@ -0,0 +1,220 @@
+package tests
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ahmadjafari86/go-todo-list/internal/encryption"
+	"github.com/ahmadjafari86/go-todo-list/internal/models"
+	"github.com/ahmadjafari86/go-todo-list/internal/repository"
+	"github.com/ahmadjafari86/go-todo-list/internal/service"
+)
+
+func newMasterKey(t *testing.T, version int) string {
+	key := make([]byte, encryption.KeySize)
+	_, err := rand.Read(key)
+	require.NoError(t, err)
+	return fmt.Sprintf("%d:%s", version, base64.StdEncoding.EncodeToString(key))
+}
+
+// encryptTestRepos turns on encryption for repos and returns the unencrypted
+// repositories, which show what is stored.
+func encryptTestRepos(t *testing.T, repos *repository.Repositories, masterKeys ...string) (*repository.ContentCipher, repository.Repositories) {
+	raw := *repos
+	master, err := encryption.ParseMasterKeys(masterKeys, 0)
+	require.NoError(t, err)
+	cipher := repository.NewContentCipher(repos.DataKeys, master)
+	repository.EncryptContent(repos, cipher)
+	return cipher, raw
+}
+
+func TestTodoTitlesAreEncryptedAtRest(t *testing.T) {
+	forEachRepositoryImplementation(t, func(t *testing.T, repos *repository.Repositories) {
+		ctx := context.Background()
+		owner := createTestUser(t, repos, "owner@example.com")
+		_, raw := encryptTestRepos(t, repos, newMasterKey(t, 1))
+		todos := service.NewTodoService(repos.Todos, repos.Workspaces, repos.Lists, repos.Revisions, repos.Tx)
+
+		// The service only sees plaintext ...
+		todo := &models.Todo{Title: "call the bank about 1234"}
+		require.NoError(t, todos.CreateTodo(ctx, todo, owner.ID))
+		assert.Equal(t, "call the bank about 1234", todo.Title)
+		todo.Title = "call the bank again"
+		require.NoError(t, todos.UpdateTodo(ctx, todo, owner.ID))
+		got, err := todos.GetTodo(ctx, todo.ID, owner.ID)
+		require.NoError(t, err)
+		assert.Equal(t, "call the bank again", got.Title)
+		list, err := todos.ListTodos(ctx, owner.ID, repository.TodoFilter{})
+		require.NoError(t, err)
+		assert.Equal(t, []string{"call the bank again"}, todoTitles(list))
+		history, err := todos.History(ctx, todo.ID, owner.ID)
+		require.NoError(t, err)
+		require.Len(t, history, 2)
+		assert.JSONEq(t, `"call the bank about 1234"`, string(history[1].Changes[0].Before))
+
+		// ... while the title and its history are stored sealed
+		stored, err := raw.Todos.GetByID(ctx, todo.ID, owner.ID)
+		require.NoError(t, err)
+		assert.True(t, strings.HasPrefix(stored.Title, encryption.SealedPrefix), stored.Title)
+		revs, err := raw.Revisions.ListByTodo(ctx, todo.ID)
+		require.NoError(t, err)
+		for _, rev := range revs {
+			assert.NotContains(t, fmt.Sprint(rev.Changes), "bank")
+		}
+
+		// Reverting replays decrypted values
+		reverted, err := todos.RevertTodo(ctx, todo.ID, 1, owner.ID)
+		require.NoError(t, err)
+		assert.Equal(t, "call the bank about 1234", reverted.Title)
+
+		// The account export is readable
+		export, err := repos.Accounts.Export(ctx, owner.ID)
+		require.NoError(t, err)
+		assert.Equal(t, []string{"call the bank about 1234"}, todoTitles(export.Todos))
+
+		// The data key goes with the account
+		require.NoError(t, repos.Accounts.Delete(ctx, owner.ID))
+		_, err = repos.DataKeys.Current(ctx, owner.ID)
+		assert.Error(t, err)
+	})
+}
+
+func TestReencryptionRotatesMasterKeys(t *testing.T) {
+	forEachRepositoryImplementation(t, func(t *testing.T, repos *repository.Repositories) {
+		ctx := context.Background()
+		owner := createTestUser(t, repos, "owner@example.com")
+		ws, err := repos.Workspaces.EnsurePersonal(ctx, owner.ID)
+		require.NoError(t, err)
+		legacy := createTestTodo(t, repos, owner, ws.ID, 0, "stored before encryption")
+
+		v1, v2 := newMasterKey(t, 1), newMasterKey(t, 2)
+		encrypted := *repos
+		cipher, raw := encryptTestRepos(t, &encrypted, v1)
+		todos := service.NewTodoService(encrypted.Todos, encrypted.Workspaces, encrypted.Lists, encrypted.Revisions, encrypted.Tx)
+		todo := &models.Todo{Title: "draft", WorkspaceID: ws.ID}
+		require.NoError(t, todos.CreateTodo(ctx, todo, owner.ID))
+		todo.Title = "sealed with v1"
+		require.NoError(t, todos.UpdateTodo(ctx, todo, owner.ID))
+
+		// Plaintext from before is readable, and sealed by the job
+		got, err := encrypted.Todos.GetByID(ctx, legacy.ID, owner.ID)
+		require.NoError(t, err)
+		assert.Equal(t, "stored before encryption", got.Title)
+		n, err := service.NewReencryptor(cipher, service.ReencryptConfig{}).Reencrypt(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, int64(1), n)
+		stored, err := raw.Todos.GetByID(ctx, legacy.ID, owner.ID)
+		require.NoError(t, err)
+		assert.True(t, encryption.IsSealed(stored.Title))
+		oldKey, _ := encryption.KeyID(stored.Title)
+
+		// Rotating: v2 becomes active while v1 stays known
+		rotated := raw
+		cipher, _ = encryptTestRepos(t, &rotated, v1, v2)
+		job := service.NewReencryptor(cipher, service.ReencryptConfig{})
+		n, err = job.Reencrypt(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, int64(4), n, "two titles and two revisions")
+		n, err = job.Reencrypt(ctx)
+		require.NoError(t, err)
+		assert.Zero(t, n)
+		_, err = repos.DataKeys.Get(ctx, oldKey)
+		assert.Error(t, err, "the old data key is deleted")
+
+		// Without v1 everything still decrypts
+		current := raw
+		encryptTestRepos(t, &current, v2)
+		all, err := current.Todos.GetAll(ctx, owner.ID, repository.TodoFilter{})
+		require.NoError(t, err)
+		assert.ElementsMatch(t, []string{"stored before encryption", "sealed with v1"}, todoTitles(all))
+		history, err := service.NewTodoService(current.Todos, current.Workspaces, current.Lists, current.Revisions, current.Tx).History(ctx, todo.ID, owner.ID)
+		require.NoError(t, err)
+		require.Len(t, history, 2)
+		assert.JSONEq(t, `"draft"`, string(history[1].Changes[0].Before))
+		key, err := repos.DataKeys.Current(ctx, owner.ID)
+		require.NoError(t, err)
+		assert.Equal(t, 2, key.MasterKeyVersion)
+	})
+}
+
+func TestMasterKeysAreValidated(t *testing.T) {
+	_, err := encryption.ParseMasterKeys([]string{"1:" + base64.StdEncoding.EncodeToString([]byte("short"))}, 0)
+	assert.ErrorContains(t, err, "5 bytes")
+	_, err = encryption.ParseMasterKeys([]string{"key-without-version"}, 0)
+	assert.Error(t, err)
+	_, err = encryption.ParseMasterKeys([]string{newMasterKey(t, 1)}, 2)
+	assert.ErrorContains(t, err, "active master key 2")
+
+	// Wrapped data keys only unwrap for their user
+	master, err := encryption.ParseMasterKeys([]string{newMasterKey(t, 1)}, 0)
+	require.NoError(t, err)
+	_, wrapped, err := master.Wrap(1, make([]byte, encryption.KeySize))
+	require.NoError(t, err)
+	_, err = master.Unwrap(1, 2, wrapped)
+	assert.Error(t, err)
+}
+
+func TestReencryptionSealsPlaintextHistories(t *testing.T) {
+	forEachRepositoryImplementation(t, func(t *testing.T, repos *repository.Repositories) {
+		ctx := context.Background()
+		owner := createTestUser(t, repos, "owner@example.com")
+		ws, err := repos.Workspaces.EnsurePersonal(ctx, owner.ID)
+		require.NoError(t, err)
+		todos := service.NewTodoService(repos.Todos, repos.Workspaces, repos.Lists, repos.Revisions, repos.Tx)
+		todo := &models.Todo{Title: "pick up the keys", WorkspaceID: ws.ID}
+		require.NoError(t, todos.CreateTodo(ctx, todo, owner.ID))
+
+		// The title gets sealed, its history from before encryption does not
+		encrypted := *repos
+		cipher, raw := encryptTestRepos(t, &encrypted, newMasterKey(t, 1))
+		require.NoError(t, encrypted.Todos.Update(ctx, todo, owner.ID))
+
+		n, err := service.NewReencryptor(cipher, service.ReencryptConfig{}).Reencrypt(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, int64(1), n)
+		revs, err := raw.Revisions.ListByTodo(ctx, todo.ID)
+		require.NoError(t, err)
+		require.Len(t, revs, 1)
+		assert.NotContains(t, fmt.Sprint(revs[0].Changes), "keys")
+		owners, err := repos.DataKeys.PlaintextOwners(ctx, 10)
+		require.NoError(t, err)
+		assert.Empty(t, owners)
+	})
+}
+
+func TestReencryptionSkipsUsersItCannotReencrypt(t *testing.T) {
+	forEachRepositoryImplementation(t, func(t *testing.T, repos *repository.Repositories) {
+		ctx := context.Background()
+		broken := createTestUser(t, repos, "broken@example.com")
+		owner := createTestUser(t, repos, "owner@example.com")
+		v1, v2 := newMasterKey(t, 1), newMasterKey(t, 2)
+
+		// broken's data key does not unwrap, and comes first
+		require.NoError(t, repos.DataKeys.Create(ctx, &models.DataKey{UserID: broken.ID, MasterKeyVersion: 1, WrappedKey: "garbage"}))
+		encrypted := *repos
+		encryptTestRepos(t, &encrypted, v1)
+		ws, err := encrypted.Workspaces.EnsurePersonal(ctx, owner.ID)
+		require.NoError(t, err)
+		createTestTodo(t, &encrypted, owner, ws.ID, 0, "sealed with v1")
+
+		rotated := *repos
+		cipher, _ := encryptTestRepos(t, &rotated, v1, v2)
+		n, err := service.NewReencryptor(cipher, service.ReencryptConfig{}).Reencrypt(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, int64(1), n)
+		key, err := repos.DataKeys.Current(ctx, owner.ID)
+		require.NoError(t, err)
+		assert.Equal(t, 2, key.MasterKeyVersion)
+		stale, err := repos.DataKeys.ListStale(ctx, 2, 10)
+		require.NoError(t, err)
+		require.Len(t, stale, 2, "broken's key, and owner's until the next pass")
+		assert.Equal(t, broken.ID, stale[0].UserID)
+	})
+}
@@ -0,0 +1,130 @@
+package tests
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tidwall/gjson"
+
+	"github.com/ahmadjafari86/go-todo-list/internal/models"
+	"github.com/ahmadjafari86/go-todo-list/internal/repository"
+)
+
+func TestTodoHistoryAndRevert(t *testing.T) {
+	setupAuthDB(t)
+	setupAuthRouter()
+	registerUser(t, "author@example.com", "pass1234")
+	registerUser(t, "reader@example.com", "pass1234")
+	token := loginUserAndGetToken(t, "author@example.com", "pass1234")
+	readerToken := loginUserAndGetToken(t, "reader@example.com", "pass1234")
+	author, _ := testRepos.Users.GetByEmail(context.Background(), "author@example.com")
+	reader, _ := testRepos.Users.GetByEmail(context.Background(), "reader@example.com")
+
+	w := postJSON(`{"name":"Team"}`, "/api/workspaces", token)
+	require.Equal(t, http.StatusCreated, w.Code)
+	wsID := gjson.Get(w.Body.String(), "id").Int()
+	w = postJSON(fmt.Sprintf(`{"title":"Draft","workspace_id":%d}`, wsID), "/api/todos", token)
+	require.Equal(t, http.StatusCreated, w.Code)
+	id := gjson.Get(w.Body.String(), "id").Int()
+	todoPath := fmt.Sprintf("/api/todos/%d", id)
+
+	// Every kind of change is recorded; updates that change nothing are not
+	require.Equal(t, http.StatusOK, sendJSON("PUT", `{"title":"Final"}`, todoPath, token).Code)
+	require.Equal(t, http.StatusOK, sendJSON("PUT", `{"title":"Final"}`, todoPath, token).Code)
+	require.Equal(t, http.StatusOK, sendJSON("PATCH", "", todoPath+"/complete", token).Code)
+	require.Equal(t, http.StatusNoContent, sendJSON("DELETE", "", todoPath, token).Code)
+	require.Equal(t, http.StatusOK, sendJSON("POST", "", fmt.Sprintf("/api/trash/%d/restore", id), token).Code)
+
+	w = getWithToken(todoPath+"/history", token)
+	require.Equal(t, http.StatusOK, w.Code)
+	body := w.Body.String()
+	assert.Equal(t, []interface{}{float64(1), float64(2), float64(3), float64(4), float64(5)}, gjson.Get(body, "#.rev").Value())
+	assert.Equal(t, []interface{}{"create", "update", "toggle", "delete", "restore"}, gjson.Get(body, "#.action").Value())
+	assert.Equal(t, int64(author.ID), gjson.Get(body, "0.user_id").Int())
+	assert.NotEmpty(t, gjson.Get(body, "0.created_at").String())
+	assert.JSONEq(t, `[{"field":"title","before":null,"after":"Draft"},{"field":"completed","before":null,"after":false}]`,
+		gjson.Get(body, "0.changes").Raw)
+	assert.JSONEq(t, `[{"field":"title","before":"Draft","after":"Final"}]`, gjson.Get(body, "1.changes").Raw)
+	assert.JSONEq(t, `[{"field":"completed","before":false,"after":true}]`, gjson.Get(body, "2.changes").Raw)
+	assert.Equal(t, "deleted_at", gjson.Get(body, "3.changes.0.field").String())
+	assert.Equal(t, "null", gjson.Get(body, "3.changes.0.before").Raw)
+	assert.NotEmpty(t, gjson.Get(body, "3.changes.0.after").String())
+	assert.Equal(t, "null", gjson.Get(body, "4.changes.0.after").Raw)
+
+	// Reverting sets the fields back to their values after the revision and is recorded too
+	w = sendJSON("POST", "", todoPath+"/revert/1", token)
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "Draft", gjson.Get(w.Body.String(), "title").String())
+	assert.False(t, gjson.Get(w.Body.String(), "completed").Bool())
+	w = getWithToken(todoPath, token)
+	assert.Equal(t, "Draft", gjson.Get(w.Body.String(), "title").String())
+	body = getWithToken(todoPath+"/history", token).Body.String()
+	assert.Equal(t, "revert", gjson.Get(body, "5.action").String())
+	assert.Equal(t, int64(6), gjson.Get(body, "5.rev").Int())
+	assert.JSONEq(t, `[{"field":"title","before":"Final","after":"Draft"},{"field":"completed","before":true,"after":false}]`,
+		gjson.Get(body, "5.changes").Raw)
+
+	w = sendJSON("POST", "", todoPath+"/revert/3", token)
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "Final", gjson.Get(w.Body.String(), "title").String())
+	assert.True(t, gjson.Get(w.Body.String(), "completed").Bool())
+	assert.Equal(t, http.StatusNotFound, sendJSON("POST", "", todoPath+"/revert/99", token).Code)
+	assert.Equal(t, http.StatusNotFound, sendJSON("POST", "", todoPath+"/revert/0", token).Code)
+
+	// Non-members see nothing; viewers can read the history but not revert
+	assert.Equal(t, http.StatusNotFound, getWithToken(todoPath+"/history", readerToken).Code)
+	assert.Equal(t, http.StatusNotFound, sendJSON("POST", "", todoPath+"/revert/1", readerToken).Code)
+	w = postJSON(fmt.Sprintf(`{"user_id":%d,"role":"viewer"}`, reader.ID), fmt.Sprintf("/api/workspaces/%d/members", wsID), token)
+	require.Equal(t, http.StatusCreated, w.Code)
+	assert.Equal(t, http.StatusOK, getWithToken(todoPath+"/history", readerToken).Code)
+	assert.Equal(t, http.StatusForbidden, sendJSON("POST", "", todoPath+"/revert/1", readerToken).Code)
+
+	// Trashed todos have no visible history
+	require.Equal(t, http.StatusNoContent, sendJSON("DELETE", "", todoPath, token).Code)
+	assert.Equal(t, http.StatusNotFound, getWithToken(todoPath+"/history", token).Code)
+}
+
+func TestRevisionRepositoryConformance(t *testing.T) {
+	forEachRepositoryImplementation(t, func(t *testing.T, repos *repository.Repositories) {
+		ctx := context.Background()
+		owner := createTestUser(t, repos, "owner@example.com")
+		ws, err := repos.Workspaces.EnsurePersonal(ctx, owner.ID)
+		require.NoError(t, err)
+		first := createTestTodo(t, repos, owner, ws.ID, 0, "first")
+		second := createTestTodo(t, repos, owner, ws.ID, 0, "second")
+
+		// revisions are numbered per todo
+		for _, todo := range []*models.Todo{first, second, first} {
+			require.NoError(t, repos.Revisions.Create(ctx, &models.TodoRevision{TodoID: todo.ID, UserID: owner.ID, Action: models.RevisionUpdate}))
+		}
+		revs, err := repos.Revisions.ListByTodo(ctx, first.ID)
+		require.NoError(t, err)
+		require.Len(t, revs, 2)
+		assert.Equal(t, []uint{1, 2}, []uint{revs[0].Rev, revs[1].Rev})
+		assert.False(t, revs[0].CreatedAt.IsZero())
+		revs, err = repos.Revisions.ListByTodo(ctx, second.ID)
+		require.NoError(t, err)
+		require.Len(t, revs, 1)
+		assert.Equal(t, uint(1), revs[0].Rev)
+
+		assert.Error(t, repos.Revisions.Create(ctx, &models.TodoRevision{TodoID: 9999, UserID: owner.ID, Action: models.RevisionUpdate}))
+
+		// the history goes with the todo when it is removed for good
+		require.NoError(t, repos.Todos.Delete(ctx, first.ID, owner.ID))
+		revs, err = repos.Revisions.ListByTodo(ctx, first.ID)
+		require.NoError(t, err)
+		assert.Len(t, revs, 2)
+		_, err = repos.Todos.EmptyTrash(ctx, owner.ID)
+		require.NoError(t, err)
+		revs, err = repos.Revisions.ListByTodo(ctx, first.ID)
+		require.NoError(t, err)
+		assert.Empty(t, revs)
+		revs, err = repos.Revisions.ListByTodo(ctx, second.ID)
+		require.NoError(t, err)
+		assert.Len(t, revs, 1)
+	})
+}
@@ -0,0 +1,236 @@
+package tests
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tidwall/gjson"
+
+	"github.com/ahmadjafari86/go-todo-list/internal/mail"
+	"github.com/ahmadjafari86/go-todo-list/internal/models"
+	"github.com/ahmadjafari86/go-todo-list/internal/repository"
+	"github.com/ahmadjafari86/go-todo-list/internal/service"
+)
+
+// mailbox records outgoing email instead of sending it.
+type mailbox struct {
+	mu   sync.Mutex
+	sent []mail.Message
+}
+
+var sentMail *mailbox
+
+func (m *mailbox) Send(msg mail.Message) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.sent = append(m.sent, msg)
+	return nil
+}
+
+var linkPattern = regexp.MustCompile(`https?://\S+`)
+
+// lastTokenTo returns the token query parameter of the last link emailed to the address.
+func (m *mailbox) lastTokenTo(t *testing.T, to string) string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for i := len(m.sent) - 1; i >= 0; i-- {
+		if m.sent[i].To == to {
+			u, err := url.Parse(linkPattern.FindString(m.sent[i].Body))
+			require.NoError(t, err)
+			return u.Query().Get("token")
+		}
+	}
+	t.Fatalf("no email sent to %s", to)
+	return ""
+}
+
+func TestInvitationsAreSingleUseAndRegisterNewUsers(t *testing.T) {
+	setupAuthDB(t)
+	setupAuthRouter()
+
+	registerUser(t, "host@example.com", "pass1234")
+	registerUser(t, "guest@example.com", "pass1234")
+	hostToken := loginUserAndGetToken(t, "host@example.com", "pass1234")
+	guestToken := loginUserAndGetToken(t, "guest@example.com", "pass1234")
+
+	w := postJSON(`{"name":"Team"}`, "/api/workspaces", hostToken)
+	wsID := gjson.Get(w.Body.String(), "id").Int()
+	postJSON(fmt.Sprintf(`{"title":"Team todo","workspace_id":%d}`, wsID), "/api/todos", hostToken)
+
+	// Invite an existing account
+	w = postJSON(fmt.Sprintf(`{"email":"guest@example.com","role":"member","workspace_id":%d}`, wsID), "/api/invitations", hostToken)
+	assert.Equal(t, http.StatusCreated, w.Code)
+	token := sentMail.lastTokenTo(t, "guest@example.com")
+	assert.NotEmpty(t, token)
+
+	// Only the invited address can accept
+	assert.Equal(t, http.StatusForbidden, postJSON(`{"token":"`+token+`"}`, "/api/invitations/accept", hostToken).Code)
+	assert.Equal(t, http.StatusBadRequest, postJSON(`{"token":"`+token+`x"}`, "/api/invitations/accept", guestToken).Code)
+
+	w = postJSON(`{"token":"`+token+`"}`, "/api/invitations/accept", guestToken)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, getWithToken("/api/todos", guestToken).Body.String(), "Team todo")
+
+	// Tokens are single use
+	assert.Equal(t, http.StatusBadRequest, postJSON(`{"token":"`+token+`"}`, "/api/invitations/accept", guestToken).Code)
+	assert.Equal(t, http.StatusBadRequest, postJSON(`{"token":"`+token+`"}`, "/auth/invitations/decline", "").Code)
+
+	// New users register through the invitation
+	w = postJSON(fmt.Sprintf(`{"email":"newbie@example.com","role":"viewer","workspace_id":%d}`, wsID), "/api/invitations", hostToken)
+	assert.Equal(t, http.StatusCreated, w.Code)
+	token = sentMail.lastTokenTo(t, "newbie@example.com")
+	w = postJSON(`{"token":"`+token+`","password":"newpass123"}`, "/auth/invitations/accept", "")
+	assert.Equal(t, http.StatusCreated, w.Code)
+	newbieToken := loginUserAndGetToken(t, "newbie@example.com", "newpass123")
+	assert.Contains(t, getWithToken("/api/todos", newbieToken).Body.String(), "Team todo")
+
+	// Pending invitations can be listed and revoked; declined ones disappear
+	postJSON(fmt.Sprintf(`{"email":"later@example.com","role":"member","workspace_id":%d}`, wsID), "/api/invitations", hostToken)
+	postJSON(fmt.Sprintf(`{"email":"nope@example.com","role":"member","workspace_id":%d}`, wsID), "/api/invitations", hostToken)
+	w = getWithToken("/api/invitations", hostToken)
+	assert.Equal(t, int64(2), gjson.Get(w.Body.String(), "#").Int())
+	laterID := gjson.Get(w.Body.String(), `#(email=="later@example.com").id`).Int()
+	laterToken := sentMail.lastTokenTo(t, "later@example.com")
+
+	assert.Equal(t, http.StatusNoContent, postJSON(`{"token":"`+sentMail.lastTokenTo(t, "nope@example.com")+`"}`, "/auth/invitations/decline", "").Code)
+	assert.Equal(t, http.StatusNotFound, sendJSON("DELETE", "", fmt.Sprintf("/api/invitations/%d", laterID), guestToken).Code)
+	assert.Equal(t, http.StatusNoContent, sendJSON("DELETE", "", fmt.Sprintf("/api/invitations/%d", laterID), hostToken).Code)
+	assert.Equal(t, "[]", getWithToken("/api/invitations", hostToken).Body.String())
+	w = postJSON(`{"token":"`+laterToken+`","password":"laterpass1"}`, "/auth/invitations/accept", "")
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	// Members cannot invite
+	w = postJSON(fmt.Sprintf(`{"email":"x@example.com","role":"member","workspace_id":%d}`, wsID), "/api/invitations", guestToken)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+}
+
+// failingShares makes AddShare fail while fail is set.
+type failingShares struct {
+	repository.ListRepository
+	fail bool
+}
+
+func (r *failingShares) AddShare(ctx context.Context, share *models.ListShare) error {
+	if r.fail {
+		return errors.New("share failed")
+	}
+	return r.ListRepository.AddShare(ctx, share)
+}
+
+func TestAcceptingAnInvitationIsAllOrNothing(t *testing.T) {
+	setupAuthDB(t)
+	lists := &failingShares{ListRepository: testRepos.Lists}
+	testRepos.Lists = lists
+	setupAuthRouter()
+
+	registerUser(t, "host@example.com", "pass1234")
+	hostToken := loginUserAndGetToken(t, "host@example.com", "pass1234")
+	w := postJSON(`{"name":"Groceries"}`, "/api/lists", hostToken)
+	listID := gjson.Get(w.Body.String(), "id").Int()
+	w = postJSON(fmt.Sprintf(`{"email":"newbie@example.com","role":"view","list_id":%d}`, listID), "/api/invitations", hostToken)
+	require.Equal(t, http.StatusCreated, w.Code)
+	token := sentMail.lastTokenTo(t, "newbie@example.com")
+
+	// Sharing fails, so neither the account nor the used-up invitation is kept ...
+	lists.fail = true
+	w = postJSON(`{"token":"`+token+`","password":"newpass123"}`, "/auth/invitations/accept", "")
+	assert.NotEqual(t, http.StatusCreated, w.Code)
+	u, err := testRepos.Users.GetByEmail(context.Background(), "newbie@example.com")
+	require.NoError(t, err)
+	assert.Nil(t, u)
+
+	// ... and the same invitation works once sharing does
+	lists.fail = false
+	w = postJSON(`{"token":"`+token+`","password":"newpass123"}`, "/auth/invitations/accept", "")
+	assert.Equal(t, http.StatusCreated, w.Code)
+	newbieToken := loginUserAndGetToken(t, "newbie@example.com", "newpass123")
+	assert.Contains(t, getWithToken("/api/lists/shared", newbieToken).Body.String(), "Groceries")
+}
+
+type refusingMailer struct{}
+
+func (refusingMailer) Send(mail.Message) error { return errors.New("mail server unavailable") }
+
+// undeletableInvitations makes Delete fail.
+type undeletableInvitations struct {
+	repository.InvitationRepository
+}
+
+func (undeletableInvitations) Delete(context.Context, uint, uint) error {
+	return errors.New("delete failed")
+}
+
+func TestUnsentInvitationsAreRemovedOrReported(t *testing.T) {
+	setupAuthDB(t)
+	setupAuthRouter()
+	registerUser(t, "host@example.com", "pass1234")
+	hostToken := loginUserAndGetToken(t, "host@example.com", "pass1234")
+	w := postJSON(`{"name":"Groceries"}`, "/api/lists", hostToken)
+	listID := uint(gjson.Get(w.Body.String(), "id").Int())
+	host, _ := testRepos.Users.GetByEmail(context.Background(), "host@example.com")
+	keys, _ := service.NewHMACKeySet("testsecret")
+	invite := func(invitations repository.InvitationRepository) error {
+		svc := service.NewInvitationService(invitations, testRepos.Workspaces, testRepos.Lists, testRepos.Users, nil,
+			refusingMailer{}, testRepos.Tx, service.InvitationConfig{JWT: service.JWTConfig{Keys: keys}, TTL: time.Hour})
+		_, err := svc.Invite(context.Background(), host.ID, service.InviteRequest{Email: "friend@example.com", Role: "view", ListID: listID})
+		return err
+	}
+
+	err := invite(testRepos.Invitations)
+	assert.ErrorContains(t, err, "mail server unavailable")
+	pending, err := testRepos.Invitations.ListPending(context.Background(), host.ID, time.Now())
+	require.NoError(t, err)
+	assert.Empty(t, pending)
+
+	// an invitation that could not be removed is not passed over in silence
+	err = invite(undeletableInvitations{testRepos.Invitations})
+	assert.ErrorContains(t, err, "mail server unavailable")
+	assert.ErrorContains(t, err, "removing unsent invitation")
+}
+
+func TestInvitationsFromDemotedInvitersCannotBeAccepted(t *testing.T) {
+	setupAuthDB(t)
+	setupAuthRouter()
+	registerUser(t, "host@example.com", "pass1234")
+	registerUser(t, "deputy@example.com", "pass1234")
+	registerUser(t, "guest@example.com", "pass1234")
+	hostToken := loginUserAndGetToken(t, "host@example.com", "pass1234")
+	deputyToken := loginUserAndGetToken(t, "deputy@example.com", "pass1234")
+	guestToken := loginUserAndGetToken(t, "guest@example.com", "pass1234")
+	deputy, _ := testRepos.Users.GetByEmail(context.Background(), "deputy@example.com")
+
+	w := postJSON(`{"name":"Team"}`, "/api/workspaces", hostToken)
+	wsID := gjson.Get(w.Body.String(), "id").Int()
+	w = postJSON(fmt.Sprintf(`{"user_id":%d,"role":"admin"}`, deputy.ID), fmt.Sprintf("/api/workspaces/%d/members", wsID), hostToken)
+	require.Equal(t, http.StatusCreated, w.Code)
+
+	// The deputy invites while still an admin ...
+	w = postJSON(fmt.Sprintf(`{"email":"guest@example.com","role":"member","workspace_id":%d}`, wsID), "/api/invitations", deputyToken)
+	require.Equal(t, http.StatusCreated, w.Code)
+	guestInvite := sentMail.lastTokenTo(t, "guest@example.com")
+	w = postJSON(fmt.Sprintf(`{"email":"newbie@example.com","role":"member","workspace_id":%d}`, wsID), "/api/invitations", deputyToken)
+	require.Equal(t, http.StatusCreated, w.Code)
+	newbieInvite := sentMail.lastTokenTo(t, "newbie@example.com")
+
+	// ... and is demoted before the invitations are accepted
+	w = sendJSON("PUT", `{"role":"member"}`, fmt.Sprintf("/api/workspaces/%d/members/%d", wsID, deputy.ID), hostToken)
+	require.Equal(t, http.StatusNoContent, w.Code)
+
+	assert.Equal(t, http.StatusBadRequest, postJSON(`{"token":"`+guestInvite+`"}`, "/api/invitations/accept", guestToken).Code)
+	assert.Equal(t, http.StatusBadRequest, postJSON(`{"token":"`+newbieInvite+`","password":"newpass123"}`, "/auth/invitations/accept", "").Code)
+	members, err := testRepos.Workspaces.ListMembers(context.Background(), uint(wsID))
+	require.NoError(t, err)
+	assert.Len(t, members, 2)
+	u, err := testRepos.Users.GetByEmail(context.Background(), "newbie@example.com")
+	require.NoError(t, err)
+	assert.Nil(t, u)
+}
@@ -0,0 +1,95 @@
+package tests
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tidwall/gjson"
+
+	"github.com/ahmadjafari86/go-todo-list/internal/service"
+)
+
+func writePKCS8(t *testing.T, dir, name string, key interface{}) string {
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	require.NoError(t, err)
+	path := filepath.Join(dir, name+".pem")
+	require.NoError(t, os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), 0o600))
+	return path
+}
+
+func getWithToken(path, token string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", path, nil)
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	routerAuth.ServeHTTP(w, req)
+	return w
+}
+
+func TestAsymmetricSigningAndKeyRotation(t *testing.T) {
+	setupAuthDB(t)
+
+	dir := t.TempDir()
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	files := []string{writePKCS8(t, dir, "rsa-old", rsaKey), writePKCS8(t, dir, "ed-new", edKey)}
+
+	oldKeys, err := service.LoadKeySet(files, "rsa-old")
+	require.NoError(t, err)
+	setupAuthRouterWithKeys(oldKeys)
+
+	registerUser(t, "rotate@example.com", "pass1234")
+	oldToken := loginUserAndGetToken(t, "rotate@example.com", "pass1234")
+	parsed, _, err := jwt.NewParser().ParseUnverified(oldToken, &jwt.RegisteredClaims{})
+	require.NoError(t, err)
+	assert.Equal(t, "rsa-old", parsed.Header["kid"])
+	assert.Equal(t, "RS256", parsed.Header["alg"])
+
+	// Rotate: the new key signs, the old one still verifies
+	newKeys, err := service.LoadKeySet(files, "ed-new")
+	require.NoError(t, err)
+	setupAuthRouterWithKeys(newKeys)
+
+	assert.Equal(t, http.StatusOK, getWithToken("/api/todos", oldToken).Code)
+	newToken := loginUserAndGetToken(t, "rotate@example.com", "pass1234")
+
+	// Other services verify with the published key
+	w := getWithToken("/.well-known/jwks.json", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	keys := gjson.Get(w.Body.String(), "keys").Array()
+	assert.Len(t, keys, 2)
+	x := gjson.Get(w.Body.String(), `keys.#(kid=="ed-new").x`).String()
+	pub, err := base64.RawURLEncoding.DecodeString(x)
+	require.NoError(t, err)
+	claims := &jwt.RegisteredClaims{}
+	_, err = jwt.ParseWithClaims(newToken, claims, func(*jwt.Token) (interface{}, error) {
+		return ed25519.PublicKey(pub), nil
+	}, jwt.WithValidMethods([]string{"EdDSA"}), jwt.WithIssuer("todo-api"), jwt.WithAudience("todo-api"))
+	assert.NoError(t, err)
+
+	// A validly signed token for another audience is rejected
+	foreign := jwt.NewWithClaims(jwt.SigningMethodEdDSA, jwt.MapClaims{
+		"iss": "todo-api", "aud": "billing", "sub": claims.Subject, "typ": "access",
+		"exp": time.Now().Add(time.Minute).Unix(),
+	})
+	foreign.Header["kid"] = "ed-new"
+	foreignStr, err := foreign.SignedString(edKey)
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusUnauthorized, getWithToken("/api/todos", foreignStr).Code)
+}
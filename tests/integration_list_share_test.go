@@ -0,0 +1,74 @@
+package tests
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tidwall/gjson"
+)
+
+func TestListSharingGrantsPerUserPermissions(t *testing.T) {
+	setupAuthDB(t)
+	setupAuthRouter()
+
+	registerUser(t, "alice@example.com", "pass1234")
+	registerUser(t, "bob@example.com", "pass1234")
+	aliceToken := loginUserAndGetToken(t, "alice@example.com", "pass1234")
+	bobToken := loginUserAndGetToken(t, "bob@example.com", "pass1234")
+	bob, _ := testRepos.Users.GetByEmail(context.Background(), "bob@example.com")
+
+	w := postJSON(`{"name":"Groceries"}`, "/api/lists", aliceToken)
+	assert.Equal(t, http.StatusCreated, w.Code)
+	listID := gjson.Get(w.Body.String(), "id").Int()
+	w = postJSON(fmt.Sprintf(`{"title":"Milk","list_id":%d}`, listID), "/api/todos", aliceToken)
+	assert.Equal(t, http.StatusCreated, w.Code)
+	milkID := gjson.Get(w.Body.String(), "id").Int()
+	postJSON(`{"title":"Not shared"}`, "/api/todos", aliceToken)
+
+	// Before sharing bob sees nothing
+	assert.Equal(t, http.StatusNotFound, getWithToken(fmt.Sprintf("/api/todos/%d", milkID), bobToken).Code)
+	sharesPath := fmt.Sprintf("/api/lists/%d/shares", listID)
+	assert.Equal(t, http.StatusNotFound, postJSON(fmt.Sprintf(`{"user_id":%d,"permission":"admin"}`, bob.ID), sharesPath, bobToken).Code)
+
+	// View permission: read only
+	w = postJSON(fmt.Sprintf(`{"user_id":%d,"permission":"view"}`, bob.ID), sharesPath, aliceToken)
+	assert.Equal(t, http.StatusCreated, w.Code)
+	w = getWithToken("/api/lists/shared", bobToken)
+	assert.Equal(t, "Groceries", gjson.Get(w.Body.String(), "0.name").String())
+	assert.Equal(t, "view", gjson.Get(w.Body.String(), "0.permission").String())
+	body := getWithToken("/api/todos", bobToken).Body.String()
+	assert.Contains(t, body, "Milk")
+	assert.NotContains(t, body, "Not shared")
+	milkPath := fmt.Sprintf("/api/todos/%d", milkID)
+	assert.Equal(t, http.StatusOK, getWithToken(milkPath, bobToken).Code)
+	assert.Equal(t, http.StatusForbidden, sendJSON("PUT", `{"title":"Oat milk"}`, milkPath, bobToken).Code)
+	assert.Equal(t, http.StatusForbidden, sendJSON("PATCH", "", milkPath+"/complete", bobToken).Code)
+	assert.Equal(t, http.StatusForbidden, sendJSON("DELETE", "", milkPath, bobToken).Code)
+	assert.Equal(t, http.StatusForbidden, postJSON(fmt.Sprintf(`{"title":"Eggs","list_id":%d}`, listID), "/api/todos", bobToken).Code)
+	assert.Equal(t, http.StatusForbidden, getWithToken(sharesPath, bobToken).Code)
+
+	// Edit permission: can change todos but not the shares
+	sharePath := fmt.Sprintf("%s/%d", sharesPath, bob.ID)
+	assert.Equal(t, http.StatusNoContent, sendJSON("PUT", `{"permission":"edit"}`, sharePath, aliceToken).Code)
+	w = sendJSON("PUT", `{"title":"Oat milk"}`, milkPath, bobToken)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, http.StatusOK, sendJSON("PATCH", "", milkPath+"/complete", bobToken).Code)
+	assert.Equal(t, http.StatusCreated, postJSON(fmt.Sprintf(`{"title":"Eggs","list_id":%d}`, listID), "/api/todos", bobToken).Code)
+	assert.Equal(t, http.StatusForbidden, sendJSON("PUT", `{"permission":"admin"}`, sharePath, bobToken).Code)
+	w = getWithToken(sharesPath, bobToken)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "edit", gjson.Get(w.Body.String(), "0.permission").String())
+
+	w = getWithToken(milkPath, aliceToken)
+	assert.Equal(t, "Oat milk", gjson.Get(w.Body.String(), "title").String())
+	assert.True(t, gjson.Get(w.Body.String(), "completed").Bool())
+
+	// Revoking removes all access
+	assert.Equal(t, http.StatusNoContent, sendJSON("DELETE", "", sharePath, aliceToken).Code)
+	assert.Equal(t, http.StatusNotFound, getWithToken(milkPath, bobToken).Code)
+	assert.Equal(t, http.StatusNotFound, sendJSON("DELETE", "", milkPath, bobToken).Code)
+	assert.Equal(t, "[]", getWithToken("/api/lists/shared", bobToken).Body.String())
+}
@@ -0,0 +1,110 @@
+package tests
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tidwall/gjson"
+
+	"github.com/ahmadjafari86/go-todo-list/internal/models"
+	"github.com/ahmadjafari86/go-todo-list/internal/repository"
+)
+
+func TestLoginLockoutAfterRepeatedFailures(t *testing.T) {
+	setupAuthDB(t)
+	setupAuthRouter()
+
+	registerUser(t, "locked@example.com", "pass1234")
+
+	// A success in between resets the account counter
+	for i := 0; i < 2; i++ {
+		w := postJSON(`{"email":"locked@example.com","password":"wrong-pass"}`, "/auth/login", "")
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+	}
+	loginUserAndGetToken(t, "locked@example.com", "pass1234")
+
+	for i := 0; i < 3; i++ {
+		w := postJSON(`{"email":"locked@example.com","password":"wrong-pass"}`, "/auth/login", "")
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+	}
+
+	// Locked out even with the right password
+	w := postJSON(`{"email":"locked@example.com","password":"pass1234"}`, "/auth/login", "")
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.Equal(t, "60", w.Header().Get("Retry-After"))
+	assert.Equal(t, "application/problem+json", w.Header().Get("Content-Type"))
+	assert.Equal(t, int64(429), gjson.Get(w.Body.String(), "status").Int())
+
+	// Other accounts from the same client are unaffected
+	registerUser(t, "other@example.com", "pass1234")
+	loginUserAndGetToken(t, "other@example.com", "pass1234")
+}
+
+// postJSONFrom posts like postJSON from the given client address.
+func postJSONFrom(body, path, remoteAddr string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", path, strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	req.RemoteAddr = remoteAddr
+	routerAuth.ServeHTTP(w, req)
+	return w
+}
+
+func TestMFACodeGuessesLockTheAccount(t *testing.T) {
+	setupAuthDB(t)
+	setupAuthRouter()
+
+	registerUser(t, "mfa@example.com", "pass1234")
+	token := loginUserAndGetToken(t, "mfa@example.com", "pass1234")
+	secret := gjson.Get(postJSON(`{}`, "/api/me/mfa/totp", token).Body.String(), "secret").String()
+	w := postJSON(`{"code":"`+totpNow(t, secret)+`"}`, "/api/me/mfa/totp/confirm", token)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	// The password step does not clear earlier failures ...
+	for i := 0; i < 2; i++ {
+		w = postJSON(`{"email":"mfa@example.com","password":"wrong-pass"}`, "/auth/login", "")
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+	}
+	w = postJSON(`{"email":"mfa@example.com","password":"pass1234"}`, "/auth/login", "")
+	challenge := gjson.Get(w.Body.String(), "mfa_token").String()
+	assert.NotEmpty(t, challenge)
+
+	// ... and wrong codes count against the account whatever the client address
+	w = postJSONFrom(`{"mfa_token":"`+challenge+`","code":"000000"}`, "/auth/login/mfa", "192.0.2.1:1234")
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	for i := 2; i < 5; i++ {
+		w = postJSONFrom(`{"mfa_token":"`+challenge+`","code":"`+totpNow(t, secret)+`"}`, "/auth/login/mfa", fmt.Sprintf("192.0.2.%d:1234", i))
+		assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	}
+}
+
+// unreachableUsers fails every lookup by email, like a database that is down.
+type unreachableUsers struct {
+	repository.UserRepository
+}
+
+func (unreachableUsers) GetByEmail(context.Context, string) (*models.User, error) {
+	return nil, errors.New("dial tcp 10.0.0.5:5432: connection refused")
+}
+
+func TestLoginStoreFailuresAreServerErrors(t *testing.T) {
+	setupAuthDB(t)
+	setupAuthRouter()
+	registerUser(t, "unlucky@example.com", "pass1234")
+
+	testRepos.Users = unreachableUsers{testRepos.Users}
+	setupAuthRouter()
+	w := postJSON(`{"email":"unlucky@example.com","password":"pass1234"}`, "/auth/login", "")
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+	assert.NotEqual(t, "Invalid Credentials", gjson.Get(w.Body.String(), "title").String())
+
+	// a forged challenge is still the client's mistake
+	w = postJSON(`{"mfa_token":"forged","code":"123456"}`, "/auth/login/mfa", "")
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+}
@@ -0,0 +1,99 @@
+package tests
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tidwall/gjson"
+
+	"github.com/ahmadjafari86/go-todo-list/internal/service"
+)
+
+// requestMagicLink asks for a login link and returns the browser's nonce cookie.
+func requestMagicLink(t *testing.T, email string) *http.Cookie {
+	w := postJSON(`{"email":"`+email+`"}`, "/auth/magic-link", "")
+	require.Equal(t, http.StatusAccepted, w.Code)
+	for _, c := range w.Result().Cookies() {
+		if c.Name == "magic_link" {
+			return c
+		}
+	}
+	t.Fatal("no nonce cookie set")
+	return nil
+}
+
+func magicLinkCallback(token string, cookie *http.Cookie) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/auth/magic-link/callback?token="+url.QueryEscape(token), nil)
+	if cookie != nil {
+		req.AddCookie(cookie)
+	}
+	routerAuth.ServeHTTP(w, req)
+	return w
+}
+
+func TestMagicLinkLoginIsBoundToBrowserAndSingleUse(t *testing.T) {
+	setupAuthDB(t)
+	setupAuthRouter()
+	registerUser(t, "forgetful@example.com", "pass1234")
+
+	browser := requestMagicLink(t, "forgetful@example.com")
+	token := sentMail.lastTokenTo(t, "forgetful@example.com")
+
+	// The link does not work without the requesting browser's nonce
+	assert.Equal(t, http.StatusBadRequest, magicLinkCallback(token, nil).Code)
+	other := requestMagicLink(t, "someone-else@example.com")
+	assert.Equal(t, http.StatusUnauthorized, magicLinkCallback(token, other).Code)
+
+	w := magicLinkCallback(token, browser)
+	assert.Equal(t, http.StatusOK, w.Code)
+	jwt := gjson.Get(w.Body.String(), "token").String()
+	assert.Equal(t, http.StatusOK, getWithToken("/api/todos", jwt).Code)
+
+	// Links are single use
+	assert.Equal(t, http.StatusUnauthorized, magicLinkCallback(token, browser).Code)
+
+	// Unknown addresses get the same response but no email
+	sentMail.mu.Lock()
+	for _, m := range sentMail.sent {
+		assert.False(t, strings.Contains(m.To, "someone-else"))
+	}
+	sentMail.mu.Unlock()
+
+	// Requests are rate limited per address
+	requestMagicLink(t, "forgetful@example.com")
+	requestMagicLink(t, "forgetful@example.com")
+	w = postJSON(`{"email":"Forgetful@example.com"}`, "/auth/magic-link", "")
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.NotEmpty(t, w.Header().Get("Retry-After"))
+}
+
+func TestLoginCookiesFollowThePublicURL(t *testing.T) {
+	setupAuthDB(t)
+	mock := newMockOIDCIssuer(t)
+	oidcProviders = []service.OIDCProvider{mock.provider()}
+	publicURL = "https://todo.example.com/app/"
+	t.Cleanup(func() { oidcProviders, publicURL = nil, "http://localhost" })
+	setupAuthRouter()
+
+	// Behind a proxy the request says neither the host nor the /app prefix
+	nonce := requestMagicLink(t, "nobody@example.com")
+	assert.Equal(t, "todo.example.com", nonce.Domain)
+	assert.Equal(t, "/app/auth/magic-link", nonce.Path)
+	assert.True(t, nonce.Secure)
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/auth/oidc/mock/login", nil)
+	routerAuth.ServeHTTP(w, req)
+	require.Equal(t, http.StatusFound, w.Code)
+	cookies := w.Result().Cookies()
+	require.Len(t, cookies, 1)
+	assert.Equal(t, "todo.example.com", cookies[0].Domain)
+	assert.Equal(t, "/app/auth/oidc/mock", cookies[0].Path)
+	assert.True(t, cookies[0].Secure)
+}
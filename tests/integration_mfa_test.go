@@ -0,0 +1,167 @@
+package tests
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/base32"
+	"encoding/binary"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tidwall/gjson"
+
+	"github.com/ahmadjafari86/go-todo-list/internal/models"
+	"github.com/ahmadjafari86/go-todo-list/internal/repository"
+	"github.com/ahmadjafari86/go-todo-list/internal/service"
+)
+
+func totpNow(t *testing.T, secret string) string {
+	key, err := base32.StdEncoding.WithPadding(base32.NoPadding).DecodeString(secret)
+	assert.NoError(t, err)
+	var msg [8]byte
+	binary.BigEndian.PutUint64(msg[:], uint64(time.Now().Unix()/30))
+	mac := hmac.New(sha1.New, key)
+	mac.Write(msg[:])
+	sum := mac.Sum(nil)
+	off := sum[len(sum)-1] & 0x0f
+	return fmt.Sprintf("%06d", (binary.BigEndian.Uint32(sum[off:off+4])&0x7fffffff)%1000000)
+}
+
+func postJSON(body, path, token string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", path, strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	routerAuth.ServeHTTP(w, req)
+	return w
+}
+
+func TestTOTPEnrollmentAndTwoStepLogin(t *testing.T) {
+	setupAuthDB(t)
+	setupAuthRouter()
+
+	registerUser(t, "mfa@example.com", "pass1234")
+	token := loginUserAndGetToken(t, "mfa@example.com", "pass1234")
+
+	w := postJSON(`{}`, "/api/me/mfa/totp", token)
+	assert.Equal(t, http.StatusOK, w.Code)
+	secret := gjson.Get(w.Body.String(), "secret").String()
+	assert.True(t, strings.HasPrefix(gjson.Get(w.Body.String(), "otpauth_uri").String(), "otpauth://totp/"))
+
+	w = postJSON(`{"code":"000000"}`, "/api/me/mfa/totp/confirm", token)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	w = postJSON(`{"code":"`+totpNow(t, secret)+`"}`, "/api/me/mfa/totp/confirm", token)
+	assert.Equal(t, http.StatusOK, w.Code)
+	codes := gjson.Get(w.Body.String(), "recovery_codes").Array()
+	assert.Len(t, codes, 10)
+
+	// Password alone now only yields a challenge
+	w = postJSON(`{"email":"mfa@example.com","password":"pass1234"}`, "/auth/login", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.False(t, gjson.Get(w.Body.String(), "token").Exists())
+	challenge := gjson.Get(w.Body.String(), "mfa_token").String()
+	assert.NotEmpty(t, challenge)
+
+	// The challenge is not an access token
+	w = postJSON(`{"title":"x"}`, "/api/todos", challenge)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	w = postJSON(`{"mfa_token":"`+challenge+`","code":"`+codes[0].String()+`"}`, "/auth/login/mfa", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.NotEmpty(t, gjson.Get(w.Body.String(), "token").String())
+
+	// Recovery codes are single use
+	w = postJSON(`{"mfa_token":"`+challenge+`","code":"`+codes[0].String()+`"}`, "/auth/login/mfa", "")
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+}
+
+func TestConcurrentLoginsCannotReuseATOTPCode(t *testing.T) {
+	forEachRepositoryImplementation(t, func(t *testing.T, repos *repository.Repositories) {
+		ctx := context.Background()
+		owner := createTestUser(t, repos, "mfa@example.com")
+		mfa := service.NewMFAService(repos.Users, repos.RecoveryCodes, "Todo API")
+		secret, _, err := mfa.BeginTOTPEnrollment(ctx, owner.ID)
+		require.NoError(t, err)
+		u, err := repos.Users.GetByID(ctx, owner.ID)
+		require.NoError(t, err)
+		u.TOTPEnabled = true
+		require.NoError(t, repos.Users.Update(ctx, u))
+
+		// every login loaded the user before any of them recorded the code
+		code := totpNow(t, secret)
+		errs := make([]error, 8)
+		var wg sync.WaitGroup
+		for i := range errs {
+			loaded := *u
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				errs[i] = mfa.Verify(ctx, &loaded, code)
+			}()
+		}
+		wg.Wait()
+		accepted := 0
+		for _, err := range errs {
+			if err == nil {
+				accepted++
+			} else {
+				assert.ErrorIs(t, err, service.ErrInvalidMFACode)
+			}
+		}
+		assert.Equal(t, 1, accepted)
+	})
+}
+
+// racingUsers runs meanwhile after every GetByID, as if another request wrote the
+// user between a service's read and its write.
+type racingUsers struct {
+	repository.UserRepository
+	meanwhile func(ctx context.Context, id uint)
+}
+
+func (r racingUsers) GetByID(ctx context.Context, id uint) (*models.User, error) {
+	u, err := r.UserRepository.GetByID(ctx, id)
+	if err == nil && u != nil {
+		r.meanwhile(ctx, id)
+	}
+	return u, err
+}
+
+func TestTOTPChangesKeepConcurrentUserWrites(t *testing.T) {
+	forEachRepositoryImplementation(t, func(t *testing.T, repos *repository.Repositories) {
+		ctx := context.Background()
+		owner := createTestUser(t, repos, "busy@example.com")
+		hashes := 0
+		users := racingUsers{UserRepository: repos.Users, meanwhile: func(ctx context.Context, id uint) {
+			hashes++
+			require.NoError(t, repos.Users.UpdatePasswordHash(ctx, id, fmt.Sprintf("hash-%d", hashes)))
+		}}
+		mfa := service.NewMFAService(users, repos.RecoveryCodes, "Todo API")
+
+		secret, _, err := mfa.BeginTOTPEnrollment(ctx, owner.ID)
+		require.NoError(t, err)
+		codes, err := mfa.ConfirmTOTPEnrollment(ctx, owner.ID, totpNow(t, secret))
+		require.NoError(t, err)
+		u, err := repos.Users.GetByID(ctx, owner.ID)
+		require.NoError(t, err)
+		assert.True(t, u.TOTPEnabled)
+		assert.Equal(t, fmt.Sprintf("hash-%d", hashes), u.PasswordHash)
+
+		require.NoError(t, mfa.DisableTOTP(ctx, owner.ID, codes[0]))
+		u, err = repos.Users.GetByID(ctx, owner.ID)
+		require.NoError(t, err)
+		assert.False(t, u.TOTPEnabled)
+		assert.Equal(t, fmt.Sprintf("hash-%d", hashes), u.PasswordHash)
+	})
+}
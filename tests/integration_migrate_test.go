@@ -0,0 +1,174 @@
+package tests
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+
+	appdb "github.com/ahmadjafari86/go-todo-list/internal/db"
+	"github.com/ahmadjafari86/go-todo-list/internal/models"
+)
+
+// schemaModels are every model the repositories read and write.
+var schemaModels = []interface{}{
+	&models.User{}, &models.Todo{}, &models.TodoRevision{}, &models.PersonalAccessToken{}, &models.RecoveryCode{}, &models.LoginAttempt{},
+	&models.UserIdentity{}, &models.Workspace{}, &models.Membership{}, &models.TodoList{}, &models.ListShare{},
+	&models.Invitation{}, &models.Session{}, &models.MagicLink{}, &models.PasswordReset{},
+	&models.OAuthClient{}, &models.OAuthAuthorization{}, &models.OAuthCode{}, &models.OAuthToken{},
+	&models.TodoCacheInvalidation{}, &models.DataKey{},
+}
+
+func TestMigrationsMatchModels(t *testing.T) {
+	requireDatabase(t)
+	setupAuthDB(t)
+
+	m := dbAuth.Migrator()
+	for _, model := range schemaModels {
+		stmt := &gorm.Statement{DB: dbAuth}
+		require.NoError(t, stmt.Parse(model))
+		table := stmt.Schema.Table
+		assert.True(t, m.HasTable(table), "table %s", table)
+		for _, field := range stmt.Schema.Fields {
+			if field.DBName == "" {
+				continue
+			}
+			assert.True(t, m.HasColumn(model, field.DBName), "column %s.%s", table, field.DBName)
+		}
+		for _, idx := range stmt.Schema.ParseIndexes() {
+			assert.True(t, m.HasIndex(model, idx.Name), "index %s on %s", idx.Name, table)
+		}
+	}
+	assert.True(t, m.HasConstraint(&models.Todo{}, "fk_todos_owner"))
+	assert.True(t, m.HasConstraint(&models.TodoRevision{}, "fk_todo_revisions_todo"))
+	assert.True(t, m.HasConstraint(&models.DataKey{}, "fk_data_keys_user"))
+}
+
+func TestMigrateDownAndUpAgain(t *testing.T) {
+	requireDatabase(t)
+	setupAuthDB(t)
+	migrator, err := appdb.NewMigrator(dbAuth)
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	statuses, err := migrator.Status(ctx)
+	require.NoError(t, err)
+	require.NotEmpty(t, statuses)
+	for _, s := range statuses {
+		assert.NotNil(t, s.AppliedAt, "migration %d", s.Version)
+	}
+
+	// already up to date
+	n, err := migrator.Up(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 0, n)
+
+	n, err = migrator.Down(ctx, math.MaxInt)
+	require.NoError(t, err)
+	assert.Equal(t, len(statuses), n)
+	assert.False(t, dbAuth.Migrator().HasTable("todos"))
+	statuses, _ = migrator.Status(ctx)
+	assert.Nil(t, statuses[0].AppliedAt)
+
+	n, err = migrator.Up(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, len(statuses), n)
+	assert.True(t, dbAuth.Migrator().HasTable("todos"))
+}
+
+func TestConcurrentMigrationsApplyOnce(t *testing.T) {
+	requireDatabase(t)
+	setupAuthDB(t)
+	ctx := context.Background()
+	migrator, err := appdb.NewMigrator(dbAuth)
+	require.NoError(t, err)
+	total, err := migrator.Down(ctx, math.MaxInt)
+	require.NoError(t, err)
+
+	// replicas booting together must not apply a migration twice
+	var wg sync.WaitGroup
+	applied := make([]int, 4)
+	errs := make([]error, 4)
+	for i := range applied {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			m, _ := appdb.NewMigrator(dbAuth)
+			applied[i], errs[i] = m.Up(ctx)
+		}(i)
+	}
+	wg.Wait()
+
+	sum := 0
+	for i := range applied {
+		assert.NoError(t, errs[i])
+		sum += applied[i]
+	}
+	assert.Equal(t, total, sum)
+	var rows int64
+	dbAuth.Table("schema_migrations").Count(&rows)
+	assert.Equal(t, int64(total), rows)
+}
+
+func TestDownRefusesUnknownMigrations(t *testing.T) {
+	requireDatabase(t)
+	setupAuthDB(t)
+	ctx := context.Background()
+	require.NoError(t, dbAuth.Exec("INSERT INTO schema_migrations (version, name, applied_at) VALUES (?, ?, ?)", 99999, "from_a_newer_build", time.Now()).Error)
+
+	migrator, _ := appdb.NewMigrator(dbAuth)
+	_, err := migrator.Down(ctx, 1)
+	assert.ErrorIs(t, err, appdb.ErrUnknownMigration)
+	assert.True(t, dbAuth.Migrator().HasTable("todos"))
+
+	statuses, err := migrator.Status(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, int64(99999), statuses[len(statuses)-1].Version)
+}
+
+func TestCreateMigrationNumbersFilesForEveryDatabase(t *testing.T) {
+	root := t.TempDir()
+	paths, err := appdb.CreateMigration(root, "Add due dates")
+	require.NoError(t, err)
+	assert.Equal(t, []string{
+		filepath.Join(root, "postgres", "0001_add_due_dates.up.sql"),
+		filepath.Join(root, "postgres", "0001_add_due_dates.down.sql"),
+		filepath.Join(root, "sqlite", "0001_add_due_dates.up.sql"),
+		filepath.Join(root, "sqlite", "0001_add_due_dates.down.sql"),
+	}, paths)
+
+	// the next version follows the highest one in any dialect
+	require.NoError(t, os.WriteFile(filepath.Join(root, "sqlite", "0005_manual.up.sql"), []byte("--"), 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(root, "sqlite", "0005_manual.down.sql"), []byte("--"), 0o644))
+	paths, err = appdb.CreateMigration(root, "index titles")
+	require.NoError(t, err)
+	assert.Equal(t, filepath.Join(root, "postgres", "0006_index_titles.up.sql"), paths[0])
+
+	migrations, err := appdb.LoadMigrations(os.DirFS(filepath.Join(root, "postgres")))
+	require.NoError(t, err)
+	assert.Len(t, migrations, 2)
+}
+
+func TestEmbeddedMigrationsMatchAcrossDatabases(t *testing.T) {
+	var versions [][]string
+	for _, dialect := range []string{appdb.DialectPostgres, appdb.DialectSQLite} {
+		fsys, err := appdb.Migrations(dialect)
+		require.NoError(t, err)
+		migrations, err := appdb.LoadMigrations(fsys)
+		require.NoError(t, err)
+		var names []string
+		for _, m := range migrations {
+			names = append(names, fmt.Sprintf("%04d_%s", m.Version, m.Name))
+		}
+		versions = append(versions, names)
+	}
+	assert.Equal(t, versions[0], versions[1], "every migration needs a postgres and a sqlite version")
+}
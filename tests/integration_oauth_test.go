@@ -0,0 +1,219 @@
+package tests
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tidwall/gjson"
+)
+
+const (
+	bridgeRedirect = "https://bridge.example.com/callback"
+	pkceVerifier   = "dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk-long-enough"
+)
+
+func pkceChallenge(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+func postForm(form url.Values, path, user, pass string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", path, strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	if user != "" {
+		req.SetBasicAuth(user, pass)
+	}
+	routerAuth.ServeHTTP(w, req)
+	return w
+}
+
+// authorizeBridge approves the client for the user and returns the authorization code.
+func authorizeBridge(t *testing.T, token, clientID, scope string) string {
+	body := fmt.Sprintf(`{"response_type":"code","client_id":%q,"redirect_uri":%q,"scope":%q,"state":"xyz","code_challenge":%q,"code_challenge_method":"S256","approve":true}`,
+		clientID, bridgeRedirect, scope, pkceChallenge(pkceVerifier))
+	w := postJSON(body, "/api/oauth/authorize", token)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	u, err := url.Parse(gjson.Get(w.Body.String(), "redirect_to").String())
+	require.NoError(t, err)
+	assert.Equal(t, "xyz", u.Query().Get("state"))
+	return u.Query().Get("code")
+}
+
+func exchangeCode(clientID, secret, code, verifier string) *httptest.ResponseRecorder {
+	return postForm(url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {bridgeRedirect},
+		"code_verifier": {verifier},
+	}, "/oauth/token", clientID, secret)
+}
+
+func TestOAuthAuthorizationCodeFlow(t *testing.T) {
+	setupAuthDB(t)
+	setupAuthRouter()
+
+	registerUser(t, "dev@example.com", "pass1234")
+	registerUser(t, "owner@example.com", "pass1234")
+	devToken := loginUserAndGetToken(t, "dev@example.com", "pass1234")
+	userToken := loginUserAndGetToken(t, "owner@example.com", "pass1234")
+	postJSON(`{"title":"sync me"}`, "/api/todos", userToken)
+
+	// The developer registers a confidential client
+	w := postJSON(`{"name":"Calendar Bridge","redirect_uris":["`+bridgeRedirect+`"],"scopes":["todos:read"],"confidential":true}`, "/api/oauth/clients", devToken)
+	require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+	clientID := gjson.Get(w.Body.String(), "client.client_id").String()
+	secret := gjson.Get(w.Body.String(), "client_secret").String()
+	assert.NotEmpty(t, secret)
+
+	// The consent screen describes the request; unregistered redirect URIs are refused outright
+	query := url.Values{
+		"response_type": {"code"}, "client_id": {clientID}, "redirect_uri": {bridgeRedirect},
+		"code_challenge": {pkceChallenge(pkceVerifier)}, "code_challenge_method": {"S256"},
+	}
+	w = getWithToken("/api/oauth/authorize?"+query.Encode(), userToken)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "Calendar Bridge", gjson.Get(w.Body.String(), "client.name").String())
+	assert.Equal(t, "todos:read", gjson.Get(w.Body.String(), "scopes.0").String())
+	assert.False(t, gjson.Get(w.Body.String(), "authorized").Bool())
+	query.Set("redirect_uri", "https://evil.example.com/cb")
+	assert.Equal(t, http.StatusBadRequest, getWithToken("/api/oauth/authorize?"+query.Encode(), userToken).Code)
+
+	// Scopes beyond the client's registration and missing PKCE are reported to the client
+	w = postJSON(`{"response_type":"code","client_id":"`+clientID+`","redirect_uri":"`+bridgeRedirect+`","scope":"todos:write","code_challenge":"x","code_challenge_method":"S256","approve":true}`, "/api/oauth/authorize", userToken)
+	assert.Contains(t, gjson.Get(w.Body.String(), "redirect_to").String(), "error=invalid_scope")
+	w = postJSON(`{"response_type":"code","client_id":"`+clientID+`","redirect_uri":"`+bridgeRedirect+`","approve":true}`, "/api/oauth/authorize", userToken)
+	assert.Contains(t, gjson.Get(w.Body.String(), "redirect_to").String(), "error=invalid_request")
+
+	// Denying consent sends the user back with access_denied
+	w = postJSON(`{"response_type":"code","client_id":"`+clientID+`","redirect_uri":"`+bridgeRedirect+`","state":"s1","code_challenge":"x","code_challenge_method":"S256","approve":false}`, "/api/oauth/authorize", userToken)
+	assert.Equal(t, bridgeRedirect+"?error=access_denied&state=s1", gjson.Get(w.Body.String(), "redirect_to").String())
+
+	code := authorizeBridge(t, userToken, clientID, "todos:read")
+	assert.NotEmpty(t, code)
+
+	// The client must authenticate and prove possession of the PKCE verifier
+	w = exchangeCode(clientID, "wrong-secret", code, pkceVerifier)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	assert.Equal(t, "invalid_client", gjson.Get(w.Body.String(), "error").String())
+	w = exchangeCode(clientID, secret, code, strings.Repeat("a", 43))
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Equal(t, "invalid_grant", gjson.Get(w.Body.String(), "error").String())
+
+	w = exchangeCode(clientID, secret, code, pkceVerifier)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.Equal(t, "no-store", w.Header().Get("Cache-Control"))
+	assert.Equal(t, "Bearer", gjson.Get(w.Body.String(), "token_type").String())
+	assert.Equal(t, "todos:read", gjson.Get(w.Body.String(), "scope").String())
+	access := gjson.Get(w.Body.String(), "access_token").String()
+	refresh := gjson.Get(w.Body.String(), "refresh_token").String()
+
+	// The access token acts for the user within its scopes only
+	w = getWithToken("/api/todos", access)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "sync me", gjson.Get(w.Body.String(), "0.title").String())
+	assert.Equal(t, http.StatusForbidden, postJSON(`{"title":"nope"}`, "/api/todos", access).Code)
+	assert.Equal(t, http.StatusForbidden, getWithToken("/api/me/authorized-apps", access).Code)
+
+	// Refreshing rotates the pair; replaying a refresh token revokes the grant
+	w = postForm(url.Values{"grant_type": {"refresh_token"}, "refresh_token": {refresh}}, "/oauth/token", clientID, secret)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	access2 := gjson.Get(w.Body.String(), "access_token").String()
+	assert.Equal(t, http.StatusUnauthorized, getWithToken("/api/todos", access).Code)
+	assert.Equal(t, http.StatusOK, getWithToken("/api/todos", access2).Code)
+
+	w = postForm(url.Values{"grant_type": {"refresh_token"}, "refresh_token": {refresh}}, "/oauth/token", clientID, secret)
+	assert.Equal(t, "invalid_grant", gjson.Get(w.Body.String(), "error").String())
+	assert.Equal(t, http.StatusUnauthorized, getWithToken("/api/todos", access2).Code)
+
+	// Codes are single use
+	assert.Equal(t, "invalid_grant", gjson.Get(exchangeCode(clientID, secret, code, pkceVerifier).Body.String(), "error").String())
+}
+
+func TestOAuthRedirectURISchemesAreRestricted(t *testing.T) {
+	setupAuthDB(t)
+	setupAuthRouter()
+
+	registerUser(t, "dev@example.com", "pass1234")
+	devToken := loginUserAndGetToken(t, "dev@example.com", "pass1234")
+	register := func(uri string) int {
+		return postJSON(`{"name":"App","redirect_uris":["`+uri+`"],"scopes":["todos:read"]}`, "/api/oauth/clients", devToken).Code
+	}
+
+	for _, uri := range []string{
+		"javascript:alert(document.cookie)",
+		"data:text/html,<script>alert(1)</script>",
+		"file:///etc/passwd",
+		"http://bridge.example.com/callback",
+		"ftp://bridge.example.com/callback",
+	} {
+		assert.Equal(t, http.StatusBadRequest, register(uri), uri)
+	}
+	for _, uri := range []string{
+		bridgeRedirect,
+		"http://localhost:8765/callback",
+		"http://127.0.0.1/callback",
+		"http://[::1]:8765/callback",
+		"com.example.bridge:/callback",
+	} {
+		assert.Equal(t, http.StatusCreated, register(uri), uri)
+	}
+}
+
+func TestUsersCanListAndRevokeAuthorizedApps(t *testing.T) {
+	setupAuthDB(t)
+	setupAuthRouter()
+
+	registerUser(t, "dev@example.com", "pass1234")
+	registerUser(t, "owner@example.com", "pass1234")
+	devToken := loginUserAndGetToken(t, "dev@example.com", "pass1234")
+	userToken := loginUserAndGetToken(t, "owner@example.com", "pass1234")
+
+	// A public client relies on PKCE alone
+	w := postJSON(`{"name":"Phone App","redirect_uris":["`+bridgeRedirect+`"],"scopes":["todos:read","todos:write"]}`, "/api/oauth/clients", devToken)
+	require.Equal(t, http.StatusCreated, w.Code)
+	clientID := gjson.Get(w.Body.String(), "client.client_id").String()
+	assert.False(t, gjson.Get(w.Body.String(), "client_secret").Exists())
+
+	code := authorizeBridge(t, userToken, clientID, "")
+	w = postForm(url.Values{
+		"grant_type": {"authorization_code"}, "code": {code}, "redirect_uri": {bridgeRedirect},
+		"code_verifier": {pkceVerifier}, "client_id": {clientID},
+	}, "/oauth/token", "", "")
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.Equal(t, "todos:read todos:write", gjson.Get(w.Body.String(), "scope").String())
+	access := gjson.Get(w.Body.String(), "access_token").String()
+	assert.Equal(t, http.StatusCreated, postJSON(`{"title":"from the app"}`, "/api/todos", access).Code)
+
+	w = getWithToken("/api/me/authorized-apps", userToken)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, int64(1), gjson.Get(w.Body.String(), "#").Int())
+	assert.Equal(t, "Phone App", gjson.Get(w.Body.String(), "0.name").String())
+	appID := gjson.Get(w.Body.String(), "0.id").Int()
+
+	// Apps can only be revoked by the user who authorized them
+	assert.Equal(t, http.StatusNotFound, sendJSON("DELETE", "", fmt.Sprintf("/api/me/authorized-apps/%d", appID), devToken).Code)
+	assert.Equal(t, http.StatusNoContent, sendJSON("DELETE", "", fmt.Sprintf("/api/me/authorized-apps/%d", appID), userToken).Code)
+	assert.Equal(t, http.StatusUnauthorized, getWithToken("/api/todos", access).Code)
+	w = getWithToken("/api/me/authorized-apps", userToken)
+	assert.Equal(t, int64(0), gjson.Get(w.Body.String(), "#").Int())
+
+	// Authorizing again shows the consent screen again
+	query := url.Values{
+		"response_type": {"code"}, "client_id": {clientID}, "redirect_uri": {bridgeRedirect},
+		"code_challenge": {pkceChallenge(pkceVerifier)}, "code_challenge_method": {"S256"},
+	}
+	w = getWithToken("/api/oauth/authorize?"+query.Encode(), userToken)
+	assert.False(t, gjson.Get(w.Body.String(), "authorized").Bool())
+	authorizeBridge(t, userToken, clientID, "todos:read")
+	w = getWithToken("/api/oauth/authorize?"+query.Encode()+"&scope=todos:read", userToken)
+	assert.True(t, gjson.Get(w.Body.String(), "authorized").Bool())
+}
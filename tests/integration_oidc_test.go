@@ -0,0 +1,197 @@
+package tests
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tidwall/gjson"
+
+	"github.com/ahmadjafari86/go-todo-list/internal/service"
+)
+
+type mockOIDCUser struct {
+	Subject       string
+	Email         string
+	EmailVerified bool
+}
+
+type mockAuthorization struct {
+	user      mockOIDCUser
+	nonce     string
+	challenge string
+}
+
+// mockOIDCIssuer is a minimal OpenID Connect provider: discovery, JWKS, an authorize
+// endpoint that immediately approves as the configured user, and a token endpoint that
+// enforces PKCE.
+type mockOIDCIssuer struct {
+	srv          *httptest.Server
+	key          *rsa.PrivateKey
+	clientID     string
+	clientSecret string
+
+	mu    sync.Mutex
+	user  mockOIDCUser
+	codes map[string]mockAuthorization
+}
+
+func newMockOIDCIssuer(t *testing.T) *mockOIDCIssuer {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	m := &mockOIDCIssuer{key: key, clientID: "todo-client", clientSecret: "s3cret", codes: map[string]mockAuthorization{}}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]string{
+			"issuer":                 m.srv.URL,
+			"authorization_endpoint": m.srv.URL + "/authorize",
+			"token_endpoint":         m.srv.URL + "/token",
+			"jwks_uri":               m.srv.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		b64 := base64.RawURLEncoding
+		json.NewEncoder(w).Encode(map[string]interface{}{"keys": []map[string]string{{
+			"kty": "RSA", "kid": "mock", "alg": "RS256", "use": "sig",
+			"n": b64.EncodeToString(key.N.Bytes()),
+			"e": b64.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		}}})
+	})
+	mux.HandleFunc("/authorize", func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		if q.Get("client_id") != m.clientID || q.Get("code_challenge_method") != "S256" {
+			http.Error(w, "bad request", http.StatusBadRequest)
+			return
+		}
+		code := "code-" + q.Get("state")
+		m.mu.Lock()
+		m.codes[code] = mockAuthorization{user: m.user, nonce: q.Get("nonce"), challenge: q.Get("code_challenge")}
+		m.mu.Unlock()
+		http.Redirect(w, r, q.Get("redirect_uri")+"?code="+url.QueryEscape(code)+"&state="+url.QueryEscape(q.Get("state")), http.StatusFound)
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		id, secret, ok := r.BasicAuth()
+		if !ok || id != m.clientID || secret != m.clientSecret {
+			http.Error(w, "invalid_client", http.StatusUnauthorized)
+			return
+		}
+		r.ParseForm()
+		m.mu.Lock()
+		auth, found := m.codes[r.Form.Get("code")]
+		delete(m.codes, r.Form.Get("code"))
+		m.mu.Unlock()
+		sum := sha256.Sum256([]byte(r.Form.Get("code_verifier")))
+		if !found || base64.RawURLEncoding.EncodeToString(sum[:]) != auth.challenge {
+			http.Error(w, "invalid_grant", http.StatusBadRequest)
+			return
+		}
+		tok := jwt.NewWithClaims(jwt.SigningMethodRS256, jwt.MapClaims{
+			"iss": m.srv.URL, "aud": m.clientID, "sub": auth.user.Subject,
+			"email": auth.user.Email, "email_verified": auth.user.EmailVerified,
+			"nonce": auth.nonce, "iat": time.Now().Unix(), "exp": time.Now().Add(time.Minute).Unix(),
+		})
+		tok.Header["kid"] = "mock"
+		signed, _ := tok.SignedString(key)
+		json.NewEncoder(w).Encode(map[string]string{"access_token": "opaque", "token_type": "Bearer", "id_token": signed})
+	})
+	m.srv = httptest.NewServer(mux)
+	t.Cleanup(m.srv.Close)
+	return m
+}
+
+func (m *mockOIDCIssuer) provider() service.OIDCProvider {
+	return service.OIDCProvider{
+		Name:         "mock",
+		Issuer:       m.srv.URL,
+		ClientID:     m.clientID,
+		ClientSecret: m.clientSecret,
+		RedirectURL:  "http://localhost/auth/oidc/mock/callback",
+	}
+}
+
+// oidcLogin drives the browser side of the flow and returns the callback response.
+func oidcLogin(t *testing.T, m *mockOIDCIssuer, user mockOIDCUser, tamperState bool) *httptest.ResponseRecorder {
+	m.mu.Lock()
+	m.user = user
+	m.mu.Unlock()
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/auth/oidc/mock/login", nil)
+	routerAuth.ServeHTTP(w, req)
+	require.Equal(t, http.StatusFound, w.Code)
+	cookies := w.Result().Cookies()
+	require.NotEmpty(t, cookies)
+
+	browser := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }}
+	resp, err := browser.Get(w.Header().Get("Location"))
+	require.NoError(t, err)
+	resp.Body.Close()
+	require.Equal(t, http.StatusFound, resp.StatusCode)
+	back, err := url.Parse(resp.Header.Get("Location"))
+	require.NoError(t, err)
+	if tamperState {
+		q := back.Query()
+		q.Set("state", "forged")
+		back.RawQuery = q.Encode()
+	}
+
+	w2 := httptest.NewRecorder()
+	req2, _ := http.NewRequest("GET", back.RequestURI(), nil)
+	for _, c := range cookies {
+		req2.AddCookie(c)
+	}
+	routerAuth.ServeHTTP(w2, req2)
+	return w2
+}
+
+func TestOIDCLoginProvisionsAndLinksUsers(t *testing.T) {
+	setupAuthDB(t)
+	mock := newMockOIDCIssuer(t)
+	oidcProviders = []service.OIDCProvider{mock.provider()}
+	t.Cleanup(func() { oidcProviders = nil })
+	setupAuthRouter()
+
+	// First login auto-provisions a user
+	w := oidcLogin(t, mock, mockOIDCUser{Subject: "sso-1", Email: "new@corp.example", EmailVerified: true}, false)
+	assert.Equal(t, http.StatusOK, w.Code)
+	ssoToken := gjson.Get(w.Body.String(), "token").String()
+	assert.Equal(t, http.StatusOK, getWithToken("/api/todos", ssoToken).Code)
+
+	// An existing password account is linked by verified email
+	registerUser(t, "pw@corp.example", "pass1234")
+	pwToken := loginUserAndGetToken(t, "pw@corp.example", "pass1234")
+	assert.Equal(t, http.StatusCreated, postJSON(`{"title":"Linked Todo"}`, "/api/todos", pwToken).Code)
+
+	w = oidcLogin(t, mock, mockOIDCUser{Subject: "sso-2", Email: "pw@corp.example", EmailVerified: true}, false)
+	assert.Equal(t, http.StatusOK, w.Code)
+	linked := gjson.Get(w.Body.String(), "token").String()
+	assert.Contains(t, getWithToken("/api/todos", linked).Body.String(), "Linked Todo")
+
+	// Later logins resolve by subject even if the provider email changes
+	w = oidcLogin(t, mock, mockOIDCUser{Subject: "sso-2", Email: "renamed@corp.example", EmailVerified: true}, false)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, getWithToken("/api/todos", gjson.Get(w.Body.String(), "token").String()).Body.String(), "Linked Todo")
+
+	// Unverified emails are never trusted
+	w = oidcLogin(t, mock, mockOIDCUser{Subject: "sso-3", Email: "pw@corp.example", EmailVerified: false}, false)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	// A forged state is rejected before the code is redeemed
+	w = oidcLogin(t, mock, mockOIDCUser{Subject: "sso-1", Email: "new@corp.example", EmailVerified: true}, true)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.True(t, strings.Contains(w.Body.String(), "state mismatch"))
+}
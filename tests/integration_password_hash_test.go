@@ -0,0 +1,76 @@
+package tests
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/bcrypt"
+
+	"github.com/ahmadjafari86/go-todo-list/internal/models"
+	"github.com/ahmadjafari86/go-todo-list/internal/service"
+)
+
+func passwordHashOf(t *testing.T, email string) string {
+	u, err := testRepos.Users.GetByEmail(context.Background(), email)
+	require.NoError(t, err)
+	require.NotNil(t, u)
+	return u.PasswordHash
+}
+
+func TestPasswordsAreHashedWithArgon2id(t *testing.T) {
+	setupAuthDB(t)
+	setupAuthRouter()
+
+	registerUser(t, "modern@example.com", "pass1234")
+	hash := passwordHashOf(t, "modern@example.com")
+	assert.True(t, strings.HasPrefix(hash, "$argon2id$v=19$m=1024,t=2,p=1$"), hash)
+
+	loginUserAndGetToken(t, "modern@example.com", "pass1234")
+	assert.Equal(t, hash, passwordHashOf(t, "modern@example.com"), "current hashes are left alone")
+}
+
+func TestLoginRehashesLegacyPasswordHashes(t *testing.T) {
+	setupAuthDB(t)
+	setupAuthRouter()
+
+	// A user from before argon2id, hashed with bcrypt
+	legacy, _ := bcrypt.GenerateFromPassword([]byte("pass1234"), bcrypt.MinCost)
+	require.NoError(t, testRepos.Users.Create(context.Background(), &models.User{Email: "legacy@example.com", PasswordHash: string(legacy), Role: models.RoleUser}))
+
+	w := postJSON(`{"email":"legacy@example.com","password":"wrong"}`, "/auth/login", "")
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	assert.Equal(t, string(legacy), passwordHashOf(t, "legacy@example.com"), "failed logins do not rehash")
+
+	loginUserAndGetToken(t, "legacy@example.com", "pass1234")
+	upgraded := passwordHashOf(t, "legacy@example.com")
+	assert.True(t, strings.HasPrefix(upgraded, "$argon2id$"), upgraded)
+	loginUserAndGetToken(t, "legacy@example.com", "pass1234")
+
+	// An argon2id hash with weaker parameters is upgraded too
+	weak := service.NewArgon2idHasher(service.Argon2Params{Memory: 512, Iterations: 1, Parallelism: 1, SaltLength: 16, KeyLength: 32})
+	weakHash, err := weak.Hash("pass1234")
+	require.NoError(t, err)
+	legacyUser, _ := testRepos.Users.GetByEmail(context.Background(), "legacy@example.com")
+	require.NoError(t, testRepos.Users.UpdatePasswordHash(context.Background(), legacyUser.ID, weakHash))
+
+	loginUserAndGetToken(t, "legacy@example.com", "pass1234")
+	assert.True(t, strings.HasPrefix(passwordHashOf(t, "legacy@example.com"), "$argon2id$v=19$m=1024,t=2,p=1$"))
+}
+
+func TestArgon2ParametersAreValidated(t *testing.T) {
+	for _, params := range []service.Argon2Params{
+		{Memory: 1024, Iterations: 0, Parallelism: 1, SaltLength: 16, KeyLength: 32},
+		{Memory: 1024, Iterations: 2, Parallelism: 0, SaltLength: 16, KeyLength: 32},
+		{Memory: 64, Iterations: 2, Parallelism: 1, SaltLength: 16, KeyLength: 32},
+		{Memory: 1024, Iterations: 2, Parallelism: 255, SaltLength: 16, KeyLength: 32},
+	} {
+		_, err := service.NewPasswordHasher(service.PasswordHashConfig{Algorithm: service.HashArgon2id, Argon2: params})
+		assert.Error(t, err, "%+v", params)
+	}
+	_, err := service.NewPasswordHasher(service.PasswordHashConfig{Algorithm: service.HashArgon2id, Argon2: service.DefaultArgon2Params})
+	assert.NoError(t, err)
+}
@@ -0,0 +1,170 @@
+package tests
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tidwall/gjson"
+
+	"github.com/ahmadjafari86/go-todo-list/internal/repository"
+	"github.com/ahmadjafari86/go-todo-list/internal/service"
+)
+
+// writeBreachCorpus stores passwords in a temporary corpus in the range format.
+func writeBreachCorpus(t *testing.T, passwords ...string) string {
+	dir := t.TempDir()
+	for _, pw := range passwords {
+		sum := sha1.Sum([]byte(pw))
+		digest := strings.ToUpper(hex.EncodeToString(sum[:]))
+		f, err := os.OpenFile(filepath.Join(dir, digest[:5]+".txt"), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+		require.NoError(t, err)
+		_, err = f.WriteString(digest[5:] + ":42\r\n")
+		require.NoError(t, err)
+		require.NoError(t, f.Close())
+	}
+	return dir
+}
+
+// useStrictPasswordPolicy makes setupAuthRouter enforce a realistic policy for one test.
+func useStrictPasswordPolicy(t *testing.T, breached ...string) {
+	corpus, err := service.NewBreachCorpus(writeBreachCorpus(t, breached...))
+	require.NoError(t, err)
+	prev := testPasswordPolicy
+	testPasswordPolicy = service.PasswordPolicyConfig{MinLength: 10, MinScore: 3, Breached: corpus}
+	t.Cleanup(func() { testPasswordPolicy = prev })
+}
+
+func fieldMessages(body, field string) []string {
+	var out []string
+	for _, e := range gjson.Get(body, "errors").Array() {
+		if e.Get("field").String() == field {
+			out = append(out, e.Get("message").String())
+		}
+	}
+	return out
+}
+
+func TestRegisterEnforcesPasswordPolicy(t *testing.T) {
+	useStrictPasswordPolicy(t, "violet-harbor-1987")
+	setupAuthDB(t)
+	setupAuthRouter()
+
+	register := func(email, password string) *httptest.ResponseRecorder {
+		return postJSON(`{"email":"`+email+`","password":"`+password+`"}`, "/auth/register", "")
+	}
+
+	w := register("not-an-email", "")
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Equal(t, "application/problem+json", w.Header().Get("Content-Type"))
+	assert.Equal(t, []string{"must be a valid email address"}, fieldMessages(w.Body.String(), "email"))
+	assert.Equal(t, []string{"is required"}, fieldMessages(w.Body.String(), "password"))
+
+	w = register("writer@example.com", "short")
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, fieldMessages(w.Body.String(), "password"), "must be at least 10 characters")
+
+	w = register("writer@example.com", "P@ssw0rd")
+	assert.Contains(t, fieldMessages(w.Body.String(), "password"), "must not be a common word")
+
+	w = register("marguerite@example.com", "Marguerite-Was-Here-77")
+	assert.Contains(t, fieldMessages(w.Body.String(), "password"), "must not contain your email address")
+
+	w = register("writer@example.com", "violet-harbor-1987")
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Equal(t, []string{"has appeared in a data breach; choose another one"}, fieldMessages(w.Body.String(), "password"))
+
+	w = register("writer@example.com", "correct horse battery staple")
+	assert.Equal(t, http.StatusCreated, w.Code)
+}
+
+func TestPasswordResetAndChange(t *testing.T) {
+	useStrictPasswordPolicy(t, "violet-harbor-1987")
+	setupAuthDB(t)
+	setupAuthRouter()
+
+	registerUser(t, "forgot@example.com", "correct horse battery staple")
+	oldToken := loginUserAndGetToken(t, "forgot@example.com", "correct horse battery staple")
+
+	// Unknown addresses look the same as known ones
+	assert.Equal(t, http.StatusAccepted, postJSON(`{"email":"nobody@example.com"}`, "/auth/password/forgot", "").Code)
+	assert.Equal(t, http.StatusAccepted, postJSON(`{"email":"forgot@example.com"}`, "/auth/password/forgot", "").Code)
+	token := sentMail.lastTokenTo(t, "forgot@example.com")
+
+	// A rejected password does not use up the link
+	w := postJSON(`{"token":"`+token+`","password":"violet-harbor-1987"}`, "/auth/password/reset", "")
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.NotEmpty(t, fieldMessages(w.Body.String(), "password"))
+
+	w = postJSON(`{"token":"`+token+`","password":"quiet lantern over marble hills"}`, "/auth/password/reset", "")
+	assert.Equal(t, http.StatusNoContent, w.Code)
+	w = postJSON(`{"token":"`+token+`","password":"another lantern over marble hills"}`, "/auth/password/reset", "")
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.NotEmpty(t, fieldMessages(w.Body.String(), "token"))
+
+	// Resetting signs out existing sessions and replaces the old password
+	assert.Equal(t, http.StatusUnauthorized, getWithToken("/api/todos", oldToken).Code)
+	w = postJSON(`{"email":"forgot@example.com","password":"correct horse battery staple"}`, "/auth/login", "")
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	token = loginUserAndGetToken(t, "forgot@example.com", "quiet lantern over marble hills")
+	other := loginUserAndGetToken(t, "forgot@example.com", "quiet lantern over marble hills")
+
+	// Changing requires the current password and an acceptable new one
+	w = postJSON(`{"current_password":"wrong","new_password":"amber orchard under winter sky"}`, "/api/me/password", token)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	assert.Equal(t, []string{"is incorrect"}, fieldMessages(w.Body.String(), "current_password"))
+	w = postJSON(`{"current_password":"quiet lantern over marble hills","new_password":"password"}`, "/api/me/password", token)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.NotEmpty(t, fieldMessages(w.Body.String(), "new_password"))
+
+	w = postJSON(`{"current_password":"quiet lantern over marble hills","new_password":"amber orchard under winter sky"}`, "/api/me/password", token)
+	assert.Equal(t, http.StatusNoContent, w.Code)
+	assert.Equal(t, http.StatusOK, getWithToken("/api/todos", token).Code)
+	assert.Equal(t, http.StatusUnauthorized, getWithToken("/api/todos", other).Code, "other sessions are signed out")
+	loginUserAndGetToken(t, "forgot@example.com", "amber orchard under winter sky")
+}
+
+// failingSignOut makes RevokeAll fail while fail is set.
+type failingSignOut struct {
+	repository.SessionRepository
+	fail bool
+}
+
+func (r *failingSignOut) RevokeAll(ctx context.Context, userID uint, at time.Time) error {
+	if r.fail {
+		return errors.New("sign out failed")
+	}
+	return r.SessionRepository.RevokeAll(ctx, userID, at)
+}
+
+func TestPasswordResetIsAllOrNothing(t *testing.T) {
+	setupAuthDB(t)
+	sessions := &failingSignOut{SessionRepository: testRepos.Sessions, fail: true}
+	testRepos.Sessions = sessions
+	setupAuthRouter()
+
+	registerUser(t, "forgot@example.com", "pass1234")
+	assert.Equal(t, http.StatusAccepted, postJSON(`{"email":"forgot@example.com"}`, "/auth/password/forgot", "").Code)
+	token := sentMail.lastTokenTo(t, "forgot@example.com")
+
+	// Signing out fails, so the password and the link stay as they were ...
+	w := postJSON(`{"token":"`+token+`","password":"newpass123"}`, "/auth/password/reset", "")
+	assert.NotEqual(t, http.StatusNoContent, w.Code)
+	loginUserAndGetToken(t, "forgot@example.com", "pass1234")
+
+	// ... and the link works once signing out does
+	sessions.fail = false
+	w = postJSON(`{"token":"`+token+`","password":"newpass123"}`, "/auth/password/reset", "")
+	assert.Equal(t, http.StatusNoContent, w.Code)
+	loginUserAndGetToken(t, "forgot@example.com", "newpass123")
+}
@@ -0,0 +1,310 @@
+package tests
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+
+	"github.com/ahmadjafari86/go-todo-list/internal/models"
+	"github.com/ahmadjafari86/go-todo-list/internal/repository"
+)
+
+// repositoryImplementations lists every Repositories implementation. Each one
+// must pass the conformance tests in this file.
+var repositoryImplementations = map[string]func(t *testing.T) *repository.Repositories{
+	"gorm": func(t *testing.T) *repository.Repositories {
+		requireDatabase(t)
+		setupAuthDB(t)
+		return repository.NewGormRepositories(dbAuth)
+	},
+	"memory": func(t *testing.T) *repository.Repositories {
+		return repository.NewMemoryRepositories()
+	},
+}
+
+func forEachRepositoryImplementation(t *testing.T, test func(t *testing.T, repos *repository.Repositories)) {
+	for name, newRepos := range repositoryImplementations {
+		t.Run(name, func(t *testing.T) {
+			test(t, newRepos(t))
+		})
+	}
+}
+
+func createTestUser(t *testing.T, repos *repository.Repositories, email string) *models.User {
+	u := &models.User{Email: email, PasswordHash: "x"}
+	require.NoError(t, repos.Users.Create(context.Background(), u))
+	return u
+}
+
+func createTestTodo(t *testing.T, repos *repository.Repositories, owner *models.User, workspaceID, listID uint, title string) *models.Todo {
+	todo := &models.Todo{Title: title, OwnerID: owner.ID, WorkspaceID: workspaceID, ListID: listID}
+	require.NoError(t, repos.Todos.Create(context.Background(), todo))
+	return todo
+}
+
+func todoTitles(todos []models.Todo) []string {
+	titles := []string{}
+	for _, t := range todos {
+		titles = append(titles, t.Title)
+	}
+	return titles
+}
+
+func TestUserRepositoryConformance(t *testing.T) {
+	forEachRepositoryImplementation(t, func(t *testing.T, repos *repository.Repositories) {
+		ctx := context.Background()
+		users := repos.Users
+		alice := createTestUser(t, repos, "alice@example.com")
+		assert.NotZero(t, alice.ID)
+		assert.Equal(t, models.RoleUser, alice.Role)
+		assert.False(t, alice.CreatedAt.IsZero())
+
+		// Emails are unique, on create and on update
+		assert.Error(t, users.Create(ctx, &models.User{Email: "alice@example.com", PasswordHash: "x"}))
+		bob := createTestUser(t, repos, "Bob@Example.com")
+		bob.Email = "alice@example.com"
+		assert.Error(t, users.Update(ctx, bob))
+		bob.Email = "Bob@Example.com"
+
+		got, err := users.GetByEmail(ctx, "alice@example.com")
+		require.NoError(t, err)
+		require.NotNil(t, got)
+		assert.Equal(t, alice.ID, got.ID)
+		got, err = users.GetByEmail(ctx, "nobody@example.com")
+		assert.NoError(t, err)
+		assert.Nil(t, got)
+		got, err = users.GetByID(ctx, alice.ID+bob.ID+100)
+		assert.NoError(t, err)
+		assert.Nil(t, got)
+
+		// Update saves every field; UpdatePasswordHash only the hash
+		bob.TOTPEnabled = true
+		require.NoError(t, users.Update(ctx, bob))
+		require.NoError(t, users.UpdatePasswordHash(ctx, bob.ID, "new-hash"))
+		got, _ = users.GetByID(ctx, bob.ID)
+		assert.True(t, got.TOTPEnabled)
+		assert.Equal(t, "new-hash", got.PasswordHash)
+
+		require.NoError(t, users.SetRoleByEmail(ctx, []string{"alice@example.com"}, models.RoleAdmin))
+		got, _ = users.GetByID(ctx, alice.ID)
+		assert.Equal(t, models.RoleAdmin, got.Role)
+		require.NoError(t, users.SetRoleByEmail(ctx, nil, models.RoleAdmin))
+
+		// Search is case-insensitive, paged and counts the todos each user owns
+		ws, err := repos.Workspaces.EnsurePersonal(ctx, bob.ID)
+		require.NoError(t, err)
+		createTestTodo(t, repos, bob, ws.ID, 0, "one")
+		createTestTodo(t, repos, bob, ws.ID, 0, "two")
+		createTestUser(t, repos, "carol@example.org")
+
+		found, total, err := users.Search(ctx, "EXAMPLE.COM", 0, 10)
+		require.NoError(t, err)
+		assert.Equal(t, int64(2), total)
+		require.Len(t, found, 2)
+		assert.Equal(t, alice.ID, found[0].ID)
+		assert.Equal(t, int64(0), found[0].TodoCount)
+		assert.Equal(t, int64(2), found[1].TodoCount)
+
+		found, total, err = users.Search(ctx, "", 1, 1)
+		require.NoError(t, err)
+		assert.Equal(t, int64(3), total)
+		require.Len(t, found, 1)
+		assert.Equal(t, bob.ID, found[0].ID)
+
+		// The query is matched literally, wildcards included
+		dan := createTestUser(t, repos, "dan_100%@example.net")
+		createTestUser(t, repos, "danx100@example.net")
+		for _, query := range []string{"dan_", "100%", `_100%@`} {
+			found, total, err = users.Search(ctx, query, 0, 10)
+			require.NoError(t, err)
+			assert.Equal(t, int64(1), total, query)
+			require.Len(t, found, 1, query)
+			assert.Equal(t, dan.ID, found[0].ID, query)
+		}
+		found, _, err = users.Search(ctx, `\`, 0, 10)
+		require.NoError(t, err)
+		assert.Empty(t, found)
+
+		sum, err := users.GetSummary(ctx, bob.ID)
+		require.NoError(t, err)
+		require.NotNil(t, sum)
+		assert.Equal(t, "Bob@Example.com", sum.Email)
+		assert.Equal(t, int64(2), sum.TodoCount)
+		sum, err = users.GetSummary(ctx, bob.ID+100)
+		assert.NoError(t, err)
+		assert.Nil(t, sum)
+	})
+}
+
+func TestUserRepositoryRejectsConcurrentDuplicateEmails(t *testing.T) {
+	forEachRepositoryImplementation(t, func(t *testing.T, repos *repository.Repositories) {
+		ctx := context.Background()
+		var wg sync.WaitGroup
+		errs := make([]error, 8)
+		for i := range errs {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				errs[i] = repos.Users.Create(ctx, &models.User{Email: "race@example.com", PasswordHash: "x"})
+			}(i)
+		}
+		wg.Wait()
+
+		created := 0
+		for _, err := range errs {
+			if err == nil {
+				created++
+			}
+		}
+		assert.Equal(t, 1, created)
+	})
+}
+
+func TestTodoRepositoryConformance(t *testing.T) {
+	forEachRepositoryImplementation(t, func(t *testing.T, repos *repository.Repositories) {
+		ctx := context.Background()
+		todos := repos.Todos
+		alice := createTestUser(t, repos, "alice@example.com")
+		bob := createTestUser(t, repos, "bob@example.com")
+		carol := createTestUser(t, repos, "carol@example.com")
+		personal, err := repos.Workspaces.EnsurePersonal(ctx, alice.ID)
+		require.NoError(t, err)
+
+		first := createTestTodo(t, repos, alice, personal.ID, 0, "first")
+		assert.NotZero(t, first.ID)
+		assert.False(t, first.CreatedAt.IsZero())
+		createTestTodo(t, repos, alice, personal.ID, 0, "second")
+
+		// Todos need an existing owner
+		assert.Error(t, todos.Create(ctx, &models.Todo{Title: "orphan", OwnerID: carol.ID + 100, WorkspaceID: personal.ID}))
+
+		// Owners see their todos in id order; everyone else sees nothing
+		all, err := todos.GetAll(ctx, alice.ID, repository.TodoFilter{})
+		require.NoError(t, err)
+		assert.Equal(t, []string{"first", "second"}, todoTitles(all))
+		all, err = todos.GetAll(ctx, bob.ID, repository.TodoFilter{})
+		require.NoError(t, err)
+		assert.Empty(t, all)
+
+		_, err = todos.GetByID(ctx, first.ID, bob.ID)
+		assert.ErrorIs(t, err, gorm.ErrRecordNotFound)
+		assert.ErrorIs(t, todos.Update(ctx, &models.Todo{ID: first.ID, Title: "stolen"}, bob.ID), gorm.ErrRecordNotFound)
+		assert.ErrorIs(t, todos.Delete(ctx, first.ID, bob.ID), gorm.ErrRecordNotFound)
+		got, err := todos.GetByID(ctx, first.ID, alice.ID)
+		require.NoError(t, err)
+		assert.Equal(t, "first", got.Title)
+
+		// Update changes the title and completion only
+		require.NoError(t, todos.Update(ctx, &models.Todo{ID: first.ID, Title: "renamed", Completed: true, OwnerID: bob.ID}, alice.ID))
+		got, _ = todos.GetByID(ctx, first.ID, alice.ID)
+		assert.Equal(t, "renamed", got.Title)
+		assert.True(t, got.Completed)
+		assert.Equal(t, alice.ID, got.OwnerID)
+		assert.ErrorIs(t, todos.Update(ctx, &models.Todo{ID: first.ID + 100, Title: "missing"}, alice.ID), gorm.ErrRecordNotFound)
+
+		// Workspace viewers read, members also write
+		team := &models.Workspace{Name: "Team", OwnerID: alice.ID}
+		require.NoError(t, repos.Workspaces.Create(ctx, team))
+		require.NoError(t, repos.Workspaces.AddMember(ctx, &models.Membership{WorkspaceID: team.ID, UserID: bob.ID, Role: models.WorkspaceRoleViewer}))
+		plan := createTestTodo(t, repos, alice, team.ID, 0, "plan")
+
+		all, _ = todos.GetAll(ctx, bob.ID, repository.TodoFilter{})
+		assert.Equal(t, []string{"plan"}, todoTitles(all))
+		all, _ = todos.GetAll(ctx, alice.ID, repository.TodoFilter{WorkspaceID: team.ID})
+		assert.Equal(t, []string{"plan"}, todoTitles(all))
+		assert.ErrorIs(t, todos.Update(ctx, &models.Todo{ID: plan.ID, Title: "viewer edit"}, bob.ID), gorm.ErrRecordNotFound)
+		require.NoError(t, repos.Workspaces.UpdateMemberRole(ctx, team.ID, bob.ID, models.WorkspaceRoleMember))
+		assert.NoError(t, todos.Update(ctx, &models.Todo{ID: plan.ID, Title: "member edit"}, bob.ID))
+
+		// List shares grant access to that list only
+		list := &models.TodoList{WorkspaceID: team.ID, OwnerID: alice.ID, Name: "Groceries"}
+		require.NoError(t, repos.Lists.Create(ctx, list))
+		milk := createTestTodo(t, repos, alice, team.ID, list.ID, "milk")
+		require.NoError(t, repos.Lists.AddShare(ctx, &models.ListShare{ListID: list.ID, UserID: carol.ID, Permission: models.SharePermissionView}))
+
+		all, _ = todos.GetAll(ctx, carol.ID, repository.TodoFilter{})
+		assert.Equal(t, []string{"milk"}, todoTitles(all))
+		all, _ = todos.GetAll(ctx, alice.ID, repository.TodoFilter{ListID: list.ID})
+		assert.Equal(t, []string{"milk"}, todoTitles(all))
+		assert.ErrorIs(t, todos.Delete(ctx, milk.ID, carol.ID), gorm.ErrRecordNotFound)
+		require.NoError(t, repos.Lists.UpdateShare(ctx, list.ID, carol.ID, models.SharePermissionEdit))
+		assert.NoError(t, todos.Delete(ctx, milk.ID, carol.ID))
+		_, err = todos.GetByID(ctx, milk.ID, alice.ID)
+		assert.ErrorIs(t, err, gorm.ErrRecordNotFound)
+
+		// Losing membership takes access away again
+		require.NoError(t, repos.Workspaces.RemoveMember(ctx, team.ID, bob.ID))
+		_, err = todos.GetByID(ctx, plan.ID, bob.ID)
+		assert.ErrorIs(t, err, gorm.ErrRecordNotFound)
+	})
+}
+
+func TestWorkspaceAndListRepositoryConformance(t *testing.T) {
+	forEachRepositoryImplementation(t, func(t *testing.T, repos *repository.Repositories) {
+		ctx := context.Background()
+		workspaces, lists := repos.Workspaces, repos.Lists
+		alice := createTestUser(t, repos, "alice@example.com")
+		bob := createTestUser(t, repos, "bob@example.com")
+
+		team := &models.Workspace{Name: "Team", OwnerID: alice.ID}
+		require.NoError(t, workspaces.Create(ctx, team))
+		personal, err := workspaces.EnsurePersonal(ctx, alice.ID)
+		require.NoError(t, err)
+		again, err := workspaces.EnsurePersonal(ctx, alice.ID)
+		require.NoError(t, err)
+		assert.Equal(t, personal.ID, again.ID)
+		assert.Error(t, workspaces.Create(ctx, &models.Workspace{Name: "Second", Personal: true, OwnerID: alice.ID}))
+
+		// The personal workspace comes first; the creator owns the rest
+		mine, err := workspaces.ListForUser(ctx, alice.ID)
+		require.NoError(t, err)
+		require.Len(t, mine, 2)
+		assert.Equal(t, personal.ID, mine[0].ID)
+		assert.Equal(t, team.ID, mine[1].ID)
+		assert.Equal(t, models.WorkspaceRoleOwner, mine[1].Role)
+
+		m, err := workspaces.GetMembership(ctx, team.ID, bob.ID)
+		assert.NoError(t, err)
+		assert.Nil(t, m)
+		require.NoError(t, workspaces.AddMember(ctx, &models.Membership{WorkspaceID: team.ID, UserID: bob.ID, Role: models.WorkspaceRoleMember}))
+		assert.Error(t, workspaces.AddMember(ctx, &models.Membership{WorkspaceID: team.ID, UserID: bob.ID, Role: models.WorkspaceRoleAdmin}))
+		members, err := workspaces.ListMembers(ctx, team.ID)
+		require.NoError(t, err)
+		require.Len(t, members, 2)
+		assert.Equal(t, alice.ID, members[0].UserID)
+		assert.ErrorIs(t, workspaces.UpdateMemberRole(ctx, team.ID, bob.ID+100, models.WorkspaceRoleAdmin), gorm.ErrRecordNotFound)
+		assert.ErrorIs(t, workspaces.RemoveMember(ctx, personal.ID, bob.ID), gorm.ErrRecordNotFound)
+
+		list := &models.TodoList{WorkspaceID: team.ID, OwnerID: alice.ID, Name: "Groceries"}
+		require.NoError(t, lists.Create(ctx, list))
+		visible, err := lists.ListForUser(ctx, bob.ID)
+		require.NoError(t, err)
+		assert.Len(t, visible, 1)
+		require.NoError(t, lists.AddShare(ctx, &models.ListShare{ListID: list.ID, UserID: bob.ID, Permission: models.SharePermissionView}))
+		assert.Error(t, lists.AddShare(ctx, &models.ListShare{ListID: list.ID, UserID: bob.ID, Permission: models.SharePermissionEdit}))
+		shared, err := lists.ListSharedWith(ctx, bob.ID)
+		require.NoError(t, err)
+		require.Len(t, shared, 1)
+		assert.Equal(t, models.SharePermissionView, shared[0].Permission)
+		assert.ErrorIs(t, lists.RemoveShare(ctx, list.ID, alice.ID), gorm.ErrRecordNotFound)
+
+		// Deleting a workspace takes its lists, shares, members and todos along
+		createTestTodo(t, repos, alice, team.ID, list.ID, "milk")
+		require.NoError(t, workspaces.Delete(ctx, team.ID))
+		gone, err := workspaces.GetByID(ctx, team.ID)
+		assert.NoError(t, err)
+		assert.Nil(t, gone)
+		l, _ := lists.GetByID(ctx, list.ID)
+		assert.Nil(t, l)
+		shared, _ = lists.ListSharedWith(ctx, bob.ID)
+		assert.Empty(t, shared)
+		all, _ := repos.Todos.GetAll(ctx, alice.ID, repository.TodoFilter{})
+		assert.Empty(t, all)
+		mine, _ = workspaces.ListForUser(ctx, bob.ID)
+		assert.Empty(t, mine)
+	})
+}
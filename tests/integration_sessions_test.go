@@ -0,0 +1,74 @@
+package tests
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tidwall/gjson"
+)
+
+func loginFrom(t *testing.T, email, password, userAgent string) string {
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/auth/login", strings.NewReader(`{"email":"`+email+`","password":"`+password+`"}`))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", userAgent)
+	routerAuth.ServeHTTP(w, req)
+	require.Equal(t, http.StatusOK, w.Code)
+	return gjson.Get(w.Body.String(), "token").String()
+}
+
+func TestSessionsCanBeListedAndRevoked(t *testing.T) {
+	setupAuthDB(t)
+	setupAuthRouter()
+
+	registerUser(t, "roamer@example.com", "pass1234")
+	registerUser(t, "other@example.com", "pass1234")
+	desktop := loginFrom(t, "roamer@example.com", "pass1234", "Desktop Browser")
+	laptop := loginFrom(t, "roamer@example.com", "pass1234", "Stolen Laptop")
+	other := loginUserAndGetToken(t, "other@example.com", "pass1234")
+
+	w := getWithToken("/api/me/sessions", desktop)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, int64(2), gjson.Get(w.Body.String(), "#").Int())
+	assert.Equal(t, "Desktop Browser", gjson.Get(w.Body.String(), "#(current==true).user_agent").String())
+	laptopID := gjson.Get(w.Body.String(), `#(user_agent=="Stolen Laptop").id`).Int()
+	assert.NotZero(t, laptopID)
+	assert.NotEmpty(t, gjson.Get(w.Body.String(), "0.last_seen_at").String())
+
+	// Sessions of other users cannot be revoked
+	assert.Equal(t, http.StatusNotFound, sendJSON("DELETE", "", fmt.Sprintf("/api/me/sessions/%d", laptopID), other).Code)
+	assert.Equal(t, http.StatusOK, getWithToken("/api/todos", laptop).Code)
+
+	assert.Equal(t, http.StatusNoContent, sendJSON("DELETE", "", fmt.Sprintf("/api/me/sessions/%d", laptopID), desktop).Code)
+	assert.Equal(t, http.StatusUnauthorized, getWithToken("/api/todos", laptop).Code)
+	assert.Equal(t, http.StatusOK, getWithToken("/api/todos", desktop).Code)
+
+	w = getWithToken("/api/me/sessions", desktop)
+	assert.Equal(t, int64(1), gjson.Get(w.Body.String(), "#").Int())
+}
+
+func TestTokensWithoutASessionAreRejected(t *testing.T) {
+	setupAuthDB(t)
+	setupAuthRouter()
+	registerUser(t, "sessionless@example.com", "pass1234")
+	u, _ := testRepos.Users.GetByEmail(context.Background(), "sessionless@example.com")
+
+	// validly signed, but no sign-out could ever reach it
+	tok := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"iss": "todo-api", "aud": "todo-api", "sub": fmt.Sprint(u.ID), "typ": "access",
+		"exp": time.Now().Add(time.Minute).Unix(),
+	})
+	tok.Header["kid"] = "hs256"
+	signed, err := tok.SignedString([]byte("testsecret"))
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusUnauthorized, getWithToken("/api/todos", signed).Code)
+}
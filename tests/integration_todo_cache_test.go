@@ -0,0 +1,229 @@
+package tests
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ahmadjafari86/go-todo-list/internal/models"
+	"github.com/ahmadjafari86/go-todo-list/internal/repository"
+)
+
+func newTodoCache(repos *repository.Repositories, cfg repository.TodoCacheConfig) *repository.CachingTodoRepository {
+	return repository.NewCachingTodoRepository(repos.Todos, repos.Workspaces, repos.Lists, cfg)
+}
+
+func TestTodoCacheInvalidatesEveryoneWhoSeesAChange(t *testing.T) {
+	forEachRepositoryImplementation(t, func(t *testing.T, repos *repository.Repositories) {
+		ctx := context.Background()
+		owner := createTestUser(t, repos, "owner@example.com")
+		member := createTestUser(t, repos, "member@example.com")
+		ws, err := repos.Workspaces.EnsurePersonal(ctx, owner.ID)
+		require.NoError(t, err)
+		require.NoError(t, repos.Workspaces.AddMember(ctx, &models.Membership{WorkspaceID: ws.ID, UserID: member.ID, Role: models.WorkspaceRoleViewer}))
+		cache := newTodoCache(repos, repository.TodoCacheConfig{MaxUsers: 10, TTL: time.Minute})
+
+		todos, err := cache.GetAll(ctx, member.ID, repository.TodoFilter{})
+		require.NoError(t, err)
+		assert.Empty(t, todos)
+		_, err = cache.GetAll(ctx, member.ID, repository.TodoFilter{})
+		require.NoError(t, err)
+		assert.Equal(t, uint64(1), cache.Stats().Hits)
+		assert.Equal(t, uint64(1), cache.Stats().Misses)
+
+		// Writes that bypass the cache are not seen until the entry expires ...
+		createTestTodo(t, repos, owner, ws.ID, 0, "behind its back")
+		todos, err = cache.GetAll(ctx, member.ID, repository.TodoFilter{})
+		require.NoError(t, err)
+		assert.Empty(t, todos)
+
+		// ... while writes through it reach every workspace member
+		todo := &models.Todo{Title: "through the cache", OwnerID: owner.ID, WorkspaceID: ws.ID}
+		require.NoError(t, cache.Create(ctx, todo))
+		todos, err = cache.GetAll(ctx, member.ID, repository.TodoFilter{})
+		require.NoError(t, err)
+		assert.ElementsMatch(t, []string{"behind its back", "through the cache"}, todoTitles(todos))
+
+		todo.Title = "renamed"
+		require.NoError(t, cache.Update(ctx, todo, owner.ID))
+		todos, err = cache.GetAll(ctx, member.ID, repository.TodoFilter{})
+		require.NoError(t, err)
+		assert.ElementsMatch(t, []string{"behind its back", "renamed"}, todoTitles(todos))
+
+		require.NoError(t, cache.Delete(ctx, todo.ID, owner.ID))
+		todos, err = cache.GetAll(ctx, member.ID, repository.TodoFilter{})
+		require.NoError(t, err)
+		assert.Equal(t, []string{"behind its back"}, todoTitles(todos))
+
+		// Cached lists are copies
+		todos[0].Title = "scribbled"
+		todos, err = cache.GetAll(ctx, member.ID, repository.TodoFilter{})
+		require.NoError(t, err)
+		assert.Equal(t, []string{"behind its back"}, todoTitles(todos))
+
+		// Reads in a transaction see its own writes and are not cached; a
+		// rolled-back write leaves the cache correct
+		errRollback := errors.New("rollback")
+		err = repos.Tx.WithinTx(ctx, repository.TxOptions{}, func(ctx context.Context) error {
+			require.NoError(t, cache.Create(ctx, &models.Todo{Title: "uncommitted", OwnerID: owner.ID, WorkspaceID: ws.ID}))
+			todos, err := cache.GetAll(ctx, member.ID, repository.TodoFilter{})
+			require.NoError(t, err)
+			assert.Len(t, todos, 2)
+			return errRollback
+		})
+		require.ErrorIs(t, err, errRollback)
+		todos, err = cache.GetAll(ctx, member.ID, repository.TodoFilter{})
+		require.NoError(t, err)
+		assert.Equal(t, []string{"behind its back"}, todoTitles(todos))
+	})
+}
+
+func TestTodoCacheExpiresAndEvictsEntries(t *testing.T) {
+	forEachRepositoryImplementation(t, func(t *testing.T, repos *repository.Repositories) {
+		ctx := context.Background()
+		alice := createTestUser(t, repos, "alice@example.com")
+		bob := createTestUser(t, repos, "bob@example.com")
+		ws, err := repos.Workspaces.EnsurePersonal(ctx, alice.ID)
+		require.NoError(t, err)
+		cache := newTodoCache(repos, repository.TodoCacheConfig{MaxUsers: 1, TTL: 50 * time.Millisecond})
+
+		_, err = cache.GetAll(ctx, alice.ID, repository.TodoFilter{})
+		require.NoError(t, err)
+		createTestTodo(t, repos, alice, ws.ID, 0, "late")
+		todos, err := cache.GetAll(ctx, alice.ID, repository.TodoFilter{})
+		require.NoError(t, err)
+		assert.Empty(t, todos)
+
+		time.Sleep(60 * time.Millisecond)
+		todos, err = cache.GetAll(ctx, alice.ID, repository.TodoFilter{})
+		require.NoError(t, err)
+		assert.Equal(t, []string{"late"}, todoTitles(todos))
+
+		// Filters are cached separately
+		_, err = cache.GetAll(ctx, alice.ID, repository.TodoFilter{WorkspaceID: ws.ID})
+		require.NoError(t, err)
+		assert.Equal(t, uint64(3), cache.Stats().Misses)
+
+		// Only one user fits
+		_, err = cache.GetAll(ctx, bob.ID, repository.TodoFilter{})
+		require.NoError(t, err)
+		stats := cache.Stats()
+		assert.Equal(t, 1, stats.Users)
+		assert.Equal(t, uint64(1), stats.Evictions)
+	})
+}
+
+func TestTodoCachesShareInvalidations(t *testing.T) {
+	buses := map[string]func(t *testing.T) repository.TodoCacheBus{
+		"memory": func(t *testing.T) repository.TodoCacheBus {
+			return repository.NewMemoryTodoCacheBus()
+		},
+		"gorm": func(t *testing.T) repository.TodoCacheBus {
+			requireDatabase(t)
+			return repository.NewGormTodoCacheBus(dbAuth, 10*time.Millisecond)
+		},
+	}
+	for name, newBus := range buses {
+		t.Run(name, func(t *testing.T) {
+			repos := repositoryImplementations[name](t)
+			bus := newBus(t)
+			ctx := context.Background()
+			owner := createTestUser(t, repos, "owner@example.com")
+			ws, err := repos.Workspaces.EnsurePersonal(ctx, owner.ID)
+			require.NoError(t, err)
+
+			// two processes, each with its own cache
+			cfg := repository.TodoCacheConfig{MaxUsers: 10, TTL: time.Minute, Bus: bus}
+			first, second := newTodoCache(repos, cfg), newTodoCache(repos, cfg)
+			runCtx, stop := context.WithCancel(ctx)
+			defer stop()
+			go first.Run(runCtx)
+			go second.Run(runCtx)
+			time.Sleep(20 * time.Millisecond) // let both subscribe
+
+			_, err = second.GetAll(ctx, owner.ID, repository.TodoFilter{})
+			require.NoError(t, err)
+			require.NoError(t, first.Create(ctx, &models.Todo{Title: "from the first", OwnerID: owner.ID, WorkspaceID: ws.ID}))
+
+			assert.Eventually(t, func() bool {
+				todos, err := second.GetAll(ctx, owner.ID, repository.TodoFilter{})
+				return err == nil && len(todos) == 1
+			}, 2*time.Second, 20*time.Millisecond)
+			assert.NotZero(t, second.Stats().Invalidations)
+		})
+	}
+}
+
+func TestTodoCacheBusKeepsPollingAfterErrors(t *testing.T) {
+	requireDatabase(t)
+	setupAuthDB(t)
+	bus := repository.NewGormTodoCacheBus(dbAuth, 10*time.Millisecond)
+	received := make(chan []uint, 10)
+	runCtx, stop := context.WithCancel(context.Background())
+	defer stop()
+	go bus.Subscribe(runCtx, func(userIDs []uint) { received <- userIDs })
+
+	// polls fail while the table is missing ...
+	require.NoError(t, dbAuth.Exec("ALTER TABLE todo_cache_invalidations RENAME TO todo_cache_invalidations_away").Error)
+	time.Sleep(50 * time.Millisecond)
+	require.NoError(t, dbAuth.Exec("ALTER TABLE todo_cache_invalidations_away RENAME TO todo_cache_invalidations").Error)
+
+	// ... and pick up again once it is back
+	require.NoError(t, bus.Publish(context.Background(), []uint{42}))
+	select {
+	case users := <-received:
+		assert.Equal(t, []uint{42}, users)
+	case <-time.After(2 * time.Second):
+		t.Fatal("no invalidation received after the database recovered")
+	}
+}
+
+func TestTodoCacheFollowsAccessChanges(t *testing.T) {
+	forEachRepositoryImplementation(t, func(t *testing.T, repos *repository.Repositories) {
+		ctx := context.Background()
+		owner := createTestUser(t, repos, "owner@example.com")
+		member := createTestUser(t, repos, "member@example.com")
+		guest := createTestUser(t, repos, "guest@example.com")
+		cache := newTodoCache(repos, repository.TodoCacheConfig{MaxUsers: 10, TTL: time.Minute})
+		workspaces, lists := cache.Workspaces(repos.Workspaces), cache.Lists(repos.Lists)
+		visible := func(userID uint) []string {
+			todos, err := cache.GetAll(ctx, userID, repository.TodoFilter{})
+			require.NoError(t, err)
+			return todoTitles(todos)
+		}
+
+		ws := &models.Workspace{Name: "Team", OwnerID: owner.ID}
+		require.NoError(t, workspaces.Create(ctx, ws))
+		list := &models.TodoList{Name: "Groceries", WorkspaceID: ws.ID}
+		require.NoError(t, lists.Create(ctx, list))
+		createTestTodo(t, repos, owner, ws.ID, list.ID, "milk")
+		assert.Empty(t, visible(member.ID))
+		assert.Empty(t, visible(guest.ID))
+
+		// Gaining access
+		require.NoError(t, workspaces.AddMember(ctx, &models.Membership{WorkspaceID: ws.ID, UserID: member.ID, Role: models.WorkspaceRoleViewer}))
+		require.NoError(t, lists.AddShare(ctx, &models.ListShare{ListID: list.ID, UserID: guest.ID, Permission: models.SharePermissionView}))
+		assert.Equal(t, []string{"milk"}, visible(member.ID))
+		assert.Equal(t, []string{"milk"}, visible(guest.ID))
+
+		// Losing it
+		require.NoError(t, workspaces.RemoveMember(ctx, ws.ID, member.ID))
+		require.NoError(t, lists.RemoveShare(ctx, list.ID, guest.ID))
+		assert.Empty(t, visible(member.ID))
+		assert.Empty(t, visible(guest.ID))
+
+		// Deleting the list, then the workspace
+		require.NoError(t, workspaces.AddMember(ctx, &models.Membership{WorkspaceID: ws.ID, UserID: member.ID, Role: models.WorkspaceRoleViewer}))
+		createTestTodo(t, repos, owner, ws.ID, 0, "bread")
+		assert.ElementsMatch(t, []string{"milk", "bread"}, visible(member.ID))
+		require.NoError(t, lists.Delete(ctx, list.ID))
+		assert.Equal(t, []string{"bread"}, visible(member.ID))
+		require.NoError(t, workspaces.Delete(ctx, ws.ID))
+		assert.Empty(t, visible(member.ID))
+		assert.Empty(t, visible(owner.ID))
+	})
+}
@@ -0,0 +1,107 @@
+package tests
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tidwall/gjson"
+
+	"github.com/ahmadjafari86/go-todo-list/internal/handlers"
+	"github.com/ahmadjafari86/go-todo-list/internal/models"
+	"github.com/ahmadjafari86/go-todo-list/internal/service"
+	"github.com/ahmadjafari86/go-todo-list/internal/validation"
+)
+
+func TestPersonalAccessTokenScopes(t *testing.T) {
+	setupAuthDB(t)
+	setupAuthRouter()
+
+	registerUser(t, "ci@example.com", "pass1234")
+	jwt := loginUserAndGetToken(t, "ci@example.com", "pass1234")
+
+	// Create a read-only token with the JWT session
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/api/tokens", strings.NewReader(`{"name":"ci","scopes":["todos:read"]}`))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+jwt)
+	routerAuth.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusCreated, w.Code)
+	pat := gjson.Get(w.Body.String(), "token").String()
+	assert.True(t, strings.HasPrefix(pat, "tdl_"))
+	assert.False(t, gjson.Get(w.Body.String(), "info.token_hash").Exists())
+
+	// Reading is allowed
+	w2 := httptest.NewRecorder()
+	req2, _ := http.NewRequest("GET", "/api/todos", nil)
+	req2.Header.Set("Authorization", "Bearer "+pat)
+	routerAuth.ServeHTTP(w2, req2)
+	assert.Equal(t, http.StatusOK, w2.Code)
+
+	// Writing is not
+	w3 := httptest.NewRecorder()
+	req3, _ := http.NewRequest("POST", "/api/todos", strings.NewReader(`{"title":"nope"}`))
+	req3.Header.Set("Content-Type", "application/json")
+	req3.Header.Set("Authorization", "Bearer "+pat)
+	routerAuth.ServeHTTP(w3, req3)
+	assert.Equal(t, http.StatusForbidden, w3.Code)
+
+	// A token cannot mint further tokens
+	w4 := httptest.NewRecorder()
+	req4, _ := http.NewRequest("POST", "/api/tokens", strings.NewReader(`{"name":"escalate","scopes":["todos:write"]}`))
+	req4.Header.Set("Content-Type", "application/json")
+	req4.Header.Set("Authorization", "Bearer "+pat)
+	routerAuth.ServeHTTP(w4, req4)
+	assert.Equal(t, http.StatusForbidden, w4.Code)
+
+	// Unknown tokens are rejected
+	w5 := httptest.NewRecorder()
+	req5, _ := http.NewRequest("GET", "/api/todos", nil)
+	req5.Header.Set("Authorization", "Bearer tdl_doesnotexist")
+	routerAuth.ServeHTTP(w5, req5)
+	assert.Equal(t, http.StatusUnauthorized, w5.Code)
+}
+
+func TestRevokingAPersonalAccessToken(t *testing.T) {
+	setupAuthDB(t)
+	setupAuthRouter()
+	registerUser(t, "revoker@example.com", "pass1234")
+	jwt := loginUserAndGetToken(t, "revoker@example.com", "pass1234")
+	w := postJSON(`{"name":"ci","scopes":["todos:read"]}`, "/api/tokens", jwt)
+	assert.Equal(t, http.StatusCreated, w.Code)
+	path := fmt.Sprintf("/api/tokens/%d", gjson.Get(w.Body.String(), "info.id").Int())
+
+	assert.Equal(t, http.StatusBadRequest, sendJSON("DELETE", "", "/api/tokens/abc", jwt).Code)
+	assert.Equal(t, http.StatusNotFound, sendJSON("DELETE", "", "/api/tokens/99999", jwt).Code)
+
+	assert.Equal(t, http.StatusNoContent, sendJSON("DELETE", "", path, jwt).Code)
+	assert.Equal(t, http.StatusNotFound, sendJSON("DELETE", "", path, jwt).Code)
+}
+
+func TestRevokeTokenReportsCancellationRatherThanNotFound(t *testing.T) {
+	setupAuthDB(t)
+	owner := createTestUser(t, testRepos, "owner@example.com")
+	svc := service.NewTokenService(testRepos.Tokens, testRepos.Users)
+	_, pat, err := svc.CreateToken(context.Background(), owner.ID, "ci", []string{models.ScopeTodosRead}, time.Hour)
+	require.NoError(t, err)
+	h := handlers.NewTokenHandler(svc)
+
+	// the handler is called directly, as the auth middleware would already
+	// stop a cancelled request
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request, _ = http.NewRequestWithContext(ctx, "DELETE", fmt.Sprintf("/api/tokens/%d", pat.ID), nil)
+	c.Params = gin.Params{{Key: "id", Value: fmt.Sprint(pat.ID)}}
+	c.Set("user_id", fmt.Sprint(owner.ID))
+	h.RevokeToken(c)
+	assert.Equal(t, validation.StatusClientClosedRequest, w.Code)
+}
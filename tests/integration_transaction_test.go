@@ -0,0 +1,108 @@
+package tests
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ahmadjafari86/go-todo-list/internal/models"
+	"github.com/ahmadjafari86/go-todo-list/internal/repository"
+	"github.com/ahmadjafari86/go-todo-list/internal/service"
+)
+
+func TestTxManagerConformance(t *testing.T) {
+	forEachRepositoryImplementation(t, func(t *testing.T, repos *repository.Repositories) {
+		ctx := context.Background()
+		owner := createTestUser(t, repos, "owner@example.com")
+		ws, err := repos.Workspaces.EnsurePersonal(ctx, owner.ID)
+		require.NoError(t, err)
+
+		// Writes through several repositories commit together
+		err = repos.Tx.WithinTx(ctx, repository.TxOptions{}, func(ctx context.Context) error {
+			if err := repos.Todos.Create(ctx, &models.Todo{Title: "committed", OwnerID: owner.ID, WorkspaceID: ws.ID}); err != nil {
+				return err
+			}
+			owner.Role = models.RoleAdmin
+			return repos.Users.Update(ctx, owner)
+		})
+		require.NoError(t, err)
+
+		// ... and roll back together, with the function's error returned as is
+		errAbort := errors.New("abort")
+		err = repos.Tx.WithinTx(ctx, repository.TxOptions{}, func(ctx context.Context) error {
+			require.NoError(t, repos.Todos.Create(ctx, &models.Todo{Title: "rolled back", OwnerID: owner.ID, WorkspaceID: ws.ID}))
+			owner.Role = models.RoleUser
+			require.NoError(t, repos.Users.Update(ctx, owner))
+
+			// reads inside the transaction see its own writes
+			todos, err := repos.Todos.GetAll(repository.WithLock(ctx, repository.LockForUpdate), owner.ID, repository.TodoFilter{})
+			require.NoError(t, err)
+			assert.Equal(t, []string{"committed", "rolled back"}, todoTitles(todos))
+			return errAbort
+		})
+		assert.ErrorIs(t, err, errAbort)
+
+		todos, err := repos.Todos.GetAll(ctx, owner.ID, repository.TodoFilter{})
+		require.NoError(t, err)
+		assert.Equal(t, []string{"committed"}, todoTitles(todos))
+		got, err := repos.Users.GetByID(ctx, owner.ID)
+		require.NoError(t, err)
+		assert.Equal(t, models.RoleAdmin, got.Role)
+
+		// A nested call joins the outer transaction, which decides the outcome
+		err = repos.Tx.WithinTx(ctx, repository.TxOptions{}, func(ctx context.Context) error {
+			require.NoError(t, repos.Tx.WithinTx(ctx, repository.TxOptions{}, func(ctx context.Context) error {
+				return repos.Todos.Create(ctx, &models.Todo{Title: "nested", OwnerID: owner.ID, WorkspaceID: ws.ID})
+			}))
+			return errAbort
+		})
+		assert.ErrorIs(t, err, errAbort)
+		todos, err = repos.Todos.GetAll(ctx, owner.ID, repository.TodoFilter{})
+		require.NoError(t, err)
+		assert.Equal(t, []string{"committed"}, todoTitles(todos))
+
+		// Errors other than serialization failures are not retried
+		attempts := 0
+		err = repos.Tx.WithinTx(ctx, repository.TxOptions{MaxRetries: 5}, func(ctx context.Context) error {
+			attempts++
+			return errAbort
+		})
+		assert.ErrorIs(t, err, errAbort)
+		assert.Equal(t, 1, attempts)
+	})
+}
+
+func TestConcurrentTogglesAreSerialized(t *testing.T) {
+	setupAuthDB(t)
+	ctx := context.Background()
+	owner := createTestUser(t, testRepos, "toggle@example.com")
+	svc := service.NewTodoService(testRepos.Todos, testRepos.Workspaces, testRepos.Lists, testRepos.Revisions, testRepos.Tx)
+	todo := &models.Todo{Title: "flip me"}
+	require.NoError(t, svc.CreateTodo(ctx, todo, owner.ID))
+
+	const toggles = 50
+	var wg sync.WaitGroup
+	var completed atomic.Int32
+	for i := 0; i < toggles; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			got, err := svc.ToggleComplete(ctx, todo.ID, owner.ID)
+			if assert.NoError(t, err) && got.Completed {
+				completed.Add(1)
+			}
+		}()
+	}
+	wg.Wait()
+
+	// every toggle saw the previous one's result: half of them completed the todo
+	assert.Equal(t, int32(toggles/2), completed.Load())
+	got, err := svc.GetTodo(ctx, todo.ID, owner.ID)
+	require.NoError(t, err)
+	assert.False(t, got.Completed)
+}
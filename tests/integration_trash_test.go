@@ -0,0 +1,130 @@
+package tests
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tidwall/gjson"
+
+	"github.com/ahmadjafari86/go-todo-list/internal/repository"
+	"github.com/ahmadjafari86/go-todo-list/internal/service"
+)
+
+func TestDeletedTodosGoToTheTrash(t *testing.T) {
+	setupAuthDB(t)
+	setupAuthRouter()
+	registerUser(t, "tidy@example.com", "pass1234")
+	registerUser(t, "peer@example.com", "pass1234")
+	token := loginUserAndGetToken(t, "tidy@example.com", "pass1234")
+	peerToken := loginUserAndGetToken(t, "peer@example.com", "pass1234")
+	peer, _ := testRepos.Users.GetByEmail(context.Background(), "peer@example.com")
+
+	w := postJSON(`{"title":"Keep"}`, "/api/todos", token)
+	require.Equal(t, http.StatusCreated, w.Code)
+	w = postJSON(`{"title":"Oops"}`, "/api/todos", token)
+	require.Equal(t, http.StatusCreated, w.Code)
+	oopsID := gjson.Get(w.Body.String(), "id").Int()
+	assert.False(t, gjson.Get(w.Body.String(), "deleted_at").Exists())
+
+	// Deleted todos disappear from the normal endpoints
+	assert.Equal(t, http.StatusNoContent, sendJSON("DELETE", "", fmt.Sprintf("/api/todos/%d", oopsID), token).Code)
+	assert.NotContains(t, getWithToken("/api/todos", token).Body.String(), "Oops")
+	assert.Equal(t, http.StatusNotFound, getWithToken(fmt.Sprintf("/api/todos/%d", oopsID), token).Code)
+	assert.Equal(t, http.StatusNotFound, sendJSON("PATCH", "", fmt.Sprintf("/api/todos/%d/complete", oopsID), token).Code)
+	assert.Equal(t, http.StatusNotFound, sendJSON("DELETE", "", fmt.Sprintf("/api/todos/%d", oopsID), token).Code)
+
+	// ... and show up in the trash, for nobody else
+	w = getWithToken("/api/trash", token)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, []interface{}{"Oops"}, gjson.Get(w.Body.String(), "#.title").Value())
+	assert.NotEmpty(t, gjson.Get(w.Body.String(), "0.deleted_at").String())
+	assert.Equal(t, "[]", getWithToken("/api/trash", peerToken).Body.String())
+	assert.Equal(t, http.StatusNotFound, sendJSON("POST", "", fmt.Sprintf("/api/trash/%d/restore", oopsID), peerToken).Code)
+
+	// Restoring puts the todo back
+	w = sendJSON("POST", "", fmt.Sprintf("/api/trash/%d/restore", oopsID), token)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "Oops", gjson.Get(w.Body.String(), "title").String())
+	assert.False(t, gjson.Get(w.Body.String(), "deleted_at").Exists())
+	assert.Contains(t, getWithToken("/api/todos", token).Body.String(), "Oops")
+	assert.Equal(t, "[]", getWithToken("/api/trash", token).Body.String())
+	assert.Equal(t, http.StatusNotFound, sendJSON("POST", "", fmt.Sprintf("/api/trash/%d/restore", oopsID), token).Code)
+
+	// Viewers of a workspace see its trash but cannot restore or empty it
+	w = postJSON(`{"name":"Team"}`, "/api/workspaces", token)
+	require.Equal(t, http.StatusCreated, w.Code)
+	wsID := gjson.Get(w.Body.String(), "id").Int()
+	w = postJSON(fmt.Sprintf(`{"title":"Team chore","workspace_id":%d}`, wsID), "/api/todos", token)
+	require.Equal(t, http.StatusCreated, w.Code)
+	choreID := gjson.Get(w.Body.String(), "id").Int()
+	w = postJSON(fmt.Sprintf(`{"user_id":%d,"role":"viewer"}`, peer.ID), fmt.Sprintf("/api/workspaces/%d/members", wsID), token)
+	require.Equal(t, http.StatusCreated, w.Code)
+	assert.Equal(t, http.StatusNoContent, sendJSON("DELETE", "", fmt.Sprintf("/api/todos/%d", choreID), token).Code)
+	assert.Contains(t, getWithToken("/api/trash", peerToken).Body.String(), "Team chore")
+	assert.Equal(t, http.StatusForbidden, sendJSON("POST", "", fmt.Sprintf("/api/trash/%d/restore", choreID), peerToken).Code)
+	w = sendJSON("DELETE", "", "/api/trash", peerToken)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, int64(0), gjson.Get(w.Body.String(), "deleted").Int())
+
+	// Emptying the trash deletes for good
+	assert.Equal(t, http.StatusNoContent, sendJSON("DELETE", "", fmt.Sprintf("/api/todos/%d", oopsID), token).Code)
+	w = sendJSON("DELETE", "", "/api/trash", token)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, int64(2), gjson.Get(w.Body.String(), "deleted").Int())
+	assert.Equal(t, "[]", getWithToken("/api/trash", token).Body.String())
+	assert.Equal(t, http.StatusNotFound, sendJSON("POST", "", fmt.Sprintf("/api/trash/%d/restore", oopsID), token).Code)
+	assert.Equal(t, []interface{}{"Keep"}, gjson.Get(getWithToken("/api/todos", token).Body.String(), "#.title").Value())
+}
+
+func TestTrashPurgerRemovesExpiredTodos(t *testing.T) {
+	forEachRepositoryImplementation(t, func(t *testing.T, repos *repository.Repositories) {
+		ctx := context.Background()
+		owner := createTestUser(t, repos, "owner@example.com")
+		ws, err := repos.Workspaces.EnsurePersonal(ctx, owner.ID)
+		require.NoError(t, err)
+		kept := createTestTodo(t, repos, owner, ws.ID, 0, "kept")
+		trashed := createTestTodo(t, repos, owner, ws.ID, 0, "trashed")
+		require.NoError(t, repos.Todos.Delete(ctx, trashed.ID, owner.ID))
+
+		// still within the retention period
+		n, err := service.NewTrashPurger(repos.Todos, service.TrashConfig{Retention: time.Hour}).Purge(ctx)
+		require.NoError(t, err)
+		assert.Zero(t, n)
+		todos, err := repos.Todos.ListTrash(ctx, owner.ID)
+		require.NoError(t, err)
+		assert.Equal(t, []string{"trashed"}, todoTitles(todos))
+
+		n, err = service.NewTrashPurger(repos.Todos, service.TrashConfig{Retention: -time.Second}).Purge(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, int64(1), n)
+		todos, err = repos.Todos.ListTrash(ctx, owner.ID)
+		require.NoError(t, err)
+		assert.Empty(t, todos)
+		_, err = repos.Todos.GetTrashed(ctx, trashed.ID, owner.ID)
+		assert.Error(t, err)
+
+		// live todos are never purged
+		got, err := repos.Todos.GetByID(ctx, kept.ID, owner.ID)
+		require.NoError(t, err)
+		assert.Nil(t, got.DeletedAt)
+	})
+}
+
+func TestClientsCannotCreateTodosInTheTrash(t *testing.T) {
+	setupAuthDB(t)
+	setupAuthRouter()
+	registerUser(t, "sneaky@example.com", "pass1234")
+	token := loginUserAndGetToken(t, "sneaky@example.com", "pass1234")
+
+	w := postJSON(`{"id":4242,"title":"Hidden","deleted_at":"2020-01-01T00:00:00Z"}`, "/api/todos", token)
+	require.Equal(t, http.StatusCreated, w.Code)
+	assert.NotEqual(t, int64(4242), gjson.Get(w.Body.String(), "id").Int())
+	assert.False(t, gjson.Get(w.Body.String(), "deleted_at").Exists())
+	assert.Contains(t, getWithToken("/api/todos", token).Body.String(), "Hidden")
+	assert.Equal(t, "[]", getWithToken("/api/trash", token).Body.String())
+}
@@ -0,0 +1,81 @@
+package tests
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tidwall/gjson"
+)
+
+func sendJSON(method, body, path, token string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest(method, path, strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	routerAuth.ServeHTTP(w, req)
+	return w
+}
+
+func TestWorkspaceMembersShareTodosByRole(t *testing.T) {
+	setupAuthDB(t)
+	setupAuthRouter()
+
+	registerUser(t, "lead@example.com", "pass1234")
+	registerUser(t, "peer@example.com", "pass1234")
+	leadToken := loginUserAndGetToken(t, "lead@example.com", "pass1234")
+	peerToken := loginUserAndGetToken(t, "peer@example.com", "pass1234")
+	peer, _ := testRepos.Users.GetByEmail(context.Background(), "peer@example.com")
+
+	// Todos without a workspace stay private in the personal workspace
+	w := postJSON(`{"title":"Private"}`, "/api/todos", leadToken)
+	assert.Equal(t, http.StatusCreated, w.Code)
+	assert.NotZero(t, gjson.Get(w.Body.String(), "workspace_id").Int())
+
+	w = postJSON(`{"name":"Team"}`, "/api/workspaces", leadToken)
+	assert.Equal(t, http.StatusCreated, w.Code)
+	wsID := gjson.Get(w.Body.String(), "id").Int()
+	w = postJSON(fmt.Sprintf(`{"title":"Shared","workspace_id":%d}`, wsID), "/api/todos", leadToken)
+	assert.Equal(t, http.StatusCreated, w.Code)
+	todoID := gjson.Get(w.Body.String(), "id").Int()
+
+	// Non-members cannot see or write into the workspace
+	assert.NotContains(t, getWithToken("/api/todos", peerToken).Body.String(), "Shared")
+	w = postJSON(fmt.Sprintf(`{"title":"Intruder","workspace_id":%d}`, wsID), "/api/todos", peerToken)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	// Viewers can read but not change todos
+	w = postJSON(fmt.Sprintf(`{"user_id":%d,"role":"viewer"}`, peer.ID), fmt.Sprintf("/api/workspaces/%d/members", wsID), leadToken)
+	assert.Equal(t, http.StatusCreated, w.Code)
+	body := getWithToken("/api/todos", peerToken).Body.String()
+	assert.Contains(t, body, "Shared")
+	assert.NotContains(t, body, "Private")
+	assert.Equal(t, http.StatusForbidden, sendJSON("PATCH", "", fmt.Sprintf("/api/todos/%d/complete", todoID), peerToken).Code)
+	assert.Equal(t, http.StatusForbidden, sendJSON("DELETE", "", fmt.Sprintf("/api/todos/%d", todoID), peerToken).Code)
+
+	// Viewers cannot manage members
+	w = sendJSON("PUT", `{"role":"admin"}`, fmt.Sprintf("/api/workspaces/%d/members/%d", wsID, peer.ID), peerToken)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+
+	// Promoted to member, they can change todos
+	w = sendJSON("PUT", `{"role":"member"}`, fmt.Sprintf("/api/workspaces/%d/members/%d", wsID, peer.ID), leadToken)
+	assert.Equal(t, http.StatusNoContent, w.Code)
+	w = sendJSON("PATCH", "", fmt.Sprintf("/api/todos/%d/complete", todoID), peerToken)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.True(t, gjson.Get(w.Body.String(), "completed").Bool())
+
+	w = getWithToken("/api/workspaces", peerToken)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, int64(2), gjson.Get(w.Body.String(), "#").Int())
+
+	// Leaving the workspace revokes access
+	w = sendJSON("DELETE", "", fmt.Sprintf("/api/workspaces/%d/members/%d", wsID, peer.ID), peerToken)
+	assert.Equal(t, http.StatusNoContent, w.Code)
+	assert.Equal(t, http.StatusNotFound, sendJSON("DELETE", "", fmt.Sprintf("/api/todos/%d", todoID), peerToken).Code)
+}